@@ -12,8 +12,10 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -100,13 +102,66 @@ type TelemetryRecord struct {
 
 // BufferStats represents buffer statistics
 type BufferStats struct {
-	Service      string `json:"service"`
-	TotalRecords int64  `json:"total_records"`
-	TotalSize    int64  `json:"total_size"`
-	OldestRecord int64  `json:"oldest_record"`
-	NewestRecord int64  `json:"newest_record"`
-	Forwarded    int64  `json:"forwarded"`
-	Pending      int64  `json:"pending"`
+	Service       string `json:"service"`
+	TotalRecords  int64  `json:"total_records"`
+	TotalSize     int64  `json:"total_size"`
+	OldestRecord  int64  `json:"oldest_record"`
+	NewestRecord  int64  `json:"newest_record"`
+	Forwarded     int64  `json:"forwarded"`
+	Pending       int64  `json:"pending"`
+	OldestPending int64  `json:"oldest_pending"` // timestamp of the oldest unforwarded record
+}
+
+// BufferCounters is a snapshot of the cumulative counters since process start
+type BufferCounters struct {
+	StartedAt        int64 `json:"started_at"`
+	IngestedRecords  int64 `json:"ingested_records"`
+	IngestedBytes    int64 `json:"ingested_bytes"`
+	ForwardedRecords int64 `json:"forwarded_records"`
+	ForwardedBytes   int64 `json:"forwarded_bytes"`
+	ForwardFailures  int64 `json:"forward_failures"`
+	DroppedRecords   int64 `json:"dropped_records"`
+	Errors           int64 `json:"errors"`
+	LastForwardAt    int64 `json:"last_forward_at"`
+}
+
+// bufferCounters holds the live counters behind BufferCounters
+type bufferCounters struct {
+	startedAt        time.Time
+	ingestedRecords  atomic.Int64
+	ingestedBytes    atomic.Int64
+	forwardedRecords atomic.Int64
+	forwardedBytes   atomic.Int64
+	forwardFailures  atomic.Int64
+	droppedRecords   atomic.Int64
+	errors           atomic.Int64
+	lastForwardAt    atomic.Int64
+}
+
+func (c *bufferCounters) snapshot() BufferCounters {
+	return BufferCounters{
+		StartedAt:        c.startedAt.Unix(),
+		IngestedRecords:  c.ingestedRecords.Load(),
+		IngestedBytes:    c.ingestedBytes.Load(),
+		ForwardedRecords: c.forwardedRecords.Load(),
+		ForwardedBytes:   c.forwardedBytes.Load(),
+		ForwardFailures:  c.forwardFailures.Load(),
+		DroppedRecords:   c.droppedRecords.Load(),
+		Errors:           c.errors.Load(),
+		LastForwardAt:    c.lastForwardAt.Load(),
+	}
+}
+
+func (c *bufferCounters) recordForwarded(record TelemetryRecord) {
+	c.forwardedRecords.Add(1)
+	c.forwardedBytes.Add(int64(len(record.JsonData)))
+	c.lastForwardAt.Store(time.Now().Unix())
+}
+
+// recordForwarded updates the lifetime counters and the forward meter for a delivered record
+func (bm *BufferManager) recordForwarded(record TelemetryRecord) {
+	bm.counters.recordForwarded(record)
+	bm.meters.Mark(meterForward, record.Service, record.SourceIP, 1)
 }
 
 // VPNStatus represents the current VPN connection state
@@ -127,14 +182,37 @@ type BufferManager struct {
 	vpnMutex    sync.RWMutex
 	forwardChan chan TelemetryRecord
 	stopChan    chan bool
+	syslogFTS   bool // syslog_fts virtual table is available
+	counters    bufferCounters
+	meters      *MeterRegistry
+
+	forwardLatency     *histogramVec // by service and result
+	sqliteWriteLatency *histogramVec // by operation
 }
 
-// NewBufferManager creates a new buffer manager instance
+// NewBufferManager creates a new buffer manager instance and starts its
+// background workers
 func NewBufferManager(dataPath string) (*BufferManager, error) {
+	bm, err := newBufferManager(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	bm.startWorkers()
+	return bm, nil
+}
+
+// newBufferManager creates a buffer manager with its database and config
+// loaded but no background workers running
+func newBufferManager(dataPath string) (*BufferManager, error) {
 	bm := &BufferManager{
 		dataPath:    dataPath,
 		forwardChan: make(chan TelemetryRecord, 1000),
 		stopChan:    make(chan bool, 1),
+		counters:    bufferCounters{startedAt: time.Now()},
+		meters:      NewMeterRegistry(),
+
+		forwardLatency:     newHistogramVec(forwardLatencyBuckets, "service", "result"),
+		sqliteWriteLatency: newHistogramVec(sqliteWriteBuckets, "operation"),
 		vpnStatus: VPNStatus{
 			Connected: false,
 			LastCheck: time.Now(),
@@ -199,11 +277,13 @@ func NewBufferManager(dataPath string) (*BufferManager, error) {
 		logger.WithError(err).Warn("Failed to load config, using defaults")
 	}
 
-	// Start background workers
+	return bm, nil
+}
+
+// startWorkers starts the VPN monitor and forwarding worker
+func (bm *BufferManager) startWorkers() {
 	go bm.startVPNMonitor()
 	go bm.startForwardingWorker()
-
-	return bm, nil
 }
 
 // compressData compresses data using the specified compression mode
@@ -326,15 +406,23 @@ func (bm *BufferManager) startForwardingWorker() {
 			if vpnConnected && bm.config.ForwardingEnabled {
 				if err := bm.forwardRecord(record); err != nil {
 					log.Printf("Failed to forward record: %v, buffering instead", err)
+					bm.counters.forwardFailures.Add(1)
+					bm.meters.Mark(meterError, record.Service, record.SourceIP, 1)
 					// Store in buffer if forwarding fails
 					if err := bm.StoreRecord(record); err != nil {
 						log.Printf("Failed to buffer record: %v", err)
+						bm.counters.errors.Add(1)
+						bm.meters.Mark(meterError, record.Service, record.SourceIP, 1)
 					}
+				} else {
+					bm.recordForwarded(record)
 				}
 			} else {
 				// VPN not available, store in buffer
 				if err := bm.StoreRecord(record); err != nil {
 					log.Printf("Failed to buffer record: %v", err)
+					bm.counters.errors.Add(1)
+					bm.meters.Mark(meterError, record.Service, record.SourceIP, 1)
 				}
 			}
 		case <-bm.stopChan:
@@ -344,11 +432,20 @@ func (bm *BufferManager) startForwardingWorker() {
 }
 
 // forwardRecord sends a single record to the remote endpoint
-func (bm *BufferManager) forwardRecord(record TelemetryRecord) error {
+func (bm *BufferManager) forwardRecord(record TelemetryRecord) (err error) {
 	if bm.config.ForwardingURL == "" {
 		return fmt.Errorf("forwarding URL not configured")
 	}
 
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "failure"
+		}
+		bm.forwardLatency.Observe(time.Since(start), record.Service, result)
+	}()
+
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -420,14 +517,19 @@ func (bm *BufferManager) forwardBufferedRecords() {
 
 		if err := bm.forwardRecord(record); err != nil {
 			log.Printf("Failed to forward buffered record %d: %v", record.ID, err)
+			bm.counters.forwardFailures.Add(1)
+			bm.meters.Mark(meterError, record.Service, record.SourceIP, 1)
 			break // Stop if forwarding fails
 		}
+		bm.recordForwarded(record)
 
 		// Mark as forwarded
 		updateQuery := "UPDATE telemetry_buffer SET forwarded = 1 WHERE id = ?"
+		start := time.Now()
 		if _, err := bm.db.Exec(updateQuery, record.ID); err != nil {
 			log.Printf("Failed to mark record as forwarded: %v", err)
 		}
+		bm.observeWrite("mark_forwarded", start)
 
 		forwarded++
 	}
@@ -453,13 +555,41 @@ func (bm *BufferManager) handleBufferOverflow() error {
 
 // dropOldestRecords removes the oldest records from buffer
 func (bm *BufferManager) dropOldestRecords(count int) error {
-	query := "DELETE FROM telemetry_buffer WHERE id IN (SELECT id FROM telemetry_buffer ORDER BY timestamp ASC LIMIT ?)"
+	oldest := "SELECT id FROM telemetry_buffer ORDER BY timestamp ASC LIMIT ?"
+
+	// Attribute drops to their service and source before deleting
+	type dropGroup struct {
+		service, sourceIP string
+		n                 int64
+	}
+	var dropped []dropGroup
+	rows, err := bm.db.Query("SELECT service, source_ip, COUNT(*) FROM telemetry_buffer WHERE id IN ("+oldest+") GROUP BY service, source_ip", count)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var d dropGroup
+		if err := rows.Scan(&d.service, &d.sourceIP, &d.n); err != nil {
+			rows.Close()
+			return err
+		}
+		dropped = append(dropped, d)
+	}
+	rows.Close()
+
+	query := "DELETE FROM telemetry_buffer WHERE id IN (" + oldest + ")"
+	start := time.Now()
 	result, err := bm.db.Exec(query, count)
+	bm.observeWrite("drop", start)
 	if err != nil {
 		return err
 	}
+	for _, d := range dropped {
+		bm.meters.Mark(meterDrop, d.service, d.sourceIP, d.n)
+	}
 
 	rowsAffected, _ := result.RowsAffected()
+	bm.counters.droppedRecords.Add(rowsAffected)
 	log.Printf("Dropped %d oldest records due to buffer overflow", rowsAffected)
 	return nil
 }
@@ -541,8 +671,17 @@ func (bm *BufferManager) createTables() error {
 	);
 	`
 
-	_, err := bm.db.Exec(schema)
-	return err
+	if _, err := bm.db.Exec(schema); err != nil {
+		return err
+	}
+
+	if err := bm.createSyslogTables(); err != nil {
+		return err
+	}
+	if err := bm.createSNMPTables(); err != nil {
+		return err
+	}
+	return bm.createWindowsTables()
 }
 
 // loadConfig loads configuration from file
@@ -621,10 +760,15 @@ func (bm *BufferManager) StoreRecord(record TelemetryRecord) error {
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	start := time.Now()
 	_, err = bm.db.Exec(query,
 		record.Service, record.Timestamp, record.DataType, record.DataSize,
 		record.FilePath, jsonData, record.SourceIP,
 		record.Forwarded, record.RetryCount, now, expiresAt)
+	bm.observeWrite("insert", start)
+	if err == nil {
+		bm.meters.Mark(meterStore, record.Service, record.SourceIP, 1)
+	}
 
 	return err
 }
@@ -640,7 +784,8 @@ func (bm *BufferManager) GetStats(service string) (*BufferStats, error) {
 			COALESCE(MIN(timestamp), 0) as oldest_record,
 			COALESCE(MAX(timestamp), 0) as newest_record,
 			COALESCE(SUM(CASE WHEN forwarded = 1 THEN 1 ELSE 0 END), 0) as forwarded,
-			COALESCE(SUM(CASE WHEN forwarded = 0 THEN 1 ELSE 0 END), 0) as pending
+			COALESCE(SUM(CASE WHEN forwarded = 0 THEN 1 ELSE 0 END), 0) as pending,
+			COALESCE(MIN(CASE WHEN forwarded = 0 THEN timestamp END), 0) as oldest_pending
 		FROM telemetry_buffer 
 		WHERE service = ?
 	`
@@ -652,6 +797,7 @@ func (bm *BufferManager) GetStats(service string) (*BufferStats, error) {
 		&stats.NewestRecord,
 		&stats.Forwarded,
 		&stats.Pending,
+		&stats.OldestPending,
 	)
 
 	return stats, err
@@ -661,7 +807,9 @@ func (bm *BufferManager) GetStats(service string) (*BufferStats, error) {
 func (bm *BufferManager) CleanupExpiredRecords() error {
 	now := time.Now().Unix()
 	query := "DELETE FROM telemetry_buffer WHERE expires_at < ?"
+	start := time.Now()
 	result, err := bm.db.Exec(query, now)
+	bm.observeWrite("cleanup", start)
 	if err != nil {
 		return err
 	}
@@ -671,13 +819,63 @@ func (bm *BufferManager) CleanupExpiredRecords() error {
 		log.Printf("Cleaned up %d expired records", rowsAffected)
 	}
 
+	syslogRemoved, err := bm.cleanupSyslogIndex()
+	if err != nil {
+		return err
+	}
+	if syslogRemoved > 0 {
+		log.Printf("Cleaned up %d expired syslog index entries", syslogRemoved)
+	}
+
+	snmpRemoved, err := bm.cleanupSNMPIndex()
+	if err != nil {
+		return err
+	}
+	if snmpRemoved > 0 {
+		log.Printf("Cleaned up %d expired SNMP traps and devices", snmpRemoved)
+	}
+
+	windowsRemoved, err := bm.cleanupWindowsIndex()
+	if err != nil {
+		return err
+	}
+	if windowsRemoved > 0 {
+		log.Printf("Cleaned up %d expired Windows event index entries", windowsRemoved)
+	}
+
 	return nil
 }
 
 // HTTP Handlers
 
+// knownServices returns the configured services plus any service present in the buffer
+func (bm *BufferManager) knownServices() []string {
+	seen := make(map[string]bool)
+	for name := range bm.config.Services {
+		seen[name] = true
+	}
+
+	rows, err := bm.db.Query("SELECT DISTINCT service FROM telemetry_buffer")
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var name string
+			if rows.Scan(&name) == nil {
+				seen[name] = true
+			}
+		}
+	}
+
+	services := make([]string, 0, len(seen))
+	for name := range seen {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+	return services
+}
+
 func (bm *BufferManager) handleStatus(w http.ResponseWriter, r *http.Request) {
-	services := []string{"vector", "fluent-bit", "goflow2", "telegraf"}
+	services := bm.knownServices()
 	bufferSizeMB, _ := bm.getBufferSizeMB()
 
 	bm.vpnMutex.RLock()
@@ -693,6 +891,10 @@ func (bm *BufferManager) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"max_buffer_size_mb": bm.config.MaxBufferSizeMB,
 		"buffer_usage_pct":   float64(bufferSizeMB) / float64(bm.config.MaxBufferSizeMB) * 100,
 		"vpn_status":         vpnStatus,
+		"forwarding_url":     bm.config.ForwardingURL,
+		"forward_queue":      len(bm.forwardChan),
+		"forward_queue_cap":  cap(bm.forwardChan),
+		"counters":           bm.counters.snapshot(),
 		"services":           make(map[string]*BufferStats),
 		"updated_at":         time.Now().Unix(),
 	}
@@ -797,7 +999,7 @@ func (bm *BufferManager) handleBufferStats(w http.ResponseWriter, r *http.Reques
 
 	// Get record counts by service
 	serviceCounts := make(map[string]int64)
-	services := []string{"vector", "fluent-bit", "goflow2", "telegraf"}
+	services := bm.knownServices()
 
 	for _, service := range services {
 		stats, err := bm.GetStats(service)
@@ -827,6 +1029,7 @@ func (bm *BufferManager) handleBufferStats(w http.ResponseWriter, r *http.Reques
 		"compression_enabled": bm.config.CompressionEnabled,
 		"overflow_action":     bm.config.OverflowAction,
 		"service_records":     serviceCounts,
+		"counters":            bm.counters.snapshot(),
 		"timestamp":           time.Now().Unix(),
 	}
 
@@ -850,12 +1053,18 @@ func (bm *BufferManager) handleIngest(w http.ResponseWriter, r *http.Request) {
 
 	processed := 0
 	errors := 0
+	var processedBytes int64
+	var syslogEntries []SyslogEntry
+	var snmpObservations []snmpObservation
+	var windowsEvents []WindowsEvent
 
 	for _, event := range payload {
 		// Extract common fields
 		service := "vector"
 		if s, ok := event["source_type"].(string); ok && s != "" {
 			service = s
+		} else if isSyslogEvent(event) {
+			service = "syslog"
 		}
 
 		dataType := "unknown"
@@ -883,11 +1092,22 @@ func (bm *BufferManager) handleIngest(w http.ResponseWriter, r *http.Request) {
 			sourceIP = host
 		}
 
+		if service == "syslog" {
+			syslogEntries = append(syslogEntries, syslogEntryFromEvent(event, timestamp, sourceIP))
+		}
+		snmpObservations = append(snmpObservations, snmpObservationsFromEvent(event, timestamp, sourceIP)...)
+		if service == "windows_events" {
+			if ev, ok := windowsEventFromEvent(event, timestamp, sourceIP); ok {
+				windowsEvents = append(windowsEvents, ev)
+			}
+		}
+
 		// Serialize event data
 		jsonData, err := json.Marshal(event)
 		if err != nil {
 			log.Printf("Failed to marshal event data: %v", err)
 			errors++
+			bm.meters.Mark(meterError, service, sourceIP, 1)
 			continue
 		}
 
@@ -912,6 +1132,7 @@ func (bm *BufferManager) handleIngest(w http.ResponseWriter, r *http.Request) {
 				if err := bm.StoreRecord(record); err != nil {
 					log.Printf("Failed to store record: %v", err)
 					errors++
+					bm.meters.Mark(meterError, service, sourceIP, 1)
 					continue
 				}
 			}
@@ -920,11 +1141,41 @@ func (bm *BufferManager) handleIngest(w http.ResponseWriter, r *http.Request) {
 			if err := bm.StoreRecord(record); err != nil {
 				log.Printf("Failed to store record: %v", err)
 				errors++
+				bm.meters.Mark(meterError, service, sourceIP, 1)
 				continue
 			}
 		}
 
 		processed++
+		bm.meters.Mark(meterIngest, service, sourceIP, 1)
+		processedBytes += int64(len(jsonData))
+	}
+
+	bm.counters.ingestedRecords.Add(int64(processed))
+	bm.counters.ingestedBytes.Add(processedBytes)
+	bm.counters.errors.Add(int64(errors))
+
+	// Index syslog messages for search regardless of whether they were forwarded or buffered
+	if len(syslogEntries) > 0 {
+		start := time.Now()
+		if err := bm.indexSyslogEntries(syslogEntries); err != nil {
+			log.Printf("Failed to index syslog messages: %v", err)
+		}
+		bm.observeWrite("index_syslog", start)
+	}
+	if len(snmpObservations) > 0 {
+		start := time.Now()
+		if err := bm.recordSNMPObservations(snmpObservations); err != nil {
+			log.Printf("Failed to update SNMP inventory: %v", err)
+		}
+		bm.observeWrite("index_snmp", start)
+	}
+	if len(windowsEvents) > 0 {
+		start := time.Now()
+		if err := bm.indexWindowsEvents(windowsEvents); err != nil {
+			log.Printf("Failed to index Windows events: %v", err)
+		}
+		bm.observeWrite("index_windows", start)
 	}
 
 	// Return response
@@ -984,12 +1235,24 @@ func main() {
 	api.HandleFunc("/stats/{service}", bm.handleServiceStats).Methods("GET")
 	api.HandleFunc("/cleanup", bm.handleCleanup).Methods("POST")
 	api.HandleFunc("/config", bm.handleConfig).Methods("GET", "POST")
+	api.HandleFunc("/meters", bm.handleMeters).Methods("GET")
+	api.HandleFunc("/meters/reset", bm.handleMetersReset).Methods("POST")
 	api.HandleFunc("/ingest", bm.handleIngest).Methods("POST")
 
+	// Telemetry search
+	api.HandleFunc("/syslog/search", bm.handleSyslogSearch).Methods("GET")
+	api.HandleFunc("/snmp/devices", bm.handleSNMPDevices).Methods("GET")
+	api.HandleFunc("/snmp/devices/{ip}/traps", bm.handleSNMPDeviceTraps).Methods("GET")
+	api.HandleFunc("/snmp/traps", bm.handleSNMPTraps).Methods("GET")
+	api.HandleFunc("/windows/events", bm.handleWindowsEvents).Methods("GET")
+
 	// VPN and forwarding operations
 	api.HandleFunc("/vpn/status", bm.handleVPNStatus).Methods("GET")
 	api.HandleFunc("/forward", bm.handleForwardBuffer).Methods("POST")
 
+	// Prometheus scrape endpoint
+	r.HandleFunc("/metrics", bm.handlePrometheusMetrics).Methods("GET")
+
 	// Health check with enhanced status
 	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		bufferSize, _ := bm.getBufferSizeMB()
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestBufferManager starts a buffer manager in a temp dir; configure runs
+// before the background workers so it can change config without racing them
+func newTestBufferManager(t *testing.T, configure ...func(*BufferConfig)) *BufferManager {
+	t.Helper()
+	bm, err := newBufferManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("newBufferManager: %v", err)
+	}
+	for _, fn := range configure {
+		fn(&bm.config)
+	}
+	bm.startWorkers()
+	t.Cleanup(func() {
+		close(bm.stopChan)
+		bm.db.Close()
+	})
+	return bm
+}
+
+func TestSearchSyslog_FiltersAndAggregates(t *testing.T) {
+	bm := newTestBufferManager(t)
+
+	base := time.Now().Add(-time.Hour).Unix()
+	events := []map[string]interface{}{
+		{"hostname": "core-sw1", "appname": "sshd", "facility": "auth", "severity": "err", "message": "Failed password for admin"},
+		{"hostname": "core-sw1", "appname": "sshd", "facility": "auth", "severity": "info", "message": "Accepted password for noc"},
+		{"hostname": "edge-fw", "appname": "kernel", "facility": "kern", "severity": "warning", "message": "link down on eth1"},
+		{"hostname": "edge-fw", "appname": "kernel", "facility": "kern", "severity": 3.0, "message": "100% packet drop on eth1"},
+	}
+	var entries []SyslogEntry
+	for i, ev := range events {
+		entries = append(entries, syslogEntryFromEvent(ev, base+int64(i), "10.0.0.1"))
+	}
+	if err := bm.indexSyslogEntries(entries); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	res, err := bm.SearchSyslog(SyslogQuery{Limit: 50})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if res.Total != 4 || len(res.Entries) != 4 {
+		t.Fatalf("expected 4 results, got total=%d entries=%d", res.Total, len(res.Entries))
+	}
+	if res.Entries[0].Message != "100% packet drop on eth1" {
+		t.Fatalf("expected newest first, got %q", res.Entries[0].Message)
+	}
+	if res.Levels["error"] != 2 || res.Levels["warning"] != 1 || res.Levels["info"] != 1 {
+		t.Fatalf("unexpected level distribution: %v", res.Levels)
+	}
+	if len(res.TopHosts) != 2 || res.TopHosts[0].Count != 2 {
+		t.Fatalf("unexpected top hosts: %v", res.TopHosts)
+	}
+
+	res, err = bm.SearchSyslog(SyslogQuery{Host: "core-sw1", Severities: []int{3}, Limit: 50})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if res.Total != 1 || res.Entries[0].Program != "sshd" {
+		t.Fatalf("host+severity filter: got %+v", res.Entries)
+	}
+
+	res, err = bm.SearchSyslog(SyslogQuery{Text: "eth1 100%", Limit: 50})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if res.Total != 1 || res.Entries[0].Hostname != "edge-fw" {
+		t.Fatalf("text search: got %+v", res.Entries)
+	}
+
+	res, err = bm.SearchSyslog(SyslogQuery{Since: base + 2, Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if res.Total != 2 || len(res.Entries) != 1 || res.Entries[0].Message != "link down on eth1" {
+		t.Fatalf("time range + pagination: total=%d entries=%+v", res.Total, res.Entries)
+	}
+}
+
+func TestSNMPInventory_DiscoveryStatusAndRestarts(t *testing.T) {
+	bm := newTestBufferManager(t)
+
+	now := time.Now()
+	t0 := now.Add(-40 * time.Minute).Unix()
+	poll := func(ip, hostname, objectID string, ts, uptimeSecs int64) map[string]interface{} {
+		return map[string]interface{}{
+			"name":      "snmp",
+			"timestamp": float64(ts),
+			"tags":      map[string]interface{}{"agent_host": ip, "hostname": hostname},
+			"fields": map[string]interface{}{
+				"uptime_seconds": float64(uptimeSecs),
+				"sys_object_id":  objectID,
+			},
+		}
+	}
+
+	var obs []snmpObservation
+	batch := map[string]interface{}{"metrics": []interface{}{
+		poll("10.0.0.1", "edge-fw", "1.3.6.1.4.1.12356.101.1.3", t0, 86400),
+		poll("10.0.0.2", "core-rtr", "1.3.6.1.4.1.14988.1", t0, 3600),
+		// core-rtr reports an uptime lower than expected: it rebooted
+		poll("10.0.0.2", "core-rtr", "1.3.6.1.4.1.14988.1", now.Add(-2*time.Minute).Unix(), 60),
+		poll("10.0.0.1", "edge-fw", "1.3.6.1.4.1.12356.101.1.3", now.Add(-20*time.Minute).Unix(), 87600),
+	}}
+	obs = append(obs, snmpObservationsFromEvent(batch, now.Unix(), "")...)
+
+	trap := map[string]interface{}{
+		"source_type": "snmp_trap",
+		"message":     "SNMPv2-MIB::snmpTrapOID.0 = OID: IF-MIB::linkDown ifIndex.3 = 3",
+	}
+	obs = append(obs, snmpObservationsFromEvent(trap, now.Add(-time.Minute).Unix(), "10.0.0.3:40123")...)
+
+	if err := bm.recordSNMPObservations(obs); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	inv, err := bm.GetSNMPInventory(now)
+	if err != nil {
+		t.Fatalf("inventory: %v", err)
+	}
+	if inv.Total != 3 {
+		t.Fatalf("expected 3 devices, got %d: %+v", inv.Total, inv.Devices)
+	}
+
+	byIP := map[string]SNMPDevice{}
+	for _, d := range inv.Devices {
+		byIP[d.IP] = d
+	}
+	if d := byIP["10.0.0.1"]; d.Type != deviceFirewall || d.Status != "warning" || d.RestartCount != 0 {
+		t.Fatalf("stale firewall: %+v", d)
+	}
+	if d := byIP["10.0.0.2"]; d.Type != deviceRouter || d.Status != "warning" || d.RestartCount != 1 || d.LastRestart == nil {
+		t.Fatalf("rebooted router: %+v", d)
+	}
+	if d := byIP["10.0.0.3"]; d.Status != "online" || d.LastPolled != nil || d.Traps24h != 1 {
+		t.Fatalf("trap-only device: %+v", d)
+	}
+	if inv.Status["warning"] != 2 || inv.Status["online"] != 1 || inv.Types[deviceUnknown] != 1 {
+		t.Fatalf("unexpected breakdowns: status=%v types=%v", inv.Status, inv.Types)
+	}
+
+	traps, err := bm.QuerySNMPTraps(SNMPTrapQuery{Device: "10.0.0.3", Limit: 10})
+	if err != nil {
+		t.Fatalf("traps: %v", err)
+	}
+	if traps.Total != 1 || traps.Traps[0].Name != "linkDown" || traps.Traps[0].Severity != "error" {
+		t.Fatalf("unexpected trap timeline: %+v", traps.Traps)
+	}
+}
+
+func TestHandleSNMPDevices_FilteredTotals(t *testing.T) {
+	bm := newTestBufferManager(t)
+
+	now := time.Now()
+	poll := func(ip, objectID string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":      "snmp",
+			"timestamp": float64(now.Unix()),
+			"tags":      map[string]interface{}{"agent_host": ip},
+			"fields":    map[string]interface{}{"uptime_seconds": float64(3600), "sys_object_id": objectID},
+		}
+	}
+	batch := map[string]interface{}{"metrics": []interface{}{
+		poll("10.0.0.1", "1.3.6.1.4.1.12356.101.1.3"),
+		poll("10.0.0.2", "1.3.6.1.4.1.14988.1"),
+		poll("10.0.0.3", "1.3.6.1.4.1.14988.1"),
+	}}
+	if err := bm.recordSNMPObservations(snmpObservationsFromEvent(batch, now.Unix(), "")); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	cases := []struct {
+		query       string
+		total       int
+		routers     int64
+		firewalls   int64
+		online      int64
+		polledCount int64
+	}{
+		{"", 3, 2, 1, 3, 3},
+		{"?type=" + deviceRouter, 2, 2, 0, 2, 2},
+		{"?type=" + deviceFirewall + "&status=online", 1, 0, 1, 1, 1},
+		{"?status=offline", 0, 0, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		bm.handleSNMPDevices(rec, httptest.NewRequest(http.MethodGet, "/api/snmp/devices"+tc.query, nil))
+		var inv SNMPInventory
+		if err := json.Unmarshal(rec.Body.Bytes(), &inv); err != nil {
+			t.Fatalf("%s: decode: %v", tc.query, err)
+		}
+		if inv.Total != tc.total || len(inv.Devices) != tc.total || inv.PolledCount != tc.polledCount {
+			t.Errorf("%s: total=%d devices=%d polled=%d, want %d", tc.query, inv.Total, len(inv.Devices), inv.PolledCount, tc.total)
+		}
+		if inv.Types[deviceRouter] != tc.routers || inv.Types[deviceFirewall] != tc.firewalls || inv.Status["online"] != tc.online {
+			t.Errorf("%s: types=%v status=%v", tc.query, inv.Types, inv.Status)
+		}
+	}
+}
+
+func TestSNMPObservations_UptimeFields(t *testing.T) {
+	cases := []struct {
+		name   string
+		fields map[string]interface{}
+		want   int64
+	}{
+		{"uptime_seconds passes through", map[string]interface{}{"uptime_seconds": float64(3600)}, 3600},
+		{"uptime_seconds from float(2)", map[string]interface{}{"uptime_seconds": 3600.42}, 3600},
+		{"raw sysUpTime ticks", map[string]interface{}{"uptime": float64(360000)}, 3600},
+		{"raw sysUpTime string", map[string]interface{}{"uptime": "360000"}, 3600},
+		{"no uptime", map[string]interface{}{}, -1},
+	}
+	for _, tc := range cases {
+		event := map[string]interface{}{
+			"name":   "snmp",
+			"tags":   map[string]interface{}{"agent_host": "10.0.0.1"},
+			"fields": tc.fields,
+		}
+		obs := snmpObservationsFromEvent(event, time.Now().Unix(), "")
+		if len(obs) != 1 || obs[0].Uptime != tc.want {
+			t.Errorf("%s: observations = %+v, want uptime %d", tc.name, obs, tc.want)
+		}
+	}
+}
+
+func TestClassifyDevice(t *testing.T) {
+	cases := []struct {
+		objectID, descr, want string
+	}{
+		{"1.3.6.1.4.1.25461.2.3.18", "", deviceFirewall},
+		{".1.3.6.1.4.1.41112.1.6", "", deviceAccessPoint},
+		{"1.3.6.1.4.1.30065.1.3011", "", deviceSwitch},
+		{"1.3.6.1.4.1.9.1.1208", "Cisco IOS Software, C2960X Software, Catalyst 2960-X", deviceSwitch},
+		{"1.3.6.1.4.1.9.1.2068", "Cisco Adaptive Security Appliance Version 9.12", deviceFirewall},
+		{"1.3.6.1.4.1.9.1.1", "Cisco IOS Software, 4300 Software (ISR4300)", deviceRouter},
+		{"1.3.6.1.4.1.8072.3.2.10", "Linux web01 5.15.0", deviceUnknown},
+	}
+	for _, c := range cases {
+		if got := classifyDevice(c.objectID, c.descr); got != c.want {
+			t.Errorf("classifyDevice(%q, %q) = %q, want %q", c.objectID, c.descr, got, c.want)
+		}
+	}
+}
+
+func TestQueryWindowsEvents_Aggregates(t *testing.T) {
+	bm := newTestBufferManager(t)
+
+	base := time.Now().Add(-time.Hour).Unix()
+	raw := []map[string]interface{}{
+		{"event_id": 4625.0, "channel": "Security", "computer": "DC01", "ProviderName": "Microsoft-Windows-Security-Auditing", "Level": 0.0, "Message": "An account failed to log on."},
+		{"event_id": 4625.0, "channel": "Security", "computer": "DC01", "ProviderName": "Microsoft-Windows-Security-Auditing", "Level": 0.0, "Message": "An account failed to log on."},
+		{"EventID": "7031", "Channel": "System", "Computer": "APP01", "ProviderName": "Service Control Manager", "Level": 2.0, "Message": "The Print Spooler service terminated unexpectedly."},
+		{"EventID": 41.0, "Channel": "System", "Computer": "APP01", "ProviderName": "Microsoft-Windows-Kernel-Power", "Level": 1.0},
+		{"EventID": 1000.0, "Channel": "Application", "Computer": "WS17", "SourceName": "Application Error", "Level": "Warning"},
+		// telegraf metrics share the windows_events source and must be ignored
+		{"name": "cpu", "fields": map[string]interface{}{"usage_idle": 98.0}, "tags": map[string]interface{}{"host": "noc-raven"}},
+	}
+	var events []WindowsEvent
+	for i, r := range raw {
+		if ev, ok := windowsEventFromEvent(r, base+int64(i), "10.0.0.5"); ok {
+			events = append(events, ev)
+		}
+	}
+	if len(events) != 5 {
+		t.Fatalf("expected 5 Windows events, got %d", len(events))
+	}
+	if err := bm.indexWindowsEvents(events); err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	res, err := bm.QueryWindowsEvents(WindowsQuery{Limit: 50})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if res.Total != 5 || res.Levels["critical"] != 1 || res.Levels["error"] != 1 || res.Levels["warning"] != 1 || res.Levels["information"] != 2 {
+		t.Fatalf("unexpected levels: total=%d %v", res.Total, res.Levels)
+	}
+	if res.Channels["Security"] != 2 || res.Channels["System"] != 2 || res.Channels["Application"] != 1 {
+		t.Fatalf("unexpected channels: %v", res.Channels)
+	}
+	if res.TopEventIDs[0].EventID != 4625 || res.TopEventIDs[0].Count != 2 {
+		t.Fatalf("unexpected top event IDs: %v", res.TopEventIDs)
+	}
+	if len(res.TopComputers) != 3 || res.TopComputers[0].Name != "APP01" || res.TopComputers[0].Count != 2 {
+		t.Fatalf("unexpected top computers: %v", res.TopComputers)
+	}
+
+	res, err = bm.QueryWindowsEvents(WindowsQuery{Channel: "system", Limit: 50})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if res.Total != 2 || res.Events[0].EventID != 41 || res.Events[0].Level != "critical" {
+		t.Fatalf("channel filter: total=%d events=%+v", res.Total, res.Events)
+	}
+	if len(res.TopProviders) != 2 {
+		t.Fatalf("aggregates should follow the channel filter: %v", res.TopProviders)
+	}
+}
+
+func TestHandleIngest_CountersAndPendingAge(t *testing.T) {
+	bm := newTestBufferManager(t, func(c *BufferConfig) { c.VPNFailoverEnabled = false })
+
+	body := `[{"source_type":"syslog","timestamp":1700000000,"message":"a"},{"source_type":"syslog","timestamp":1700000060,"message":"b"}]`
+	rec := httptest.NewRecorder()
+	bm.handleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/buffer/ingest", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest: %d %s", rec.Code, rec.Body.String())
+	}
+
+	c := bm.counters.snapshot()
+	if c.IngestedRecords != 2 || c.IngestedBytes == 0 || c.Errors != 0 {
+		t.Fatalf("unexpected counters: %+v", c)
+	}
+
+	stats, err := bm.GetStats("syslog")
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Pending != 2 || stats.OldestPending != 1700000000 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	meters := bm.meters.Snapshot("", "", 0)
+	syslog := meters.Services["syslog"]
+	if syslog["ingest"].Count != 2 || syslog["store"].Count != 2 || syslog["error"].Count != 0 {
+		t.Fatalf("unexpected syslog meters: %+v", syslog)
+	}
+	if len(meters.Series) != 1 || meters.Series[0].Service != "syslog" {
+		t.Fatalf("unexpected series: %+v", meters.Series)
+	}
+}
+
+// Events as Vector's syslog_parser delivers them: parse_syslog replaces the
+// event, so source_type may be missing and severity/facility are names
+func TestHandleIngest_VectorSyslogIsSearchable(t *testing.T) {
+	bm := newTestBufferManager(t, func(c *BufferConfig) { c.VPNFailoverEnabled = false })
+
+	body := `[
+		{"appname":"sshd","facility":"auth","hostname":"core-sw1","message":"Failed password for admin from 10.9.9.9","msgid":"ID47","procid":8710,"severity":"err","timestamp":"2026-10-19T08:00:00Z","version":1},
+		{"appname":"kernel","facility":"kern","hostname":"edge-fw","message":"link down on eth1","severity":"warning","timestamp":"2026-10-19T08:00:05Z","source_type":"syslog","appliance":"noc-raven"}
+	]`
+	rec := httptest.NewRecorder()
+	bm.handleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/buffer/ingest", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		text, host, program string
+	}{
+		{"password admin", "core-sw1", "sshd"},
+		{"eth1", "edge-fw", "kernel"},
+	} {
+		res, err := bm.SearchSyslog(SyslogQuery{Text: tc.text, Limit: 10})
+		if err != nil {
+			t.Fatalf("search %q: %v", tc.text, err)
+		}
+		if res.Total != 1 || res.Entries[0].Hostname != tc.host || res.Entries[0].Program != tc.program {
+			t.Errorf("search %q = %+v", tc.text, res.Entries)
+		}
+	}
+	if stats, err := bm.GetStats("syslog"); err != nil || stats.Pending != 2 {
+		t.Errorf("syslog stats = %+v, %v", stats, err)
+	}
+}
+
+func TestMeterRegistry_RatesOverflowAndReset(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+	r := &MeterRegistry{now: func() time.Time { return clock }}
+	r.Reset()
+
+	// 10 events/s for one minute
+	for i := 0; i < 12; i++ {
+		r.Mark(meterIngest, "syslog", "10.0.0.1", 50)
+		clock = clock.Add(meterTickInterval)
+	}
+	in := r.Snapshot("", "", 0).Totals["ingest"]
+	if in.Count != 600 || math.Abs(in.Rate1m-10) > 0.01 || math.Abs(in.MeanRate-10) > 0.01 {
+		t.Fatalf("steady rate: %+v", in)
+	}
+
+	// Idle for five minutes: the 1m rate decays much faster than the 15m rate
+	clock = clock.Add(5 * time.Minute)
+	in = r.Snapshot("", "", 0).Totals["ingest"]
+	if in.Rate1m > 0.1 || in.Rate15m < 5 || in.Count != 600 {
+		t.Fatalf("decay: %+v", in)
+	}
+
+	r.Mark(meterDrop, "snmp_trap", "10.0.0.2", 3)
+	snap := r.Snapshot("snmp_trap", "", 0)
+	if len(snap.Series) != 1 || snap.Series[0].Events["drop"].Count != 3 {
+		t.Fatalf("service filter: %+v", snap.Series)
+	}
+	if snap.Services["syslog"]["ingest"].Count != 600 {
+		t.Fatalf("service aggregates should ignore the series filter: %+v", snap.Services)
+	}
+
+	// Sources past the series limit fold into "other"
+	for i := 0; i < maxMeterSeries+10; i++ {
+		r.Mark(meterIngest, "netflow", fmt.Sprintf("10.1.%d.%d", i/256, i%256), 1)
+	}
+	if len(r.series) != maxMeterSeries+1 {
+		t.Fatalf("expected series to be capped, got %d", len(r.series))
+	}
+	snap = r.Snapshot("netflow", meterOverflowIP, 0)
+	if len(snap.Series) != 1 || snap.Series[0].Events["ingest"].Count != 12 {
+		t.Fatalf("overflow series: %+v", snap.Series)
+	}
+
+	r.Reset()
+	snap = r.Snapshot("", "", 0)
+	if snap.Totals["ingest"].Count != 0 || len(snap.Series) != 0 || !snap.Since.Equal(clock) {
+		t.Fatalf("reset: %+v", snap)
+	}
+}
+
+func TestPrometheusMetrics_Exposition(t *testing.T) {
+	bm := newTestBufferManager(t, func(c *BufferConfig) { c.VPNFailoverEnabled = false })
+
+	old := time.Now().Add(-90 * time.Second).Unix()
+	body := fmt.Sprintf(`[{"source_type":"syslog","timestamp":%d,"message":"a"},{"source_type":"syslog","timestamp":%d,"message":"b"}]`, old, old+30)
+	rec := httptest.NewRecorder()
+	bm.handleIngest(rec, httptest.NewRequest(http.MethodPost, "/api/buffer/ingest", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest: %d %s", rec.Code, rec.Body.String())
+	}
+	bm.forwardLatency.Observe(30*time.Millisecond, "syslog", "success")
+	bm.forwardLatency.Observe(3*time.Second, "syslog", "success")
+
+	rec = httptest.NewRecorder()
+	bm.handlePrometheusMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("scrape: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	out := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE noc_raven_buffer_backlog_records gauge\n",
+		`noc_raven_buffer_backlog_records{service="syslog"} 2` + "\n",
+		`noc_raven_buffer_backlog_records{service="telegraf"} 0` + "\n",
+		"noc_raven_buffer_ingested_records_total 2\n",
+		"# TYPE noc_raven_buffer_forward_duration_seconds histogram\n",
+		`noc_raven_buffer_forward_duration_seconds_bucket{service="syslog",result="success",le="0.025"} 0` + "\n",
+		`noc_raven_buffer_forward_duration_seconds_bucket{service="syslog",result="success",le="0.05"} 1` + "\n",
+		`noc_raven_buffer_forward_duration_seconds_bucket{service="syslog",result="success",le="+Inf"} 2` + "\n",
+		`noc_raven_buffer_forward_duration_seconds_count{service="syslog",result="success"} 2` + "\n",
+		`noc_raven_buffer_sqlite_write_duration_seconds_count{operation="insert"} 2` + "\n",
+		`noc_raven_buffer_sqlite_write_duration_seconds_count{operation="index_syslog"} 1` + "\n",
+		"noc_raven_buffer_forward_queue_capacity 1000\n",
+		"noc_raven_buffer_vpn_up 0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+
+	var age float64
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, `noc_raven_buffer_oldest_pending_age_seconds{service="syslog"} `) {
+			fmt.Sscanf(strings.Fields(line)[1], "%g", &age)
+		}
+	}
+	if age < 89 || age > 120 {
+		t.Errorf("oldest pending age = %v, want ~90s", age)
+	}
+	if t.Failed() {
+		t.Log(out)
+	}
+}
+
+func TestMetricWriter_EscapesLabels(t *testing.T) {
+	var b strings.Builder
+	bw := bufio.NewWriter(&b)
+	m := &metricWriter{w: bw}
+	m.sample("x", 1.5, "a", "say \"hi\"\\\n")
+	bw.Flush()
+	if got, want := b.String(), `x{a="say \"hi\"\\\n"} 1.5`+"\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
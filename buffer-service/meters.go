@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Meter events tracked per service and source IP
+const (
+	meterIngest = iota
+	meterStore
+	meterForward
+	meterDrop
+	meterError
+	numMeterEvents
+)
+
+var meterEventNames = [numMeterEvents]string{"ingest", "store", "forward", "drop", "error"}
+
+const (
+	// meterTickInterval matches the classic load-average update period
+	meterTickInterval = 5 * time.Second
+
+	// maxMeterSeries bounds memory when many distinct sources appear; sources past
+	// the limit are folded into an "other" series for their service
+	maxMeterSeries  = 5000
+	meterOverflowIP = "other"
+)
+
+var (
+	ewmaAlpha1m  = 1 - math.Exp(-meterTickInterval.Seconds()/60)
+	ewmaAlpha5m  = 1 - math.Exp(-meterTickInterval.Seconds()/300)
+	ewmaAlpha15m = 1 - math.Exp(-meterTickInterval.Seconds()/900)
+)
+
+// ewma is an exponentially weighted moving average of a per-second rate
+type ewma struct {
+	alpha float64
+	rate  float64
+	init  bool
+}
+
+// tick folds n events seen during one tick interval into the average, then
+// decays it over idle additional intervals
+func (e *ewma) tick(n int64, idle int64) {
+	instant := float64(n) / meterTickInterval.Seconds()
+	if e.init {
+		e.rate += e.alpha * (instant - e.rate)
+	} else {
+		e.rate = instant
+		e.init = true
+	}
+	if idle > 0 {
+		e.rate *= math.Pow(1-e.alpha, float64(idle))
+	}
+}
+
+// meter counts events and tracks their 1, 5 and 15 minute rates
+type meter struct {
+	count     int64
+	uncounted int64
+	m1        ewma
+	m5        ewma
+	m15       ewma
+}
+
+func newMeter() meter {
+	return meter{m1: ewma{alpha: ewmaAlpha1m}, m5: ewma{alpha: ewmaAlpha5m}, m15: ewma{alpha: ewmaAlpha15m}}
+}
+
+func (m *meter) mark(n int64) {
+	m.count += n
+	m.uncounted += n
+}
+
+func (m *meter) tick(ticks int64) {
+	n := m.uncounted
+	m.uncounted = 0
+	m.m1.tick(n, ticks-1)
+	m.m5.tick(n, ticks-1)
+	m.m15.tick(n, ticks-1)
+}
+
+// MeterSnapshot is the exported view of a single meter
+type MeterSnapshot struct {
+	Count    int64   `json:"count"`
+	Rate1m   float64 `json:"rate_1m"`
+	Rate5m   float64 `json:"rate_5m"`
+	Rate15m  float64 `json:"rate_15m"`
+	MeanRate float64 `json:"mean_rate"`
+}
+
+func (m *meter) snapshot(elapsed time.Duration) MeterSnapshot {
+	s := MeterSnapshot{Count: m.count, Rate1m: m.m1.rate, Rate5m: m.m5.rate, Rate15m: m.m15.rate}
+	if elapsed > 0 {
+		s.MeanRate = float64(m.count) / elapsed.Seconds()
+	}
+	return s
+}
+
+type meterKey struct {
+	service  string
+	sourceIP string
+}
+
+type meterSet [numMeterEvents]meter
+
+func newMeterSet() *meterSet {
+	var s meterSet
+	for i := range s {
+		s[i] = newMeter()
+	}
+	return &s
+}
+
+// MeterSeries is the meters for one service and source IP pair
+type MeterSeries struct {
+	Service  string                   `json:"service"`
+	SourceIP string                   `json:"source_ip"`
+	Events   map[string]MeterSnapshot `json:"events"`
+}
+
+// MeterStats is the response of the meters API
+type MeterStats struct {
+	Since    time.Time                           `json:"since"`
+	Totals   map[string]MeterSnapshot            `json:"totals"`
+	Services map[string]map[string]MeterSnapshot `json:"services"`
+	Series   []MeterSeries                       `json:"series"`
+}
+
+// MeterRegistry tracks ingest, store, forward, drop and error rates keyed by
+// service and source IP. Unlike BufferCounters it can be reset at runtime.
+type MeterRegistry struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	since    time.Time
+	lastTick time.Time
+	totals   *meterSet
+	series   map[meterKey]*meterSet
+}
+
+// NewMeterRegistry creates an empty registry
+func NewMeterRegistry() *MeterRegistry {
+	r := &MeterRegistry{now: time.Now}
+	r.resetLocked()
+	return r
+}
+
+func (r *MeterRegistry) resetLocked() {
+	r.since = r.now()
+	r.lastTick = r.since
+	r.totals = newMeterSet()
+	r.series = make(map[meterKey]*meterSet)
+}
+
+// tickLocked advances all EWMAs to the current time
+func (r *MeterRegistry) tickLocked() {
+	ticks := int64(r.now().Sub(r.lastTick) / meterTickInterval)
+	if ticks <= 0 {
+		return
+	}
+	r.lastTick = r.lastTick.Add(time.Duration(ticks) * meterTickInterval)
+	for i := range r.totals {
+		r.totals[i].tick(ticks)
+	}
+	for _, set := range r.series {
+		for i := range set {
+			set[i].tick(ticks)
+		}
+	}
+}
+
+// Mark records n events of the given kind for a service and source IP
+func (r *MeterRegistry) Mark(event int, service, sourceIP string, n int64) {
+	if n <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tickLocked()
+
+	key := meterKey{service: service, sourceIP: sourceIP}
+	set, ok := r.series[key]
+	if !ok {
+		if len(r.series) >= maxMeterSeries {
+			key.sourceIP = meterOverflowIP
+			set, ok = r.series[key]
+		}
+		if !ok {
+			set = newMeterSet()
+			r.series[key] = set
+		}
+	}
+	set[event].mark(n)
+	r.totals[event].mark(n)
+}
+
+// Reset clears every meter and restarts the mean-rate clock
+func (r *MeterRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetLocked()
+}
+
+// Snapshot returns totals, per-service aggregates and per-source series, optionally
+// filtered by service and source IP. Series are ordered by ingest count, busiest first.
+func (r *MeterRegistry) Snapshot(service, sourceIP string, limit int) MeterStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tickLocked()
+	elapsed := r.now().Sub(r.since)
+
+	stats := MeterStats{
+		Since:    r.since.UTC(),
+		Totals:   make(map[string]MeterSnapshot),
+		Services: make(map[string]map[string]MeterSnapshot),
+		Series:   []MeterSeries{},
+	}
+	for i, name := range meterEventNames {
+		stats.Totals[name] = r.totals[i].snapshot(elapsed)
+	}
+
+	ingest := make(map[meterKey]int64)
+	for key, set := range r.series {
+		// Per-service aggregates are sums of the per-source series
+		svc, ok := stats.Services[key.service]
+		if !ok {
+			svc = make(map[string]MeterSnapshot)
+			stats.Services[key.service] = svc
+		}
+		for i, name := range meterEventNames {
+			s := set[i].snapshot(elapsed)
+			agg := svc[name]
+			agg.Count += s.Count
+			agg.Rate1m += s.Rate1m
+			agg.Rate5m += s.Rate5m
+			agg.Rate15m += s.Rate15m
+			agg.MeanRate += s.MeanRate
+			svc[name] = agg
+		}
+
+		if (service != "" && key.service != service) || (sourceIP != "" && key.sourceIP != sourceIP) {
+			continue
+		}
+		series := MeterSeries{Service: key.service, SourceIP: key.sourceIP, Events: make(map[string]MeterSnapshot)}
+		for i, name := range meterEventNames {
+			series.Events[name] = set[i].snapshot(elapsed)
+		}
+		ingest[key] = set[meterIngest].count
+		stats.Series = append(stats.Series, series)
+	}
+
+	sort.Slice(stats.Series, func(i, j int) bool {
+		a, b := stats.Series[i], stats.Series[j]
+		ca := ingest[meterKey{a.Service, a.SourceIP}]
+		cb := ingest[meterKey{b.Service, b.SourceIP}]
+		if ca != cb {
+			return ca > cb
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.SourceIP < b.SourceIP
+	})
+	if limit > 0 && len(stats.Series) > limit {
+		stats.Series = stats.Series[:limit]
+	}
+	return stats
+}
+
+// handleMeters serves ingest/store/forward/drop/error meters by service and source
+func (bm *BufferManager) handleMeters(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit := 100
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	stats := bm.meters.Snapshot(params.Get("service"), params.Get("source"), limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleMetersReset clears all meters
+func (bm *BufferManager) handleMetersReset(w http.ResponseWriter, r *http.Request) {
+	bm.meters.Reset()
+	logger.Info("Buffer meters reset")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "meters reset"})
+}
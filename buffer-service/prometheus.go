@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricPrefix namespaces everything exported on /metrics. Metric names are part
+// of the scrape contract with Prometheus and dashboards, so rename only with a
+// deprecation period.
+const metricPrefix = "noc_raven_buffer_"
+
+var (
+	// forwardLatencyBuckets span a LAN round trip up to the 10s client timeout
+	forwardLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// sqliteWriteBuckets span a cached page write up to a stalled fsync
+	sqliteWriteBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+// histogram is a Prometheus-style cumulative histogram
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // per bucket, non-cumulative; last entry is +Inf
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// histogramVec is a set of histograms sharing bucket bounds, keyed by label values
+type histogramVec struct {
+	mu      sync.Mutex
+	labels  []string
+	buckets []float64
+	series  map[string]*histogram
+	values  map[string][]string
+}
+
+func newHistogramVec(buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+		values:  make(map[string][]string),
+	}
+}
+
+// Observe records a duration for the given label values
+func (v *histogramVec) Observe(d time.Duration, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.series[key]
+	if !ok {
+		h = &histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets)+1)}
+		v.series[key] = h
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+	h.observe(d.Seconds())
+}
+
+// write emits the histogram family in text exposition format
+func (v *histogramVec) write(w *metricWriter, name, help string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	w.header(name, "histogram", help)
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h := v.series[k]
+		pairs := make([]string, 0, 2*len(v.labels)+2)
+		for i, l := range v.labels {
+			pairs = append(pairs, l, v.values[k][i])
+		}
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += h.counts[i]
+			w.sample(name+"_bucket", float64(cumulative), append(pairs, "le", formatFloat(le))...)
+		}
+		w.sample(name+"_bucket", float64(h.count), append(pairs, "le", "+Inf")...)
+		w.sample(name+"_sum", h.sum, pairs...)
+		w.sample(name+"_count", float64(h.count), pairs...)
+	}
+}
+
+// metricWriter writes the Prometheus text exposition format (version 0.0.4)
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one line; labels are given as alternating name, value pairs
+func (m *metricWriter) sample(name string, value float64, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			m.w.WriteString(labels[i])
+			m.w.WriteString(`="`)
+			m.w.WriteString(escapeLabelValue(labels[i+1]))
+			m.w.WriteByte('"')
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(formatFloat(value))
+	m.w.WriteByte('\n')
+}
+
+// single writes a metric family with one unlabeled sample
+func (m *metricWriter) single(name, kind, help string, value float64) {
+	m.header(name, kind, help)
+	m.sample(name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// observeWrite records the latency of a SQLite write operation
+func (bm *BufferManager) observeWrite(operation string, start time.Time) {
+	bm.sqliteWriteLatency.Observe(time.Since(start), operation)
+}
+
+// serviceBacklog is the stored and pending volume of one service
+type serviceBacklog struct {
+	records, bytes               int64
+	pendingRecords, pendingBytes int64
+	oldestPending                int64
+}
+
+// backlogByService aggregates the buffer per service in a single scan
+func (bm *BufferManager) backlogByService() (map[string]serviceBacklog, error) {
+	rows, err := bm.db.Query(`
+		SELECT service,
+			COUNT(*),
+			COALESCE(SUM(data_size), 0),
+			COALESCE(SUM(CASE WHEN forwarded = 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN forwarded = 0 THEN data_size ELSE 0 END), 0),
+			COALESCE(MIN(CASE WHEN forwarded = 0 THEN timestamp END), 0)
+		FROM telemetry_buffer
+		GROUP BY service`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backlog := make(map[string]serviceBacklog)
+	for rows.Next() {
+		var service string
+		var b serviceBacklog
+		if err := rows.Scan(&service, &b.records, &b.bytes, &b.pendingRecords, &b.pendingBytes, &b.oldestPending); err != nil {
+			return nil, err
+		}
+		backlog[service] = b
+	}
+	return backlog, rows.Err()
+}
+
+// handlePrometheusMetrics serves buffer, forwarding and VPN metrics for Prometheus
+func (bm *BufferManager) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	backlog, err := bm.backlogByService()
+	if err != nil {
+		logger.WithError(err).Error("Failed to collect buffer backlog metrics")
+		http.Error(w, "failed to collect metrics", http.StatusInternalServerError)
+		return
+	}
+	bufferSize, _ := bm.getBufferSizeMB()
+
+	bm.vpnMutex.RLock()
+	vpn := bm.vpnStatus
+	bm.vpnMutex.RUnlock()
+
+	now := time.Now()
+	counters := bm.counters.snapshot()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	m := &metricWriter{w: bw}
+
+	// Every known service gets a series, so idle services report 0 rather than vanishing
+	services := bm.knownServices()
+	perService := func(name, kind, help string, value func(serviceBacklog) float64) {
+		m.header(metricPrefix+name, kind, help)
+		for _, svc := range services {
+			m.sample(metricPrefix+name, value(backlog[svc]), "service", svc)
+		}
+	}
+	perService("records", "gauge", "Records currently held in the buffer.",
+		func(b serviceBacklog) float64 { return float64(b.records) })
+	perService("bytes", "gauge", "Bytes of record data currently held in the buffer.",
+		func(b serviceBacklog) float64 { return float64(b.bytes) })
+	perService("backlog_records", "gauge", "Buffered records not yet forwarded.",
+		func(b serviceBacklog) float64 { return float64(b.pendingRecords) })
+	perService("backlog_bytes", "gauge", "Bytes of buffered records not yet forwarded.",
+		func(b serviceBacklog) float64 { return float64(b.pendingBytes) })
+	perService("oldest_pending_age_seconds", "gauge", "Age of the oldest record not yet forwarded, 0 when nothing is pending.",
+		func(b serviceBacklog) float64 {
+			if b.pendingRecords == 0 || b.oldestPending == 0 {
+				return 0
+			}
+			return math.Max(0, now.Sub(time.Unix(b.oldestPending, 0)).Seconds())
+		})
+
+	m.single(metricPrefix+"database_size_bytes", "gauge", "Size of the buffer database.", float64(bufferSize)*1024*1024)
+	m.single(metricPrefix+"max_size_bytes", "gauge", "Configured buffer size limit.", float64(bm.config.MaxBufferSizeMB)*1024*1024)
+
+	m.single(metricPrefix+"ingested_records_total", "counter", "Records accepted on the ingest API.", float64(counters.IngestedRecords))
+	m.single(metricPrefix+"ingested_bytes_total", "counter", "Bytes of records accepted on the ingest API.", float64(counters.IngestedBytes))
+	m.single(metricPrefix+"forwarded_records_total", "counter", "Records delivered to the forwarding endpoint.", float64(counters.ForwardedRecords))
+	m.single(metricPrefix+"forwarded_bytes_total", "counter", "Bytes of records delivered to the forwarding endpoint.", float64(counters.ForwardedBytes))
+	m.single(metricPrefix+"forward_failures_total", "counter", "Forward attempts that failed.", float64(counters.ForwardFailures))
+	m.single(metricPrefix+"dropped_records_total", "counter", "Records dropped to make room when the buffer overflowed.", float64(counters.DroppedRecords))
+	m.single(metricPrefix+"errors_total", "counter", "Ingest and store errors.", float64(counters.Errors))
+	m.single(metricPrefix+"last_forward_timestamp_seconds", "gauge", "Unix time of the last successful forward, 0 if none.", float64(counters.LastForwardAt))
+	m.single(metricPrefix+"start_time_seconds", "gauge", "Unix time buffer-service started.", float64(counters.StartedAt))
+
+	bm.forwardLatency.write(m, metricPrefix+"forward_duration_seconds", "Time to deliver a record to the forwarding endpoint.")
+	bm.sqliteWriteLatency.write(m, metricPrefix+"sqlite_write_duration_seconds", "Time spent in SQLite write operations.")
+
+	m.single(metricPrefix+"forward_queue_depth", "gauge", "Records waiting in the in-memory forward queue.", float64(len(bm.forwardChan)))
+	m.single(metricPrefix+"forward_queue_capacity", "gauge", "Capacity of the in-memory forward queue.", float64(cap(bm.forwardChan)))
+
+	m.single(metricPrefix+"vpn_up", "gauge", "Whether the forwarding endpoint was reachable at the last check.", boolFloat(vpn.Connected))
+	m.single(metricPrefix+"vpn_latency_seconds", "gauge", "Forwarding endpoint health check latency at the last successful check.", float64(vpn.Latency)/1000)
+	m.single(metricPrefix+"vpn_consecutive_failures", "gauge", "Consecutive failed forwarding endpoint checks.", float64(vpn.FailureCount))
+	m.single(metricPrefix+"vpn_last_check_timestamp_seconds", "gauge", "Unix time of the last forwarding endpoint check.", float64(vpn.LastCheck.Unix()))
+}
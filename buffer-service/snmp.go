@@ -0,0 +1,874 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Polled devices report every poll interval (5 minutes in telegraf-production.conf)
+	snmpPollWarningAfter = 10 * time.Minute
+	snmpPollOfflineAfter = 30 * time.Minute
+
+	// Trap-only devices are silent until something happens, so allow much longer gaps
+	snmpTrapWarningAfter = 6 * time.Hour
+	snmpTrapOfflineAfter = 24 * time.Hour
+
+	// A device that restarted within this window is reported as warning
+	snmpRestartWarningWindow = time.Hour
+
+	// sysUpTime is a 32-bit TimeTicks counter (hundredths of a second) that wraps after ~497 days
+	snmpUptimeWrapSeconds = (1 << 32) / 100
+)
+
+// Device classes reported by the inventory
+const (
+	deviceRouter      = "router"
+	deviceSwitch      = "switch"
+	deviceFirewall    = "firewall"
+	deviceAccessPoint = "access_point"
+	deviceUnknown     = "unknown"
+)
+
+var snmpDeviceTypes = []string{deviceRouter, deviceSwitch, deviceFirewall, deviceAccessPoint, deviceUnknown}
+
+// snmpObjectIDClasses maps sysObjectID prefixes to device classes; the longest
+// matching prefix wins. Vendors that ship every class of hardware under one
+// enterprise number (Cisco, Meraki) are left to the sysDescr keywords.
+var snmpObjectIDClasses = map[string]string{
+	"1.3.6.1.4.1.12356":        deviceFirewall,    // Fortinet FortiGate
+	"1.3.6.1.4.1.25461":        deviceFirewall,    // Palo Alto Networks
+	"1.3.6.1.4.1.2620":         deviceFirewall,    // Check Point
+	"1.3.6.1.4.1.8741":         deviceFirewall,    // SonicWall
+	"1.3.6.1.4.1.14179":        deviceAccessPoint, // Cisco Airespace WLC / lightweight APs
+	"1.3.6.1.4.1.14823":        deviceAccessPoint, // Aruba
+	"1.3.6.1.4.1.41112":        deviceAccessPoint, // Ubiquiti UniFi
+	"1.3.6.1.4.1.25053":        deviceAccessPoint, // Ruckus Wireless
+	"1.3.6.1.4.1.2636.1.1.1.2": deviceRouter,      // Juniper MX/M/T/J series
+	"1.3.6.1.4.1.2636.1.1.1.1": deviceRouter,      // Juniper legacy routers
+	"1.3.6.1.4.1.14988":        deviceRouter,      // MikroTik RouterOS
+	"1.3.6.1.4.1.6527":         deviceRouter,      // Nokia (Alcatel-Lucent) SR
+	"1.3.6.1.4.1.2011.2.62":    deviceRouter,      // Huawei AR/NE routers
+	"1.3.6.1.4.1.11.2.3.7.11":  deviceSwitch,      // HPE ProCurve / Aruba switches
+	"1.3.6.1.4.1.1916":         deviceSwitch,      // Extreme Networks
+	"1.3.6.1.4.1.1991":         deviceSwitch,      // Brocade / Foundry
+	"1.3.6.1.4.1.674.10895":    deviceSwitch,      // Dell PowerConnect
+	"1.3.6.1.4.1.4526":         deviceSwitch,      // Netgear
+	"1.3.6.1.4.1.30065":        deviceSwitch,      // Arista
+}
+
+// snmpDescrKeywords classifies devices by sysDescr when sysObjectID is not conclusive.
+// Order matters: firewalls and APs often also mention routing or switching.
+var snmpDescrKeywords = []struct {
+	class    string
+	keywords []string
+}{
+	{deviceFirewall, []string{"adaptive security appliance", "firewall", "fortigate", "pan-os", "sonicos", "firepower"}},
+	{deviceAccessPoint, []string{"access point", "aironet", "wireless lan", "unifi ap", "wlan"}},
+	{deviceSwitch, []string{"switch", "catalyst", "nexus", "procurve", "arista", "powerconnect"}},
+	{deviceRouter, []string{"router", "ios xr", "ios-xe", "junos", "routeros", "ios software", "vyos"}},
+}
+
+// snmpTrapSeverities maps well-known trap names to UI severities
+var snmpTrapSeverities = map[string]string{
+	"coldstart":             "warning",
+	"warmstart":             "warning",
+	"linkdown":              "error",
+	"linkup":                "info",
+	"authenticationfailure": "warning",
+	"egpneighborloss":       "error",
+	"bgpbackwardtransition": "error",
+	"bgpestablished":        "info",
+}
+
+// snmpTrapOIDNames maps the SNMPv2 generic trap OIDs to their names
+var snmpTrapOIDNames = map[string]string{
+	"1.3.6.1.6.3.1.1.5.1": "coldStart",
+	"1.3.6.1.6.3.1.1.5.2": "warmStart",
+	"1.3.6.1.6.3.1.1.5.3": "linkDown",
+	"1.3.6.1.6.3.1.1.5.4": "linkUp",
+	"1.3.6.1.6.3.1.1.5.5": "authenticationFailure",
+	"1.3.6.1.6.3.1.1.5.6": "egpNeighborLoss",
+}
+
+var (
+	snmpOIDPattern      = regexp.MustCompile(`\b1\.3\.6\.1(?:\.[0-9]+)+\b`)
+	snmpTrapNamePattern = regexp.MustCompile(`(?i)\b(coldStart|warmStart|linkDown|linkUp|authenticationFailure|egpNeighborLoss|bgpBackwardTransition|bgpEstablished)\b`)
+)
+
+// SNMPDevice represents a device discovered from polls or traps
+type SNMPDevice struct {
+	IP            string     `json:"ip"`
+	Hostname      string     `json:"hostname,omitempty"`
+	SysObjectID   string     `json:"sys_object_id,omitempty"`
+	SysDescr      string     `json:"sys_descr,omitempty"`
+	Type          string     `json:"type"`
+	Status        string     `json:"status"` // "online", "warning" or "offline"
+	StatusReason  string     `json:"status_reason,omitempty"`
+	UptimeSeconds int64      `json:"uptime_seconds"`
+	FirstSeen     time.Time  `json:"first_seen"`
+	LastSeen      time.Time  `json:"last_seen"`
+	LastPolled    *time.Time `json:"last_polled,omitempty"`
+	LastTrap      *time.Time `json:"last_trap,omitempty"`
+	LastRestart   *time.Time `json:"last_restart,omitempty"`
+	RestartCount  int64      `json:"restart_count"`
+	Traps24h      int64      `json:"traps_24h"`
+
+	uptimeAt int64 // unix time the uptime sample was taken
+}
+
+// SNMPInventory is the response of the device inventory API
+type SNMPInventory struct {
+	Total       int              `json:"total"`
+	Devices     []SNMPDevice     `json:"devices"`
+	Status      map[string]int64 `json:"status"`
+	Types       map[string]int64 `json:"types"`
+	Traps24h    int64            `json:"traps_24h"`
+	PolledCount int64            `json:"polled_devices"`
+	GeneratedAt time.Time        `json:"generated_at"`
+}
+
+// SNMPTrap represents a single received trap
+type SNMPTrap struct {
+	ID        int64                  `json:"id"`
+	Timestamp time.Time              `json:"timestamp"`
+	DeviceIP  string                 `json:"device_ip"`
+	OID       string                 `json:"oid,omitempty"`
+	Name      string                 `json:"name,omitempty"`
+	Severity  string                 `json:"severity"`
+	Message   string                 `json:"message,omitempty"`
+	Varbinds  map[string]interface{} `json:"varbinds,omitempty"`
+}
+
+// SNMPTrapQuery holds the filters accepted by the trap timeline API
+type SNMPTrapQuery struct {
+	Device   string
+	Severity string
+	Since    int64
+	Until    int64
+	Limit    int
+	Offset   int
+}
+
+// SNMPTrapResult is the response of the trap timeline API
+type SNMPTrapResult struct {
+	Total  int64      `json:"total"`
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
+	Traps  []SNMPTrap `json:"traps"`
+}
+
+// snmpObservation is a single sighting of a device extracted from an ingested event
+type snmpObservation struct {
+	IP          string
+	Hostname    string
+	SysObjectID string
+	SysDescr    string
+	Uptime      int64 // seconds, -1 when not reported
+	Timestamp   int64
+	Polled      bool
+	Trap        *SNMPTrap
+}
+
+// createSNMPTables creates the device inventory and trap timeline tables
+func (bm *BufferManager) createSNMPTables() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS snmp_devices (
+		ip TEXT PRIMARY KEY,
+		hostname TEXT NOT NULL DEFAULT '',
+		sys_object_id TEXT NOT NULL DEFAULT '',
+		sys_descr TEXT NOT NULL DEFAULT '',
+		device_type TEXT NOT NULL DEFAULT 'unknown',
+		uptime_seconds INTEGER NOT NULL DEFAULT -1,
+		uptime_at INTEGER NOT NULL DEFAULT 0,
+		first_seen INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL,
+		last_polled INTEGER NOT NULL DEFAULT 0,
+		last_trap INTEGER NOT NULL DEFAULT 0,
+		last_restart INTEGER NOT NULL DEFAULT 0,
+		restart_count INTEGER NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS snmp_traps (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		device_ip TEXT NOT NULL,
+		oid TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		severity TEXT NOT NULL DEFAULT 'info',
+		message TEXT NOT NULL DEFAULT '',
+		varbinds TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_snmp_traps_device_ts ON snmp_traps(device_ip, timestamp);
+	CREATE INDEX IF NOT EXISTS idx_snmp_traps_timestamp ON snmp_traps(timestamp);
+	`
+	_, err := bm.db.Exec(schema)
+	return err
+}
+
+// classifyDevice derives a device class from sysObjectID, falling back to sysDescr keywords
+func classifyDevice(sysObjectID, sysDescr string) string {
+	oid := strings.TrimPrefix(strings.TrimSpace(sysObjectID), ".")
+	best := ""
+	for prefix := range snmpObjectIDClasses {
+		if (oid == prefix || strings.HasPrefix(oid, prefix+".")) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return snmpObjectIDClasses[best]
+	}
+
+	descr := strings.ToLower(sysDescr)
+	for _, c := range snmpDescrKeywords {
+		for _, kw := range c.keywords {
+			if strings.Contains(descr, kw) {
+				return c.class
+			}
+		}
+	}
+	return deviceUnknown
+}
+
+// trapSeverity maps a trap name to the severity shown in the UI
+func trapSeverity(name string) string {
+	if s, ok := snmpTrapSeverities[strings.ToLower(name)]; ok {
+		return s
+	}
+	return "info"
+}
+
+// stripPort returns the host part of an address that may carry a port
+func stripPort(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func stringField(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
+
+// intField reads an integer field, returning -1 when none of keys is set
+func intField(m map[string]interface{}, keys ...string) int64 {
+	for _, k := range keys {
+		switch v := m[k].(type) {
+		case float64:
+			return int64(v)
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return -1
+}
+
+// timeticksField reads a sysUpTime value (hundredths of a second) and returns seconds
+func timeticksField(m map[string]interface{}, keys ...string) int64 {
+	if ticks := intField(m, keys...); ticks >= 0 {
+		return ticks / 100
+	}
+	return -1
+}
+
+func mapField(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	return map[string]interface{}{}
+}
+
+// snmpObservationsFromEvent extracts device sightings from a Vector trap event or a
+// telegraf JSON metric (single or batched under "metrics")
+func snmpObservationsFromEvent(event map[string]interface{}, timestamp int64, sourceIP string) []snmpObservation {
+	if batch, ok := event["metrics"].([]interface{}); ok {
+		var out []snmpObservation
+		for _, item := range batch {
+			if m, ok := item.(map[string]interface{}); ok {
+				ts := timestamp
+				if v, ok := m["timestamp"].(float64); ok {
+					ts = int64(v)
+				}
+				out = append(out, snmpObservationsFromEvent(m, ts, sourceIP)...)
+			}
+		}
+		return out
+	}
+
+	// Raw traps received by Vector's snmp_input socket
+	if st, _ := event["source_type"].(string); st == "snmp_trap" {
+		ip := stripPort(sourceIP)
+		if ip == "" {
+			return nil
+		}
+		message, _ := event["message"].(string)
+		trap := &SNMPTrap{
+			Timestamp: time.Unix(timestamp, 0).UTC(),
+			DeviceIP:  ip,
+			OID:       stringField(event, "oid"),
+			Message:   message,
+		}
+		if m := snmpTrapNamePattern.FindString(message); m != "" {
+			trap.Name = m
+		}
+		if trap.OID == "" {
+			trap.OID = snmpOIDPattern.FindString(message)
+		}
+		if trap.Name == "" {
+			trap.Name = snmpTrapOIDNames[trap.OID]
+		}
+		trap.Severity = trapSeverity(trap.Name)
+		return []snmpObservation{{IP: ip, Uptime: -1, Timestamp: timestamp, Trap: trap}}
+	}
+
+	name, _ := event["name"].(string)
+	tags := mapField(event, "tags")
+	fields := mapField(event, "fields")
+
+	switch name {
+	case "snmp", "interface":
+		// telegraf inputs.snmp: agent_host identifies the polled device
+		ip := stripPort(stringField(tags, "agent_host"))
+		if ip == "" {
+			return nil
+		}
+		obs := snmpObservation{
+			IP:          ip,
+			Hostname:    stringField(tags, "hostname"),
+			SysObjectID: stringField(fields, "sys_object_id"),
+			SysDescr:    stringField(fields, "sys_description"),
+			Uptime:      -1,
+			Timestamp:   timestamp,
+			Polled:      true,
+		}
+		if obs.Hostname == "" {
+			obs.Hostname = stringField(fields, "hostname")
+		}
+		if name == "snmp" {
+			// uptime_seconds is already converted; uptime is raw sysUpTime
+			if obs.Uptime = intField(fields, "uptime_seconds"); obs.Uptime < 0 {
+				obs.Uptime = timeticksField(fields, "uptime")
+			}
+		}
+		return []snmpObservation{obs}
+
+	case "snmp_trap", "snmp_trap_socket":
+		// telegraf inputs.snmp_trap: source is the agent that sent the trap
+		ip := stripPort(stringField(tags, "source", "agent_address", "agent", "host"))
+		if ip == "" {
+			return nil
+		}
+		trap := &SNMPTrap{
+			Timestamp: time.Unix(timestamp, 0).UTC(),
+			DeviceIP:  ip,
+			OID:       stringField(tags, "oid"),
+			Name:      stringField(tags, "name", "trap_type"),
+			Message:   stringField(fields, "message"),
+			Varbinds:  fields,
+		}
+		if trap.Name == "" {
+			trap.Name = snmpTrapOIDNames[strings.TrimPrefix(trap.OID, ".")]
+		}
+		if trap.Message == "" {
+			trap.Message = strings.TrimSpace(strings.Join([]string{stringField(tags, "mib"), trap.Name}, "::"))
+			trap.Message = strings.Trim(trap.Message, ":")
+		}
+		trap.Severity = trapSeverity(trap.Name)
+		return []snmpObservation{{
+			IP:        ip,
+			Hostname:  stringField(tags, "hostname"),
+			Uptime:    timeticksField(fields, "sysUpTimeInstance"),
+			Timestamp: timestamp,
+			Trap:      trap,
+		}}
+	}
+
+	return nil
+}
+
+// applySNMPObservation merges an observation into a device row, detecting restarts
+// from sysUpTime going backwards (or coldStart/warmStart traps)
+func applySNMPObservation(dev *SNMPDevice, obs snmpObservation) {
+	ts := time.Unix(obs.Timestamp, 0).UTC()
+	if dev.FirstSeen.IsZero() || ts.Before(dev.FirstSeen) {
+		dev.FirstSeen = ts
+	}
+	if ts.After(dev.LastSeen) {
+		dev.LastSeen = ts
+	}
+	if obs.Hostname != "" {
+		dev.Hostname = obs.Hostname
+	}
+	if obs.SysObjectID != "" {
+		dev.SysObjectID = strings.TrimPrefix(obs.SysObjectID, ".")
+	}
+	if obs.SysDescr != "" {
+		dev.SysDescr = obs.SysDescr
+	}
+	dev.Type = classifyDevice(dev.SysObjectID, dev.SysDescr)
+
+	if obs.Polled && (dev.LastPolled == nil || ts.After(*dev.LastPolled)) {
+		dev.LastPolled = &ts
+	}
+
+	restartAt := int64(0)
+	if obs.Trap != nil {
+		if dev.LastTrap == nil || ts.After(*dev.LastTrap) {
+			dev.LastTrap = &ts
+		}
+		switch strings.ToLower(obs.Trap.Name) {
+		case "coldstart", "warmstart":
+			restartAt = obs.Timestamp
+			if obs.Uptime >= 0 {
+				restartAt = obs.Timestamp - obs.Uptime
+			}
+		}
+	}
+
+	// Only compare samples that arrive in order; late observations don't move uptime
+	if obs.Uptime >= 0 && obs.Timestamp >= dev.uptimeAt {
+		if dev.UptimeSeconds >= 0 && dev.uptimeAt > 0 {
+			expected := dev.UptimeSeconds + (obs.Timestamp - dev.uptimeAt)
+			wrapped := expected >= snmpUptimeWrapSeconds && obs.Uptime < expected-snmpUptimeWrapSeconds+60
+			if obs.Uptime+60 < expected && !wrapped {
+				restartAt = obs.Timestamp - obs.Uptime
+			}
+		}
+		dev.UptimeSeconds = obs.Uptime
+		dev.uptimeAt = obs.Timestamp
+	}
+
+	// A coldStart trap and the next poll describe the same reboot; count it once
+	if restartAt > 0 && (dev.LastRestart == nil || restartAt-dev.LastRestart.Unix() > 120) {
+		t := time.Unix(restartAt, 0).UTC()
+		dev.LastRestart = &t
+		dev.RestartCount++
+	}
+}
+
+// deriveDeviceStatus computes online/warning/offline from last-seen and recent restarts
+func deriveDeviceStatus(dev *SNMPDevice, now time.Time) {
+	warnAfter, offlineAfter := snmpTrapWarningAfter, snmpTrapOfflineAfter
+	if dev.LastPolled != nil {
+		warnAfter, offlineAfter = snmpPollWarningAfter, snmpPollOfflineAfter
+	}
+
+	age := now.Sub(dev.LastSeen)
+	switch {
+	case age > offlineAfter:
+		dev.Status = "offline"
+		dev.StatusReason = fmt.Sprintf("not seen for %s", age.Truncate(time.Minute))
+	case age > warnAfter:
+		dev.Status = "warning"
+		dev.StatusReason = fmt.Sprintf("not seen for %s", age.Truncate(time.Minute))
+	case dev.LastRestart != nil && now.Sub(*dev.LastRestart) < snmpRestartWarningWindow:
+		dev.Status = "warning"
+		dev.StatusReason = fmt.Sprintf("restarted at %s", dev.LastRestart.Format(time.RFC3339))
+	default:
+		dev.Status = "online"
+		dev.StatusReason = ""
+	}
+
+	// Report uptime as of now rather than as of the last sample
+	if dev.UptimeSeconds >= 0 && dev.uptimeAt > 0 && dev.Status != "offline" {
+		dev.UptimeSeconds += now.Unix() - dev.uptimeAt
+	}
+}
+
+func unixPtr(v int64) *time.Time {
+	if v <= 0 {
+		return nil
+	}
+	t := time.Unix(v, 0).UTC()
+	return &t
+}
+
+func ptrUnix(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+const snmpDeviceColumns = `ip, hostname, sys_object_id, sys_descr, device_type, uptime_seconds, uptime_at,
+	first_seen, last_seen, last_polled, last_trap, last_restart, restart_count`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSNMPDevice(row rowScanner) (SNMPDevice, error) {
+	var dev SNMPDevice
+	var firstSeen, lastSeen, lastPolled, lastTrap, lastRestart int64
+	err := row.Scan(&dev.IP, &dev.Hostname, &dev.SysObjectID, &dev.SysDescr, &dev.Type,
+		&dev.UptimeSeconds, &dev.uptimeAt, &firstSeen, &lastSeen, &lastPolled, &lastTrap,
+		&lastRestart, &dev.RestartCount)
+	if err != nil {
+		return dev, err
+	}
+	dev.FirstSeen = time.Unix(firstSeen, 0).UTC()
+	dev.LastSeen = time.Unix(lastSeen, 0).UTC()
+	dev.LastPolled = unixPtr(lastPolled)
+	dev.LastTrap = unixPtr(lastTrap)
+	dev.LastRestart = unixPtr(lastRestart)
+	return dev, nil
+}
+
+// recordSNMPObservations updates the device inventory and appends traps to the timeline
+func (bm *BufferManager) recordSNMPObservations(observations []snmpObservation) error {
+	if len(observations) == 0 {
+		return nil
+	}
+
+	// Process in time order so restart detection sees samples as they happened
+	sort.SliceStable(observations, func(i, j int) bool {
+		return observations[i].Timestamp < observations[j].Timestamp
+	})
+
+	tx, err := bm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	devices := map[string]*SNMPDevice{}
+	now := time.Now().Unix()
+
+	for _, obs := range observations {
+		dev, ok := devices[obs.IP]
+		if !ok {
+			row := tx.QueryRow("SELECT "+snmpDeviceColumns+" FROM snmp_devices WHERE ip = ?", obs.IP)
+			d, err := scanSNMPDevice(row)
+			if err == sql.ErrNoRows {
+				d = SNMPDevice{IP: obs.IP, UptimeSeconds: -1}
+			} else if err != nil {
+				return err
+			}
+			dev = &d
+			devices[obs.IP] = dev
+		}
+		applySNMPObservation(dev, obs)
+
+		if obs.Trap != nil {
+			varbinds := ""
+			if len(obs.Trap.Varbinds) > 0 {
+				if b, err := json.Marshal(obs.Trap.Varbinds); err == nil {
+					varbinds = string(b)
+				}
+			}
+			_, err := tx.Exec(`INSERT INTO snmp_traps (timestamp, device_ip, oid, name, severity, message, varbinds, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				obs.Timestamp, obs.IP, obs.Trap.OID, obs.Trap.Name, obs.Trap.Severity, obs.Trap.Message, varbinds, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dev := range devices {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO snmp_devices (`+snmpDeviceColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			dev.IP, dev.Hostname, dev.SysObjectID, dev.SysDescr, dev.Type, dev.UptimeSeconds, dev.uptimeAt,
+			dev.FirstSeen.Unix(), dev.LastSeen.Unix(), ptrUnix(dev.LastPolled), ptrUnix(dev.LastTrap),
+			ptrUnix(dev.LastRestart), dev.RestartCount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSNMPInventory returns all known devices with derived status and type breakdowns
+func (bm *BufferManager) GetSNMPInventory(now time.Time) (*SNMPInventory, error) {
+	rows, err := bm.db.Query("SELECT " + snmpDeviceColumns + " FROM snmp_devices ORDER BY ip")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inv := &SNMPInventory{
+		Devices:     []SNMPDevice{},
+		Status:      map[string]int64{"online": 0, "warning": 0, "offline": 0},
+		Types:       map[string]int64{},
+		GeneratedAt: now.UTC(),
+	}
+	for _, t := range snmpDeviceTypes {
+		inv.Types[t] = 0
+	}
+
+	for rows.Next() {
+		dev, err := scanSNMPDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		deriveDeviceStatus(&dev, now)
+		inv.Devices = append(inv.Devices, dev)
+		inv.Status[dev.Status]++
+		inv.Types[dev.Type]++
+		if dev.LastPolled != nil {
+			inv.PolledCount++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	inv.Total = len(inv.Devices)
+
+	// Attach trap counts for the last 24h
+	since := now.Add(-24 * time.Hour).Unix()
+	counts := map[string]int64{}
+	crow, err := bm.db.Query("SELECT device_ip, COUNT(*) FROM snmp_traps WHERE timestamp >= ? GROUP BY device_ip", since)
+	if err != nil {
+		return nil, err
+	}
+	defer crow.Close()
+	for crow.Next() {
+		var ip string
+		var n int64
+		if err := crow.Scan(&ip, &n); err != nil {
+			return nil, err
+		}
+		counts[ip] = n
+		inv.Traps24h += n
+	}
+	for i := range inv.Devices {
+		inv.Devices[i].Traps24h = counts[inv.Devices[i].IP]
+	}
+
+	return inv, crow.Err()
+}
+
+// filter narrows the inventory to devices matching status and type, and
+// recomputes the totals and breakdowns from the devices that remain
+func (inv *SNMPInventory) filter(status, deviceType string) {
+	filtered := []SNMPDevice{}
+	for _, dev := range inv.Devices {
+		if (status == "" || dev.Status == status) && (deviceType == "" || dev.Type == deviceType) {
+			filtered = append(filtered, dev)
+		}
+	}
+
+	inv.Devices = filtered
+	inv.Total = len(filtered)
+	inv.PolledCount = 0
+	inv.Traps24h = 0
+	for k := range inv.Status {
+		inv.Status[k] = 0
+	}
+	for k := range inv.Types {
+		inv.Types[k] = 0
+	}
+	for _, dev := range filtered {
+		inv.Status[dev.Status]++
+		inv.Types[dev.Type]++
+		inv.Traps24h += dev.Traps24h
+		if dev.LastPolled != nil {
+			inv.PolledCount++
+		}
+	}
+}
+
+// GetSNMPDevice returns a single device, or nil when it is unknown
+func (bm *BufferManager) GetSNMPDevice(ip string, now time.Time) (*SNMPDevice, error) {
+	row := bm.db.QueryRow("SELECT "+snmpDeviceColumns+" FROM snmp_devices WHERE ip = ?", ip)
+	dev, err := scanSNMPDevice(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	deriveDeviceStatus(&dev, now)
+	return &dev, nil
+}
+
+// QuerySNMPTraps returns the trap timeline, newest first
+func (bm *BufferManager) QuerySNMPTraps(q SNMPTrapQuery) (*SNMPTrapResult, error) {
+	var conds []string
+	var args []interface{}
+	if q.Device != "" {
+		conds = append(conds, "device_ip = ?")
+		args = append(args, q.Device)
+	}
+	if q.Severity != "" {
+		conds = append(conds, "severity = ?")
+		args = append(args, q.Severity)
+	}
+	if q.Since > 0 {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conds = append(conds, "timestamp <= ?")
+		args = append(args, q.Until)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	result := &SNMPTrapResult{Limit: q.Limit, Offset: q.Offset, Traps: []SNMPTrap{}}
+	if err := bm.db.QueryRow("SELECT COUNT(*) FROM snmp_traps"+where, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	rows, err := bm.db.Query(`SELECT id, timestamp, device_ip, oid, name, severity, message, varbinds
+		FROM snmp_traps`+where+` ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t SNMPTrap
+		var ts int64
+		var varbinds string
+		if err := rows.Scan(&t.ID, &ts, &t.DeviceIP, &t.OID, &t.Name, &t.Severity, &t.Message, &varbinds); err != nil {
+			return nil, err
+		}
+		t.Timestamp = time.Unix(ts, 0).UTC()
+		if varbinds != "" {
+			_ = json.Unmarshal([]byte(varbinds), &t.Varbinds)
+		}
+		result.Traps = append(result.Traps, t)
+	}
+	return result, rows.Err()
+}
+
+// cleanupSNMPIndex removes expired traps and devices that have been silent past retention
+func (bm *BufferManager) cleanupSNMPIndex() (int64, error) {
+	retention := int64(bm.config.MaxRetentionDays * 24 * 60 * 60)
+	if cfg, ok := bm.config.Services["snmp_trap"]; ok && cfg.RetentionHours > 0 {
+		retention = int64(cfg.RetentionHours * 60 * 60)
+	}
+	cutoff := time.Now().Unix() - retention
+
+	result, err := bm.db.Exec("DELETE FROM snmp_traps WHERE timestamp < ?", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := result.RowsAffected()
+
+	result, err = bm.db.Exec("DELETE FROM snmp_devices WHERE last_seen < ?", cutoff)
+	if err != nil {
+		return removed, err
+	}
+	devices, _ := result.RowsAffected()
+	return removed + devices, nil
+}
+
+// parseSNMPTrapQuery builds an SNMPTrapQuery from request parameters
+func parseSNMPTrapQuery(r *http.Request) (SNMPTrapQuery, error) {
+	params := r.URL.Query()
+	q := SNMPTrapQuery{
+		Device:   strings.TrimSpace(params.Get("device")),
+		Severity: strings.ToLower(strings.TrimSpace(params.Get("severity"))),
+	}
+
+	var err error
+	if q.Since, err = parseTimeParam(params.Get("since")); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTimeParam(params.Get("until")); err != nil {
+		return q, err
+	}
+
+	q.Limit, q.Offset, err = parsePagination(params)
+	return q, err
+}
+
+// handleSNMPDevices serves the device inventory, optionally filtered by status or type
+func (bm *BufferManager) handleSNMPDevices(w http.ResponseWriter, r *http.Request) {
+	inv, err := bm.GetSNMPInventory(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Inventory query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	deviceType := r.URL.Query().Get("type")
+	if status != "" || deviceType != "" {
+		inv.filter(status, deviceType)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inv)
+}
+
+// handleSNMPTraps serves the trap timeline across all devices
+func (bm *BufferManager) handleSNMPTraps(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSNMPTrapQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := bm.QuerySNMPTraps(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Trap query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleSNMPDeviceTraps serves a single device together with its trap timeline
+func (bm *BufferManager) handleSNMPDeviceTraps(w http.ResponseWriter, r *http.Request) {
+	ip := mux.Vars(r)["ip"]
+	dev, err := bm.GetSNMPDevice(ip, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Device query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if dev == nil {
+		http.Error(w, fmt.Sprintf("Unknown SNMP device %q", ip), http.StatusNotFound)
+		return
+	}
+
+	q, err := parseSNMPTrapQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Device = ip
+
+	result, err := bm.QuerySNMPTraps(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Trap query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device": dev,
+		"traps":  result,
+	})
+}
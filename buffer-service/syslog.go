@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslogSeverities maps RFC 5424 severity codes to the names used by the UI
+var syslogSeverities = []string{"emergency", "alert", "critical", "error", "warning", "notice", "info", "debug"}
+
+// syslogSeverityAliases maps the short names emitted by parse_syslog to canonical names
+var syslogSeverityAliases = map[string]string{
+	"emerg":         "emergency",
+	"panic":         "emergency",
+	"crit":          "critical",
+	"err":           "error",
+	"warn":          "warning",
+	"informational": "info",
+}
+
+// SyslogEntry represents a syslog message indexed for search
+type SyslogEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Hostname  string    `json:"hostname"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	Facility  string    `json:"facility"`
+	Severity  string    `json:"severity"`
+	Program   string    `json:"program,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// SyslogQuery holds the filters accepted by the syslog search API
+type SyslogQuery struct {
+	Host       string
+	Severities []int
+	Facility   string
+	Program    string
+	Since      int64
+	Until      int64
+	Text       string
+	Limit      int
+	Offset     int
+}
+
+// HostCount represents a message count for a single host
+type HostCount struct {
+	Hostname string `json:"hostname"`
+	Count    int64  `json:"count"`
+}
+
+// SyslogSearchResult is the response of the syslog search API
+type SyslogSearchResult struct {
+	Total      int64            `json:"total"`
+	Limit      int              `json:"limit"`
+	Offset     int              `json:"offset"`
+	Entries    []SyslogEntry    `json:"entries"`
+	Levels     map[string]int64 `json:"levels"`
+	TopHosts   []HostCount      `json:"top_hosts"`
+	SearchMode string           `json:"search_mode"` // "fts5" or "like"
+}
+
+// severityCode resolves a severity name or numeric code to its RFC 5424 code
+func severityCode(v interface{}) (int, bool) {
+	switch t := v.(type) {
+	case float64:
+		if t >= 0 && int(t) < len(syslogSeverities) {
+			return int(t), true
+		}
+	case string:
+		s := strings.ToLower(strings.TrimSpace(t))
+		if n, err := strconv.Atoi(s); err == nil {
+			return severityCode(float64(n))
+		}
+		if alias, ok := syslogSeverityAliases[s]; ok {
+			s = alias
+		}
+		for i, name := range syslogSeverities {
+			if name == s {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// severityName returns the canonical name for a severity code
+func severityName(code int) string {
+	if code >= 0 && code < len(syslogSeverities) {
+		return syslogSeverities[code]
+	}
+	return "unknown"
+}
+
+// createSyslogTables creates the syslog index and, when available, its FTS5 companion
+func (bm *BufferManager) createSyslogTables() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS syslog_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		host TEXT NOT NULL DEFAULT '',
+		source_ip TEXT NOT NULL DEFAULT '',
+		facility TEXT NOT NULL DEFAULT '',
+		severity INTEGER NOT NULL,
+		program TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_syslog_timestamp ON syslog_messages(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_syslog_host ON syslog_messages(host);
+	CREATE INDEX IF NOT EXISTS idx_syslog_severity ON syslog_messages(severity);
+	`
+	if _, err := bm.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag;
+	// fall back to LIKE matching when the module is missing.
+	fts := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS syslog_fts USING fts5(
+		message, content='syslog_messages', content_rowid='id'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS syslog_fts_insert AFTER INSERT ON syslog_messages BEGIN
+		INSERT INTO syslog_fts(rowid, message) VALUES (new.id, new.message);
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS syslog_fts_delete AFTER DELETE ON syslog_messages BEGIN
+		INSERT INTO syslog_fts(syslog_fts, rowid, message) VALUES ('delete', old.id, old.message);
+	END;
+	`
+	if _, err := bm.db.Exec(fts); err != nil {
+		logger.WithError(err).Warn("SQLite FTS5 unavailable, syslog search will use LIKE matching")
+		bm.syslogFTS = false
+		return nil
+	}
+	bm.syslogFTS = true
+	return nil
+}
+
+// isSyslogEvent reports whether an event without a source_type carries the
+// facility and severity fields that Vector's parse_syslog produces
+func isSyslogEvent(event map[string]interface{}) bool {
+	_, hasFacility := event["facility"]
+	_, hasSeverity := event["severity"]
+	return hasFacility && hasSeverity
+}
+
+// syslogEntryFromEvent extracts a SyslogEntry from a Vector syslog event
+func syslogEntryFromEvent(event map[string]interface{}, timestamp int64, sourceIP string) SyslogEntry {
+	str := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := event[k].(string); ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	entry := SyslogEntry{
+		Timestamp: time.Unix(timestamp, 0).UTC(),
+		Hostname:  str("hostname", "device_hostname", "host"),
+		SourceIP:  sourceIP,
+		Program:   str("appname", "program", "app_name"),
+		Message:   str("message", "msg"),
+		Severity:  "info",
+	}
+
+	if code, ok := severityCode(event["severity"]); ok {
+		entry.Severity = severityName(code)
+	} else if code, ok := severityCode(event["severity_name"]); ok {
+		entry.Severity = severityName(code)
+	}
+
+	switch f := event["facility"].(type) {
+	case string:
+		entry.Facility = f
+	case float64:
+		entry.Facility = strconv.Itoa(int(f))
+	}
+
+	if entry.Hostname == "" {
+		entry.Hostname = sourceIP
+	}
+	return entry
+}
+
+// indexSyslogEntries stores syslog entries in the searchable index
+func (bm *BufferManager) indexSyslogEntries(entries []SyslogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := bm.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO syslog_messages
+		(timestamp, host, source_ip, facility, severity, program, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().Unix()
+	for _, e := range entries {
+		code, _ := severityCode(e.Severity)
+		if _, err := stmt.Exec(e.Timestamp.Unix(), e.Hostname, e.SourceIP, e.Facility,
+			code, e.Program, e.Message, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// cleanupSyslogIndex removes indexed syslog messages past their retention
+func (bm *BufferManager) cleanupSyslogIndex() (int64, error) {
+	retention := int64(bm.config.MaxRetentionDays * 24 * 60 * 60)
+	if cfg, ok := bm.config.Services["syslog"]; ok && cfg.RetentionHours > 0 {
+		retention = int64(cfg.RetentionHours * 60 * 60)
+	}
+
+	result, err := bm.db.Exec("DELETE FROM syslog_messages WHERE timestamp < ?", time.Now().Unix()-retention)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ftsMatchExpr turns free text into an FTS5 query that matches every term literally
+func ftsMatchExpr(text string) string {
+	terms := strings.Fields(text)
+	quoted := make([]string, 0, len(terms))
+	for _, t := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// likePattern escapes a term for use in a LIKE expression with ESCAPE '\'
+func likePattern(term string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(term) + "%"
+}
+
+// syslogWhere builds the WHERE clause shared by the search and aggregate queries
+func (bm *BufferManager) syslogWhere(q SyslogQuery) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+
+	if q.Host != "" {
+		clauses = append(clauses, "(host = ? OR source_ip = ?)")
+		args = append(args, q.Host, q.Host)
+	}
+	if len(q.Severities) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(q.Severities)), ",")
+		clauses = append(clauses, "severity IN ("+placeholders+")")
+		for _, s := range q.Severities {
+			args = append(args, s)
+		}
+	}
+	if q.Facility != "" {
+		clauses = append(clauses, "facility = ?")
+		args = append(args, q.Facility)
+	}
+	if q.Program != "" {
+		clauses = append(clauses, "program = ?")
+		args = append(args, q.Program)
+	}
+	if q.Since > 0 {
+		clauses = append(clauses, "timestamp >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		clauses = append(clauses, "timestamp <= ?")
+		args = append(args, q.Until)
+	}
+	if strings.TrimSpace(q.Text) != "" {
+		if bm.syslogFTS {
+			clauses = append(clauses, "id IN (SELECT rowid FROM syslog_fts WHERE syslog_fts MATCH ?)")
+			args = append(args, ftsMatchExpr(q.Text))
+		} else {
+			for _, term := range strings.Fields(q.Text) {
+				clauses = append(clauses, `message LIKE ? ESCAPE '\'`)
+				args = append(args, likePattern(term))
+			}
+		}
+	}
+
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// SearchSyslog returns a page of matching syslog messages with aggregates over all matches
+func (bm *BufferManager) SearchSyslog(q SyslogQuery) (*SyslogSearchResult, error) {
+	where, args := bm.syslogWhere(q)
+
+	result := &SyslogSearchResult{
+		Limit:      q.Limit,
+		Offset:     q.Offset,
+		Entries:    make([]SyslogEntry, 0),
+		Levels:     make(map[string]int64),
+		TopHosts:   make([]HostCount, 0),
+		SearchMode: "like",
+	}
+	if bm.syslogFTS {
+		result.SearchMode = "fts5"
+	}
+	for _, name := range syslogSeverities {
+		result.Levels[name] = 0
+	}
+
+	// Level distribution also yields the total match count
+	rows, err := bm.db.Query("SELECT severity, COUNT(*) FROM syslog_messages"+where+" GROUP BY severity", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate levels: %v", err)
+	}
+	for rows.Next() {
+		var code int
+		var count int64
+		if err := rows.Scan(&code, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Levels[severityName(code)] += count
+		result.Total += count
+	}
+	rows.Close()
+
+	rows, err = bm.db.Query("SELECT host, COUNT(*) AS c FROM syslog_messages"+where+
+		" GROUP BY host ORDER BY c DESC, host ASC LIMIT 10", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate hosts: %v", err)
+	}
+	for rows.Next() {
+		var hc HostCount
+		if err := rows.Scan(&hc.Hostname, &hc.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.TopHosts = append(result.TopHosts, hc)
+	}
+	rows.Close()
+
+	pageArgs := append(append([]interface{}{}, args...), q.Limit, q.Offset)
+	rows, err = bm.db.Query(`
+		SELECT id, timestamp, host, source_ip, facility, severity, program, message
+		FROM syslog_messages`+where+`
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?`, pageArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e SyslogEntry
+		var ts int64
+		var code int
+		if err := rows.Scan(&e.ID, &ts, &e.Hostname, &e.SourceIP, &e.Facility, &code, &e.Program, &e.Message); err != nil {
+			return nil, err
+		}
+		e.Timestamp = time.Unix(ts, 0).UTC()
+		e.Severity = severityName(code)
+		result.Entries = append(result.Entries, e)
+	}
+
+	return result, rows.Err()
+}
+
+// parseTimeParam accepts RFC3339 timestamps or unix seconds
+func parseTimeParam(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: use RFC3339 or unix seconds", v)
+	}
+	return t.Unix(), nil
+}
+
+// parseSyslogQuery builds a SyslogQuery from request parameters
+func parseSyslogQuery(r *http.Request) (SyslogQuery, error) {
+	params := r.URL.Query()
+	q := SyslogQuery{
+		Host:     strings.TrimSpace(params.Get("host")),
+		Facility: strings.TrimSpace(params.Get("facility")),
+		Program:  strings.TrimSpace(params.Get("program")),
+		Text:     params.Get("q"),
+	}
+
+	if v := params.Get("severity"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			code, ok := severityCode(s)
+			if !ok {
+				return q, fmt.Errorf("invalid severity %q", s)
+			}
+			q.Severities = append(q.Severities, code)
+		}
+	}
+
+	var err error
+	if q.Since, err = parseTimeParam(params.Get("since")); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTimeParam(params.Get("until")); err != nil {
+		return q, err
+	}
+
+	q.Limit, q.Offset, err = parsePagination(params)
+	return q, err
+}
+
+// parsePagination reads limit (default 50, max 500) and offset from request parameters
+func parsePagination(params url.Values) (limit, offset int, err error) {
+	limit = 50
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid limit %q", v)
+		}
+		limit = n
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", v)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// handleSyslogSearch serves filtered, paginated syslog search results
+func (bm *BufferManager) handleSyslogSearch(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSyslogQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := bm.SearchSyslog(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// windowsLevels maps Windows event Level values to the names used by the UI.
+// Level 0 (LogAlways) is what most Security audit events carry, so it is
+// reported as information rather than verbose.
+var windowsLevels = map[int]string{
+	0: "information",
+	1: "critical",
+	2: "error",
+	3: "warning",
+	4: "information",
+	5: "verbose",
+}
+
+var windowsLevelNames = []string{"critical", "error", "warning", "information", "verbose"}
+
+// WindowsEvent represents a Windows event indexed for analytics
+type WindowsEvent struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Computer  string    `json:"computer"`
+	Channel   string    `json:"channel"`
+	Provider  string    `json:"provider,omitempty"`
+	EventID   int       `json:"event_id"`
+	Level     string    `json:"level"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// WindowsQuery holds the filters accepted by the Windows events API
+type WindowsQuery struct {
+	Channel  string
+	Levels   []string
+	Computer string
+	Provider string
+	EventID  int
+	Since    int64
+	Until    int64
+	Limit    int
+	Offset   int
+}
+
+// NamedCount is a count for a single aggregated value
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// EventIDCount is a count for a single event ID and provider pair
+type EventIDCount struct {
+	EventID  int    `json:"event_id"`
+	Provider string `json:"provider,omitempty"`
+	Count    int64  `json:"count"`
+}
+
+// WindowsEventsResult is the response of the Windows events API
+type WindowsEventsResult struct {
+	Total        int64            `json:"total"`
+	Limit        int              `json:"limit"`
+	Offset       int              `json:"offset"`
+	Events       []WindowsEvent   `json:"events"`
+	Levels       map[string]int64 `json:"levels"`
+	Channels     map[string]int64 `json:"channels"`
+	TopEventIDs  []EventIDCount   `json:"top_event_ids"`
+	TopProviders []NamedCount     `json:"top_providers"`
+	TopComputers []NamedCount     `json:"top_computers"`
+}
+
+// windowsLevelName resolves a numeric or textual Level to its canonical name
+func windowsLevelName(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case float64:
+		name, ok := windowsLevels[int(t)]
+		return name, ok
+	case string:
+		s := strings.ToLower(strings.TrimSpace(t))
+		if n, err := strconv.Atoi(s); err == nil {
+			return windowsLevelName(float64(n))
+		}
+		switch s {
+		case "info", "informational":
+			return "information", true
+		case "err":
+			return "error", true
+		case "warn":
+			return "warning", true
+		}
+		for _, name := range windowsLevelNames {
+			if name == s {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// windowsEventFromEvent extracts a WindowsEvent from an ingested record. Telegraf
+// metrics share the :8084 endpoint with event forwarders, so events without an
+// EventID are not Windows events and are skipped.
+func windowsEventFromEvent(event map[string]interface{}, timestamp int64, sourceIP string) (WindowsEvent, bool) {
+	str := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := event[k].(string); ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	var eventID int
+	found := false
+	for _, k := range []string{"event_id", "EventID", "EventId"} {
+		switch v := event[k].(type) {
+		case float64:
+			eventID, found = int(v), true
+		case string:
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				eventID, found = n, true
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return WindowsEvent{}, false
+	}
+
+	ev := WindowsEvent{
+		Timestamp: time.Unix(timestamp, 0).UTC(),
+		Computer:  str("computer", "Computer", "Hostname", "hostname"),
+		Channel:   str("channel", "Channel"),
+		Provider:  str("ProviderName", "provider_name", "Provider", "SourceName", "source_name"),
+		EventID:   eventID,
+		Level:     "information",
+		SourceIP:  sourceIP,
+		Message:   str("Message", "message", "description"),
+	}
+
+	for _, k := range []string{"level", "Level", "severity_name", "LevelText"} {
+		if name, ok := windowsLevelName(event[k]); ok {
+			ev.Level = name
+			break
+		}
+	}
+
+	// Prefer the time the event was generated over the time it reached us
+	if t := str("TimeCreated", "EventTime", "time_created"); t != "" {
+		if parsed, err := time.Parse(time.RFC3339Nano, t); err == nil {
+			ev.Timestamp = parsed.UTC()
+		}
+	}
+
+	if ev.Computer == "" {
+		ev.Computer = sourceIP
+	}
+	return ev, true
+}
+
+// createWindowsTables creates the Windows event index
+func (bm *BufferManager) createWindowsTables() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS windows_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		computer TEXT NOT NULL DEFAULT '',
+		channel TEXT NOT NULL DEFAULT '',
+		provider TEXT NOT NULL DEFAULT '',
+		event_id INTEGER NOT NULL,
+		level TEXT NOT NULL,
+		source_ip TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_windows_timestamp ON windows_events(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_windows_channel ON windows_events(channel);
+	CREATE INDEX IF NOT EXISTS idx_windows_computer ON windows_events(computer);
+	`
+	_, err := bm.db.Exec(schema)
+	return err
+}
+
+// indexWindowsEvents stores extracted Windows events in the analytics index
+func (bm *BufferManager) indexWindowsEvents(events []WindowsEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := bm.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO windows_events
+		(timestamp, computer, channel, provider, event_id, level, source_ip, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().Unix()
+	for _, e := range events {
+		if _, err := stmt.Exec(e.Timestamp.Unix(), e.Computer, e.Channel, e.Provider,
+			e.EventID, e.Level, e.SourceIP, e.Message, now); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// cleanupWindowsIndex removes indexed events older than the windows_events retention
+func (bm *BufferManager) cleanupWindowsIndex() (int64, error) {
+	retention := int64(bm.config.MaxRetentionDays * 24 * 60 * 60)
+	if cfg, ok := bm.config.Services["windows_events"]; ok && cfg.RetentionHours > 0 {
+		retention = int64(cfg.RetentionHours * 60 * 60)
+	}
+
+	result, err := bm.db.Exec("DELETE FROM windows_events WHERE timestamp < ?", time.Now().Unix()-retention)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// windowsWhere builds the WHERE clause shared by the page and aggregate queries
+func windowsWhere(q WindowsQuery) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	if q.Channel != "" {
+		conds = append(conds, "channel = ? COLLATE NOCASE")
+		args = append(args, q.Channel)
+	}
+	if len(q.Levels) > 0 {
+		conds = append(conds, "level IN (?"+strings.Repeat(",?", len(q.Levels)-1)+")")
+		for _, l := range q.Levels {
+			args = append(args, l)
+		}
+	}
+	if q.Computer != "" {
+		conds = append(conds, "computer = ? COLLATE NOCASE")
+		args = append(args, q.Computer)
+	}
+	if q.Provider != "" {
+		conds = append(conds, "provider = ? COLLATE NOCASE")
+		args = append(args, q.Provider)
+	}
+	if q.EventID > 0 {
+		conds = append(conds, "event_id = ?")
+		args = append(args, q.EventID)
+	}
+	if q.Since > 0 {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, q.Since)
+	}
+	if q.Until > 0 {
+		conds = append(conds, "timestamp <= ?")
+		args = append(args, q.Until)
+	}
+
+	if len(conds) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// topNamed runs a GROUP BY over column and returns the ten largest groups
+func (bm *BufferManager) topNamed(column, where string, args []interface{}) ([]NamedCount, error) {
+	rows, err := bm.db.Query("SELECT "+column+", COUNT(*) AS c FROM windows_events"+where+
+		" GROUP BY "+column+" ORDER BY c DESC, "+column+" ASC LIMIT 10", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate %s: %v", column, err)
+	}
+	defer rows.Close()
+
+	out := make([]NamedCount, 0)
+	for rows.Next() {
+		var nc NamedCount
+		if err := rows.Scan(&nc.Name, &nc.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, nc)
+	}
+	return out, rows.Err()
+}
+
+// QueryWindowsEvents returns filtered Windows events with level, channel, event ID,
+// provider and computer breakdowns over the whole match set
+func (bm *BufferManager) QueryWindowsEvents(q WindowsQuery) (*WindowsEventsResult, error) {
+	where, args := windowsWhere(q)
+
+	result := &WindowsEventsResult{
+		Limit:    q.Limit,
+		Offset:   q.Offset,
+		Events:   make([]WindowsEvent, 0),
+		Levels:   make(map[string]int64),
+		Channels: make(map[string]int64),
+	}
+	for _, name := range windowsLevelNames {
+		result.Levels[name] = 0
+	}
+
+	// Level distribution also yields the total match count
+	rows, err := bm.db.Query("SELECT level, COUNT(*) FROM windows_events"+where+" GROUP BY level", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate levels: %v", err)
+	}
+	for rows.Next() {
+		var level string
+		var count int64
+		if err := rows.Scan(&level, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Levels[level] += count
+		result.Total += count
+	}
+	rows.Close()
+
+	rows, err = bm.db.Query("SELECT channel, COUNT(*) FROM windows_events"+where+" GROUP BY channel", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate channels: %v", err)
+	}
+	for rows.Next() {
+		var channel string
+		var count int64
+		if err := rows.Scan(&channel, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.Channels[channel] = count
+	}
+	rows.Close()
+
+	rows, err = bm.db.Query("SELECT event_id, provider, COUNT(*) AS c FROM windows_events"+where+
+		" GROUP BY event_id, provider ORDER BY c DESC, event_id ASC LIMIT 10", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate event IDs: %v", err)
+	}
+	result.TopEventIDs = make([]EventIDCount, 0)
+	for rows.Next() {
+		var ec EventIDCount
+		if err := rows.Scan(&ec.EventID, &ec.Provider, &ec.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		result.TopEventIDs = append(result.TopEventIDs, ec)
+	}
+	rows.Close()
+
+	if result.TopProviders, err = bm.topNamed("provider", where, args); err != nil {
+		return nil, err
+	}
+	if result.TopComputers, err = bm.topNamed("computer", where, args); err != nil {
+		return nil, err
+	}
+
+	pageArgs := append(append([]interface{}{}, args...), q.Limit, q.Offset)
+	rows, err = bm.db.Query(`
+		SELECT id, timestamp, computer, channel, provider, event_id, level, source_ip, message
+		FROM windows_events`+where+`
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ? OFFSET ?`, pageArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e WindowsEvent
+		var ts int64
+		if err := rows.Scan(&e.ID, &ts, &e.Computer, &e.Channel, &e.Provider, &e.EventID,
+			&e.Level, &e.SourceIP, &e.Message); err != nil {
+			return nil, err
+		}
+		e.Timestamp = time.Unix(ts, 0).UTC()
+		result.Events = append(result.Events, e)
+	}
+
+	return result, rows.Err()
+}
+
+// parseWindowsQuery builds a WindowsQuery from request parameters
+func parseWindowsQuery(r *http.Request) (WindowsQuery, error) {
+	params := r.URL.Query()
+	q := WindowsQuery{
+		Channel:  strings.TrimSpace(params.Get("channel")),
+		Computer: strings.TrimSpace(params.Get("computer")),
+		Provider: strings.TrimSpace(params.Get("provider")),
+	}
+
+	if v := params.Get("level"); v != "" {
+		for _, l := range strings.Split(v, ",") {
+			name, ok := windowsLevelName(l)
+			if !ok {
+				return q, fmt.Errorf("invalid level %q", l)
+			}
+			q.Levels = append(q.Levels, name)
+		}
+	}
+	if v := params.Get("event_id"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return q, fmt.Errorf("invalid event_id %q", v)
+		}
+		q.EventID = n
+	}
+
+	var err error
+	if q.Since, err = parseTimeParam(params.Get("since")); err != nil {
+		return q, err
+	}
+	if q.Until, err = parseTimeParam(params.Get("until")); err != nil {
+		return q, err
+	}
+
+	q.Limit, q.Offset, err = parsePagination(params)
+	return q, err
+}
+
+// handleWindowsEvents serves filtered Windows events and their aggregates
+func (bm *BufferManager) handleWindowsEvents(w http.ResponseWriter, r *http.Request) {
+	q, err := parseWindowsQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := bm.QueryWindowsEvents(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// bufferServiceURL is the base URL of the local buffer-service API
+	bufferServiceURL = envDefault("NOC_RAVEN_BUFFER_URL", "http://127.0.0.1:5005")
+
+	bufferHTTPClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// bufferSyslogEntry mirrors buffer-service's SyslogEntry
+type bufferSyslogEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Hostname  string    `json:"hostname"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	Facility  string    `json:"facility"`
+	Severity  string    `json:"severity"`
+	Program   string    `json:"program,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// bufferHostCount mirrors buffer-service's HostCount
+type bufferHostCount struct {
+	Hostname string `json:"hostname"`
+	Count    int64  `json:"count"`
+}
+
+// bufferSyslogSearch mirrors buffer-service's SyslogSearchResult
+type bufferSyslogSearch struct {
+	Total      int64               `json:"total"`
+	Limit      int                 `json:"limit"`
+	Offset     int                 `json:"offset"`
+	Entries    []bufferSyslogEntry `json:"entries"`
+	Levels     map[string]int64    `json:"levels"`
+	TopHosts   []bufferHostCount   `json:"top_hosts"`
+	SearchMode string              `json:"search_mode"`
+}
+
+// bufferStatusError is returned when buffer-service answers with a non-2xx status
+type bufferStatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *bufferStatusError) Error() string {
+	return fmt.Sprintf("buffer-service returned HTTP %d: %s", e.Status, e.Message)
+}
+
+// fetchBufferJSON performs a GET against buffer-service and decodes the JSON response into out
+func fetchBufferJSON(path string, query url.Values, out any) error {
+	u := strings.TrimRight(bufferServiceURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	resp, err := bufferHTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &bufferStatusError{Status: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// copyQuery returns the subset of params listed in keys
+func copyQuery(params url.Values, keys ...string) url.Values {
+	out := url.Values{}
+	for _, k := range keys {
+		if v := params.Get(k); v != "" {
+			out.Set(k, v)
+		}
+	}
+	return out
+}
+
+// writeBufferError reports a failed buffer-service call to the client
+func writeBufferError(w http.ResponseWriter, err error) {
+	status := http.StatusServiceUnavailable
+	msg := fmt.Sprintf("buffer service unavailable: %v", err)
+	if se, ok := err.(*bufferStatusError); ok && se.Status == http.StatusBadRequest {
+		status = http.StatusBadRequest
+		msg = se.Message
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "message": msg})
+}
+
+// bufferSNMPDevice mirrors buffer-service's SNMPDevice
+type bufferSNMPDevice struct {
+	IP            string     `json:"ip"`
+	Hostname      string     `json:"hostname,omitempty"`
+	SysObjectID   string     `json:"sys_object_id,omitempty"`
+	SysDescr      string     `json:"sys_descr,omitempty"`
+	Type          string     `json:"type"`
+	Status        string     `json:"status"`
+	StatusReason  string     `json:"status_reason,omitempty"`
+	UptimeSeconds int64      `json:"uptime_seconds"`
+	FirstSeen     time.Time  `json:"first_seen"`
+	LastSeen      time.Time  `json:"last_seen"`
+	LastPolled    *time.Time `json:"last_polled,omitempty"`
+	LastTrap      *time.Time `json:"last_trap,omitempty"`
+	LastRestart   *time.Time `json:"last_restart,omitempty"`
+	RestartCount  int64      `json:"restart_count"`
+	Traps24h      int64      `json:"traps_24h"`
+}
+
+// bufferSNMPInventory mirrors buffer-service's SNMPInventory
+type bufferSNMPInventory struct {
+	Total       int                `json:"total"`
+	Devices     []bufferSNMPDevice `json:"devices"`
+	Status      map[string]int64   `json:"status"`
+	Types       map[string]int64   `json:"types"`
+	Traps24h    int64              `json:"traps_24h"`
+	PolledCount int64              `json:"polled_devices"`
+}
+
+// bufferSNMPTrap mirrors buffer-service's SNMPTrap
+type bufferSNMPTrap struct {
+	ID        int64          `json:"id"`
+	Timestamp time.Time      `json:"timestamp"`
+	DeviceIP  string         `json:"device_ip"`
+	OID       string         `json:"oid,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	Severity  string         `json:"severity"`
+	Message   string         `json:"message,omitempty"`
+	Varbinds  map[string]any `json:"varbinds,omitempty"`
+}
+
+// bufferSNMPTraps mirrors buffer-service's SNMPTrapResult
+type bufferSNMPTraps struct {
+	Total  int64            `json:"total"`
+	Limit  int              `json:"limit"`
+	Offset int              `json:"offset"`
+	Traps  []bufferSNMPTrap `json:"traps"`
+}
+
+// bufferWindowsEvent mirrors buffer-service's WindowsEvent
+type bufferWindowsEvent struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Computer  string    `json:"computer"`
+	Channel   string    `json:"channel"`
+	Provider  string    `json:"provider,omitempty"`
+	EventID   int       `json:"event_id"`
+	Level     string    `json:"level"`
+	SourceIP  string    `json:"source_ip,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// bufferNamedCount mirrors buffer-service's NamedCount
+type bufferNamedCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// bufferEventIDCount mirrors buffer-service's EventIDCount
+type bufferEventIDCount struct {
+	EventID  int    `json:"event_id"`
+	Provider string `json:"provider,omitempty"`
+	Count    int64  `json:"count"`
+}
+
+// bufferWindowsEvents mirrors buffer-service's WindowsEventsResult
+type bufferWindowsEvents struct {
+	Total        int64                `json:"total"`
+	Limit        int                  `json:"limit"`
+	Offset       int                  `json:"offset"`
+	Events       []bufferWindowsEvent `json:"events"`
+	Levels       map[string]int64     `json:"levels"`
+	Channels     map[string]int64     `json:"channels"`
+	TopEventIDs  []bufferEventIDCount `json:"top_event_ids"`
+	TopProviders []bufferNamedCount   `json:"top_providers"`
+	TopComputers []bufferNamedCount   `json:"top_computers"`
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// bufferVPNStatus mirrors buffer-service's VPNStatus
+type bufferVPNStatus struct {
+	Connected    bool      `json:"connected"`
+	LastCheck    time.Time `json:"last_check"`
+	Latency      int       `json:"latency_ms"`
+	FailureCount int       `json:"failure_count"`
+	LastError    string    `json:"last_error,omitempty"`
+}
+
+// bufferServiceStats mirrors buffer-service's BufferStats
+type bufferServiceStats struct {
+	Service       string `json:"service"`
+	TotalRecords  int64  `json:"total_records"`
+	TotalSize     int64  `json:"total_size"`
+	OldestRecord  int64  `json:"oldest_record"`
+	NewestRecord  int64  `json:"newest_record"`
+	Forwarded     int64  `json:"forwarded"`
+	Pending       int64  `json:"pending"`
+	OldestPending int64  `json:"oldest_pending"`
+}
+
+// bufferCounters mirrors buffer-service's BufferCounters
+type bufferCounters struct {
+	StartedAt        int64 `json:"started_at"`
+	IngestedRecords  int64 `json:"ingested_records"`
+	IngestedBytes    int64 `json:"ingested_bytes"`
+	ForwardedRecords int64 `json:"forwarded_records"`
+	ForwardedBytes   int64 `json:"forwarded_bytes"`
+	ForwardFailures  int64 `json:"forward_failures"`
+	DroppedRecords   int64 `json:"dropped_records"`
+	Errors           int64 `json:"errors"`
+	LastForwardAt    int64 `json:"last_forward_at"`
+}
+
+// bufferStatus mirrors the response of buffer-service /api/buffer/status
+type bufferStatus struct {
+	Enabled         bool                          `json:"enabled"`
+	Compression     bool                          `json:"compression"`
+	VPNFailover     bool                          `json:"vpn_failover"`
+	Forwarding      bool                          `json:"forwarding"`
+	BufferSizeMB    int                           `json:"buffer_size_mb"`
+	MaxBufferSizeMB int                           `json:"max_buffer_size_mb"`
+	BufferUsagePct  float64                       `json:"buffer_usage_pct"`
+	VPNStatus       bufferVPNStatus               `json:"vpn_status"`
+	ForwardingURL   string                        `json:"forwarding_url"`
+	ForwardQueue    int                           `json:"forward_queue"`
+	ForwardQueueCap int                           `json:"forward_queue_cap"`
+	Counters        bufferCounters                `json:"counters"`
+	Services        map[string]bufferServiceStats `json:"services"`
+	UpdatedAt       int64                         `json:"updated_at"`
+}
+
+// bufferStats mirrors the response of buffer-service /api/buffer/stats
+type bufferStats struct {
+	BufferSizeMB       int              `json:"buffer_size_mb"`
+	MaxBufferSizeMB    int              `json:"max_buffer_size_mb"`
+	UsagePercentage    float64          `json:"usage_percentage"`
+	TotalRecords       int64            `json:"total_records"`
+	OldestRecord       int64            `json:"oldest_record"`
+	NewestRecord       int64            `json:"newest_record"`
+	RetentionDays      int              `json:"retention_days"`
+	CompressionEnabled bool             `json:"compression_enabled"`
+	OverflowAction     string           `json:"overflow_action"`
+	ServiceRecords     map[string]int64 `json:"service_records"`
+	Counters           bufferCounters   `json:"counters"`
+	Timestamp          int64            `json:"timestamp"`
+}
+
+// throughputWindow is how far back rates are averaged over
+const throughputWindow = time.Minute
+
+// throughputRates are per-second rates derived from two counter samples
+type throughputRates struct {
+	Available       bool
+	Window          time.Duration
+	InPerSec        float64
+	OutPerSec       float64
+	BytesInPerSec   float64
+	BytesOutPerSec  float64
+	Ingested        int64 // deltas over Window
+	Dropped         int64
+	Errors          int64
+	ForwardFailures int64
+}
+
+type counterSample struct {
+	at       time.Time
+	counters bufferCounters
+}
+
+// throughputSampler keeps recent counter samples from buffer-service to derive rates
+type throughputSampler struct {
+	mu      sync.Mutex
+	samples []counterSample
+}
+
+var bufferThroughput = &throughputSampler{}
+
+// observe records a sample and returns rates over the sampling window
+func (s *throughputSampler) observe(now time.Time, c bufferCounters) throughputRates {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A restarted buffer-service starts its counters again from zero
+	if n := len(s.samples); n > 0 {
+		last := s.samples[n-1].counters
+		if c.StartedAt != last.StartedAt || c.IngestedRecords < last.IngestedRecords {
+			s.samples = nil
+		}
+	}
+	s.samples = append(s.samples, counterSample{at: now, counters: c})
+
+	// Drop samples that fell out of the window, keeping the newest one before it as the base
+	for len(s.samples) > 1 && now.Sub(s.samples[1].at) >= throughputWindow {
+		s.samples = s.samples[1:]
+	}
+
+	base := s.samples[0]
+	dt := now.Sub(base.at)
+	if dt < time.Second {
+		return throughputRates{}
+	}
+
+	secs := dt.Seconds()
+	b := base.counters
+	return throughputRates{
+		Available:       true,
+		Window:          dt,
+		InPerSec:        float64(c.IngestedRecords-b.IngestedRecords) / secs,
+		OutPerSec:       float64(c.ForwardedRecords-b.ForwardedRecords) / secs,
+		BytesInPerSec:   float64(c.IngestedBytes-b.IngestedBytes) / secs,
+		BytesOutPerSec:  float64(c.ForwardedBytes-b.ForwardedBytes) / secs,
+		Ingested:        c.IngestedRecords - b.IngestedRecords,
+		Dropped:         c.DroppedRecords - b.DroppedRecords,
+		Errors:          c.Errors - b.Errors,
+		ForwardFailures: c.ForwardFailures - b.ForwardFailures,
+	}
+}
+
+// healthFactor explains a deduction from the buffer health score
+type healthFactor struct {
+	Factor  string `json:"factor"`
+	Penalty int    `json:"penalty"`
+	Detail  string `json:"detail"`
+}
+
+// forwardingLag returns the age of the oldest record still waiting to be forwarded
+func forwardingLag(st bufferStatus, now time.Time) time.Duration {
+	var oldest int64
+	for _, svc := range st.Services {
+		if svc.Pending > 0 && svc.OldestPending > 0 && (oldest == 0 || svc.OldestPending < oldest) {
+			oldest = svc.OldestPending
+		}
+	}
+	if oldest == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(oldest, 0))
+}
+
+// computeBufferHealth derives a 0-100 score from backlog, drops, errors and forwarding lag
+func computeBufferHealth(st bufferStatus, rates throughputRates, now time.Time) (int, []healthFactor) {
+	factors := []healthFactor{}
+	add := func(factor string, penalty int, detail string) {
+		factors = append(factors, healthFactor{Factor: factor, Penalty: penalty, Detail: detail})
+	}
+
+	// Backlog: start deducting once the buffer is half full, up to 40 points when full
+	if st.BufferUsagePct > 50 {
+		penalty := int(math.Min(40, (st.BufferUsagePct-50)*0.8))
+		add("backlog", penalty, fmt.Sprintf("buffer %.0f%% full", st.BufferUsagePct))
+	}
+
+	if st.Forwarding {
+		lag := forwardingLag(st, now)
+		switch {
+		case lag > 6*time.Hour:
+			add("forwarding_lag", 40, fmt.Sprintf("oldest pending record is %s old", lag.Truncate(time.Minute)))
+		case lag > time.Hour:
+			add("forwarding_lag", 25, fmt.Sprintf("oldest pending record is %s old", lag.Truncate(time.Minute)))
+		case lag > 5*time.Minute:
+			add("forwarding_lag", 10, fmt.Sprintf("oldest pending record is %s old", lag.Truncate(time.Second)))
+		}
+		if !st.VPNStatus.Connected {
+			add("forwarding_endpoint", 15, "forwarding endpoint unreachable")
+		}
+	}
+
+	if rates.Available && rates.Dropped > 0 {
+		add("drops", 25, fmt.Sprintf("%d records dropped in the last %s", rates.Dropped, rates.Window.Truncate(time.Second)))
+	} else if st.Counters.DroppedRecords > 0 {
+		add("drops", 5, fmt.Sprintf("%d records dropped since buffer-service start", st.Counters.DroppedRecords))
+	}
+
+	if rates.Available && rates.Errors > 0 {
+		penalty := 5
+		if rates.Ingested == 0 || float64(rates.Errors)/float64(rates.Ingested+rates.Errors) > 0.01 {
+			penalty = 15
+		}
+		add("errors", penalty, fmt.Sprintf("%d ingest/store errors in the last %s", rates.Errors, rates.Window.Truncate(time.Second)))
+	}
+
+	if rates.Available && rates.ForwardFailures > 0 {
+		add("forward_failures", 10, fmt.Sprintf("%d forward attempts failed in the last %s", rates.ForwardFailures, rates.Window.Truncate(time.Second)))
+	}
+
+	score := 100
+	for _, f := range factors {
+		score -= f.Penalty
+	}
+	if score < 0 {
+		score = 0
+	}
+	return score, factors
+}
+
+// bufferMeter mirrors buffer-service's MeterSnapshot
+type bufferMeter struct {
+	Count    int64   `json:"count"`
+	Rate1m   float64 `json:"rate_1m"`
+	Rate5m   float64 `json:"rate_5m"`
+	Rate15m  float64 `json:"rate_15m"`
+	MeanRate float64 `json:"mean_rate"`
+}
+
+// bufferMeters mirrors the response of buffer-service /api/buffer/meters
+type bufferMeters struct {
+	Since    time.Time                         `json:"since"`
+	Totals   map[string]bufferMeter            `json:"totals"`
+	Services map[string]map[string]bufferMeter `json:"services"`
+}
+
+// telemetryServices maps the metrics page keys to buffer-service service names
+var telemetryServices = []struct{ key, service string }{
+	{"syslog_messages", "syslog"},
+	{"netflow_records", "netflow"},
+	{"snmp_traps", "snmp_trap"},
+	{"windows_events", "windows_events"},
+}
+
+// telemetryFromMeters returns per-minute ingest rates and ingest counts per telemetry type
+func telemetryFromMeters(m bufferMeters) (perMinute map[string]float64, counts map[string]int64) {
+	perMinute = map[string]float64{}
+	counts = map[string]int64{}
+	for _, t := range telemetryServices {
+		in := m.Services[t.service]["ingest"]
+		perMinute[t.key] = round2(in.Rate1m * 60)
+		counts[t.key] = in.Count
+	}
+	return perMinute, counts
+}
@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -134,51 +137,54 @@ func copyFile(src, dst string) error {
 	return err
 }
 
-func getNestedInt(cfg Config, path ...string) (int, bool) {
-	var cur any = cfg
-	for i, p := range path {
+// getNested walks path through nested JSON objects in cfg
+func getNested(cfg Config, path ...string) (any, bool) {
+	// Config is a named map type, so convert before walking generic JSON values
+	var cur any = map[string]any(cfg)
+	for _, p := range path {
 		m, ok := cur.(map[string]any)
 		if !ok {
-			return 0, false
+			return nil, false
 		}
-		v, ok := m[p]
-		if !ok {
-			return 0, false
+		if cur, ok = m[p]; !ok {
+			return nil, false
 		}
-		if i == len(path)-1 {
-			// number may be float64 in generic json
-			switch t := v.(type) {
-			case float64:
-				return int(t), true
-			case int:
-				return t, true
-			default:
-				return 0, false
-			}
-		}
-		cur = v
 	}
-	return 0, false
+	return cur, true
+}
+
+func getNestedInt(cfg Config, path ...string) (int, bool) {
+	v, ok := getNested(cfg, path...)
+	if !ok {
+		return 0, false
+	}
+	// number may be float64 in generic json
+	switch t := v.(type) {
+	case float64:
+		return int(t), true
+	case int:
+		return t, true
+	default:
+		return 0, false
+	}
 }
 
 func getNestedBool(cfg Config, path ...string) (bool, bool) {
-	var cur any = cfg
-	for i, p := range path {
-		m, ok := cur.(map[string]any)
-		if !ok {
-			return false, false
-		}
-		v, ok := m[p]
-		if !ok {
-			return false, false
-		}
-		if i == len(path)-1 {
-			b, ok := v.(bool)
-			return b, ok
-		}
-		cur = v
+	v, ok := getNested(cfg, path...)
+	if !ok {
+		return false, false
 	}
-	return false, false
+	b, ok := v.(bool)
+	return b, ok
+}
+
+func getNestedString(cfg Config, path ...string) (string, bool) {
+	v, ok := getNested(cfg, path...)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
 }
 
 func restartService(name string) error {
@@ -462,6 +468,14 @@ func newMux() http.Handler {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	})
 
+	mux.HandleFunc("/api/snmp/traps", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handleSNMPTraps(w, r)
+			return
+		}
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	})
+
 	mux.HandleFunc("/api/windows", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handleWindows(w, r)
@@ -674,21 +688,46 @@ func handleFlows(w http.ResponseWriter, r *http.Request) {
 func handleSyslog(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Read recent syslog entries from fluent-bit output
+	// Query the syslog index kept by buffer-service
+	query := copyQuery(r.URL.Query(), "host", "severity", "facility", "program", "since", "until", "q", "limit", "offset")
+	var result bufferSyslogSearch
+	if err := fetchBufferJSON("/api/buffer/syslog/search", query, &result); err != nil {
+		logger.WithError(err).Warn("Syslog search via buffer-service failed")
+		writeBufferError(w, err)
+		return
+	}
+	if result.Entries == nil {
+		result.Entries = []bufferSyslogEntry{}
+	}
+	if result.TopHosts == nil {
+		result.TopHosts = []bufferHostCount{}
+	}
+
+	lv := result.Levels
+	errorCount := lv["emergency"] + lv["alert"] + lv["critical"] + lv["error"]
+
 	syslog := map[string]any{
-		"total_logs":  0,
-		"entries":     0,
-		"warnings":    0,
-		"errors":      0,
-		"recent_logs": []map[string]any{},
+		"total_logs":  result.Total,
+		"entries":     len(result.Entries),
+		"warnings":    lv["warning"],
+		"errors":      errorCount,
+		"recent_logs": result.Entries,
+		"logs":        result.Entries,
 		"log_level_distribution": map[string]any{
-			"error":   0,
-			"warning": 0,
-			"info":    0,
-			"debug":   0,
+			"error":   errorCount,
+			"warning": lv["warning"],
+			"info":    lv["notice"] + lv["info"],
+			"debug":   lv["debug"],
 		},
-		"top_hosts":        []map[string]any{},
+		"log_levels":       lv,
+		"top_hosts":        result.TopHosts,
 		"message_patterns": "No pattern data available",
+		"pagination": map[string]any{
+			"limit":  result.Limit,
+			"offset": result.Offset,
+			"total":  result.Total,
+		},
+		"search_mode": result.SearchMode,
 	}
 
 	_ = json.NewEncoder(w).Encode(syslog)
@@ -698,100 +737,246 @@ func handleSyslog(w http.ResponseWriter, r *http.Request) {
 func handleSNMP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Read SNMP device status from telegraf output
+	// Device inventory and trap timeline are maintained by buffer-service
+	var inv bufferSNMPInventory
+	if err := fetchBufferJSON("/api/buffer/snmp/devices", copyQuery(r.URL.Query(), "status", "type"), &inv); err != nil {
+		logger.WithError(err).Warn("SNMP inventory via buffer-service failed")
+		writeBufferError(w, err)
+		return
+	}
+	var traps bufferSNMPTraps
+	if err := fetchBufferJSON("/api/buffer/snmp/traps", url.Values{"limit": {"20"}}, &traps); err != nil {
+		logger.WithError(err).Warn("SNMP trap timeline via buffer-service failed")
+		writeBufferError(w, err)
+		return
+	}
+
+	devices := make([]map[string]any, 0, len(inv.Devices))
+	for _, d := range inv.Devices {
+		name := d.Hostname
+		if name == "" {
+			name = d.IP
+		}
+		uptime := "N/A"
+		if d.UptimeSeconds >= 0 && d.Status != "offline" {
+			uptime = formatUptime(time.Duration(d.UptimeSeconds) * time.Second)
+		}
+		devices = append(devices, map[string]any{
+			"name":          name,
+			"hostname":      d.Hostname,
+			"ip":            d.IP,
+			"type":          d.Type,
+			"sysDescr":      d.SysDescr,
+			"sys_object_id": d.SysObjectID,
+			"status":        d.Status,
+			"status_reason": d.StatusReason,
+			"uptime":        uptime,
+			"lastSeen":      d.LastSeen,
+			"last_restart":  d.LastRestart,
+			"restart_count": d.RestartCount,
+			"traps_24h":     d.Traps24h,
+		})
+	}
+
+	recentTraps := make([]map[string]any, 0, len(traps.Traps))
+	for _, t := range traps.Traps {
+		recentTraps = append(recentTraps, map[string]any{
+			"source":    t.DeviceIP,
+			"timestamp": t.Timestamp,
+			"oid":       t.OID,
+			"name":      t.Name,
+			"message":   t.Message,
+			"severity":  t.Severity,
+		})
+	}
+
 	snmp := map[string]any{
-		"total_devices": 0,
-		"online":        0,
-		"warnings":      0,
-		"offline":       0,
-		"device_status": []map[string]any{},
-		"device_types": map[string]any{
-			"router":       0,
-			"switch":       0,
-			"firewall":     0,
-			"access_point": 0,
+		"total_devices": inv.Total,
+		"online":        inv.Status["online"],
+		"warnings":      inv.Status["warning"],
+		"offline":       inv.Status["offline"],
+		"device_status": map[string]any{
+			"online":  inv.Status["online"],
+			"warning": inv.Status["warning"],
+			"offline": inv.Status["offline"],
+		},
+		"devices":      devices,
+		"device_types": inv.Types,
+		"recent_traps": recentTraps,
+		"performance_metrics": map[string]any{
+			"polled_devices":    inv.PolledCount,
+			"trap_only_devices": int64(inv.Total) - inv.PolledCount,
+			"traps_last_24h":    inv.Traps24h,
 		},
-		"recent_traps":        "No recent SNMP traps",
-		"performance_metrics": "No performance metrics available",
 	}
 
 	_ = json.NewEncoder(w).Encode(snmp)
 }
 
+// SNMP trap timeline handler, optionally scoped to one device
+func handleSNMPTraps(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := copyQuery(r.URL.Query(), "severity", "since", "until", "limit", "offset")
+	path := "/api/buffer/snmp/traps"
+	if device := r.URL.Query().Get("device"); device != "" {
+		path = "/api/buffer/snmp/devices/" + url.PathEscape(device) + "/traps"
+	}
+
+	var result json.RawMessage
+	if err := fetchBufferJSON(path, query, &result); err != nil {
+		logger.WithError(err).Warn("SNMP trap query via buffer-service failed")
+		if se, ok := err.(*bufferStatusError); ok && se.Status == http.StatusNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]any{"success": false, "message": se.Message})
+			return
+		}
+		writeBufferError(w, err)
+		return
+	}
+
+	_, _ = w.Write(result)
+}
+
+// formatUptime renders a duration the way the dashboard shows uptimes
+func formatUptime(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	} else if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
 // Windows Events data handler
 func handleWindows(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Read Windows events from vector HTTP endpoint
+	// Events arrive through vector's windows_events source and are indexed by buffer-service
+	query := copyQuery(r.URL.Query(), "channel", "level", "computer", "provider", "event_id", "since", "until", "limit", "offset")
+	var result bufferWindowsEvents
+	if err := fetchBufferJSON("/api/buffer/windows/events", query, &result); err != nil {
+		logger.WithError(err).Warn("Windows event query via buffer-service failed")
+		writeBufferError(w, err)
+		return
+	}
+	if result.Events == nil {
+		result.Events = []bufferWindowsEvent{}
+	}
+	if result.TopEventIDs == nil {
+		result.TopEventIDs = []bufferEventIDCount{}
+	}
+	if result.TopProviders == nil {
+		result.TopProviders = []bufferNamedCount{}
+	}
+	if result.TopComputers == nil {
+		result.TopComputers = []bufferNamedCount{}
+	}
+
+	events := make([]map[string]any, 0, len(result.Events))
+	for _, e := range result.Events {
+		events = append(events, map[string]any{
+			"id":        e.ID,
+			"timestamp": e.Timestamp,
+			"level":     e.Level,
+			"channel":   e.Channel,
+			"source":    e.Provider,
+			"event_id":  e.EventID,
+			"computer":  e.Computer,
+			"source_ip": e.SourceIP,
+			"message":   e.Message,
+		})
+	}
+
+	cfg, err := readJSONConfig()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read config for Windows configuration block")
+		cfg = Config{}
+	}
+
+	lv := result.Levels
 	windows := map[string]any{
-		"total_events":  0,
-		"critical":      0,
-		"errors":        0,
-		"warnings":      0,
-		"recent_events": []map[string]any{},
-		"event_sources": "No event source data available",
-		"event_levels":  "No event level data available",
-		"top_computers": "No computer data available",
-		"configuration": map[string]any{
-			"collection_port":     8084,
-			"enabled":             true,
-			"collection_protocol": "HTTP/JSON",
-			"buffer_size":         "50MB",
-			"forwarding_target":   "",
-			"forwarding_enabled":  false,
-		},
-		"performance": map[string]any{
-			"cpu_usage":          "0%",
-			"memory_usage":       "0MB",
-			"disk_io_rate":       "0MB/s",
-			"network_io_rate":    "0KB/s",
-			"buffer_utilization": "0%",
+		"total_events":  result.Total,
+		"critical":      lv["critical"],
+		"errors":        lv["error"],
+		"warnings":      lv["warning"],
+		"events":        events,
+		"recent_events": events,
+		"event_levels":  lv,
+		"channels":      result.Channels,
+		"event_sources": result.TopProviders,
+		"top_event_ids": result.TopEventIDs,
+		"top_computers": result.TopComputers,
+		"configuration": windowsConfiguration(cfg),
+		"pagination": map[string]any{
+			"limit":  result.Limit,
+			"offset": result.Offset,
+			"total":  result.Total,
 		},
 	}
 
 	_ = json.NewEncoder(w).Encode(windows)
 }
 
-// getTelemetryCount counts lines in telemetry data files
-func getTelemetryCount(dataDir, pattern string) int {
-	count := 0
-
-	// Get all matching files in the directory
-	files, err := filepath.Glob(filepath.Join(dataDir, pattern))
-	if err != nil {
-		return 0
+// windowsConfiguration summarizes the Windows collection and forwarding settings from config.json
+func windowsConfiguration(cfg Config) map[string]any {
+	out := map[string]any{}
+	if v, ok := getNestedBool(cfg, "collection", "windows", "enabled"); ok {
+		out["enabled"] = v
 	}
-
-	for _, file := range files {
-		// Skip empty files
-		if info, err := os.Stat(file); err != nil || info.Size() == 0 {
-			continue
+	if v, ok := getNestedInt(cfg, "collection", "windows", "port"); ok {
+		out["collection_port"] = v
+	}
+	if v, ok := getNestedString(cfg, "collection", "windows", "protocol"); ok {
+		out["collection_protocol"] = v
+	}
+	if v, ok := getNestedString(cfg, "collection", "windows", "bindAddress"); ok {
+		out["bind_address"] = v
+	}
+	if v, ok := getNestedString(cfg, "collection", "windows", "format"); ok {
+		out["format"] = v
+	}
+	if v, ok := getNestedInt(cfg, "collection", "windows", "bufferSize"); ok {
+		out["buffer_size"] = v
+	}
+	if v, ok := getNestedBool(cfg, "forwarding", "windows", "enabled"); ok {
+		out["forwarding_enabled"] = v
+	}
+	if host, ok := getNestedString(cfg, "forwarding", "windows", "targetHost"); ok {
+		target := host
+		if port, ok := getNestedInt(cfg, "forwarding", "windows", "targetPort"); ok && host != "" {
+			target = net.JoinHostPort(host, strconv.Itoa(port))
 		}
-
-		// Count lines in file (each line typically represents one telemetry record)
-		if data, err := os.ReadFile(file); err == nil {
-			lines := strings.Split(string(data), "\n")
-			// Filter out empty lines
-			for _, line := range lines {
-				if strings.TrimSpace(line) != "" {
-					count++
-				}
+		out["forwarding_target"] = target
+	}
+	if v, ok := getNestedString(cfg, "forwarding", "windows", "channels"); ok {
+		channels := []string{}
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				channels = append(channels, c)
 			}
 		}
+		out["channels"] = channels
 	}
-
-	return count
+	return out
 }
 
 // Enhanced metrics handler
 func handleMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get telemetry data counts from actual data files
-	syslogCount := getTelemetryCount("/data/syslog", "production-syslog.log")
-	flowsCount := getTelemetryCount("/data/flows", "production-flows-*.log")
-	snmpCount := getTelemetryCount("/data/snmp", "*.log")
-	windowsCount := getTelemetryCount("/data/vector", "*.log")
+	// Telemetry rates come from buffer-service's ingest meters; the rest of the
+	// metrics are still useful when it is down, so only flag them unavailable
+	var meters bufferMeters
+	telemetryAvailable := true
+	if err := fetchBufferJSON("/api/buffer/meters", url.Values{"limit": {"1"}}, &meters); err != nil {
+		logger.WithError(err).Warn("Telemetry meters via buffer-service failed")
+		telemetryAvailable = false
+	}
+	telemetry, counts := telemetryFromMeters(meters)
 
 	// Get system metrics with error handling
 	var memTotal, memAvail, memUsed int64 = 1, 0, 0 // Default values to avoid division by zero
@@ -843,16 +1028,7 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 		parts := strings.Split(string(b), " ")
 		if len(parts) > 0 {
 			if secs, err := time.ParseDuration(strings.TrimSpace(parts[0]) + "s"); err == nil {
-				days := int(secs.Hours()) / 24
-				hours := int(secs.Hours()) % 24
-				minutes := int(secs.Minutes()) % 60
-				if days > 0 {
-					uptime = fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
-				} else if hours > 0 {
-					uptime = fmt.Sprintf("%dh %dm", hours, minutes)
-				} else {
-					uptime = fmt.Sprintf("%dm", minutes)
-				}
+				uptime = formatUptime(secs)
 			}
 		}
 	}
@@ -930,11 +1106,13 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 		"memory_usage": fmt.Sprintf("%.1f%%", memUsagePct),
 		"disk_usage":   fmt.Sprintf("%.1f%%", diskUsagePct),
 		"uptime":       uptime,
-		// Telemetry data counts
-		"syslog_messages_received": syslogCount,
-		"netflow_records_received": flowsCount,
-		"snmp_traps_received":      snmpCount,
-		"windows_events_received":  windowsCount,
+		// Telemetry ingested since buffer-service start (or the last meter reset)
+		"syslog_messages_received": counts["syslog_messages"],
+		"netflow_records_received": counts["netflow_records"],
+		"snmp_traps_received":      counts["snmp_traps"],
+		"windows_events_received":  counts["windows_events"],
+		"telemetry":                telemetry,
+		"telemetry_available":      telemetryAvailable,
 		"memory": map[string]any{
 			"total":     memTotal,
 			"used":      memUsed,
@@ -967,14 +1145,137 @@ func handleMetrics(w http.ResponseWriter, r *http.Request) {
 func handleBuffer(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get real system uptime
-	var uptime int64 = 0
-	if output, err := exec.Command("uptime", "-s").Output(); err == nil {
-		if startTime, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(string(output))); err == nil {
-			uptime = int64(time.Since(startTime).Seconds())
+	var st bufferStatus
+	if err := fetchBufferJSON("/api/buffer/status", nil, &st); err != nil {
+		logger.WithError(err).Warn("Buffer status via buffer-service failed")
+		writeBufferError(w, err)
+		return
+	}
+	var stats bufferStats
+	if err := fetchBufferJSON("/api/buffer/stats", nil, &stats); err != nil {
+		logger.WithError(err).Warn("Buffer stats via buffer-service failed")
+		writeBufferError(w, err)
+		return
+	}
+
+	now := time.Now()
+	rates := bufferThroughput.observe(now, st.Counters)
+	score, factors := computeBufferHealth(st, rates, now)
+
+	// Buffer usage in bytes from the per-service totals (buffer_size_mb is truncated)
+	var used, pending int64
+	utilization := map[string]any{}
+	for name, svc := range st.Services {
+		used += svc.TotalSize
+		pending += svc.Pending
+		utilization[name] = map[string]any{
+			"records":        svc.TotalRecords,
+			"pending":        svc.Pending,
+			"size_bytes":     svc.TotalSize,
+			"oldest_pending": svc.OldestPending,
+		}
+	}
+	total := int64(st.MaxBufferSizeMB) * 1024 * 1024
+	available := total - used
+	if available < 0 {
+		available = 0
+	}
+
+	errorRate := 0.0
+	if rates.Available && rates.Ingested+rates.Errors > 0 {
+		errorRate = float64(rates.Errors) / float64(rates.Ingested+rates.Errors) * 100
+	}
+
+	queues := []map[string]any{
+		{
+			"name":                "forward_queue",
+			"status":              queueStatus(percent(int64(st.ForwardQueue), int64(st.ForwardQueueCap))),
+			"size":                st.ForwardQueue,
+			"max_size":            st.ForwardQueueCap,
+			"processing_rate":     round2(rates.OutPerSec),
+			"utilization_percent": round2(percent(int64(st.ForwardQueue), int64(st.ForwardQueueCap))),
+		},
+		{
+			"name":                "buffer_backlog",
+			"status":              queueStatus(st.BufferUsagePct),
+			"size":                used,
+			"max_size":            total,
+			"pending_records":     pending,
+			"processing_rate":     round2(rates.InPerSec),
+			"utilization_percent": round2(st.BufferUsagePct),
+		},
+	}
+
+	destinations := []map[string]any{}
+	if st.ForwardingURL != "" {
+		destStatus := "disabled"
+		if st.Forwarding {
+			destStatus = "disconnected"
+			if st.VPNStatus.Connected {
+				destStatus = "connected"
+			}
+		}
+		protocol := "HTTP"
+		if u, err := url.Parse(st.ForwardingURL); err == nil && u.Scheme == "https" {
+			protocol = "HTTPS"
 		}
+		var lastSuccess any
+		if st.Counters.LastForwardAt > 0 {
+			lastSuccess = time.Unix(st.Counters.LastForwardAt, 0).UTC()
+		}
+		destinations = append(destinations, map[string]any{
+			"name":            "primary",
+			"status":          destStatus,
+			"endpoint":        st.ForwardingURL,
+			"protocol":        protocol,
+			"last_success":    lastSuccess,
+			"last_check":      st.VPNStatus.LastCheck,
+			"latency_ms":      st.VPNStatus.Latency,
+			"last_error":      st.VPNStatus.LastError,
+			"messages_sent":   st.Counters.ForwardedRecords,
+			"messages_failed": st.Counters.ForwardFailures,
+			"success_rate":    round2(percent(st.Counters.ForwardedRecords, st.Counters.ForwardedRecords+st.Counters.ForwardFailures)),
+		})
+	}
+
+	buffer := map[string]any{
+		"available":           true,
+		"health_score":        score,
+		"health_factors":      factors,
+		"buffer_size":         used,
+		"buffer_used":         used,
+		"buffer_available":    available,
+		"buffer_total":        total,
+		"utilization_percent": round2(st.BufferUsagePct),
+		"uptime":              now.Unix() - st.Counters.StartedAt,
+		"total_records":       stats.TotalRecords,
+		"retention_days":      stats.RetentionDays,
+		"overflow_action":     stats.OverflowAction,
+		"utilization_metrics": utilization,
+		"throughput": map[string]any{
+			"messages_in":             st.Counters.IngestedRecords,
+			"messages_out":            st.Counters.ForwardedRecords,
+			"bytes_in":                st.Counters.IngestedBytes,
+			"bytes_out":               st.Counters.ForwardedBytes,
+			"dropped_messages":        st.Counters.DroppedRecords,
+			"error_rate":              round2(errorRate),
+			"messages_per_second":     round2(rates.InPerSec),
+			"messages_out_per_second": round2(rates.OutPerSec),
+			"bytes_in_per_second":     round2(rates.BytesInPerSec),
+			"bytes_out_per_second":    round2(rates.BytesOutPerSec),
+			"rates_available":         rates.Available,
+			"sample_window_seconds":   int(rates.Window.Seconds()),
+		},
+		"queues":       queues,
+		"destinations": destinations,
+		"performance":  hostPerformance(),
 	}
 
+	_ = json.NewEncoder(w).Encode(buffer)
+}
+
+// hostPerformance reports appliance CPU and memory usage for the buffer page
+func hostPerformance() map[string]any {
 	// Get real CPU usage (Alpine Linux compatible)
 	cpuUsage := 0
 	if output, err := exec.Command("sh", "-c", "top -bn1 | grep 'CPU:' | head -1 | awk '{print $2}' | sed 's/%//'").Output(); err == nil {
@@ -1005,47 +1306,33 @@ func handleBuffer(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Get disk I/O usage (simplified)
-	diskIO := 5 // Default to 5% as a reasonable baseline for active system
+	return map[string]any{
+		"cpu_usage":    cpuUsage,
+		"memory_usage": memUsage,
+	}
+}
 
-	buffer := map[string]any{
-		"health_score":        85,
-		"buffer_size":         67108864, // 64MB in bytes
-		"buffer_used":         12582912, // 12MB in bytes
-		"buffer_available":    54525952, // 52MB in bytes
-		"buffer_total":        67108864, // 64MB in bytes
-		"utilization_percent": 18,
-		"uptime":              uptime,
-		"utilization_metrics": map[string]any{
-			"syslog":  map[string]any{"entries": 1.2, "rate_per_sec": 15},
-			"netflow": map[string]any{"entries": 2.8, "rate_per_sec": 42},
-			"snmp":    map[string]any{"entries": 0.5, "rate_per_sec": 8},
-			"windows": map[string]any{"entries": 0.0, "rate_per_sec": 0},
-		},
-		"throughput": map[string]any{
-			"messages_in":         0,
-			"messages_out":        0,
-			"bytes_in":            0,
-			"bytes_out":           0,
-			"dropped_messages":    0,
-			"error_rate":          0,
-			"messages_per_second": 0,
-		},
-		"buffer_queues": map[string]any{
-			"input_queue":      "No data available",
-			"processing_queue": "No data available",
-			"output_queue":     "No data available",
-		},
-		"forwarding_destinations": "No forwarding data available",
-		"recent_activity":         "No activity data available",
-		"performance": map[string]any{
-			"cpu_usage":    cpuUsage,
-			"memory_usage": memUsage,
-			"disk_io":      diskIO,
-		},
+func percent(part, whole int64) float64 {
+	if whole <= 0 {
+		return 0
 	}
+	return float64(part) / float64(whole) * 100
+}
 
-	_ = json.NewEncoder(w).Encode(buffer)
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// queueStatus buckets a utilization percentage the same way the UI colours it
+func queueStatus(pct float64) string {
+	switch {
+	case pct > 80:
+		return "critical"
+	case pct > 60:
+		return "warning"
+	default:
+		return "ok"
+	}
 }
 
 func withCORS(next http.Handler) http.Handler {
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
 	"testing"
+	"time"
 )
 
 type restartRecorder struct{ names []string }
@@ -104,6 +106,51 @@ func TestPOSTConfig_PersistAndRestart(t *testing.T) {
 	}
 }
 
+func TestPOSTConfig_RestartsChangedServices(t *testing.T) {
+	const base = `{"collection":{"syslog":{"port":514,"enabled":true},"netflow":{"enabled":true,"ports":{"netflow_v5":2055,"ipfix":4739,"sflow":6343}},"snmp":{"trap_port":162,"enabled":true},"windows":{"port":8084,"enabled":true}}}`
+	cases := []struct {
+		name    string
+		updated string
+		want    []string
+	}{
+		{"unchanged", base, nil},
+		{"syslog port", `{"collection":{"syslog":{"port":5514,"enabled":true},"netflow":{"enabled":true,"ports":{"netflow_v5":2055,"ipfix":4739,"sflow":6343}},"snmp":{"trap_port":162,"enabled":true},"windows":{"port":8084,"enabled":true}}}`, []string{"fluent-bit"}},
+		{"ipfix port", `{"collection":{"syslog":{"port":514,"enabled":true},"netflow":{"enabled":true,"ports":{"netflow_v5":2055,"ipfix":4740,"sflow":6343}},"snmp":{"trap_port":162,"enabled":true},"windows":{"port":8084,"enabled":true}}}`, []string{"goflow2"}},
+		{"snmp disabled", `{"collection":{"syslog":{"port":514,"enabled":true},"netflow":{"enabled":true,"ports":{"netflow_v5":2055,"ipfix":4739,"sflow":6343}},"snmp":{"trap_port":162,"enabled":false},"windows":{"port":8084,"enabled":true}}}`, []string{"telegraf"}},
+		{"windows port and syslog disabled", `{"collection":{"syslog":{"port":514,"enabled":false},"netflow":{"enabled":true,"ports":{"netflow_v5":2055,"ipfix":4739,"sflow":6343}},"snmp":{"trap_port":162,"enabled":true},"windows":{"port":8085,"enabled":true}}}`, []string{"fluent-bit", "vector"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, bkp, lg := tempPaths(t)
+			configPath = cfg
+			backupDir = bkp
+			logPath = lg
+			if err := os.WriteFile(cfg, []byte(base), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := &restartRecorder{}
+			restartSvc = rec.call
+			t.Cleanup(func() { restartSvc = restartService })
+
+			ts := httptest.NewServer(newMux())
+			defer ts.Close()
+
+			resp, err := http.Post(ts.URL+"/api/config", "application/json", bytes.NewReader([]byte(tc.updated)))
+			if err != nil {
+				t.Fatalf("POST failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status: %d", resp.StatusCode)
+			}
+			if !slices.Equal(rec.names, tc.want) {
+				t.Errorf("restarts = %v, want %v", rec.names, tc.want)
+			}
+		})
+	}
+}
+
 func TestPOSTConfig_InvalidJSON(t *testing.T) {
 	cfg, bkp, lg := tempPaths(t)
 	withEnv(t, "NOC_RAVEN_CONFIG_PATH", cfg)
@@ -199,3 +246,381 @@ func TestAuthOptionalAndEnabled(t *testing.T) {
 	}
 }
 
+
+// withBufferService points the buffer-service client at a test server
+func withBufferService(t *testing.T, h http.Handler) {
+	t.Helper()
+	apiKey = ""
+	ts := httptest.NewServer(h)
+	old := bufferServiceURL
+	bufferServiceURL = ts.URL
+	t.Cleanup(func() {
+		bufferServiceURL = old
+		ts.Close()
+	})
+}
+
+func TestGETSyslog_ProxiesSearch(t *testing.T) {
+	var gotQuery url.Values
+	withBufferService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/buffer/syslog/search" {
+			http.NotFound(w, r)
+			return
+		}
+		gotQuery = r.URL.Query()
+		_, _ = w.Write([]byte(`{"total":3,"limit":2,"offset":0,
+			"entries":[{"id":3,"timestamp":"2025-09-15T10:00:00Z","hostname":"edge-fw","facility":"kern","severity":"error","message":"link down"}],
+			"levels":{"error":2,"warning":0,"info":1,"debug":0,"critical":0,"emergency":0,"alert":0,"notice":0},
+			"top_hosts":[{"hostname":"edge-fw","count":3}],"search_mode":"fts5"}`))
+	}))
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/syslog?host=edge-fw&q=link&limit=2&bogus=1")
+	if err != nil { t.Fatalf("GET failed: %v", err) }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if gotQuery.Get("host") != "edge-fw" || gotQuery.Get("q") != "link" || gotQuery.Get("limit") != "2" || gotQuery.Has("bogus") {
+		t.Fatalf("unexpected forwarded query: %v", gotQuery)
+	}
+
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["total_logs"].(float64) != 3 || got["errors"].(float64) != 2 {
+		t.Fatalf("unexpected totals: %v", got)
+	}
+	if logs, ok := got["logs"].([]any); !ok || len(logs) != 1 {
+		t.Fatalf("expected one log entry, got %v", got["logs"])
+	}
+	if hosts, ok := got["top_hosts"].([]any); !ok || len(hosts) != 1 {
+		t.Fatalf("expected one top host, got %v", got["top_hosts"])
+	}
+}
+
+func TestGETSyslog_BufferUnavailable(t *testing.T) {
+	apiKey = ""
+	old := bufferServiceURL
+	bufferServiceURL = "http://127.0.0.1:1"
+	t.Cleanup(func() { bufferServiceURL = old })
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/syslog")
+	if err != nil { t.Fatalf("GET failed: %v", err) }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+}
+
+func TestGETSNMP_InventoryAndTraps(t *testing.T) {
+	withBufferService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/buffer/snmp/devices":
+			_, _ = w.Write([]byte(`{"total":2,
+				"devices":[{"ip":"10.0.0.1","hostname":"edge-fw","type":"firewall","status":"online","uptime_seconds":90061,"last_seen":"2025-09-15T10:00:00Z"},
+					{"ip":"10.0.0.2","type":"router","status":"offline","uptime_seconds":-1,"last_seen":"2025-09-14T10:00:00Z"}],
+				"status":{"online":1,"warning":0,"offline":1},
+				"types":{"router":1,"switch":0,"firewall":1,"access_point":0,"unknown":0},
+				"traps_24h":1,"polled_devices":1}`))
+		case "/api/buffer/snmp/traps":
+			_, _ = w.Write([]byte(`{"total":1,"limit":20,"offset":0,
+				"traps":[{"id":1,"timestamp":"2025-09-15T09:59:00Z","device_ip":"10.0.0.1","name":"linkDown","severity":"error","message":"IF-MIB::linkDown"}]}`))
+		case "/api/buffer/snmp/devices/10.0.0.9/traps":
+			http.Error(w, `Unknown SNMP device "10.0.0.9"`, http.StatusNotFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/snmp")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["total_devices"].(float64) != 2 || got["device_status"].(map[string]any)["offline"].(float64) != 1 {
+		t.Fatalf("unexpected totals: %v", got)
+	}
+	devices := got["devices"].([]any)
+	first := devices[0].(map[string]any)
+	if first["name"] != "edge-fw" || first["uptime"] != "1d 1h 1m" {
+		t.Fatalf("unexpected device row: %v", first)
+	}
+	if second := devices[1].(map[string]any); second["name"] != "10.0.0.2" || second["uptime"] != "N/A" {
+		t.Fatalf("unexpected device row: %v", second)
+	}
+	if traps, ok := got["recent_traps"].([]any); !ok || len(traps) != 1 || traps[0].(map[string]any)["source"] != "10.0.0.1" {
+		t.Fatalf("unexpected recent traps: %v", got["recent_traps"])
+	}
+
+	resp2, err := http.Get(ts.URL + "/api/snmp/traps?device=10.0.0.9")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown device, got %d", resp2.StatusCode)
+	}
+}
+
+func TestGETWindows_AnalyticsAndConfiguration(t *testing.T) {
+	cfg, _, _ := tempPaths(t)
+	old := configPath
+	configPath = cfg
+	t.Cleanup(func() { configPath = old })
+	conf := []byte(`{"collection":{"windows":{"enabled":true,"port":8084,"protocol":"HTTP","bufferSize":10}},
+		"forwarding":{"windows":{"enabled":true,"targetHost":"siem.example.net","targetPort":8088,"channels":"System, Security"}}}`)
+	if err := os.WriteFile(cfg, conf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotQuery url.Values
+	withBufferService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/buffer/windows/events" {
+			http.NotFound(w, r)
+			return
+		}
+		gotQuery = r.URL.Query()
+		_, _ = w.Write([]byte(`{"total":2,"limit":50,"offset":0,
+			"events":[{"id":2,"timestamp":"2025-09-15T10:00:00Z","computer":"APP01","channel":"System","provider":"Service Control Manager","event_id":7031,"level":"error","message":"Spooler terminated"}],
+			"levels":{"critical":0,"error":1,"warning":0,"information":1,"verbose":0},
+			"channels":{"System":2},
+			"top_event_ids":[{"event_id":7031,"provider":"Service Control Manager","count":1}],
+			"top_providers":[{"name":"Service Control Manager","count":2}],
+			"top_computers":[{"name":"APP01","count":2}]}`))
+	}))
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/windows?channel=System")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if gotQuery.Get("channel") != "System" {
+		t.Fatalf("channel not forwarded: %v", gotQuery)
+	}
+
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["total_events"].(float64) != 2 || got["errors"].(float64) != 1 {
+		t.Fatalf("unexpected totals: %v", got)
+	}
+	if events := got["events"].([]any); len(events) != 1 || events[0].(map[string]any)["source"] != "Service Control Manager" {
+		t.Fatalf("unexpected events: %v", got["events"])
+	}
+	winCfg := got["configuration"].(map[string]any)
+	if winCfg["collection_port"].(float64) != 8084 || winCfg["forwarding_target"] != "siem.example.net:8088" {
+		t.Fatalf("unexpected configuration: %v", winCfg)
+	}
+	if ch := winCfg["channels"].([]any); len(ch) != 2 || ch[1] != "Security" {
+		t.Fatalf("unexpected channels: %v", winCfg["channels"])
+	}
+	if _, ok := got["performance"]; ok {
+		t.Fatalf("synthetic performance block should be gone")
+	}
+}
+
+func TestThroughputSampler_RatesAndRestart(t *testing.T) {
+	s := &throughputSampler{}
+	t0 := time.Unix(1_700_000_000, 0)
+
+	if r := s.observe(t0, bufferCounters{StartedAt: 1, IngestedRecords: 100}); r.Available {
+		t.Fatalf("first sample should not produce rates: %+v", r)
+	}
+	r := s.observe(t0.Add(10*time.Second), bufferCounters{StartedAt: 1, IngestedRecords: 600, ForwardedRecords: 50, DroppedRecords: 3})
+	if !r.Available || r.InPerSec != 50 || r.OutPerSec != 5 || r.Dropped != 3 {
+		t.Fatalf("unexpected rates: %+v", r)
+	}
+
+	// Older samples age out of the window
+	s.observe(t0.Add(70*time.Second), bufferCounters{StartedAt: 1, IngestedRecords: 1200})
+	r = s.observe(t0.Add(80*time.Second), bufferCounters{StartedAt: 1, IngestedRecords: 1300})
+	if r.Window != 70*time.Second || r.Ingested != 700 {
+		t.Fatalf("expected base sample at t+10s, got window=%s ingested=%d", r.Window, r.Ingested)
+	}
+
+	// A buffer-service restart resets the baseline instead of producing negative rates
+	if r := s.observe(t0.Add(90*time.Second), bufferCounters{StartedAt: 2, IngestedRecords: 5}); r.Available {
+		t.Fatalf("rates should restart after buffer-service restart: %+v", r)
+	}
+}
+
+func TestComputeBufferHealth(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	healthy := bufferStatus{Forwarding: true, BufferUsagePct: 10, VPNStatus: bufferVPNStatus{Connected: true}}
+	if score, factors := computeBufferHealth(healthy, throughputRates{Available: true}, now); score != 100 || len(factors) != 0 {
+		t.Fatalf("expected perfect health, got %d %v", score, factors)
+	}
+
+	degraded := bufferStatus{
+		Forwarding:     true,
+		BufferUsagePct: 100,
+		VPNStatus:      bufferVPNStatus{Connected: false},
+		Services: map[string]bufferServiceStats{
+			"syslog": {Pending: 10, OldestPending: now.Add(-2 * time.Hour).Unix()},
+		},
+	}
+	rates := throughputRates{Available: true, Window: time.Minute, Dropped: 1000, Ingested: 5000}
+	score, factors := computeBufferHealth(degraded, rates, now)
+	// backlog 40 + lag 25 + endpoint 15 + drops 25 => clamped to 0
+	if score != 0 || len(factors) != 4 {
+		t.Fatalf("expected score 0 with 4 factors, got %d %v", score, factors)
+	}
+}
+
+func TestGETBuffer_LiveStatus(t *testing.T) {
+	bufferThroughput = &throughputSampler{}
+	withBufferService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/buffer/status":
+			_, _ = w.Write([]byte(`{"enabled":true,"forwarding":true,"buffer_size_mb":1,"max_buffer_size_mb":10,"buffer_usage_pct":10,
+				"vpn_status":{"connected":true,"latency_ms":42},"forwarding_url":"https://obs.example.net/api/ingest",
+				"forward_queue":250,"forward_queue_cap":1000,
+				"counters":{"started_at":1700000000,"ingested_records":900,"ingested_bytes":90000,"forwarded_records":800,"forward_failures":200,"last_forward_at":1700000100},
+				"services":{"syslog":{"service":"syslog","total_records":100,"total_size":1048576,"pending":100}}}`))
+		case "/api/buffer/stats":
+			_, _ = w.Write([]byte(`{"total_records":100,"retention_days":14,"overflow_action":"drop_oldest"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/buffer")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["health_score"].(float64) != 100 || got["buffer_used"].(float64) != 1048576 || got["buffer_total"].(float64) != 10*1048576 {
+		t.Fatalf("unexpected buffer figures: %v", got)
+	}
+	tp := got["throughput"].(map[string]any)
+	if tp["messages_in"].(float64) != 900 || tp["rates_available"] != false {
+		t.Fatalf("unexpected throughput: %v", tp)
+	}
+	dest := got["destinations"].([]any)[0].(map[string]any)
+	if dest["status"] != "connected" || dest["protocol"] != "HTTPS" || dest["success_rate"].(float64) != 80 {
+		t.Fatalf("unexpected destination: %v", dest)
+	}
+	if q := got["queues"].([]any)[0].(map[string]any); q["utilization_percent"].(float64) != 25 {
+		t.Fatalf("unexpected forward queue: %v", q)
+	}
+}
+
+func TestGETBuffer_Unavailable(t *testing.T) {
+	apiKey = ""
+	old := bufferServiceURL
+	bufferServiceURL = "http://127.0.0.1:1"
+	t.Cleanup(func() { bufferServiceURL = old })
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/buffer")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, ok := got["health_score"]; ok {
+		t.Fatalf("unavailable buffer-service must not report a health score: %v", got)
+	}
+}
+
+func TestGETMetrics_TelemetryFromMeters(t *testing.T) {
+	withBufferService(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/buffer/meters" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"since":"2026-01-01T00:00:00Z","totals":{},"series":[],
+			"services":{"syslog":{"ingest":{"count":1200,"rate_1m":2.5}},"snmp_trap":{"ingest":{"count":7,"rate_1m":0.05}}}}`))
+	}))
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/metrics")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["telemetry_available"] != true || got["syslog_messages_received"] != 1200.0 || got["snmp_traps_received"] != 7.0 {
+		t.Fatalf("unexpected metrics: %v", got)
+	}
+	telemetry, _ := got["telemetry"].(map[string]any)
+	if telemetry["syslog_messages"] != 150.0 || telemetry["snmp_traps"] != 3.0 || telemetry["windows_events"] != 0.0 {
+		t.Fatalf("unexpected telemetry: %v", telemetry)
+	}
+}
+
+func TestGETMetrics_BufferServiceDown(t *testing.T) {
+	apiKey = ""
+	old := bufferServiceURL
+	bufferServiceURL = "http://127.0.0.1:1"
+	t.Cleanup(func() { bufferServiceURL = old })
+
+	ts := httptest.NewServer(newMux())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/metrics")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var got map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got["telemetry_available"] != false || got["cpu_usage"] == nil {
+		t.Fatalf("unexpected metrics: %v", got)
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -24,6 +26,10 @@ type VPNConnectionHistory struct {
 	BytesSent        int64     `json:"bytes_sent"`
 	DisconnectReason string    `json:"disconnect_reason,omitempty"`
 	Success          bool      `json:"success"`
+	Event            string    `json:"event,omitempty"` // "failover" or "failback" decision rather than a session
+	FromProfileID    string    `json:"from_profile_id,omitempty"`
+	Reason           string    `json:"reason,omitempty"`
+	Remote           string    `json:"remote,omitempty"` // remote the session connected to
 }
 
 // VPNConnectionManager handles VPN connection lifecycle
@@ -44,6 +50,37 @@ type VPNConnectionManager struct {
 	connectionAttempts  map[string]int // Track failed connection attempts per profile
 	lastFailoverTime    time.Time
 	failoverCooldown    time.Duration
+	counters            map[string]*VPNProfileCounters // Lifecycle counters per profile since startup
+	reconnectPending    map[string]bool                // Profiles whose tunnel dropped unexpectedly
+	profileConfigs      map[string]VPNProfileConfig    // Saved per-profile connection policies
+	reconnect           *reconnectState                // Pending automatic reconnect, if any
+	jitterRand          func() float64
+	failback            FailbackPolicy
+	failbackStop        chan struct{}
+	preferredUpSince    time.Time                      // Start of the preferred profile's passing probe streak
+	preferredProbeErr   string
+	preferredProbedAt   time.Time
+	probeProfile        func(*VPNProfile) error        // Background health probe of a standby profile
+	startProcess        func(*VPNConnection) error     // Starts OpenVPN for a connection
+	readiness           map[string]ProfileReadiness    // Latest pre-flight check of each standby profile
+	readinessStop       chan struct{}
+	checkReadiness      func(*VPNProfile) ProfileReadiness
+	remoteStats         map[string]map[string]*VPNRemoteStats // Attempts per profile remote since startup
+	remoteOrders        map[string]remoteOrder                // Latest latency order of each profile's remotes
+	orderRemotes        func(*VPNProfile) []VPNRemote         // Probes and orders a profile's remotes
+	rejectedCredentials map[string]time.Time                  // UpdatedAt of stored credentials each profile's server refused
+	totpSteps           map[string]int64                      // Last TOTP time step sent for each profile
+}
+
+// VPNProfileCounters counts connection lifecycle events for a profile since startup
+type VPNProfileCounters struct {
+	ConnectAttempts  int64 `json:"connect_attempts"`
+	ConnectFailures  int64 `json:"connect_failures"`
+	Connections      int64 `json:"connections"`
+	Reconnects       int64 `json:"reconnects"`
+	Disconnects      int64 `json:"disconnects"`
+	Failovers        int64 `json:"failovers"`
+	FailoverFailures int64 `json:"failover_failures"`
 }
 
 // FailoverThresholds defines when to trigger failover
@@ -60,9 +97,17 @@ type VPNProfileConfig struct {
 	ProfileID      string `json:"profile_id"`
 	Priority       int    `json:"priority"` // Lower number = higher priority
 	Enabled        bool   `json:"enabled"`
-	MaxRetries     int    `json:"max_retries"`
+	MaxRetries     int    `json:"max_retries"` // 0 = retry forever
 	RetryDelay     int    `json:"retry_delay_seconds"`
 	HealthRequired bool   `json:"health_required"` // Require health checks before considering stable
+
+	// Reconnect policy used when the tunnel drops and failover is disabled
+	AutoReconnect     bool    `json:"auto_reconnect"`
+	MaxRetryDelay     int     `json:"max_retry_delay_seconds"`
+	BackoffMultiplier float64 `json:"backoff_multiplier"`
+	Jitter            float64 `json:"jitter"` // fraction of the delay, 0-1
+	ResetAfter        int     `json:"reset_after_seconds"` // stable time before the retry count resets
+	RemoteSelection   string  `json:"remote_selection,omitempty"` // "ordered" (default) or "latency"
 }
 
 // VPNConnection represents an active VPN connection
@@ -74,6 +119,7 @@ type VPNConnection struct {
 	StatusFile    string           `json:"status_file"`
 	ConfigFile    string           `json:"config_file"`
 	StartedAt     time.Time        `json:"started_at"`
+	ConnectedAt   time.Time        `json:"connected_at,omitempty"`
 	LastSeen      time.Time        `json:"last_seen"`
 	State         string           `json:"state"` // "connecting", "connected", "disconnecting", "disconnected"
 	Interface     string           `json:"interface,omitempty"`
@@ -82,6 +128,27 @@ type VPNConnection struct {
 	BytesIn       int64            `json:"bytes_in"`
 	BytesOut      int64            `json:"bytes_out"`
 	Reconnects    int              `json:"reconnects"`
+
+	// Management interface
+	ManagementSocket string         `json:"management_socket,omitempty"`
+	OpenVPNState     string         `json:"openvpn_state,omitempty"` // CONNECTING, WAIT, AUTH, GET_CONFIG, CONNECTED, RECONNECTING, ...
+	StateDescription string         `json:"state_description,omitempty"`
+	StateChangedAt   time.Time      `json:"state_changed_at,omitempty"`
+	LastError        string         `json:"last_error,omitempty"`
+	PendingAuth      *VPNAuthPrompt `json:"pending_auth,omitempty"`
+	Statistics       *OpenVPNStatus `json:"statistics,omitempty"` // last parsed --status file
+	ConnectedRemote  string         `json:"connected_remote,omitempty"` // host:port of the remote in use
+
+	mgmt        *managementClient
+	exited      chan struct{} // closed when a process we started exits
+	credentials *VPNAuthAnswer
+	challenge   *dynamicChallenge
+
+	credentialsFromStore bool      // credentials were read from the credential store
+	storeVersion         time.Time // UpdatedAt of the stored credentials sent
+
+	remoteAttempt   string // remote OpenVPN is currently trying
+	remoteAttemptOK bool
 }
 
 // NewVPNConnectionManager creates a new connection manager
@@ -97,6 +164,19 @@ func NewVPNConnectionManager(vm *VPNManager, statePath string) *VPNConnectionMan
 		failoverProfiles:   make([]string, 0),
 		connectionAttempts: make(map[string]int),
 		failoverCooldown:   5 * time.Minute,
+		counters:           make(map[string]*VPNProfileCounters),
+		reconnectPending:   make(map[string]bool),
+		profileConfigs:     make(map[string]VPNProfileConfig),
+		jitterRand:         rand.Float64,
+		failback:           defaultFailbackPolicy(),
+		probeProfile:       probeProfileReadiness,
+		readiness:          make(map[string]ProfileReadiness),
+		checkReadiness:     checkProfileReadiness,
+		remoteStats:        make(map[string]map[string]*VPNRemoteStats),
+		remoteOrders:       make(map[string]remoteOrder),
+		orderRemotes:       orderRemotesByLatency,
+		rejectedCredentials: make(map[string]time.Time),
+		totpSteps:          make(map[string]int64),
 		failoverThresholds: FailoverThresholds{
 			MaxLatencyMs:        300.0,
 			MaxPacketLoss:       10.0,
@@ -106,11 +186,15 @@ func NewVPNConnectionManager(vm *VPNManager, statePath string) *VPNConnectionMan
 		},
 	}
 
+	cm.startProcess = cm.startOpenVPN
+
 	// Ensure directories exist
 	os.MkdirAll(statePath, 0755)
 	os.MkdirAll(cm.historyPath, 0755)
 
 	// Load existing state
+	cm.loadProfileConfigs()
+	cm.loadFailoverPolicy()
 	cm.loadConnectionState()
 	cm.loadConnectionHistory()
 
@@ -119,6 +203,8 @@ func NewVPNConnectionManager(vm *VPNManager, statePath string) *VPNConnectionMan
 
 // Connect establishes a VPN connection using the specified profile
 func (cm *VPNConnectionManager) Connect(profileID string) error {
+	cm.refreshRemoteOrder(profileID)
+
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
@@ -127,6 +213,8 @@ func (cm *VPNConnectionManager) Connect(profileID string) error {
 		return fmt.Errorf("VPN already connected to profile: %s", cm.activeConn.Profile.Name)
 	}
 
+	// An explicit connect supersedes any pending automatic retry
+	cm.cancelReconnect()
 	return cm.connectInternal(profileID)
 }
 
@@ -135,16 +223,23 @@ func (cm *VPNConnectionManager) Disconnect() error {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 	
+	cm.cancelReconnect()
 	return cm.disconnectInternal()
 }
 
 // disconnectInternal performs the actual disconnection (requires lock)
 func (cm *VPNConnectionManager) disconnectInternal() error {
+	return cm.disconnectInternalReason("user_requested")
+}
+
+// disconnectInternalReason disconnects, recording why in the history (requires lock)
+func (cm *VPNConnectionManager) disconnectInternalReason(reason string) error {
 	if cm.activeConn == nil {
 		return fmt.Errorf("no active connection")
 	}
 
 	conn := cm.activeConn
+	wasConnected := conn.State == "connected"
 	conn.State = "disconnecting"
 	cm.saveConnectionState()
 
@@ -163,16 +258,20 @@ func (cm *VPNConnectionManager) disconnectInternal() error {
 		Duration:         duration,
 		BytesReceived:    conn.BytesIn,
 		BytesSent:        conn.BytesOut,
-		DisconnectReason: "user_requested",
-		Success:          conn.State == "connected",
+		DisconnectReason: reason,
+		Success:          wasConnected,
+		Remote:           conn.ConnectedRemote,
 	}
 
 	cm.addConnectionHistory(history)
+	cm.profileCounters(conn.Profile.ID).Disconnects++
+	delete(cm.reconnectPending, conn.Profile.ID)
 
 	// Clean up temporary files
 	os.Remove(conn.ConfigFile)
 	os.Remove(conn.PidFile)
 	os.Remove(conn.StatusFile)
+	os.Remove(conn.ManagementSocket)
 
 	cm.activeConn = nil
 	cm.saveConnectionState()
@@ -183,15 +282,22 @@ func (cm *VPNConnectionManager) disconnectInternal() error {
 	return nil
 }
 
-// startOpenVPN starts the OpenVPN process
+// startOpenVPN starts the OpenVPN process and attaches to its management
+// interface. OpenVPN holds until we have subscribed to its state, and asks
+// for credentials over the interface rather than reading them itself.
 func (cm *VPNConnectionManager) startOpenVPN(conn *VPNConnection) error {
+	os.Remove(conn.ManagementSocket)
+
 	// Build OpenVPN command
 	args := []string{
 		"--config", conn.ConfigFile,
-		"--daemon",
 		"--log", conn.LogFile,
 		"--writepid", conn.PidFile,
 		"--status", conn.StatusFile, "10",
+		"--management", conn.ManagementSocket, "unix",
+		"--management-hold",
+		"--management-query-passwords",
+		"--management-query-remote",
 		"--script-security", "2",
 		"--up-delay",
 		"--up-restart",
@@ -200,9 +306,9 @@ func (cm *VPNConnectionManager) startOpenVPN(conn *VPNConnection) error {
 		"--verb", "3",
 	}
 
-	// Add auth file if required
-	if conn.Profile.AuthUserPass != "" && conn.Profile.AuthUserPass != "required" {
-		args = append(args, "--auth-user-pass", conn.Profile.AuthUserPass)
+	// Credentials are answered over the management interface
+	if conn.Profile.AuthUserPass != "" {
+		args = append(args, "--auth-user-pass")
 	}
 
 	// Start the process
@@ -215,46 +321,111 @@ func (cm *VPNConnectionManager) startOpenVPN(conn *VPNConnection) error {
 	}
 
 	conn.Process = cmd.Process
+	conn.exited = make(chan struct{})
+	go func(exited chan struct{}) {
+		cmd.Wait()
+		close(exited)
+	}(conn.exited)
 	log.Printf("Started OpenVPN process PID %d for profile %s", 
 		cmd.Process.Pid, conn.Profile.Name)
 
+	if err := cm.attachManagement(conn, managementDialTimeout, true); err != nil {
+		cmd.Process.Kill()
+		<-conn.exited
+		return err
+	}
+
 	return nil
 }
 
-// stopOpenVPN stops the OpenVPN process
+// stopOpenVPN asks OpenVPN to shut down through the management interface,
+// falling back to SIGTERM on the recorded PID, and kills it if it lingers
 func (cm *VPNConnectionManager) stopOpenVPN(conn *VPNConnection) error {
-	// Try to read PID from file
-	if pidData, err := os.ReadFile(conn.PidFile); err == nil {
-		if pid, err := strconv.Atoi(strings.TrimSpace(string(pidData))); err == nil {
-			if process, err := os.FindProcess(pid); err == nil {
-				log.Printf("Terminating OpenVPN process PID %d", pid)
-				if err := process.Signal(os.Interrupt); err == nil {
-					// Give it time to shut down gracefully
-					time.Sleep(2 * time.Second)
-					// Force kill if still running
-					process.Kill()
-				}
-			}
+	defer func() {
+		if conn.mgmt != nil {
+			conn.mgmt.Close()
+			conn.mgmt = nil
+		}
+	}()
+
+	if conn.mgmt != nil {
+		err := cm.shutdownViaManagement(conn)
+		if err == nil && conn.exited != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Warning: management shutdown failed: %v", err)
 		}
 	}
 
-	// Also try to kill by process if we have it
-	if conn.Process != nil {
-		conn.Process.Signal(os.Interrupt)
-		time.Sleep(2 * time.Second)
-		conn.Process.Kill()
+	process := conn.Process
+	if process == nil {
+		process = findPidFileProcess(conn.PidFile)
+	}
+	if process == nil {
+		return nil
 	}
 
-	// Kill any remaining OpenVPN processes (nuclear option)
-	exec.Command("pkill", "-f", "openvpn.*"+conn.Profile.ID).Run()
+	if conn.exited == nil {
+		// Not our child, so there is no Wait to tell us when it is gone
+		process.Signal(syscall.SIGTERM)
+		deadline := time.Now().Add(shutdownTimeout)
+		for time.Now().Before(deadline) {
+			if process.Signal(syscall.Signal(0)) != nil {
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		log.Printf("Warning: OpenVPN PID %d did not exit, killing it", process.Pid)
+		return process.Kill()
+	}
 
-	return nil
+	select {
+	case <-conn.exited:
+		return nil
+	default:
+	}
+	process.Signal(syscall.SIGTERM)
+	select {
+	case <-conn.exited:
+		return nil
+	case <-time.After(shutdownTimeout):
+		log.Printf("Warning: OpenVPN PID %d did not exit, killing it", process.Pid)
+		process.Kill()
+		<-conn.exited
+		return nil
+	}
 }
 
-// startConnectionMonitoring monitors the VPN connection status
+// findPidFileProcess returns the live process recorded in an OpenVPN PID file
+func findPidFileProcess(pidFile string) *os.Process {
+	pidData, err := os.ReadFile(pidFile)
+	if err != nil {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidData)))
+	if err != nil {
+		return nil
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+	// Send signal 0 to check if process exists
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		return nil
+	}
+	return process
+}
+
+// startConnectionMonitoring monitors the VPN connection status. Callers set
+// cm.monitoring under the lock before starting it, so only one runs.
 func (cm *VPNConnectionManager) startConnectionMonitoring() {
-	cm.monitoring = true
-	defer func() { cm.monitoring = false }()
+	defer func() {
+		cm.mutex.Lock()
+		cm.monitoring = false
+		cm.mutex.Unlock()
+	}()
 
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -286,6 +457,7 @@ func (cm *VPNConnectionManager) updateConnectionStatus(conn *VPNConnection) {
 	if !cm.isProcessRunning(conn) {
 		if conn.State == "connected" || conn.State == "connecting" {
 			log.Printf("OpenVPN process died unexpectedly for profile: %s", conn.Profile.Name)
+			wasConnected := conn.State == "connected"
 			conn.State = "disconnected"
 			
 			// Record failure in history
@@ -299,21 +471,27 @@ func (cm *VPNConnectionManager) updateConnectionStatus(conn *VPNConnection) {
 				BytesReceived:    conn.BytesIn,
 				BytesSent:        conn.BytesOut,
 				DisconnectReason: "process_died",
-				Success:          false,
+				Success:          wasConnected, // the tunnel was up before it dropped
+				Remote:           conn.ConnectedRemote,
 			}
+			cm.finishRemoteAttempt(conn, time.Now())
 			cm.addConnectionHistory(history)
+			cm.profileCounters(conn.Profile.ID).Disconnects++
+			cm.reconnectPending[conn.Profile.ID] = true
 			cm.activeConn = nil
 
 			// Attempt automatic failover if enabled
 			if cm.failoverEnabled {
 				log.Println("Attempting automatic failover due to connection failure")
-				go func() {
+				go func(failedID string) {
 					// Small delay to allow cleanup
 					time.Sleep(2 * time.Second)
-					if err := cm.performFailover(); err != nil {
+					if err := cm.triggerFailover(failedID, "process_died"); err != nil {
 						log.Printf("Automatic failover failed: %v", err)
 					}
-				}()
+				}(conn.Profile.ID)
+			} else {
+				cm.scheduleReconnect(conn.Profile.ID, "process_died")
 			}
 		}
 		return
@@ -321,13 +499,13 @@ func (cm *VPNConnectionManager) updateConnectionStatus(conn *VPNConnection) {
 
 	// Check for failover conditions if connected
 	if conn.State == "connected" || conn.State == "connecting" {
-		if cm.checkFailoverConditions(conn) {
+		if failover, reason := cm.checkFailoverConditions(conn); failover {
 			log.Println("Failover conditions met, attempting failover")
-			go func() {
-				if err := cm.performFailover(); err != nil {
+			go func(fromID string) {
+				if err := cm.triggerFailover(fromID, reason); err != nil {
 					log.Printf("Failover attempt failed: %v", err)
 				}
-			}()
+			}(conn.Profile.ID)
 			return
 		}
 	}
@@ -337,70 +515,67 @@ func (cm *VPNConnectionManager) updateConnectionStatus(conn *VPNConnection) {
 		cm.parseOpenVPNStatus(conn, string(statusData))
 	}
 
-	// Check for VPN interface
+	// Check for VPN interface; state changes come from the management
+	// interface when attached
 	if conn.State == "connecting" || conn.State == "connected" {
 		if iface := cm.detectVPNInterface(); iface != "" {
 			conn.Interface = iface
-			if conn.State == "connecting" {
-				conn.State = "connected"
-				log.Printf("VPN connection established for profile: %s (interface: %s)", 
-					conn.Profile.Name, conn.Interface)
+			if conn.State == "connecting" && conn.mgmt == nil {
+				cm.markConnected(conn)
 			}
 		}
 	}
 
-	// Update traffic statistics
-	if conn.Interface != "" {
+	// Fall back to kernel counters when neither the management interface nor
+	// the status file report traffic
+	if conn.Interface != "" && conn.mgmt == nil && conn.Statistics == nil {
 		if stats := cm.getInterfaceStats(conn.Interface); stats != nil {
 			conn.BytesIn = stats.BytesReceived
 			conn.BytesOut = stats.BytesSent
 		}
 	}
+
+	cm.checkReconnectStable(conn)
 }
 
-// parseOpenVPNStatus parses OpenVPN status file output
+// parseOpenVPNStatus parses OpenVPN status file output. Byte counts come from
+// the TCP/UDP link counters, matching what the management interface reports.
 func (cm *VPNConnectionManager) parseOpenVPNStatus(conn *VPNConnection, statusContent string) {
-	lines := strings.Split(statusContent, "\n")
-	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		
-		if strings.HasPrefix(line, "Virtual Address,") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 2 {
-				conn.LocalIP = parts[1]
-			}
-		} else if strings.HasPrefix(line, "Real Address,") {
-			parts := strings.Split(line, ",")
-			if len(parts) >= 2 {
-				conn.RemoteIP = parts[1]
-			}
-		}
+	status, err := parseOpenVPNStatusFile(statusContent)
+	if err != nil {
+		log.Printf("Warning: failed to parse OpenVPN status file %s: %v", conn.StatusFile, err)
+		return
+	}
+	conn.Statistics = status
+
+	if conn.mgmt == nil && status.Version > 0 {
+		conn.BytesIn = status.Counters.TCPUDPReadBytes
+		conn.BytesOut = status.Counters.TCPUDPWriteBytes
 	}
 }
 
 // isProcessRunning checks if the OpenVPN process is still running
 func (cm *VPNConnectionManager) isProcessRunning(conn *VPNConnection) bool {
-	// Check PID file
-	if pidData, err := os.ReadFile(conn.PidFile); err == nil {
-		if pid, err := strconv.Atoi(strings.TrimSpace(string(pidData))); err == nil {
-			if process, err := os.FindProcess(pid); err == nil {
-				// Send signal 0 to check if process exists
-				if err := process.Signal(os.Signal(0)); err == nil {
-					return true
-				}
-			}
+	// A process we started reports its own exit
+	if conn.exited != nil {
+		select {
+		case <-conn.exited:
+			return false
+		default:
+			return true
 		}
 	}
 
-	// Also check our stored process
-	if conn.Process != nil {
-		if err := conn.Process.Signal(os.Signal(0)); err == nil {
+	// An open management connection means OpenVPN is alive
+	if conn.mgmt != nil {
+		select {
+		case <-conn.mgmt.Closed():
+		default:
 			return true
 		}
 	}
 
-	return false
+	return findPidFileProcess(conn.PidFile) != nil
 }
 
 // detectVPNInterface detects the VPN network interface
@@ -428,8 +603,14 @@ func (cm *VPNConnectionManager) detectVPNInterface() string {
 	return ""
 }
 
+// interfaceStats holds kernel byte counters for a network interface
+type interfaceStats struct {
+	BytesReceived int64
+	BytesSent     int64
+}
+
 // getInterfaceStats gets network interface statistics
-func (cm *VPNConnectionManager) getInterfaceStats(iface string) *VPNHealthMetrics {
+func (cm *VPNConnectionManager) getInterfaceStats(iface string) *interfaceStats {
 	statsFile := fmt.Sprintf("/sys/class/net/%s/statistics", iface)
 	
 	rxBytesData, err1 := os.ReadFile(filepath.Join(statsFile, "rx_bytes"))
@@ -446,8 +627,9 @@ func (cm *VPNConnectionManager) getInterfaceStats(iface string) *VPNHealthMetric
 		return nil
 	}
 
-	return &VPNHealthMetrics{
-		LastHealthCheck: time.Now(),
+	return &interfaceStats{
+		BytesReceived: rxBytes,
+		BytesSent:     txBytes,
 	}
 }
 
@@ -457,12 +639,18 @@ func (cm *VPNConnectionManager) GetConnectionStatus() *VPNConnectionState {
 	defer cm.mutex.RUnlock()
 
 	if cm.activeConn == nil {
-		return &VPNConnectionState{
+		state := &VPNConnectionState{
 			Connected: false,
 			Health: VPNHealthMetrics{
 				LastHealthCheck: time.Now(),
 			},
 		}
+		if cm.reconnect != nil {
+			state.ProfileID = cm.reconnect.ProfileID
+			state.LastError = cm.reconnect.LastError
+		}
+		cm.applyReconnectStatus(state)
+		return state
 	}
 
 	conn := cm.activeConn
@@ -472,20 +660,28 @@ func (cm *VPNConnectionManager) GetConnectionStatus() *VPNConnectionState {
 		connectionTime = int(time.Since(conn.StartedAt).Seconds())
 	}
 
-	return &VPNConnectionState{
+	state := &VPNConnectionState{
 		ProfileID:      conn.Profile.ID,
 		Connected:      conn.State == "connected",
 		ConnectedAt:    &connectedAt,
 		ConnectionTime: connectionTime,
 		LocalIP:        conn.LocalIP,
 		RemoteIP:       conn.RemoteIP,
+		Remote:         conn.ConnectedRemote,
 		BytesReceived:  conn.BytesIn,
 		BytesSent:      conn.BytesOut,
+		LastError:      conn.LastError,
 		RetryCount:     conn.Reconnects,
+		OpenVPNState:   conn.OpenVPNState,
+		StateDetail:    conn.StateDescription,
+		PendingAuth:    conn.PendingAuth,
+		Statistics:     conn.Statistics,
 		Health: VPNHealthMetrics{
 			LastHealthCheck: conn.LastSeen,
 		},
 	}
+	cm.applyReconnectStatus(state)
+	return state
 }
 
 // GetConnectionHistory returns the connection history
@@ -499,6 +695,36 @@ func (cm *VPNConnectionManager) GetConnectionHistory() []*VPNConnectionHistory {
 	return history
 }
 
+// ConnectionTotals counts tunnels established across the recorded history and
+// the active connection. A reconnect is an established tunnel that follows a
+// session which ended without being requested.
+func (cm *VPNConnectionManager) ConnectionTotals() (connections, reconnects int) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	unexpectedEnd := false
+	for _, h := range cm.history {
+		if h.Event != "" {
+			continue
+		}
+		if h.Success {
+			connections++
+			if unexpectedEnd {
+				reconnects++
+			}
+		}
+		unexpectedEnd = h.DisconnectReason != "user_requested" && h.DisconnectReason != disconnectReasonProfileUpdated &&
+			h.DisconnectReason != historyEventFailover && h.DisconnectReason != historyEventFailback
+	}
+	if cm.activeConn != nil && cm.activeConn.State == "connected" {
+		connections++
+		if unexpectedEnd {
+			reconnects++
+		}
+	}
+	return connections, reconnects
+}
+
 // saveConnectionState saves the current connection state to disk
 func (cm *VPNConnectionManager) saveConnectionState() {
 	if cm.activeConn == nil {
@@ -507,17 +733,22 @@ func (cm *VPNConnectionManager) saveConnectionState() {
 		return
 	}
 
-	file, err := os.Create(cm.statusFile)
+	// The profile goes to disk with its secrets sealed
+	state := *cm.activeConn
+	sealed, err := cm.vm.sealProfile(state.Profile)
 	if err != nil {
 		log.Printf("Warning: failed to save connection state: %v", err)
 		return
 	}
-	defer file.Close()
+	state.Profile = sealed
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(cm.activeConn); err != nil {
+	data, err := json.MarshalIndent(&state, "", "  ")
+	if err != nil {
 		log.Printf("Warning: failed to encode connection state: %v", err)
+		return
+	}
+	if err := writePrivateFile(cm.statusFile, append(data, '\n')); err != nil {
+		log.Printf("Warning: failed to save connection state: %v", err)
 	}
 }
 
@@ -536,14 +767,30 @@ func (cm *VPNConnectionManager) loadConnectionState() {
 		log.Printf("Warning: failed to decode connection state: %v", err)
 		return
 	}
+	if conn.Profile == nil {
+		log.Printf("Warning: connection state has no profile")
+		return
+	}
+	if _, err := cm.vm.openProfile(conn.Profile); err != nil {
+		log.Printf("Warning: failed to decrypt connection state: %v", err)
+		return
+	}
 
 	// Verify the connection is still valid
 	if cm.isProcessRunning(&conn) {
 		cm.activeConn = &conn
+		conn.PendingAuth = nil
 		log.Printf("Restored VPN connection state for profile: %s", conn.Profile.Name)
+
+		if conn.ManagementSocket != "" {
+			if err := cm.attachManagement(&conn, time.Second, true); err != nil {
+				log.Printf("Warning: failed to reattach to OpenVPN management interface: %v", err)
+			}
+		}
 		
 		// Resume monitoring
 		if !cm.monitoring {
+			cm.monitoring = true
 			go cm.startConnectionMonitoring()
 		}
 	} else {
@@ -552,6 +799,7 @@ func (cm *VPNConnectionManager) loadConnectionState() {
 		os.Remove(conn.ConfigFile)
 		os.Remove(conn.PidFile)
 		os.Remove(conn.StatusFile)
+		os.Remove(conn.ManagementSocket)
 		os.Remove(cm.statusFile)
 	}
 }
@@ -605,7 +853,7 @@ func (cm *VPNConnectionManager) loadConnectionHistory() {
 }
 
 // EnableFailover enables automatic failover with the specified profile list
-func (cm *VPNConnectionManager) EnableFailover(profileIDs []string, thresholds *FailoverThresholds) error {
+func (cm *VPNConnectionManager) EnableFailover(profileIDs []string, thresholds *FailoverThresholds, failbackPolicy *FailbackPolicy) error {
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
@@ -620,17 +868,34 @@ func (cm *VPNConnectionManager) EnableFailover(profileIDs []string, thresholds *
 		}
 	}
 
+	// Nothing is applied unless the failback settings are valid too. Without
+	// new settings, a preferred profile dropped from the list falls back to
+	// the first one.
+	failback := cm.failback
+	if failbackPolicy != nil {
+		if err := failbackPolicy.Validate(profileIDs); err != nil {
+			return err
+		}
+		failback = *failbackPolicy
+	} else if failback.PreferredProfile != "" && failback.Validate(profileIDs) != nil {
+		failback.PreferredProfile = ""
+	}
+
 	cm.failoverEnabled = true
 	cm.failoverProfiles = profileIDs
 	if thresholds != nil {
 		cm.failoverThresholds = *thresholds
 	}
+	cm.failback = failback
 
 	// Reset connection attempts
 	cm.connectionAttempts = make(map[string]int)
+	cm.resetPreferredHealth()
+	cm.restartFailbackMonitor()
+	cm.restartReadinessMonitor()
 
 	log.Printf("Failover enabled with %d profiles", len(profileIDs))
-	return nil
+	return cm.saveFailoverPolicy()
 }
 
 // DisableFailover disables automatic failover
@@ -640,6 +905,11 @@ func (cm *VPNConnectionManager) DisableFailover() {
 
 	cm.failoverEnabled = false
 	cm.failoverProfiles = make([]string, 0)
+	cm.restartFailbackMonitor()
+	cm.restartReadinessMonitor()
+	if err := cm.saveFailoverPolicy(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
 	log.Println("Failover disabled")
 }
 
@@ -684,7 +954,11 @@ func (cm *VPNConnectionManager) connectInternal(profileID string) error {
 		return fmt.Errorf("profile not found: %s", profileID)
 	}
 
+	counters := cm.profileCounters(profileID)
+	counters.ConnectAttempts++
+
 	if !profile.Validated {
+		counters.ConnectFailures++
 		return fmt.Errorf("profile not validated: %s", profile.ValidationError)
 	}
 
@@ -705,15 +979,24 @@ func (cm *VPNConnectionManager) connectInternal(profileID string) error {
 		LogFile:    filepath.Join(cm.statePath, fmt.Sprintf("openvpn_%s.log", profile.ID)),
 		StatusFile: filepath.Join(cm.statePath, fmt.Sprintf("openvpn_%s.status", profile.ID)),
 		ConfigFile: filepath.Join(cm.statePath, fmt.Sprintf("temp_%s.ovpn", profile.ID)),
+		ManagementSocket: cm.managementSocketPath(profile.ID),
 	}
 
-	// Export profile to temporary config file
-	if err := cm.vm.ExportProfile(profileID, conn.ConfigFile); err != nil {
-		return fmt.Errorf("failed to export profile config: %v", err)
+	// Export profile to temporary config file, fastest remote first if asked
+	var exportErr error
+	if cm.profileConfig(profileID).RemoteSelection == remoteSelectionLatency && len(profile.Remote) > 1 {
+		exportErr = cm.exportLatencyOrdered(profile, conn.ConfigFile)
+	} else {
+		exportErr = cm.vm.ExportProfile(profileID, conn.ConfigFile)
+	}
+	if exportErr != nil {
+		counters.ConnectFailures++
+		return fmt.Errorf("failed to export profile config: %v", exportErr)
 	}
 
 	// Start OpenVPN process
-	if err := cm.startOpenVPN(conn); err != nil {
+	if err := cm.startProcess(conn); err != nil {
+		counters.ConnectFailures++
 		return fmt.Errorf("failed to start OpenVPN: %v", err)
 	}
 
@@ -724,6 +1007,7 @@ func (cm *VPNConnectionManager) connectInternal(profileID string) error {
 
 	// Start monitoring if not already running
 	if !cm.monitoring {
+		cm.monitoring = true
 		go cm.startConnectionMonitoring()
 	}
 
@@ -731,15 +1015,15 @@ func (cm *VPNConnectionManager) connectInternal(profileID string) error {
 	return nil
 }
 
-// checkFailoverConditions checks if failover should be triggered
-func (cm *VPNConnectionManager) checkFailoverConditions(conn *VPNConnection) bool {
+// checkFailoverConditions checks if failover should be triggered and why
+func (cm *VPNConnectionManager) checkFailoverConditions(conn *VPNConnection) (bool, string) {
 	if !cm.failoverEnabled || len(cm.failoverProfiles) <= 1 {
-		return false
+		return false, ""
 	}
 
 	// Don't failover too frequently
 	if time.Since(cm.lastFailoverTime) < cm.failoverCooldown {
-		return false
+		return false, ""
 	}
 
 	// Get current health metrics if available
@@ -748,72 +1032,110 @@ func (cm *VPNConnectionManager) checkFailoverConditions(conn *VPNConnection) boo
 		if currentHealth != nil && currentHealth.Connected {
 			// Check latency threshold
 			if currentHealth.Latency > cm.failoverThresholds.MaxLatencyMs {
-				log.Printf("Failover triggered by high latency: %.2f ms", currentHealth.Latency)
-				return true
+				reason := fmt.Sprintf("high latency: %.2f ms", currentHealth.Latency)
+				log.Printf("Failover triggered by %s", reason)
+				return true, reason
 			}
 
 			// Check packet loss threshold
 			if currentHealth.PacketLoss > cm.failoverThresholds.MaxPacketLoss {
-				log.Printf("Failover triggered by high packet loss: %.2f%%", currentHealth.PacketLoss)
-				return true
+				reason := fmt.Sprintf("high packet loss: %.2f%%", currentHealth.PacketLoss)
+				log.Printf("Failover triggered by %s", reason)
+				return true, reason
 			}
 		}
 	}
 
 	// Check connection time (if taking too long to establish)
 	if conn.State == "connecting" && time.Since(conn.StartedAt) > cm.failoverThresholds.MaxConnectionTime {
-		log.Printf("Failover triggered by connection timeout: %v", time.Since(conn.StartedAt))
-		return true
+		reason := fmt.Sprintf("connection timeout: %v", time.Since(conn.StartedAt).Round(time.Second))
+		log.Printf("Failover triggered by %s", reason)
+		return true, reason
 	}
 
-	return false
+	return false, ""
 }
 
-// performFailover performs automatic failover to the next available profile
-func (cm *VPNConnectionManager) performFailover() error {
+// performFailover moves from a failing profile to the next available one in
+// priority order, recording the decision in history (requires lock)
+func (cm *VPNConnectionManager) performFailover(fromProfileID, reason string) error {
 	if !cm.failoverEnabled || len(cm.failoverProfiles) <= 1 {
 		return fmt.Errorf("failover not enabled or insufficient profiles")
 	}
 
-	// Find current profile index
-	currentProfileID := ""
+	// The failing connection may already be gone, e.g. after its process died
 	if cm.activeConn != nil {
-		currentProfileID = cm.activeConn.Profile.ID
+		fromProfileID = cm.activeConn.Profile.ID
 	}
 
 	currentIndex := -1
 	for i, profileID := range cm.failoverProfiles {
-		if profileID == currentProfileID {
+		if profileID == fromProfileID {
 			currentIndex = i
 			break
 		}
 	}
 
-	// Try next profiles in order
+	// Consider the other profiles in order after the current one
+	candidates := make([]string, 0, len(cm.failoverProfiles))
 	startIndex := (currentIndex + 1) % len(cm.failoverProfiles)
-	for i := 0; i < len(cm.failoverProfiles)-1; i++ {
+	for i := 0; i < len(cm.failoverProfiles); i++ {
 		nextIndex := (startIndex + i) % len(cm.failoverProfiles)
 		nextProfileID := cm.failoverProfiles[nextIndex]
+		if nextProfileID == fromProfileID {
+			continue
+		}
 
 		// Skip if max attempts exceeded
 		if cm.connectionAttempts[nextProfileID] >= cm.failoverThresholds.MaxFailedAttempts {
 			continue
 		}
+		candidates = append(candidates, nextProfileID)
+	}
+
+	// Prefer the healthiest standby and skip those known to be unreachable
+	ordered, skipped := cm.rankFailoverCandidates(candidates, time.Now())
+	for id, why := range skipped {
+		log.Printf("Skipping failover to profile %s: not ready: %s", id, why)
+	}
+	if len(ordered) == 0 {
+		outcome := "all failover profiles failed"
+		if len(skipped) > 0 {
+			outcome = "no standby profile ready"
+		}
+		cm.recordFailoverDecision(historyEventFailover, fromProfileID, "", reason+"; "+outcome, false)
+		return fmt.Errorf("%s", outcome)
+	}
+
+	if cm.activeConn != nil {
+		if err := cm.disconnectInternalReason(historyEventFailover); err != nil {
+			log.Printf("Warning: failed to disconnect failing profile: %v", err)
+		}
+	}
 
+	for _, nextProfileID := range ordered {
 		log.Printf("Attempting failover to profile: %s", nextProfileID)
 		if err := cm.connectInternal(nextProfileID); err != nil {
 			cm.connectionAttempts[nextProfileID]++
+			cm.profileCounters(nextProfileID).FailoverFailures++
 			log.Printf("Failover to profile %s failed: %v", nextProfileID, err)
 			continue
 		}
 
 		// Successful failover
+		cm.profileCounters(nextProfileID).Failovers++
 		cm.lastFailoverTime = time.Now()
 		cm.connectionAttempts[nextProfileID] = 0
+		cm.resetPreferredHealth()
+		cm.recordFailoverDecision(historyEventFailover, fromProfileID, nextProfileID, reason, true)
+		if err := cm.saveFailoverPolicy(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
 		log.Printf("Failover successful to profile: %s", nextProfileID)
 		return nil
 	}
 
+	cm.recordFailoverDecision(historyEventFailover, fromProfileID, "", reason+"; all failover profiles failed", false)
 	return fmt.Errorf("all failover profiles failed")
 }
 
@@ -836,9 +1158,55 @@ func (cm *VPNConnectionManager) GetFailoverStatus() map[string]interface{} {
 		status["current_profile_name"] = cm.activeConn.Profile.Name
 	}
 
+	failback := map[string]interface{}{
+		"policy":            cm.failback,
+		"preferred_profile": cm.preferredProfile(),
+	}
+	if !cm.preferredUpSince.IsZero() {
+		failback["preferred_healthy_since"] = cm.preferredUpSince
+	}
+	if cm.preferredProbeErr != "" {
+		failback["preferred_probe_error"] = cm.preferredProbeErr
+	}
+	if !cm.preferredProbedAt.IsZero() {
+		failback["last_probe"] = cm.preferredProbedAt
+	}
+	if cm.failback.Enabled && !cm.lastFailoverTime.IsZero() {
+		failback["hold_down_until"] = cm.lastFailoverTime.Add(time.Duration(cm.failback.HoldDownMinutes) * time.Minute)
+	}
+	status["failback"] = failback
+
+	readiness := make(map[string]ProfileReadiness, len(cm.readiness))
+	for id, r := range cm.readiness {
+		readiness[id] = r
+	}
+	status["readiness"] = readiness
+
 	return status
 }
 
+// profileCounters returns the lifecycle counters for a profile (requires lock)
+func (cm *VPNConnectionManager) profileCounters(profileID string) *VPNProfileCounters {
+	counters, exists := cm.counters[profileID]
+	if !exists {
+		counters = &VPNProfileCounters{}
+		cm.counters[profileID] = counters
+	}
+	return counters
+}
+
+// GetProfileCounters returns a copy of the lifecycle counters for every profile seen since startup
+func (cm *VPNConnectionManager) GetProfileCounters() map[string]VPNProfileCounters {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	counters := make(map[string]VPNProfileCounters, len(cm.counters))
+	for id, c := range cm.counters {
+		counters[id] = *c
+	}
+	return counters
+}
+
 // ResetConnectionAttempts resets the failed connection attempt counters
 func (cm *VPNConnectionManager) ResetConnectionAttempts() {
 	cm.mutex.Lock()
@@ -856,6 +1224,15 @@ func (cm *VPNConnectionManager) Stop() {
 	if cm.monitoring {
 		cm.monitorStop <- true
 	}
+	cm.cancelReconnect()
+	if cm.failbackStop != nil {
+		close(cm.failbackStop)
+		cm.failbackStop = nil
+	}
+	if cm.readinessStop != nil {
+		close(cm.readinessStop)
+		cm.readinessStop = nil
+	}
 
 	if cm.activeConn != nil {
 		cm.disconnectInternal()
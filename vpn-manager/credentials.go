@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// VPNCredentials are the stored auth-user-pass credentials of a profile.
+// TOTPSecret, when set, answers static-challenge and server OTP prompts.
+type VPNCredentials struct {
+	Username   string    `json:"username"`
+	Password   string    `json:"password"`
+	TOTPSecret string    `json:"totp_secret,omitempty"` // base32, as shown by authenticator enrolment
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// VPNCredentialStatus describes a profile's stored credentials without
+// revealing them
+type VPNCredentialStatus struct {
+	ProfileID   string    `json:"profile_id"`
+	Stored      bool      `json:"stored"`
+	Username    string    `json:"username,omitempty"`
+	HasPassword bool      `json:"has_password"`
+	HasTOTP     bool      `json:"has_totp"`
+	UpdatedAt   time.Time `json:"updated_at,omitempty"`
+}
+
+// credentialField names a sealed credential field; the profile ID is part of
+// it so a credential file cannot be copied to another profile
+func credentialField(profileID, field string) string {
+	return "credentials/" + profileID + "/" + field
+}
+
+// normalizeTOTPSecret strips the spacing and padding authenticator apps show
+func normalizeTOTPSecret(secret string) string {
+	secret = strings.ToUpper(strings.Join(strings.Fields(secret), ""))
+	return strings.TrimRight(secret, "=")
+}
+
+// totpStep is the RFC 6238 time step; one code is valid for each
+const totpStep = 30
+
+// totpCode returns the RFC 6238 code for a base32 secret: HMAC-SHA1, six
+// digits, 30 second steps
+func totpCode(secret string, now time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalizeTOTPSecret(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/totpStep))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// LoadCredentials returns a profile's stored credentials, or nil when none
+// are stored. Files written before the store existed hold the username and
+// password in plain text; stale reports those, and files sealed with an old
+// key, so they can be rewritten.
+func (vm *VPNManager) LoadCredentials(profileID string) (creds *VPNCredentials, stale bool, err error) {
+	data, err := os.ReadFile(vm.profileAuthPath(profileID))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read credentials: %v", err)
+	}
+
+	var sealed VPNCredentials
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		legacy := readAuthFile(vm.profileAuthPath(profileID))
+		if legacy == nil {
+			return nil, false, fmt.Errorf("failed to decode credentials: %v", err)
+		}
+		return &VPNCredentials{Username: legacy.Username, Password: legacy.Password}, true, nil
+	}
+
+	creds = &VPNCredentials{UpdatedAt: sealed.UpdatedAt}
+	for _, f := range []struct {
+		name          string
+		sealed, value *string
+	}{
+		{"username", &sealed.Username, &creds.Username},
+		{"password", &sealed.Password, &creds.Password},
+		{"totp_secret", &sealed.TOTPSecret, &creds.TOTPSecret},
+	} {
+		value, old, err := vm.secrets.open(credentialField(profileID, f.name), *f.sealed)
+		if err != nil {
+			return nil, false, err
+		}
+		*f.value = value
+		stale = stale || old
+	}
+	return creds, stale, nil
+}
+
+// storeCredentials seals credentials into the profile's credential file
+func (vm *VPNManager) storeCredentials(profileID string, creds *VPNCredentials) error {
+	sealed := VPNCredentials{UpdatedAt: creds.UpdatedAt}
+	for _, f := range []struct {
+		name          string
+		value, sealed *string
+	}{
+		{"username", &creds.Username, &sealed.Username},
+		{"password", &creds.Password, &sealed.Password},
+		{"totp_secret", &creds.TOTPSecret, &sealed.TOTPSecret},
+	} {
+		value, err := vm.secrets.seal(credentialField(profileID, f.name), *f.value)
+		if err != nil {
+			return fmt.Errorf("failed to seal credentials: %v", err)
+		}
+		*f.sealed = value
+	}
+
+	data, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %v", err)
+	}
+	os.MkdirAll(vm.profilesPath, 0700)
+	if err := writePrivateFile(vm.profileAuthPath(profileID), data); err != nil {
+		return fmt.Errorf("failed to save credentials: %v", err)
+	}
+	return nil
+}
+
+// SetCredentials validates and stores a profile's credentials, then answers
+// the active connection's prompt with them if it is waiting
+func (vm *VPNManager) SetCredentials(profileID string, creds VPNCredentials) (*VPNCredentialStatus, error) {
+	profile, exists := vm.GetProfile(profileID)
+	if !exists {
+		return nil, errProfileNotFound
+	}
+	if profile.AuthUserPass == "" {
+		return nil, fmt.Errorf("profile %s does not use auth-user-pass", profile.Name)
+	}
+	if creds.Username == "" || creds.Password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+	if strings.ContainsAny(creds.Username, "\r\n") || strings.ContainsAny(creds.Password, "\r\n") {
+		return nil, fmt.Errorf("username and password must be single lines")
+	}
+	if creds.TOTPSecret != "" {
+		creds.TOTPSecret = normalizeTOTPSecret(creds.TOTPSecret)
+		if _, err := totpCode(creds.TOTPSecret, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	creds.UpdatedAt = time.Now()
+	if err := vm.storeCredentials(profileID, &creds); err != nil {
+		return nil, err
+	}
+	// A credentials file path from before the store is replaced by it
+	if profile.AuthUserPass != "required" {
+		updated := *profile
+		updated.AuthUserPass = "required"
+		updated.LastModified = time.Now()
+		if err := vm.SaveProfile(&updated); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Stored credentials for profile %s", profile.Name)
+	vm.connectionManager.credentialsChanged(profileID)
+	return vm.GetCredentialStatus(profileID)
+}
+
+// ClearCredentials removes a profile's stored credentials
+func (vm *VPNManager) ClearCredentials(profileID string) error {
+	profile, exists := vm.GetProfile(profileID)
+	if !exists {
+		return errProfileNotFound
+	}
+	if err := os.Remove(vm.profileAuthPath(profileID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove credentials: %v", err)
+	}
+	if profile.AuthUserPass == vm.profileAuthPath(profileID) {
+		updated := *profile
+		updated.AuthUserPass = "required"
+		if err := vm.SaveProfile(&updated); err != nil {
+			return err
+		}
+	}
+	log.Printf("Cleared credentials for profile %s", profile.Name)
+	return nil
+}
+
+// GetCredentialStatus reports whether credentials are stored for a profile
+func (vm *VPNManager) GetCredentialStatus(profileID string) (*VPNCredentialStatus, error) {
+	if _, exists := vm.GetProfile(profileID); !exists {
+		return nil, errProfileNotFound
+	}
+	creds, _, err := vm.LoadCredentials(profileID)
+	if err != nil {
+		return nil, err
+	}
+	status := &VPNCredentialStatus{ProfileID: profileID}
+	if creds != nil {
+		status.Stored = true
+		status.Username = creds.Username
+		status.HasPassword = creds.Password != ""
+		status.HasTOTP = creds.TOTPSecret != ""
+		status.UpdatedAt = creds.UpdatedAt
+	}
+	return status, nil
+}
+
+// migrateCredentials moves credentials written in plain text before the
+// store existed into it, and reseals ones sealed with an old key
+func (vm *VPNManager) migrateCredentials(profile *VPNProfile) error {
+	creds, stale, err := vm.LoadCredentials(profile.ID)
+	if err != nil || creds == nil {
+		return err
+	}
+	if stale {
+		if creds.UpdatedAt.IsZero() {
+			creds.UpdatedAt = time.Now()
+		}
+		if err := vm.storeCredentials(profile.ID, creds); err != nil {
+			return err
+		}
+	}
+	if profile.AuthUserPass == vm.profileAuthPath(profile.ID) {
+		updated := *profile
+		updated.AuthUserPass = "required"
+		return vm.SaveProfile(&updated)
+	}
+	return nil
+}
+
+// storedAnswer returns the stored credentials for a connection's profile,
+// unless the server refused them before. A refusal holds across connections
+// until the credentials are stored again (requires lock)
+func (cm *VPNConnectionManager) storedAnswer(conn *VPNConnection) *VPNCredentials {
+	creds, _, err := cm.vm.LoadCredentials(conn.Profile.ID)
+	if err != nil {
+		log.Printf("Warning: failed to load credentials for profile %s: %v", conn.Profile.Name, err)
+		return nil
+	}
+	if rejected, ok := cm.rejectedCredentials[conn.Profile.ID]; ok && creds != nil && rejected.Equal(creds.UpdatedAt) {
+		return nil
+	}
+	return creds
+}
+
+// credentialsChanged answers a prompt the active connection of a profile is
+// waiting on with newly stored credentials
+func (cm *VPNConnectionManager) credentialsChanged(profileID string) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	delete(cm.rejectedCredentials, profileID)
+	conn := cm.activeConn
+	if conn == nil || conn.Profile.ID != profileID {
+		return
+	}
+	if conn.PendingAuth != nil {
+		cm.answerPendingAuth(conn)
+		cm.saveConnectionState()
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1 at T=59
+	if code, err := totpCode(testTOTPSecret, time.Unix(59, 0)); err != nil || code != "287082" {
+		t.Errorf("totpCode = %q, %v, want 287082", code, err)
+	}
+}
+
+// credentialAPIKey is configured by newCredentialTest and sent by
+// credentialRequest
+const credentialAPIKey = "admin-key"
+
+// newCredentialTest saves office_1, which prompts for credentials, and
+// plain_1, which does not
+func newCredentialTest(t *testing.T) (*VPNManager, *VPNProfile) {
+	t.Helper()
+	t.Setenv("NOC_RAVEN_API_KEY", credentialAPIKey)
+	vm := newTestVPNManager(t)
+	profile := &VPNProfile{ID: "office_1", Name: "office", AuthUserPass: "required"}
+	plain := &VPNProfile{ID: "plain_1", Name: "plain"}
+	for _, p := range []*VPNProfile{profile, plain} {
+		vm.profiles[p.ID] = p
+		if err := vm.SaveProfile(p); err != nil {
+			t.Fatalf("SaveProfile: %v", err)
+		}
+	}
+	return vm, profile
+}
+
+func credentialRequest(vm *VPNManager, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-API-Key", credentialAPIKey)
+	vm.setupRoutes().ServeHTTP(rec, req)
+	return rec
+}
+
+// storeOfficeCredentials stores alice's password and TOTP secret through the API
+func storeOfficeCredentials(t *testing.T, vm *VPNManager) VPNCredentialStatus {
+	t.Helper()
+	// The secret as an authenticator app shows it: lower case and grouped
+	totp := "gezd gnbv gy3t qojq gezd gnbv gy3t qojq"
+	rec := credentialRequest(vm, "PUT", "/api/vpn/profiles/office_1/credentials", `{"username":"alice","password":"s3cret","totp_secret":"`+totp+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT credentials = %d %s", rec.Code, rec.Body.String())
+	}
+	var status VPNCredentialStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	return status
+}
+
+func TestHandleSetCredentials_Rejects(t *testing.T) {
+	vm, _ := newCredentialTest(t)
+	for _, tc := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/api/vpn/profiles/missing/credentials", `{"username":"a","password":"b"}`, http.StatusNotFound},
+		{"/api/vpn/profiles/plain_1/credentials", `{"username":"a","password":"b"}`, http.StatusBadRequest},
+		{"/api/vpn/profiles/office_1/credentials", `{"username":"alice"}`, http.StatusBadRequest},
+		{"/api/vpn/profiles/office_1/credentials", `{"username":"alice","password":"a\nb"}`, http.StatusBadRequest},
+		{"/api/vpn/profiles/office_1/credentials", `{"username":"alice","password":"pw","totp_secret":"not base32!"}`, http.StatusBadRequest},
+	} {
+		if rec := credentialRequest(vm, "PUT", tc.path, tc.body); rec.Code != tc.code {
+			t.Errorf("PUT %s %s = %d, want %d: %s", tc.path, tc.body, rec.Code, tc.code, rec.Body.String())
+		}
+	}
+}
+
+func TestHandleSetCredentials_SealedAndRedacted(t *testing.T) {
+	vm, profile := newCredentialTest(t)
+	status := storeOfficeCredentials(t, vm)
+	if !status.Stored || status.Username != "alice" || !status.HasPassword || !status.HasTOTP {
+		t.Errorf("PUT credentials status = %+v", status)
+	}
+	if rec := credentialRequest(vm, "GET", "/api/vpn/profiles/office_1/credentials", ""); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "s3cret") || strings.Contains(rec.Body.String(), "GEZD") {
+		t.Errorf("GET credentials = %d %s", rec.Code, rec.Body.String())
+	}
+	data, err := os.ReadFile(vm.profileAuthPath(profile.ID))
+	if err != nil || strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "GEZD") || !strings.Contains(string(data), "enc:v1:") {
+		t.Errorf("credential file = %s, %v", data, err)
+	}
+	if info, err := os.Stat(vm.profileAuthPath(profile.ID)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("credential file mode = %v, %v", info, err)
+	}
+}
+
+func TestHandleClearCredentials(t *testing.T) {
+	vm, profile := newCredentialTest(t)
+	storeOfficeCredentials(t, vm)
+	if rec := credentialRequest(vm, "DELETE", "/api/vpn/profiles/office_1/credentials", ""); rec.Code != http.StatusOK {
+		t.Errorf("DELETE credentials = %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(vm.profileAuthPath(profile.ID)); !os.IsNotExist(err) {
+		t.Errorf("credential file still present: %v", err)
+	}
+	if status, _ := vm.GetCredentialStatus(profile.ID); status == nil || status.Stored {
+		t.Errorf("status after clear = %+v", status)
+	}
+}
+
+// Stored credentials are secrets, so every route needs the API key
+func TestCredentialRoutes_NeedAPIKey(t *testing.T) {
+	cases := []struct {
+		name       string
+		configured string
+		apiKey     string
+	}{
+		{"unconfigured", "", ""},
+		{"unconfigured with a key", "", credentialAPIKey},
+		{"missing key", credentialAPIKey, ""},
+		{"wrong key", credentialAPIKey, "wrong"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm, profile := newCredentialTest(t)
+			storeOfficeCredentials(t, vm)
+			t.Setenv("NOC_RAVEN_API_KEY", tc.configured)
+
+			for _, route := range []struct{ method, body string }{
+				{"GET", ""},
+				{"PUT", `{"username":"mallory","password":"pw"}`},
+				{"DELETE", ""},
+			} {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(route.method, "/api/vpn/profiles/office_1/credentials", strings.NewReader(route.body))
+				if tc.apiKey != "" {
+					req.Header.Set("X-API-Key", tc.apiKey)
+				}
+				vm.setupRoutes().ServeHTTP(rec, req)
+				if rec.Code != http.StatusForbidden {
+					t.Errorf("%s credentials = %d, want 403: %s", route.method, rec.Code, rec.Body.String())
+				}
+			}
+			if status, _ := vm.GetCredentialStatus(profile.ID); status == nil || !status.Stored || status.Username != "alice" {
+				t.Errorf("status after refused requests = %+v", status)
+			}
+		})
+	}
+}
+
+// attachOffice attaches a connecting office_1 to a fake management interface
+// that prompts for a static challenge
+func attachOffice(t *testing.T, vm *VPNManager, profile *VPNProfile, setup func(cm *VPNConnectionManager)) *fakeManagement {
+	t.Helper()
+	cm := vm.connectionManager
+	conn := &VPNConnection{
+		Profile:          profile,
+		StartedAt:        time.Now(),
+		State:            "connecting",
+		PidFile:          cm.statePath + "/missing.pid",
+		ManagementSocket: cm.managementSocketPath(profile.ID),
+	}
+	fm := newFakeManagement(t, conn.ManagementSocket)
+	cm.mutex.Lock()
+	if setup != nil {
+		setup(cm)
+	}
+	cm.activeConn = conn
+	err := cm.attachManagement(conn, time.Second, true)
+	cm.mutex.Unlock()
+	if err != nil {
+		t.Fatalf("attachManagement: %v", err)
+	}
+	return fm
+}
+
+// disconnectCommands disconnects and returns the commands fm received
+func disconnectCommands(t *testing.T, cm *VPNConnectionManager, fm *fakeManagement) []string {
+	t.Helper()
+	if err := cm.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	close(fm.commands)
+	commands := make([]string, 0)
+	for cmd := range fm.commands {
+		commands = append(commands, cmd)
+	}
+	return commands
+}
+
+// A connection stopping at the static challenge is answered from the store
+func TestCredentialStore_AnswersChallenge(t *testing.T) {
+	vm, profile := newCredentialTest(t)
+	cm := vm.connectionManager
+	storeOfficeCredentials(t, vm)
+	fm := attachOffice(t, vm, profile, nil)
+	waitFor(t, "connected", func() bool { return cm.GetConnectionStatus().Connected })
+
+	var username, password string
+	for _, cmd := range disconnectCommands(t, cm, fm) {
+		switch {
+		case strings.HasPrefix(cmd, "username "):
+			username = cmd
+		case strings.HasPrefix(cmd, "password "):
+			password = cmd
+		}
+	}
+	if username != `username "Auth" "alice"` {
+		t.Errorf("username command = %q", username)
+	}
+	now := time.Now()
+	matched := false
+	for _, at := range []time.Time{now, now.Add(-30 * time.Second)} {
+		code, _ := totpCode(testTOTPSecret, at)
+		want := fmt.Sprintf(`password "Auth" "SCRV1:%s:%s"`,
+			base64.StdEncoding.EncodeToString([]byte("s3cret")), base64.StdEncoding.EncodeToString([]byte(code)))
+		matched = matched || password == want
+	}
+	if !matched {
+		t.Errorf("password command = %q", password)
+	}
+}
+
+// A plain-text credentials file from before the store is sealed on load and
+// the profile pointed at the store
+func TestLoadProfiles_SealsPlaintextCredentials(t *testing.T) {
+	vm, profile := newCredentialTest(t)
+	profile.AuthUserPass = vm.profileAuthPath(profile.ID)
+	if err := vm.SaveProfile(profile); err != nil {
+		t.Fatalf("SaveProfile: %v", err)
+	}
+	if err := os.WriteFile(vm.profileAuthPath(profile.ID), []byte("bob\nhunter2\n"), 0644); err != nil {
+		t.Fatalf("write legacy auth file: %v", err)
+	}
+	reloaded := NewVPNManager(vm.profilesPath, vm.statePath)
+	if err := reloaded.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+	creds, stale, err := reloaded.LoadCredentials(profile.ID)
+	if err != nil || stale || creds == nil || creds.Username != "bob" || creds.Password != "hunter2" {
+		t.Errorf("migrated credentials = %+v stale=%v, %v", creds, stale, err)
+	}
+	if p := reloaded.profiles[profile.ID]; p == nil || p.AuthUserPass != "required" {
+		t.Errorf("migrated profile = %+v", p)
+	}
+	if data, _ := os.ReadFile(vm.profileAuthPath(profile.ID)); strings.Contains(string(data), "hunter2") {
+		t.Errorf("legacy credentials left in plain text: %s", data)
+	}
+}
+
+func storeAliceCredentials(t *testing.T, vm *VPNManager, password string) *VPNCredentials {
+	t.Helper()
+	creds := VPNCredentials{Username: "alice", Password: password, TOTPSecret: testTOTPSecret}
+	if _, err := vm.SetCredentials("office_1", creds); err != nil {
+		t.Fatalf("SetCredentials: %v", err)
+	}
+	stored, _, _ := vm.LoadCredentials("office_1")
+	return stored
+}
+
+// A refusal holds for the next connection, as after auth-retry none, until
+// credentials are stored again
+func TestCredentialStore_RefusalHoldsUntilReplaced(t *testing.T) {
+	vm, profile := newCredentialTest(t)
+	cm := vm.connectionManager
+	answerFor := func() *VPNCredentials {
+		cm.mutex.Lock()
+		defer cm.mutex.Unlock()
+		return cm.storedAnswer(&VPNConnection{Profile: profile})
+	}
+
+	stored := storeAliceCredentials(t, vm, "s3cret")
+	rejected := &VPNConnection{Profile: profile, credentialsFromStore: true, storeVersion: stored.UpdatedAt}
+	cm.mutex.Lock()
+	cm.handlePasswordEvent(rejected, "Verification Failed: 'Auth'")
+	cm.mutex.Unlock()
+	if answer := answerFor(); answer != nil || rejected.LastError != "stored credentials were rejected" {
+		t.Errorf("after rejection: answer = %+v, last error = %q", answer, rejected.LastError)
+	}
+
+	storeAliceCredentials(t, vm, "n3w")
+	if answer := answerFor(); answer == nil || answer.Password != "n3w" {
+		t.Errorf("after new credentials: answer = %+v", answer)
+	}
+}
+
+// An OTP code already sent is not sent again; the prompt waits
+func TestCredentialStore_UsedOTPNotResent(t *testing.T) {
+	vm, profile := newCredentialTest(t)
+	cm := vm.connectionManager
+	storeAliceCredentials(t, vm, "s3cret")
+	fm := attachOffice(t, vm, profile, func(cm *VPNConnectionManager) {
+		cm.totpSteps[profile.ID] = time.Now().Unix()/totpStep + 1
+	})
+	waitFor(t, "OTP prompt", func() bool { return cm.GetConnectionStatus().PendingAuth != nil })
+	time.Sleep(100 * time.Millisecond)
+	if status := cm.GetConnectionStatus(); status.Connected || status.PendingAuth == nil {
+		t.Errorf("status with a used OTP code = %+v", status)
+	}
+	for _, cmd := range disconnectCommands(t, cm, fm) {
+		if strings.HasPrefix(cmd, "password ") {
+			t.Errorf("answered with a used OTP code: %q", cmd)
+		}
+	}
+}
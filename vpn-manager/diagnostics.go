@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,6 +17,13 @@ import (
 type NetworkDiagnostics struct {
 	mutex   sync.RWMutex
 	results map[string]*DiagnosticResult
+	runs    map[DiagnosticRunKey]int64 // Completed runs since startup
+}
+
+// DiagnosticRunKey identifies a diagnostic test type and its outcome
+type DiagnosticRunKey struct {
+	TestType string
+	Success  bool
 }
 
 // DiagnosticResult represents the result of a network diagnostic test
@@ -104,6 +109,7 @@ type TracerouteParameters struct {
 func NewNetworkDiagnostics() *NetworkDiagnostics {
 	return &NetworkDiagnostics{
 		results: make(map[string]*DiagnosticResult),
+		runs:    make(map[DiagnosticRunKey]int64),
 	}
 }
 
@@ -612,6 +618,7 @@ func (nd *NetworkDiagnostics) storeResult(result *DiagnosticResult) {
 
 	key := fmt.Sprintf("%s_%s_%d", result.TestType, result.Target, result.StartTime.Unix())
 	nd.results[key] = result
+	nd.runs[DiagnosticRunKey{TestType: result.TestType, Success: result.Success}]++
 
 	// Keep only the last 100 results
 	if len(nd.results) > 100 {
@@ -653,6 +660,18 @@ func (nd *NetworkDiagnostics) GetResult(key string) (*DiagnosticResult, bool) {
 	return result, exists
 }
 
+// GetRunCounts returns how many diagnostic runs completed per test type and outcome
+func (nd *NetworkDiagnostics) GetRunCounts() map[DiagnosticRunKey]int64 {
+	nd.mutex.RLock()
+	defer nd.mutex.RUnlock()
+
+	runs := make(map[DiagnosticRunKey]int64, len(nd.runs))
+	for k, v := range nd.runs {
+		runs[k] = v
+	}
+	return runs
+}
+
 // ClearResults clears all stored results
 func (nd *NetworkDiagnostics) ClearResults() {
 	nd.mutex.Lock()
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Connection history events recorded for failover decisions
+const (
+	historyEventFailover = "failover"
+	historyEventFailback = "failback"
+)
+
+// FailbackPolicy controls the return to the preferred profile after a failover
+type FailbackPolicy struct {
+	Enabled              bool   `json:"enabled"`
+	PreferredProfile     string `json:"preferred_profile,omitempty"` // defaults to the first failover profile
+	HoldDownMinutes      int    `json:"hold_down_minutes"`           // minimum time on a standby before failing back
+	HealthyMinutes       int    `json:"healthy_minutes"`             // preferred profile must pass probes this long
+	ProbeIntervalSeconds int    `json:"probe_interval_seconds"`
+}
+
+// FailoverPolicy is the persisted failover configuration
+type FailoverPolicy struct {
+	Enabled    bool               `json:"enabled"`
+	Profiles   []string           `json:"profiles"` // Profile IDs in priority order
+	Thresholds FailoverThresholds `json:"thresholds"`
+	Failback   FailbackPolicy     `json:"failback"`
+}
+
+// failoverPolicyFile is the on-disk form, carrying the hold-down timer across restarts
+type failoverPolicyFile struct {
+	FailoverPolicy
+	LastFailoverAt time.Time `json:"last_failover_at,omitempty"`
+}
+
+func defaultFailbackPolicy() FailbackPolicy {
+	return FailbackPolicy{
+		HoldDownMinutes:      10,
+		HealthyMinutes:       5,
+		ProbeIntervalSeconds: 30,
+	}
+}
+
+// Validate checks the failback settings against the failover profile list
+func (p FailbackPolicy) Validate(profiles []string) error {
+	if p.HoldDownMinutes < 0 || p.HealthyMinutes < 0 {
+		return fmt.Errorf("failback hold_down_minutes and healthy_minutes must not be negative")
+	}
+	if p.ProbeIntervalSeconds < 5 || p.ProbeIntervalSeconds > 3600 {
+		return fmt.Errorf("failback probe_interval_seconds must be between 5 and 3600")
+	}
+	if p.PreferredProfile != "" {
+		for _, id := range profiles {
+			if id == p.PreferredProfile {
+				return nil
+			}
+		}
+		return fmt.Errorf("preferred profile %s is not in the failover profile list", p.PreferredProfile)
+	}
+	return nil
+}
+
+// preferredProfile is the failback target (requires lock)
+func (cm *VPNConnectionManager) preferredProfile() string {
+	if cm.failback.PreferredProfile != "" {
+		return cm.failback.PreferredProfile
+	}
+	if len(cm.failoverProfiles) > 0 {
+		return cm.failoverProfiles[0]
+	}
+	return ""
+}
+
+func (cm *VPNConnectionManager) failoverPolicyPath() string {
+	return filepath.Join(cm.statePath, "failover_policy.json")
+}
+
+// GetFailoverPolicy returns the failover configuration
+func (cm *VPNConnectionManager) GetFailoverPolicy() FailoverPolicy {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	return FailoverPolicy{
+		Enabled:    cm.failoverEnabled,
+		Profiles:   append([]string{}, cm.failoverProfiles...),
+		Thresholds: cm.failoverThresholds,
+		Failback:   cm.failback,
+	}
+}
+
+// SetFailbackPolicy validates, applies and persists the failback settings
+func (cm *VPNConnectionManager) SetFailbackPolicy(policy FailbackPolicy) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if err := policy.Validate(cm.failoverProfiles); err != nil {
+		return err
+	}
+	cm.failback = policy
+	cm.resetPreferredHealth()
+	cm.restartFailbackMonitor()
+	return cm.saveFailoverPolicy()
+}
+
+// saveFailoverPolicy persists the failover configuration (requires lock)
+func (cm *VPNConnectionManager) saveFailoverPolicy() error {
+	state := failoverPolicyFile{
+		FailoverPolicy: FailoverPolicy{
+			Enabled:    cm.failoverEnabled,
+			Profiles:   cm.failoverProfiles,
+			Thresholds: cm.failoverThresholds,
+			Failback:   cm.failback,
+		},
+		LastFailoverAt: cm.lastFailoverTime,
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode failover policy: %v", err)
+	}
+	if err := os.WriteFile(cm.failoverPolicyPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save failover policy: %v", err)
+	}
+	return nil
+}
+
+// loadFailoverPolicy restores the failover configuration saved before a restart.
+// Profiles are not loaded yet, so they are checked when failover acts on them.
+func (cm *VPNConnectionManager) loadFailoverPolicy() {
+	data, err := os.ReadFile(cm.failoverPolicyPath())
+	if err != nil {
+		return
+	}
+	state := failoverPolicyFile{FailoverPolicy: FailoverPolicy{Failback: defaultFailbackPolicy()}}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Warning: failed to decode failover policy: %v", err)
+		return
+	}
+	if err := state.Failback.Validate(state.Profiles); err != nil {
+		log.Printf("Warning: ignoring invalid failback policy: %v", err)
+		state.Failback = defaultFailbackPolicy()
+	}
+
+	cm.failoverEnabled = state.Enabled && len(state.Profiles) > 0
+	cm.failoverProfiles = state.Profiles
+	if cm.failoverProfiles == nil {
+		cm.failoverProfiles = make([]string, 0)
+	}
+	if state.Thresholds.MaxFailedAttempts > 0 {
+		cm.failoverThresholds = state.Thresholds
+	}
+	cm.failback = state.Failback
+	cm.lastFailoverTime = state.LastFailoverAt
+	cm.restartFailbackMonitor()
+	cm.restartReadinessMonitor()
+
+	if cm.failoverEnabled {
+		log.Printf("Restored failover policy with %d profiles (failback: %v)", len(cm.failoverProfiles), cm.failback.Enabled)
+	}
+}
+
+// recordFailoverDecision adds a failover or failback decision to the
+// connection history (requires lock)
+func (cm *VPNConnectionManager) recordFailoverDecision(event, fromProfileID, toProfileID, reason string, success bool) {
+	name := toProfileID
+	if profile, exists := cm.vm.GetProfile(toProfileID); exists {
+		name = profile.Name
+	}
+	cm.addConnectionHistory(&VPNConnectionHistory{
+		ProfileID:     toProfileID,
+		ProfileName:   name,
+		ConnectedAt:   time.Now(),
+		Event:         event,
+		FromProfileID: fromProfileID,
+		Reason:        reason,
+		Success:       success,
+	})
+	log.Printf("Recorded %s from %q to %q: %s (success: %v)", event, fromProfileID, toProfileID, reason, success)
+}
+
+// triggerFailover runs performFailover under the lock, for goroutines
+func (cm *VPNConnectionManager) triggerFailover(fromProfileID, reason string) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	return cm.performFailover(fromProfileID, reason)
+}
+
+// restartFailbackMonitor stops any running failback monitor and starts one if
+// the policy asks for it (requires lock)
+func (cm *VPNConnectionManager) restartFailbackMonitor() {
+	if cm.failbackStop != nil {
+		close(cm.failbackStop)
+		cm.failbackStop = nil
+	}
+	if !cm.failoverEnabled || !cm.failback.Enabled {
+		return
+	}
+	stop := make(chan struct{})
+	cm.failbackStop = stop
+	interval := time.Duration(cm.failback.ProbeIntervalSeconds) * time.Second
+	go cm.runFailbackMonitor(stop, interval)
+}
+
+func (cm *VPNConnectionManager) runFailbackMonitor(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cm.evaluateFailback(time.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// resetPreferredHealth forgets the preferred profile's probe streak (requires lock)
+func (cm *VPNConnectionManager) resetPreferredHealth() {
+	cm.preferredUpSince = time.Time{}
+	cm.preferredProbeErr = ""
+}
+
+// evaluateFailback probes the preferred profile while running on a standby
+// and fails back once it has been healthy long enough and the hold-down has passed
+func (cm *VPNConnectionManager) evaluateFailback(now time.Time) {
+	cm.mutex.Lock()
+	if !cm.failoverEnabled || !cm.failback.Enabled || cm.activeConn == nil || cm.activeConn.State != "connected" {
+		cm.mutex.Unlock()
+		return
+	}
+	preferredID := cm.preferredProfile()
+	if preferredID == "" || cm.activeConn.Profile.ID == preferredID {
+		cm.resetPreferredHealth()
+		cm.mutex.Unlock()
+		return
+	}
+	preferred, exists := cm.vm.GetProfile(preferredID)
+	probe := cm.probeProfile
+	cm.mutex.Unlock()
+	if !exists {
+		return
+	}
+
+	// Probe without the lock; it can take seconds
+	probeErr := probe(preferred)
+	if probeErr == nil {
+		cm.refreshRemoteOrder(preferredID)
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	cm.preferredProbedAt = now
+	if probeErr != nil {
+		if !cm.preferredUpSince.IsZero() {
+			log.Printf("Preferred profile %s failed its health probe: %v", preferred.Name, probeErr)
+		}
+		cm.preferredUpSince = time.Time{}
+		cm.preferredProbeErr = probeErr.Error()
+		return
+	}
+	cm.preferredProbeErr = ""
+	if cm.preferredUpSince.IsZero() {
+		cm.preferredUpSince = now
+	}
+
+	// The standby may have changed while we probed
+	if cm.activeConn == nil || cm.activeConn.State != "connected" || cm.activeConn.Profile.ID == preferredID {
+		return
+	}
+	healthyFor := now.Sub(cm.preferredUpSince)
+	if healthyFor < time.Duration(cm.failback.HealthyMinutes)*time.Minute {
+		return
+	}
+	if now.Sub(cm.lastFailoverTime) < time.Duration(cm.failback.HoldDownMinutes)*time.Minute {
+		return
+	}
+
+	reason := fmt.Sprintf("preferred profile healthy for %s", healthyFor.Round(time.Second))
+	if err := cm.performFailback(preferredID, reason); err != nil {
+		log.Printf("Failback to %s failed: %v", preferred.Name, err)
+	}
+}
+
+// performFailback switches from the current standby to the preferred profile,
+// returning to the standby if the preferred profile will not start (requires lock)
+func (cm *VPNConnectionManager) performFailback(preferredID, reason string) error {
+	standbyID := cm.activeConn.Profile.ID
+
+	if err := cm.disconnectInternalReason(historyEventFailback); err != nil {
+		log.Printf("Warning: failed to disconnect standby for failback: %v", err)
+	}
+	err := cm.connectInternal(preferredID)
+	cm.recordFailoverDecision(historyEventFailback, standbyID, preferredID, reason, err == nil)
+	cm.resetPreferredHealth()
+	cm.lastFailoverTime = time.Now()
+	if saveErr := cm.saveFailoverPolicy(); saveErr != nil {
+		log.Printf("Warning: %v", saveErr)
+	}
+	if err == nil {
+		cm.profileCounters(preferredID).Failovers++
+		return nil
+	}
+
+	cm.profileCounters(preferredID).FailoverFailures++
+	if restoreErr := cm.connectInternal(standbyID); restoreErr != nil {
+		log.Printf("Failed to return to standby profile %s: %v", standbyID, restoreErr)
+	}
+	return err
+}
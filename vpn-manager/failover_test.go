@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleEnableFailover_RejectsInvalidFailbackAtomically(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		code    int
+		enabled bool
+	}{
+		{"bad interval", `{"profile_ids":["p1","p2"],"failback":{"enabled":true,"probe_interval_seconds":1}}`, http.StatusBadRequest, false},
+		{"preferred outside list", `{"profile_ids":["p1"],"failback":{"enabled":true,"preferred_profile":"p2","probe_interval_seconds":30}}`, http.StatusBadRequest, false},
+		{"valid", `{"profile_ids":["p1","p2"],"failback":{"preferred_profile":"p2","hold_down_minutes":1,"probe_interval_seconds":30}}`, http.StatusOK, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newTestVPNManager(t)
+			for _, id := range []string{"p1", "p2"} {
+				vm.profiles[id] = &VPNProfile{ID: id, Name: id, Validated: true}
+			}
+			defer vm.connectionManager.Stop()
+
+			rec := httptest.NewRecorder()
+			vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/vpn/failover/enable", strings.NewReader(tc.body)))
+			if rec.Code != tc.code {
+				t.Fatalf("enable = %d, want %d: %s", rec.Code, tc.code, rec.Body.String())
+			}
+
+			reloaded := NewVPNConnectionManager(vm, vm.connectionManager.statePath)
+			defer reloaded.Stop()
+			for _, policy := range []FailoverPolicy{vm.connectionManager.GetFailoverPolicy(), reloaded.GetFailoverPolicy()} {
+				if policy.Enabled != tc.enabled {
+					t.Errorf("policy enabled = %v, want %v", policy.Enabled, tc.enabled)
+				}
+				if tc.enabled && (policy.Failback.PreferredProfile != "p2" || policy.Failback.HoldDownMinutes != 1) {
+					t.Errorf("failback = %+v", policy.Failback)
+				}
+			}
+		})
+	}
+}
+
+// The failback monitor looks the preferred profile up from its own
+// goroutine while the API saves profiles
+func TestFailover_FailbackReadsRaceProfileWrites(t *testing.T) {
+	vm := newTestVPNManager(t)
+	cm := vm.connectionManager
+	defer cm.Stop()
+	for _, id := range []string{"p1", "p2"} {
+		vm.profiles[id] = &VPNProfile{ID: id, Name: id, Validated: true}
+	}
+	failback := FailbackPolicy{Enabled: true, HealthyMinutes: 60, ProbeIntervalSeconds: 30}
+	if err := cm.EnableFailover([]string{"p1", "p2"}, nil, &failback); err != nil {
+		t.Fatalf("EnableFailover: %v", err)
+	}
+	cm.mutex.Lock()
+	cm.probeProfile = func(*VPNProfile) error { return nil }
+	cm.activeConn = &VPNConnection{Profile: vm.profiles["p2"], State: "connected"}
+	cm.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			vm.SaveProfile(&VPNProfile{ID: fmt.Sprintf("extra_%d", i), Name: "extra"})
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		cm.evaluateFailback(time.Now())
+	}
+	<-done
+
+	if status := cm.GetFailoverPolicy(); !status.Enabled {
+		t.Errorf("failover policy = %+v", status)
+	}
+}
+
+// testFailback holds off failback for 10 minutes and needs 5 healthy minutes
+var testFailback = FailbackPolicy{Enabled: true, HoldDownMinutes: 10, HealthyMinutes: 5, ProbeIntervalSeconds: 30}
+
+// newFailoverTest enables failover from p1 to p2 with testFailback, with
+// processes that start instantly and profiles that are always ready
+func newFailoverTest(t *testing.T) *VPNConnectionManager {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	cm := vm.connectionManager
+	cm.startProcess = func(*VPNConnection) error { return nil }
+	cm.checkReadiness = func(p *VPNProfile) ProfileReadiness {
+		return ProfileReadiness{ProfileID: p.ID, CheckedAt: time.Now(), Ready: true}
+	}
+	for _, id := range []string{"p1", "p2"} {
+		vm.profiles[id] = &VPNProfile{ID: id, Name: "site-" + id, Validated: true,
+			Remote: []VPNRemote{{Host: "127.0.0.1", Port: 1194}}, Protocol: "udp", Device: "tun"}
+	}
+	t.Cleanup(cm.Stop)
+
+	if err := cm.EnableFailover([]string{"p1", "p2"}, nil, nil); err != nil {
+		t.Fatalf("EnableFailover: %v", err)
+	}
+	if err := cm.SetFailbackPolicy(testFailback); err != nil {
+		t.Fatalf("SetFailbackPolicy: %v", err)
+	}
+	return cm
+}
+
+func markActiveConnected(cm *VPNConnectionManager) {
+	cm.mutex.Lock()
+	cm.markConnected(cm.activeConn)
+	cm.mutex.Unlock()
+}
+
+// failOverToStandby connects p1 and fails over to p2
+func failOverToStandby(t *testing.T, cm *VPNConnectionManager) {
+	t.Helper()
+	if err := cm.Connect("p1"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	markActiveConnected(cm)
+	if err := cm.triggerFailover("", "high latency: 450.00 ms"); err != nil {
+		t.Fatalf("triggerFailover: %v", err)
+	}
+	markActiveConnected(cm)
+	if id := cm.GetConnectionStatus().ProfileID; id != "p2" {
+		t.Fatalf("active profile after failover = %s, want p2", id)
+	}
+}
+
+// lastSwitch returns the session that was switched away from and the decision
+func lastSwitch(cm *VPNConnectionManager) (*VPNConnectionHistory, *VPNConnectionHistory) {
+	history := cm.GetConnectionHistory()
+	return history[len(history)-2], history[len(history)-1]
+}
+
+// probePreferred reports p1 as healthy while *healthy is set
+func probePreferred(t *testing.T, cm *VPNConnectionManager, healthy *bool) {
+	cm.probeProfile = func(p *VPNProfile) error {
+		if p.ID != "p1" {
+			t.Errorf("probed %s, want the preferred profile p1", p.ID)
+		}
+		if !*healthy {
+			return errors.New("no route to host")
+		}
+		return nil
+	}
+}
+
+func TestSetFailbackPolicy_RejectsUnlistedProfile(t *testing.T) {
+	cm := newFailoverTest(t)
+	if err := cm.SetFailbackPolicy(FailbackPolicy{Enabled: true, PreferredProfile: "p3", ProbeIntervalSeconds: 30}); err == nil {
+		t.Error("SetFailbackPolicy accepted a preferred profile outside the failover list")
+	}
+}
+
+func TestFailoverPolicy_SurvivesRestart(t *testing.T) {
+	cm := newFailoverTest(t)
+	reloaded := NewVPNConnectionManager(cm.vm, cm.statePath)
+	defer reloaded.Stop()
+	if policy := reloaded.GetFailoverPolicy(); !policy.Enabled || strings.Join(policy.Profiles, ",") != "p1,p2" || policy.Failback != testFailback {
+		t.Errorf("reloaded policy = %+v", policy)
+	}
+}
+
+func TestFailover_RecordsDecision(t *testing.T) {
+	cm := newFailoverTest(t)
+	failOverToStandby(t, cm)
+
+	session, decision := lastSwitch(cm)
+	if session.ProfileID != "p1" || session.DisconnectReason != "failover" {
+		t.Errorf("failed-over session = %+v", session)
+	}
+	if decision.Event != "failover" || decision.FromProfileID != "p1" || decision.ProfileID != "p2" ||
+		decision.Reason != "high latency: 450.00 ms" || !decision.Success {
+		t.Errorf("failover decision = %+v", decision)
+	}
+}
+
+func TestFailback_WaitsForHealthyStreakAndHoldDown(t *testing.T) {
+	cm := newFailoverTest(t)
+	failOverToStandby(t, cm)
+	healthy := false
+	probePreferred(t, cm, &healthy)
+
+	t0 := time.Now()
+	for _, step := range []struct {
+		at      time.Duration
+		healthy bool
+	}{
+		{0, false},
+		{time.Minute, true},
+		{2 * time.Minute, false}, // breaks the streak
+		{3 * time.Minute, true},
+		{7 * time.Minute, true}, // healthy for only 4m
+		{9 * time.Minute, true}, // healthy 6m but inside the 10m hold-down
+	} {
+		healthy = step.healthy
+		cm.evaluateFailback(t0.Add(step.at))
+		if id := cm.GetConnectionStatus().ProfileID; id != "p2" {
+			t.Fatalf("failed back early at +%v", step.at)
+		}
+	}
+	failbackStatus := cm.GetFailoverStatus()["failback"].(map[string]interface{})
+	if failbackStatus["preferred_profile"] != "p1" || failbackStatus["preferred_healthy_since"] == nil {
+		t.Errorf("failback status = %+v", failbackStatus)
+	}
+}
+
+func TestFailback_RecordsDecision(t *testing.T) {
+	cm := newFailoverTest(t)
+	failOverToStandby(t, cm)
+	healthy := true
+	probePreferred(t, cm, &healthy)
+
+	t0 := time.Now()
+	cm.evaluateFailback(t0.Add(3 * time.Minute))
+	cm.evaluateFailback(t0.Add(11 * time.Minute))
+	if id := cm.GetConnectionStatus().ProfileID; id != "p1" {
+		t.Fatalf("active profile after failback = %s, want p1", id)
+	}
+	markActiveConnected(cm)
+
+	session, decision := lastSwitch(cm)
+	if session.ProfileID != "p2" || session.DisconnectReason != "failback" {
+		t.Errorf("standby session = %+v", session)
+	}
+	if decision.Event != "failback" || decision.FromProfileID != "p2" || decision.ProfileID != "p1" ||
+		!strings.Contains(decision.Reason, "healthy for 8m0s") || !decision.Success {
+		t.Errorf("failback decision = %+v", decision)
+	}
+	if connections, _ := cm.ConnectionTotals(); connections != 3 {
+		t.Errorf("ConnectionTotals = %d, decisions must not count as sessions", connections)
+	}
+}
@@ -4,4 +4,5 @@ go 1.21
 
 require (
 	github.com/gorilla/mux v1.8.1
-)
\ No newline at end of file
+	github.com/mattn/go-sqlite3 v1.14.24
+)
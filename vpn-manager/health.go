@@ -1,13 +1,13 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net"
-	"net/http"
 	"os/exec"
-	"strconv"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +22,9 @@ type VPNHealthMonitor struct {
 	monitorStop       chan bool
 	intervalSeconds   int
 	alertThresholds   VPNHealthThresholds
+	store             *healthStore // nil when the history database could not be opened
+	alerts            *VPNAlertManager
+	probeConfig       VPNProbeConfig
 }
 
 // VPNHealthSnapshot represents a point-in-time health snapshot
@@ -35,7 +38,13 @@ type VPNHealthSnapshot struct {
 	RemoteIP          string               `json:"remote_ip,omitempty"`
 	Interface         string               `json:"interface,omitempty"`
 	Latency           float64              `json:"latency_ms"`
+	MinLatency        float64              `json:"min_latency_ms"`
+	MaxLatency        float64              `json:"max_latency_ms"`
+	Jitter            float64              `json:"jitter_ms"`
 	PacketLoss        float64              `json:"packet_loss_percent"`
+	Probes            []ProbeResult        `json:"probes,omitempty"`
+	Reachability      []ReachabilityResult `json:"reachability,omitempty"`
+	RequiredTargetsUp bool                 `json:"required_targets_up"`
 	Throughput        VPNThroughputMetrics `json:"throughput"`
 	DNSResolution     bool                 `json:"dns_resolution"`
 	RemoteReachable   bool                 `json:"remote_reachable"`
@@ -80,6 +89,7 @@ type VPNHealthSummary struct {
 
 // VPNHealthAlert represents a health alert
 type VPNHealthAlert struct {
+	ID          string    `json:"id,omitempty"`
 	Timestamp   time.Time `json:"timestamp"`
 	Severity    string    `json:"severity"` // "info", "warning", "critical"
 	Type        string    `json:"type"`     // "latency", "packet_loss", "throughput", "connection"
@@ -88,6 +98,9 @@ type VPNHealthAlert struct {
 	Threshold   float64   `json:"threshold,omitempty"`
 	Resolved    bool      `json:"resolved"`
 	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	Acknowledged   bool       `json:"acknowledged"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
 }
 
 // VPNPerformanceTrends represents performance trend data
@@ -102,7 +115,7 @@ type VPNPerformanceTrends struct {
 
 // NewVPNHealthMonitor creates a new health monitor
 func NewVPNHealthMonitor(vm *VPNManager) *VPNHealthMonitor {
-	return &VPNHealthMonitor{
+	hm := &VPNHealthMonitor{
 		vm:              vm,
 		healthHistory:   make([]*VPNHealthSnapshot, 0),
 		monitorStop:     make(chan bool, 1),
@@ -113,7 +126,35 @@ func NewVPNHealthMonitor(vm *VPNManager) *VPNHealthMonitor {
 			MinThroughputMbps: 1.0,
 			MaxReconnectCount: 5,
 		},
+		alerts:      NewVPNAlertManager(vm.statePath),
+		probeConfig: defaultProbeConfig(),
 	}
+	hm.loadProbeConfig()
+
+	// Persist history so tunnel SLA survives restarts; fall back to memory only
+	store, err := openHealthStore(filepath.Join(vm.statePath, "health.db"))
+	if err != nil {
+		log.Printf("Health history will not be persisted: %v", err)
+		return hm
+	}
+	hm.store = store
+
+	recent, err := store.Recent(time.Now().Add(-healthRawRetention))
+	if err != nil {
+		log.Printf("Failed to load health history: %v", err)
+	} else {
+		hm.healthHistory = recent
+	}
+
+	return hm
+}
+
+// Close closes the health history store
+func (hm *VPNHealthMonitor) Close() error {
+	if hm.store == nil {
+		return nil
+	}
+	return hm.store.Close()
 }
 
 // StartMonitoring begins health monitoring
@@ -190,24 +231,32 @@ func (hm *VPNHealthMonitor) collectHealthSnapshot(lastSnapshot *VPNHealthSnapsho
 		snapshot.ProfileName = profile.Name
 	}
 
-	// Test latency using ping
-	if snapshot.RemoteIP != "" {
-		latency, err := hm.measureLatency(snapshot.RemoteIP)
-		if err != nil {
-			snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("Failed to measure latency: %v", err))
-		} else {
-			snapshot.Latency = latency
-			snapshot.RemoteReachable = true
-		}
-	}
-
-	// Test packet loss
-	if snapshot.RemoteIP != "" {
-		packetLoss, err := hm.measurePacketLoss(snapshot.RemoteIP)
-		if err != nil {
-			snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("Failed to measure packet loss: %v", err))
-		} else {
-			snapshot.PacketLoss = packetLoss
+	// One probe train per target gives latency, jitter and loss together; the
+	// first target (the tunnel remote, unless disabled) is the primary one
+	probeConfig := hm.GetProbeConfig()
+	targets := make([]ProbeTarget, 0, len(probeConfig.Targets)+1)
+	if probeConfig.ProbeGateway && snapshot.RemoteIP != "" {
+		targets = append(targets, ProbeTarget{Name: "gateway", Host: snapshot.RemoteIP, Protocol: probeAuto})
+	}
+	targets = append(targets, probeConfig.Targets...)
+
+	// Reachability checks run alongside the probe trains
+	checksDone := make(chan []ReachabilityResult, 1)
+	go func() { checksDone <- runReachabilityChecks(probeConfig.Checks) }()
+
+	if len(targets) > 0 {
+		snapshot.Probes = runProbes(targets, probeConfig)
+		primary := snapshot.Probes[0]
+		snapshot.RemoteReachable = !primary.Unreachable
+		snapshot.Latency = primary.AvgLatency
+		snapshot.MinLatency = primary.MinLatency
+		snapshot.MaxLatency = primary.MaxLatency
+		snapshot.Jitter = primary.Jitter
+		snapshot.PacketLoss = primary.PacketLoss
+		for _, r := range snapshot.Probes {
+			if r.Unreachable {
+				snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("Probe target %s unreachable: %s", r.Target.label(), r.Error))
+			}
 		}
 	}
 
@@ -215,8 +264,20 @@ func (hm *VPNHealthMonitor) collectHealthSnapshot(lastSnapshot *VPNHealthSnapsho
 	throughput := hm.measureThroughput(connStatus, lastSnapshot)
 	snapshot.Throughput = throughput
 
+	snapshot.Reachability = <-checksDone
+	down := requiredTargetsDown(snapshot.Reachability)
+	snapshot.RequiredTargetsUp = len(down) == 0
+	for _, r := range snapshot.Reachability {
+		if !r.Reachable {
+			snapshot.Warnings = append(snapshot.Warnings, fmt.Sprintf("Check %s (%s %s) failed: %s", r.Name, r.Protocol, r.Address, r.Error))
+		}
+	}
+	if len(down) > 0 {
+		snapshot.Errors = append(snapshot.Errors, fmt.Sprintf("Required targets unreachable: %s", strings.Join(down, ", ")))
+	}
+
 	// Test DNS resolution
-	dnsWorking := hm.testDNSResolution()
+	dnsWorking := hm.testDNSResolution(snapshot.Reachability)
 	snapshot.DNSResolution = dnsWorking
 	if !dnsWorking {
 		snapshot.Warnings = append(snapshot.Warnings, "DNS resolution is not working")
@@ -235,61 +296,6 @@ func (hm *VPNHealthMonitor) collectHealthSnapshot(lastSnapshot *VPNHealthSnapsho
 	return snapshot
 }
 
-// measureLatency measures latency to the remote IP
-func (hm *VPNHealthMonitor) measureLatency(remoteIP string) (float64, error) {
-	cmd := exec.Command("ping", "-c", "3", "-W", "3", remoteIP)
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, err
-	}
-
-	// Parse ping output for average RTT
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "min/avg/max") {
-			parts := strings.Split(line, "=")
-			if len(parts) >= 2 {
-				stats := strings.Split(strings.TrimSpace(parts[1]), "/")
-				if len(stats) >= 2 {
-					if avg, err := strconv.ParseFloat(stats[1], 64); err == nil {
-						return avg, nil
-					}
-				}
-			}
-		}
-	}
-
-	return 0, fmt.Errorf("could not parse ping output")
-}
-
-// measurePacketLoss measures packet loss to the remote IP
-func (hm *VPNHealthMonitor) measurePacketLoss(remoteIP string) (float64, error) {
-	cmd := exec.Command("ping", "-c", "10", "-W", "3", remoteIP)
-	output, err := cmd.Output()
-	if err != nil {
-		return 100.0, err // Assume 100% loss if command fails
-	}
-
-	// Parse ping output for packet loss percentage
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "packet loss") {
-			// Extract percentage from line like "0 received, 0% packet loss"
-			parts := strings.Fields(line)
-			for _, part := range parts {
-				if strings.HasSuffix(part, "%") {
-					lossStr := strings.TrimSuffix(part, "%")
-					if loss, err := strconv.ParseFloat(lossStr, 64); err == nil {
-						return loss, nil
-					}
-				}
-			}
-		}
-	}
-
-	return 0, nil
-}
-
 // measureThroughput calculates throughput based on byte counters
 func (hm *VPNHealthMonitor) measureThroughput(connStatus *VPNConnectionState, lastSnapshot *VPNHealthSnapshot) VPNThroughputMetrics {
 	throughput := VPNThroughputMetrics{
@@ -314,9 +320,23 @@ func (hm *VPNHealthMonitor) measureThroughput(connStatus *VPNConnectionState, la
 	return throughput
 }
 
-// testDNSResolution tests if DNS resolution is working
-func (hm *VPNHealthMonitor) testDNSResolution() bool {
-	// Try to resolve a well-known hostname
+// testDNSResolution tests if DNS resolution is working. Configured DNS checks
+// decide it; without any, fall back to resolving a well-known hostname.
+func (hm *VPNHealthMonitor) testDNSResolution(results []ReachabilityResult) bool {
+	checked := false
+	for _, r := range results {
+		if r.Protocol != checkDNS {
+			continue
+		}
+		checked = true
+		if !r.Reachable {
+			return false
+		}
+	}
+	if checked {
+		return true
+	}
+
 	_, err := net.LookupHost("google.com")
 	return err == nil
 }
@@ -372,9 +392,13 @@ func (hm *VPNHealthMonitor) detectVPNInterface() string {
 
 // addHealthSnapshot adds a health snapshot to history
 func (hm *VPNHealthMonitor) addHealthSnapshot(snapshot *VPNHealthSnapshot) {
-	hm.mutex.Lock()
-	defer hm.mutex.Unlock()
+	if hm.store != nil {
+		if err := hm.store.Record(snapshot); err != nil {
+			log.Printf("Failed to persist health snapshot: %v", err)
+		}
+	}
 
+	hm.mutex.Lock()
 	hm.healthHistory = append(hm.healthHistory, snapshot)
 
 	// Keep only the last 2880 snapshots (24 hours at 30-second intervals)
@@ -382,35 +406,17 @@ func (hm *VPNHealthMonitor) addHealthSnapshot(snapshot *VPNHealthSnapshot) {
 	if len(hm.healthHistory) > maxHistory {
 		hm.healthHistory = hm.healthHistory[len(hm.healthHistory)-maxHistory:]
 	}
+	thresholds := hm.alertThresholds
+	hm.mutex.Unlock()
 
-	// Check for alerts
-	hm.checkHealthAlerts(snapshot)
+	// Check for alerts; they persist their state, so not under the lock
+	hm.checkHealthAlerts(snapshot, thresholds)
 }
 
-// checkHealthAlerts checks if any health thresholds are exceeded
-func (hm *VPNHealthMonitor) checkHealthAlerts(snapshot *VPNHealthSnapshot) {
-	if !snapshot.Connected {
-		return
-	}
-
-	// Check latency threshold
-	if snapshot.Latency > hm.alertThresholds.MaxLatencyMs {
-		log.Printf("Health Alert: High latency detected: %.2f ms (threshold: %.2f ms)", 
-			snapshot.Latency, hm.alertThresholds.MaxLatencyMs)
-	}
-
-	// Check packet loss threshold
-	if snapshot.PacketLoss > hm.alertThresholds.MaxPacketLoss {
-		log.Printf("Health Alert: High packet loss detected: %.2f%% (threshold: %.2f%%)", 
-			snapshot.PacketLoss, hm.alertThresholds.MaxPacketLoss)
-	}
-
-	// Check throughput threshold
-	avgThroughput := (snapshot.Throughput.DownloadSpeedMbps + snapshot.Throughput.UploadSpeedMbps) / 2
-	if avgThroughput > 0 && avgThroughput < hm.alertThresholds.MinThroughputMbps {
-		log.Printf("Health Alert: Low throughput detected: %.2f Mbps (threshold: %.2f Mbps)", 
-			avgThroughput, hm.alertThresholds.MinThroughputMbps)
-	}
+// checkHealthAlerts feeds a snapshot to the alert state machine, which raises,
+// escalates and resolves alerts and sends their notifications
+func (hm *VPNHealthMonitor) checkHealthAlerts(snapshot *VPNHealthSnapshot, thresholds VPNHealthThresholds) {
+	hm.alerts.Evaluate(snapshot, thresholds)
 }
 
 // GetCurrentHealth returns the current health status
@@ -425,8 +431,17 @@ func (hm *VPNHealthMonitor) GetCurrentHealth() *VPNHealthSnapshot {
 	return hm.healthHistory[len(hm.healthHistory)-1]
 }
 
-// GetHealthHistory returns recent health history
-func (hm *VPNHealthMonitor) GetHealthHistory(minutes int) []*VPNHealthSnapshot {
+// GetHealthHistory returns persisted health history for an arbitrary range,
+// raw or downsampled to 5-minute or hourly buckets
+func (hm *VPNHealthMonitor) GetHealthHistory(q HealthHistoryQuery) (*VPNHealthHistory, error) {
+	if hm.store == nil {
+		return nil, fmt.Errorf("health history store is not available")
+	}
+	return hm.store.Query(q, time.Now())
+}
+
+// recentHistory returns in-memory health history for the last minutes
+func (hm *VPNHealthMonitor) recentHistory(minutes int) []*VPNHealthSnapshot {
 	hm.mutex.RLock()
 	defer hm.mutex.RUnlock()
 
@@ -446,22 +461,43 @@ func (hm *VPNHealthMonitor) GetHealthHistory(minutes int) []*VPNHealthSnapshot {
 	return history
 }
 
+// Summary windows and the change needed before a trend is reported
+const (
+	summaryWindow          = time.Hour
+	uptimeWindow           = 24 * time.Hour
+	trendChangePercent     = 10.0
+	stabilityChangePercent = 5.0
+)
+
 // GetHealthSummary returns aggregated health statistics
 func (hm *VPNHealthMonitor) GetHealthSummary() *VPNHealthSummary {
+	// Copy what we need and release the lock before aggregating; helpers that
+	// take the lock themselves must not be called while it is held
 	hm.mutex.RLock()
-	defer hm.mutex.RUnlock()
+	history := make([]*VPNHealthSnapshot, len(hm.healthHistory))
+	copy(history, hm.healthHistory)
+	thresholds := hm.alertThresholds
+	hm.mutex.RUnlock()
 
+	now := time.Now()
 	summary := &VPNHealthSummary{
-		LastUpdate:    time.Now(),
-		RecentAlerts:  make([]VPNHealthAlert, 0),
+		LastUpdate:   now,
+		RecentAlerts: make([]VPNHealthAlert, 0),
+	}
+	if hm.vm != nil && hm.vm.connectionManager != nil {
+		summary.TotalConnections, summary.TotalReconnects = hm.vm.connectionManager.ConnectionTotals()
 	}
 
-	if len(hm.healthHistory) == 0 {
+	if len(history) == 0 {
 		summary.OverallStatus = "unknown"
 		return summary
 	}
 
-	latest := hm.healthHistory[len(hm.healthHistory)-1]
+	hourData := historyBetween(history, now.Add(-summaryWindow), now)
+	summary.RecentAlerts = detectHealthAlerts(hourData, thresholds)
+	summary.PerformanceTrends = computePerformanceTrends(history, now)
+
+	latest := history[len(history)-1]
 	if !latest.Connected {
 		summary.OverallStatus = "disconnected"
 		return summary
@@ -470,7 +506,6 @@ func (hm *VPNHealthMonitor) GetHealthSummary() *VPNHealthSummary {
 	summary.ConnectionUptime = latest.ConnectionUptime
 
 	// Calculate averages from last hour of data
-	hourData := hm.GetHealthHistory(60)
 	if len(hourData) == 0 {
 		summary.OverallStatus = "unknown"
 		return summary
@@ -499,30 +534,267 @@ func (hm *VPNHealthMonitor) GetHealthSummary() *VPNHealthSummary {
 	}
 
 	// Calculate success rate (uptime percentage)
-	if len(hourData) > 0 {
-		upSamples := 0
-		for _, snapshot := range hourData {
-			if snapshot.Connected {
-				upSamples++
-			}
+	upSamples := 0
+	for _, snapshot := range hourData {
+		if snapshot.Connected {
+			upSamples++
 		}
-		summary.SuccessRate = float64(upSamples) / float64(len(hourData)) * 100.0
 	}
+	summary.SuccessRate = float64(upSamples) / float64(len(hourData)) * 100.0
 
 	// Determine overall status
-	if summary.AverageLatency > hm.alertThresholds.MaxLatencyMs || 
-	   summary.AveragePacketLoss > hm.alertThresholds.MaxPacketLoss {
+	if summary.AverageLatency > thresholds.MaxLatencyMs ||
+		summary.AveragePacketLoss > thresholds.MaxPacketLoss {
 		summary.OverallStatus = "critical"
-	} else if summary.AverageLatency > hm.alertThresholds.MaxLatencyMs*0.8 || 
-	          summary.AveragePacketLoss > hm.alertThresholds.MaxPacketLoss*0.8 {
+	} else if summary.AverageLatency > thresholds.MaxLatencyMs*0.8 ||
+		summary.AveragePacketLoss > thresholds.MaxPacketLoss*0.8 {
 		summary.OverallStatus = "warning"
 	} else {
 		summary.OverallStatus = "healthy"
 	}
 
+	// The tunnel is not healthy while a required target is unreachable
+	if len(requiredTargetsDown(latest.Reachability)) > 0 {
+		summary.OverallStatus = "critical"
+	}
+
 	return summary
 }
 
+// historyBetween returns the snapshots taken after from and no later than to
+func historyBetween(history []*VPNHealthSnapshot, from, to time.Time) []*VPNHealthSnapshot {
+	window := make([]*VPNHealthSnapshot, 0)
+	for _, snapshot := range history {
+		if snapshot.Timestamp.After(from) && !snapshot.Timestamp.After(to) {
+			window = append(window, snapshot)
+		}
+	}
+	return window
+}
+
+// computePerformanceTrends compares the last summary window with the one before
+// it, and only reports a direction the regression over both windows agrees with
+func computePerformanceTrends(history []*VPNHealthSnapshot, now time.Time) VPNPerformanceTrends {
+	trends := VPNPerformanceTrends{
+		LatencyTrend:    "stable",
+		ThroughputTrend: "stable",
+		StabilityTrend:  "stable",
+	}
+
+	day := historyBetween(history, now.Add(-uptimeWindow), now)
+	if len(day) > 0 {
+		up := 0
+		for _, s := range day {
+			if s.Connected {
+				up++
+			}
+		}
+		trends.UptimePercentage = float64(up) / float64(len(day)) * 100
+	}
+
+	start := now.Add(-2 * summaryWindow)
+	previous := historyBetween(history, start, now.Add(-summaryWindow))
+	current := historyBetween(history, now.Add(-summaryWindow), now)
+	if len(previous) == 0 || len(current) == 0 {
+		return trends
+	}
+
+	latency := func(s *VPNHealthSnapshot) (float64, bool) {
+		return s.Latency, s.Connected && s.RemoteReachable
+	}
+	throughput := func(s *VPNHealthSnapshot) (float64, bool) {
+		return s.Throughput.DownloadSpeedMbps + s.Throughput.UploadSpeedMbps, s.Connected
+	}
+
+	trends.LatencyChange = percentChange(windowMean(previous, latency), windowMean(current, latency))
+	trends.LatencyTrend = classifyTrend(trends.LatencyChange, regressionSlope(append(previous, current...), start, latency), false)
+
+	trends.ThroughputChange = percentChange(windowMean(previous, throughput), windowMean(current, throughput))
+	trends.ThroughputTrend = classifyTrend(trends.ThroughputChange, regressionSlope(append(previous, current...), start, throughput), true)
+
+	// Stability compares the share of samples that were down or flapping
+	delta := instabilityPercent(current) - instabilityPercent(previous)
+	switch {
+	case delta > stabilityChangePercent:
+		trends.StabilityTrend = "degrading"
+	case delta < -stabilityChangePercent:
+		trends.StabilityTrend = "improving"
+	}
+
+	return trends
+}
+
+// windowMean averages the values a selector accepts, 0 when it accepts none
+func windowMean(window []*VPNHealthSnapshot, value func(*VPNHealthSnapshot) (float64, bool)) float64 {
+	var sum float64
+	var n int
+	for _, s := range window {
+		if v, ok := value(s); ok {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// regressionSlope is the least-squares slope of the selected values over time,
+// in units per hour since start
+func regressionSlope(window []*VPNHealthSnapshot, start time.Time, value func(*VPNHealthSnapshot) (float64, bool)) float64 {
+	var sumX, sumY, sumXY, sumXX float64
+	var n float64
+	for _, s := range window {
+		v, ok := value(s)
+		if !ok {
+			continue
+		}
+		x := s.Timestamp.Sub(start).Hours()
+		sumX += x
+		sumY += v
+		sumXY += x * v
+		sumXX += x * x
+		n++
+	}
+	denominator := n*sumXX - sumX*sumX
+	if n < 2 || denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func percentChange(previous, current float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return (current - previous) / previous * 100
+}
+
+// classifyTrend turns a window-over-window change into a direction, requiring
+// the regression slope to point the same way so a single spike is not a trend
+func classifyTrend(changePercent, slope float64, higherIsBetter bool) string {
+	if math.Abs(changePercent) < trendChangePercent || changePercent*slope <= 0 {
+		return "stable"
+	}
+	if (changePercent > 0) == higherIsBetter {
+		return "improving"
+	}
+	return "degrading"
+}
+
+// instabilityPercent is the share of samples where the tunnel was down or unstable
+func instabilityPercent(window []*VPNHealthSnapshot) float64 {
+	if len(window) == 0 {
+		return 0
+	}
+	unstable := 0
+	for _, s := range window {
+		if !s.Connected || !s.TunnelStable {
+			unstable++
+		}
+	}
+	return float64(unstable) / float64(len(window)) * 100
+}
+
+// detectHealthAlerts reports each run of consecutive threshold breaches in the
+// window as one alert carrying its worst value, resolved once a later sample
+// is back within the threshold
+func detectHealthAlerts(window []*VPNHealthSnapshot, thresholds VPNHealthThresholds) []VPNHealthAlert {
+	type check struct {
+		kind      string
+		threshold float64
+		breached  func(*VPNHealthSnapshot) (float64, bool)
+		worse     func(a, b float64) bool
+		message   func(value, threshold float64) string
+	}
+	higher := func(a, b float64) bool { return a > b }
+	lower := func(a, b float64) bool { return a < b }
+
+	checks := []check{
+		{"connection", 0,
+			func(s *VPNHealthSnapshot) (float64, bool) { return 0, !s.Connected },
+			higher,
+			func(float64, float64) string { return "VPN tunnel disconnected" }},
+		{"latency", thresholds.MaxLatencyMs,
+			func(s *VPNHealthSnapshot) (float64, bool) {
+				return s.Latency, s.Connected && s.Latency > thresholds.MaxLatencyMs
+			},
+			higher,
+			func(v, t float64) string { return fmt.Sprintf("High latency: %.2f ms (threshold: %.2f ms)", v, t) }},
+		{"packet_loss", thresholds.MaxPacketLoss,
+			func(s *VPNHealthSnapshot) (float64, bool) {
+				return s.PacketLoss, s.Connected && s.PacketLoss > thresholds.MaxPacketLoss
+			},
+			higher,
+			func(v, t float64) string { return fmt.Sprintf("High packet loss: %.2f%% (threshold: %.2f%%)", v, t) }},
+		{"throughput", thresholds.MinThroughputMbps,
+			func(s *VPNHealthSnapshot) (float64, bool) {
+				avg := (s.Throughput.DownloadSpeedMbps + s.Throughput.UploadSpeedMbps) / 2
+				return avg, s.Connected && avg > 0 && avg < thresholds.MinThroughputMbps
+			},
+			lower,
+			func(v, t float64) string { return fmt.Sprintf("Low throughput: %.2f Mbps (threshold: %.2f Mbps)", v, t) }},
+	}
+
+	alerts := make([]VPNHealthAlert, 0)
+	for _, c := range checks {
+		var open *VPNHealthAlert
+		for _, s := range window {
+			value, breached := c.breached(s)
+			if breached {
+				if open == nil {
+					open = &VPNHealthAlert{Timestamp: s.Timestamp, Type: c.kind, Value: value, Threshold: c.threshold}
+				} else if c.worse(value, open.Value) {
+					open.Value = value
+				}
+				continue
+			}
+			if open != nil {
+				resolvedAt := s.Timestamp
+				open.Resolved = true
+				open.ResolvedAt = &resolvedAt
+				alerts = append(alerts, finishAlert(*open, c.message))
+				open = nil
+			}
+		}
+		if open != nil {
+			alerts = append(alerts, finishAlert(*open, c.message))
+		}
+	}
+
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Timestamp.Before(alerts[j].Timestamp) })
+	return alerts
+}
+
+// finishAlert sets message and severity; lost tunnels and breaches more than
+// 50% past the threshold are critical
+func finishAlert(alert VPNHealthAlert, message func(value, threshold float64) string) VPNHealthAlert {
+	alert.Message = message(alert.Value, alert.Threshold)
+	alert.Severity = "warning"
+	switch alert.Type {
+	case "connection", "reachability":
+		alert.Severity = "critical"
+	case "throughput":
+		if alert.Value < alert.Threshold/2 {
+			alert.Severity = "critical"
+		}
+	default:
+		if alert.Value > alert.Threshold*1.5 {
+			alert.Severity = "critical"
+		}
+	}
+	return alert
+}
+
+// IsMonitoring reports whether the monitoring loop is running
+func (hm *VPNHealthMonitor) IsMonitoring() bool {
+	hm.mutex.RLock()
+	defer hm.mutex.RUnlock()
+
+	return hm.monitoring
+}
+
 // SetThresholds updates health alert thresholds
 func (hm *VPNHealthMonitor) SetThresholds(thresholds VPNHealthThresholds) {
 	hm.mutex.Lock()
@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// alertRaiseAfter consecutive breaching snapshots open an alert, and
+	// alertClearAfter consecutive clear snapshots resolve it
+	alertRaiseAfter = 2
+	alertClearAfter = 3
+
+	// alertClearMargin is how far back inside its threshold a value must move
+	// to count as clear, so a value hovering at the threshold does not flap
+	alertClearMargin = 0.1
+
+	maxResolvedAlerts = 200
+
+	// redactedSecret replaces passwords in API responses; sending it back
+	// keeps the stored value
+	redactedSecret = "********"
+)
+
+// alertIDEscaper keeps target names in alert IDs safe for URL paths
+var alertIDEscaper = strings.NewReplacer(":", "-", "/", "-", " ", "-", "?", "-", "#", "-", "%", "-")
+
+// Alert notification events
+const (
+	alertEventRaised    = "raised"
+	alertEventEscalated = "escalated"
+	alertEventResolved  = "resolved"
+	alertEventTest      = "test"
+)
+
+// VPNAlertNotification is the payload delivered to notification targets
+type VPNAlertNotification struct {
+	Event     string         `json:"event"`
+	Timestamp time.Time      `json:"timestamp"`
+	Alert     VPNHealthAlert `json:"alert"`
+}
+
+// AlertNotifier delivers alert notifications to one target
+type AlertNotifier interface {
+	Name() string
+	Notify(n VPNAlertNotification) error
+}
+
+// WebhookTarget posts notifications as JSON to a URL
+type WebhookTarget struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// SMTPTarget mails notifications
+type SMTPTarget struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// VPNAlertNotifierConfig lists the configured notification targets
+type VPNAlertNotifierConfig struct {
+	Webhooks []WebhookTarget `json:"webhooks"`
+	SMTP     []SMTPTarget    `json:"smtp"`
+}
+
+// Validate checks every target is usable
+func (c VPNAlertNotifierConfig) Validate() error {
+	for i, wh := range c.Webhooks {
+		u, err := url.Parse(wh.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook %d: url must be an absolute http(s) URL", i)
+		}
+	}
+	for i, s := range c.SMTP {
+		if s.Host == "" {
+			return fmt.Errorf("smtp %d: host is required", i)
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			return fmt.Errorf("smtp %d: invalid port %d", i, s.Port)
+		}
+		if s.From == "" || len(s.To) == 0 {
+			return fmt.Errorf("smtp %d: from and at least one to address are required", i)
+		}
+	}
+	return nil
+}
+
+// redacted returns a copy safe to return from the API. Webhook header
+// values carry tokens such as Authorization, so all of them are masked.
+func (c VPNAlertNotifierConfig) redacted() VPNAlertNotifierConfig {
+	out := VPNAlertNotifierConfig{Webhooks: make([]WebhookTarget, len(c.Webhooks)), SMTP: make([]SMTPTarget, len(c.SMTP))}
+	for i, wh := range c.Webhooks {
+		out.Webhooks[i] = WebhookTarget{URL: wh.URL}
+		if wh.Headers != nil {
+			out.Webhooks[i].Headers = make(map[string]string, len(wh.Headers))
+			for k := range wh.Headers {
+				out.Webhooks[i].Headers[k] = redactedSecret
+			}
+		}
+	}
+	copy(out.SMTP, c.SMTP)
+	for i := range out.SMTP {
+		if out.SMTP[i].Password != "" {
+			out.SMTP[i].Password = redactedSecret
+		}
+	}
+	return out
+}
+
+// keepRedactedValues replaces secrets sent back as redactedSecret with the
+// stored values of the same target: SMTP passwords by host and username,
+// webhook headers by URL and header name
+func (c *VPNAlertNotifierConfig) keepRedactedValues(current VPNAlertNotifierConfig) {
+	for i := range c.SMTP {
+		if c.SMTP[i].Password != redactedSecret {
+			continue
+		}
+		c.SMTP[i].Password = ""
+		for _, old := range current.SMTP {
+			if old.Host == c.SMTP[i].Host && old.Username == c.SMTP[i].Username {
+				c.SMTP[i].Password = old.Password
+			}
+		}
+	}
+	for i := range c.Webhooks {
+		for name, value := range c.Webhooks[i].Headers {
+			if value != redactedSecret {
+				continue
+			}
+			delete(c.Webhooks[i].Headers, name)
+			for _, old := range current.Webhooks {
+				if old.URL != c.Webhooks[i].URL {
+					continue
+				}
+				for oldName, oldValue := range old.Headers {
+					if strings.EqualFold(oldName, name) {
+						c.Webhooks[i].Headers[name] = oldValue
+					}
+				}
+			}
+		}
+	}
+}
+
+// webhookNotifier posts notifications to a webhook target
+type webhookNotifier struct {
+	target WebhookTarget
+	client *http.Client
+}
+
+func (n *webhookNotifier) Name() string {
+	return "webhook " + n.target.URL
+}
+
+func (n *webhookNotifier) Notify(notification VPNAlertNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.target.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier mails notifications to an SMTP target
+type smtpNotifier struct {
+	target SMTPTarget
+	send   func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (n *smtpNotifier) Name() string {
+	return "smtp " + strings.Join(n.target.To, ",")
+}
+
+func (n *smtpNotifier) Notify(notification VPNAlertNotification) error {
+	port := n.target.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if n.target.Username != "" {
+		auth = smtp.PlainAuth("", n.target.Username, n.target.Password, n.target.Host)
+	}
+	addr := net.JoinHostPort(n.target.Host, strconv.Itoa(port))
+	return n.send(addr, auth, n.target.From, n.target.To, alertMailMessage(n.target, notification))
+}
+
+// alertMailMessage formats a notification as a plain text mail
+func alertMailMessage(target SMTPTarget, n VPNAlertNotification) []byte {
+	a := n.Alert
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", target.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(target.To, ", "))
+	fmt.Fprintf(&b, "Subject: [NoC Raven] VPN %s alert %s: %s\r\n", a.Severity, n.Event, a.Message)
+	fmt.Fprintf(&b, "Date: %s\r\n", n.Timestamp.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "Alert:     %s\r\n", a.Message)
+	fmt.Fprintf(&b, "Type:      %s\r\n", a.Type)
+	fmt.Fprintf(&b, "Severity:  %s\r\n", a.Severity)
+	fmt.Fprintf(&b, "Raised:    %s\r\n", a.Timestamp.Format(time.RFC3339))
+	if a.ResolvedAt != nil {
+		fmt.Fprintf(&b, "Resolved:  %s\r\n", a.ResolvedAt.Format(time.RFC3339))
+	}
+	if a.Type != "connection" {
+		fmt.Fprintf(&b, "Value:     %.2f (threshold %.2f)\r\n", a.Value, a.Threshold)
+	}
+	if a.ID != "" {
+		fmt.Fprintf(&b, "Alert ID:  %s\r\n", a.ID)
+	}
+	return []byte(b.String())
+}
+
+// alertCondition tracks consecutive breaching and clear snapshots of one condition
+type alertCondition struct {
+	Breaches int `json:"breaches"`
+	Clears   int `json:"clears"`
+}
+
+// alertState is the persisted state of the alert manager
+type alertState struct {
+	Active        map[string]*VPNHealthAlert `json:"active"` // by alert type
+	Resolved      []*VPNHealthAlert          `json:"resolved"`
+	Conditions    map[string]*alertCondition `json:"conditions"`
+	SeenConnected bool                       `json:"seen_connected"`
+}
+
+// VPNAlertManager opens, escalates and resolves health alerts with hysteresis
+// and sends notifications on every transition
+type VPNAlertManager struct {
+	mutex      sync.Mutex
+	statePath  string
+	configPath string
+	state      alertState
+	config     VPNAlertNotifierConfig
+	notifiers  []AlertNotifier
+
+	// State is encoded under mutex and written after it is released;
+	// saveMutex orders the writes so an older encoding never wins
+	saveMutex  sync.Mutex
+	stateGen   uint64 // bumped under mutex for every encoding
+	writtenGen uint64 // under saveMutex
+}
+
+// NewVPNAlertManager creates an alert manager persisting under dir
+func NewVPNAlertManager(dir string) *VPNAlertManager {
+	am := &VPNAlertManager{
+		statePath:  filepath.Join(dir, "health_alerts.json"),
+		configPath: filepath.Join(dir, "alert_notifiers.json"),
+		state: alertState{
+			Active:     make(map[string]*VPNHealthAlert),
+			Resolved:   make([]*VPNHealthAlert, 0),
+			Conditions: make(map[string]*alertCondition),
+		},
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Warning: failed to create alert state directory: %v", err)
+	}
+	am.loadState()
+	am.loadConfig()
+	return am
+}
+
+// alertCheck evaluates one alert condition against a snapshot. The kind keys
+// the condition state; per-target conditions are "type:target".
+type alertCheck struct {
+	kind      string
+	threshold float64
+	// evaluate returns the value and whether it breaches or is clear; a
+	// snapshot may be neither when the condition cannot be measured
+	evaluate func(s *VPNHealthSnapshot) (value float64, breached, clear bool)
+	worse    func(a, b float64) bool
+	message  func(value, threshold float64) string
+}
+
+func (am *VPNAlertManager) checks(t VPNHealthThresholds, snapshot *VPNHealthSnapshot) []alertCheck {
+	higher := func(a, b float64) bool { return a > b }
+	lower := func(a, b float64) bool { return a < b }
+
+	checks := []alertCheck{
+		{"connection", 0,
+			func(s *VPNHealthSnapshot) (float64, bool, bool) {
+				// Only a tunnel that has been up can go down
+				return 0, !s.Connected && am.state.SeenConnected, s.Connected
+			},
+			higher,
+			func(float64, float64) string { return "VPN tunnel disconnected" }},
+		{"latency", t.MaxLatencyMs,
+			func(s *VPNHealthSnapshot) (float64, bool, bool) {
+				if !s.Connected || !s.RemoteReachable {
+					return 0, false, false
+				}
+				return s.Latency, s.Latency > t.MaxLatencyMs, s.Latency <= t.MaxLatencyMs*(1-alertClearMargin)
+			},
+			higher,
+			func(v, t float64) string { return fmt.Sprintf("High latency: %.2f ms (threshold: %.2f ms)", v, t) }},
+		{"packet_loss", t.MaxPacketLoss,
+			func(s *VPNHealthSnapshot) (float64, bool, bool) {
+				if !s.Connected {
+					return 0, false, false
+				}
+				return s.PacketLoss, s.PacketLoss > t.MaxPacketLoss, s.PacketLoss <= t.MaxPacketLoss*(1-alertClearMargin)
+			},
+			higher,
+			func(v, t float64) string { return fmt.Sprintf("High packet loss: %.2f%% (threshold: %.2f%%)", v, t) }},
+		{"throughput", t.MinThroughputMbps,
+			func(s *VPNHealthSnapshot) (float64, bool, bool) {
+				avg := (s.Throughput.DownloadSpeedMbps + s.Throughput.UploadSpeedMbps) / 2
+				if !s.Connected || avg == 0 {
+					return 0, false, false
+				}
+				return avg, avg < t.MinThroughputMbps, avg >= t.MinThroughputMbps*(1+alertClearMargin)
+			},
+			lower,
+			func(v, t float64) string {
+				return fmt.Sprintf("Low throughput: %.2f Mbps (threshold: %.2f Mbps)", v, t)
+			}},
+	}
+
+	// Each required reachability target is its own condition
+	for _, r := range snapshot.Reachability {
+		if !r.Required {
+			continue
+		}
+		name := r.Name
+		checks = append(checks, alertCheck{
+			kind: "reachability:" + name,
+			evaluate: func(s *VPNHealthSnapshot) (float64, bool, bool) {
+				for _, r := range s.Reachability {
+					if r.Name == name {
+						return 0, !r.Reachable, r.Reachable
+					}
+				}
+				return 0, false, false
+			},
+			worse: higher,
+			message: func(float64, float64) string {
+				return fmt.Sprintf("Required target %s unreachable", name)
+			},
+		})
+	}
+	return checks
+}
+
+// Evaluate folds a health snapshot into the alert state machine
+func (am *VPNAlertManager) Evaluate(snapshot *VPNHealthSnapshot, thresholds VPNHealthThresholds) {
+	am.mutex.Lock()
+
+	changed := false
+	var events []VPNAlertNotification
+
+	evaluated := make(map[string]bool)
+	for _, c := range am.checks(thresholds, snapshot) {
+		evaluated[c.kind] = true
+		value, breached, clear := c.evaluate(snapshot)
+		cond, ok := am.state.Conditions[c.kind]
+		if !ok {
+			cond = &alertCondition{}
+			am.state.Conditions[c.kind] = cond
+		}
+		active := am.state.Active[c.kind]
+
+		switch {
+		case breached:
+			cond.Breaches++
+			cond.Clears = 0
+			changed = true
+			if active != nil {
+				if c.worse(value, active.Value) {
+					previous := active.Severity
+					active.Value = value
+					*active = finishAlert(*active, c.message)
+					if previous == "warning" && active.Severity == "critical" {
+						log.Printf("Health Alert escalated: %s", active.Message)
+						events = append(events, VPNAlertNotification{Event: alertEventEscalated, Timestamp: snapshot.Timestamp, Alert: *active})
+					}
+				}
+				continue
+			}
+			if cond.Breaches < alertRaiseAfter {
+				continue
+			}
+			alert := finishAlert(VPNHealthAlert{
+				ID:        fmt.Sprintf("%s-%d", alertIDEscaper.Replace(c.kind), snapshot.Timestamp.UnixNano()),
+				Timestamp: snapshot.Timestamp,
+				Type:      strings.SplitN(c.kind, ":", 2)[0],
+				Value:     value,
+				Threshold: c.threshold,
+			}, c.message)
+			am.state.Active[c.kind] = &alert
+			log.Printf("Health Alert raised: %s", alert.Message)
+			events = append(events, VPNAlertNotification{Event: alertEventRaised, Timestamp: snapshot.Timestamp, Alert: alert})
+
+		case clear:
+			if cond.Breaches == 0 && active == nil {
+				continue
+			}
+			cond.Breaches = 0
+			changed = true
+			if active == nil {
+				continue
+			}
+			cond.Clears++
+			if cond.Clears < alertClearAfter {
+				continue
+			}
+			cond.Clears = 0
+			events = append(events, am.resolveLocked(c.kind, snapshot.Timestamp))
+		}
+	}
+
+	// Targets no longer configured cannot clear on their own
+	if snapshot.Connected {
+		for kind := range am.state.Active {
+			if strings.HasPrefix(kind, "reachability:") && !evaluated[kind] {
+				delete(am.state.Conditions, kind)
+				events = append(events, am.resolveLocked(kind, snapshot.Timestamp))
+				changed = true
+			}
+		}
+	}
+
+	if snapshot.Connected && !am.state.SeenConnected {
+		am.state.SeenConnected = true
+		changed = true
+	}
+
+	var data []byte
+	var gen uint64
+	if changed {
+		data, gen = am.encodeStateLocked()
+	}
+	for _, e := range events {
+		am.dispatch(e)
+	}
+	am.mutex.Unlock()
+
+	if data != nil {
+		am.writeState(data, gen)
+	}
+}
+
+// resolveLocked resolves the active alert of a condition; requires the lock
+func (am *VPNAlertManager) resolveLocked(kind string, at time.Time) VPNAlertNotification {
+	active := am.state.Active[kind]
+	active.Resolved = true
+	active.ResolvedAt = &at
+	delete(am.state.Active, kind)
+	am.state.Resolved = append(am.state.Resolved, active)
+	if len(am.state.Resolved) > maxResolvedAlerts {
+		am.state.Resolved = am.state.Resolved[len(am.state.Resolved)-maxResolvedAlerts:]
+	}
+	log.Printf("Health Alert resolved: %s", active.Message)
+	return VPNAlertNotification{Event: alertEventResolved, Timestamp: at, Alert: *active}
+}
+
+// dispatch sends a notification to every target without blocking the monitor
+func (am *VPNAlertManager) dispatch(n VPNAlertNotification) {
+	for _, notifier := range am.notifiers {
+		go func(notifier AlertNotifier) {
+			if err := notifier.Notify(n); err != nil {
+				log.Printf("Warning: alert notification via %s failed: %v", notifier.Name(), err)
+			}
+		}(notifier)
+	}
+}
+
+// List returns alerts filtered by status ("active", "resolved" or "all"), newest first
+func (am *VPNAlertManager) List(status string) ([]VPNHealthAlert, error) {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	alerts := make([]VPNHealthAlert, 0)
+	switch status {
+	case "", "all", "active", "resolved":
+	default:
+		return nil, fmt.Errorf("invalid status %q: use active, resolved or all", status)
+	}
+	if status != "resolved" {
+		for _, a := range am.state.Active {
+			alerts = append(alerts, *a)
+		}
+	}
+	if status != "active" {
+		for _, a := range am.state.Resolved {
+			alerts = append(alerts, *a)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Timestamp.After(alerts[j].Timestamp) })
+	return alerts, nil
+}
+
+// Acknowledge marks an active or resolved alert as acknowledged
+func (am *VPNAlertManager) Acknowledge(id, by string) (*VPNHealthAlert, error) {
+	am.mutex.Lock()
+
+	var alert *VPNHealthAlert
+	for _, a := range am.state.Active {
+		if a.ID == id {
+			alert = a
+		}
+	}
+	for _, a := range am.state.Resolved {
+		if a.ID == id {
+			alert = a
+		}
+	}
+	if alert == nil {
+		am.mutex.Unlock()
+		return nil, fmt.Errorf("alert not found: %s", id)
+	}
+
+	var data []byte
+	var gen uint64
+	if !alert.Acknowledged {
+		now := time.Now()
+		alert.Acknowledged = true
+		alert.AcknowledgedAt = &now
+		alert.AcknowledgedBy = by
+		data, gen = am.encodeStateLocked()
+	}
+	result := *alert
+	am.mutex.Unlock()
+
+	if data != nil {
+		am.writeState(data, gen)
+	}
+	return &result, nil
+}
+
+// GetNotifierConfig returns the notification targets with secrets redacted
+func (am *VPNAlertManager) GetNotifierConfig() VPNAlertNotifierConfig {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	return am.config.redacted()
+}
+
+// SetNotifierConfig validates, applies and persists notification targets
+func (am *VPNAlertManager) SetNotifierConfig(config VPNAlertNotifierConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	// A redacted secret sent back unchanged keeps the stored one
+	config.keepRedactedValues(am.config)
+
+	am.config = config
+	am.notifiers = buildNotifiers(config)
+	return am.saveConfig()
+}
+
+// TestNotifiers sends a test notification to every target and reports the result of each
+func (am *VPNAlertManager) TestNotifiers() map[string]string {
+	am.mutex.Lock()
+	notifiers := am.notifiers
+	am.mutex.Unlock()
+
+	now := time.Now()
+	n := VPNAlertNotification{
+		Event:     alertEventTest,
+		Timestamp: now,
+		Alert: VPNHealthAlert{
+			Timestamp: now,
+			Severity:  "info",
+			Type:      "test",
+			Message:   "Test notification from NoC Raven VPN manager",
+		},
+	}
+
+	results := make(map[string]string)
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(n); err != nil {
+			results[notifier.Name()] = err.Error()
+		} else {
+			results[notifier.Name()] = "ok"
+		}
+	}
+	return results
+}
+
+func buildNotifiers(config VPNAlertNotifierConfig) []AlertNotifier {
+	notifiers := make([]AlertNotifier, 0, len(config.Webhooks)+len(config.SMTP))
+	for _, wh := range config.Webhooks {
+		notifiers = append(notifiers, &webhookNotifier{target: wh, client: &http.Client{Timeout: 10 * time.Second}})
+	}
+	for _, s := range config.SMTP {
+		notifiers = append(notifiers, &smtpNotifier{target: s, send: smtp.SendMail})
+	}
+	return notifiers
+}
+
+// encodeStateLocked encodes alert state for writeState; requires the lock
+func (am *VPNAlertManager) encodeStateLocked() ([]byte, uint64) {
+	data, err := json.MarshalIndent(am.state, "", "  ")
+	if err != nil {
+		log.Printf("Warning: failed to encode alert state: %v", err)
+		return nil, 0
+	}
+	am.stateGen++
+	return data, am.stateGen
+}
+
+// writeState writes encoded alert state to disk unless a newer encoding has
+// already been written; call it without the lock
+func (am *VPNAlertManager) writeState(data []byte, gen uint64) {
+	am.saveMutex.Lock()
+	defer am.saveMutex.Unlock()
+
+	if gen <= am.writtenGen {
+		return
+	}
+	if err := os.WriteFile(am.statePath, data, 0644); err != nil {
+		log.Printf("Warning: failed to save alert state: %v", err)
+		return
+	}
+	am.writtenGen = gen
+}
+
+func (am *VPNAlertManager) loadState() {
+	data, err := os.ReadFile(am.statePath)
+	if err != nil {
+		// No existing alert state is OK
+		return
+	}
+
+	var state alertState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Warning: failed to decode alert state: %v", err)
+		return
+	}
+	if state.Active != nil {
+		am.state.Active = state.Active
+	}
+	if state.Resolved != nil {
+		am.state.Resolved = state.Resolved
+	}
+	if state.Conditions != nil {
+		am.state.Conditions = state.Conditions
+	}
+	am.state.SeenConnected = state.SeenConnected
+	log.Printf("Loaded %d active health alerts", len(am.state.Active))
+}
+
+// saveConfig writes notifier targets to disk; it holds SMTP passwords, so
+// only the owner may read it
+func (am *VPNAlertManager) saveConfig() error {
+	data, err := json.MarshalIndent(am.config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode notifier config: %v", err)
+	}
+	if err := os.WriteFile(am.configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save notifier config: %v", err)
+	}
+	return nil
+}
+
+func (am *VPNAlertManager) loadConfig() {
+	data, err := os.ReadFile(am.configPath)
+	if err != nil {
+		return
+	}
+
+	var config VPNAlertNotifierConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Printf("Warning: failed to decode notifier config: %v", err)
+		return
+	}
+	am.config = config
+	am.notifiers = buildNotifiers(config)
+}
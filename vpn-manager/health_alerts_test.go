@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// alertTest feeds latency snapshots 30 seconds apart to a manager whose
+// notifications go to a test webhook
+type alertTest struct {
+	vm       *VPNManager
+	am       *VPNAlertManager
+	received chan VPNAlertNotification
+	start    time.Time
+}
+
+func newAlertTest(t *testing.T) *alertTest {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	t.Cleanup(func() { vm.healthMonitor.Close() })
+
+	at := &alertTest{vm: vm, am: vm.healthMonitor.alerts, received: make(chan VPNAlertNotification, 10), start: time.Now()}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n VPNAlertNotification
+		json.NewDecoder(r.Body).Decode(&n)
+		if r.Header.Get("X-Token") != "secret" {
+			t.Errorf("webhook header missing")
+		}
+		at.received <- n
+	}))
+	t.Cleanup(hook.Close)
+	if err := at.am.SetNotifierConfig(VPNAlertNotifierConfig{
+		Webhooks: []WebhookTarget{{URL: hook.URL, Headers: map[string]string{"X-Token": "secret"}}},
+	}); err != nil {
+		t.Fatalf("set notifiers: %v", err)
+	}
+	return at
+}
+
+func (at *alertTest) feed(latencies ...float64) {
+	thresholds := at.vm.healthMonitor.GetThresholds()
+	for _, latency := range latencies {
+		at.am.Evaluate(&VPNHealthSnapshot{
+			Timestamp:       at.start,
+			Connected:       true,
+			RemoteReachable: true,
+			Latency:         latency,
+		}, thresholds)
+		at.start = at.start.Add(30 * time.Second)
+	}
+}
+
+func (at *alertTest) list(t *testing.T, status string) []VPNHealthAlert {
+	t.Helper()
+	alerts, err := at.am.List(status)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	return alerts
+}
+
+func (at *alertTest) notification(t *testing.T) VPNAlertNotification {
+	t.Helper()
+	select {
+	case n := <-at.received:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not delivered")
+	}
+	return VPNAlertNotification{}
+}
+
+func TestAlertManager_Hysteresis(t *testing.T) {
+	cases := []struct {
+		name      string
+		latencies []float64
+		active    int
+		resolved  int
+	}{
+		{"single breach", []float64{250}, 0, 0},
+		{"two consecutive breaches", []float64{250, 320}, 1, 0},
+		{"inside the hysteresis margin", []float64{250, 320, 190, 190, 190, 190}, 1, 0},
+		{"two clear snapshots", []float64{250, 320, 100, 100}, 1, 0},
+		{"three clear snapshots", []float64{250, 320, 100, 100, 100}, 0, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			at := newAlertTest(t)
+			at.feed(tc.latencies...)
+			active, resolved := at.list(t, "active"), at.list(t, "resolved")
+			if len(active) != tc.active || len(resolved) != tc.resolved {
+				t.Fatalf("active = %+v, resolved = %+v", active, resolved)
+			}
+			for _, alert := range append(active, resolved...) {
+				if alert.Type != "latency" || alert.Severity != "critical" || alert.Value != 320 {
+					t.Errorf("alert = %+v", alert)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertManager_Notifications(t *testing.T) {
+	at := newAlertTest(t)
+	at.feed(250, 320)
+	alerts := at.list(t, "active")
+	if len(alerts) != 1 {
+		t.Fatalf("active alerts = %+v", alerts)
+	}
+	if n := at.notification(t); n.Event != alertEventRaised || n.Alert.ID != alerts[0].ID {
+		t.Errorf("raise notification = %+v", n)
+	}
+	at.feed(100, 100, 100)
+	if n := at.notification(t); n.Event != alertEventResolved || n.Alert.ID != alerts[0].ID {
+		t.Errorf("resolve notification = %+v", n)
+	}
+}
+
+func TestAlertManager_StateSurvivesRestart(t *testing.T) {
+	at := newAlertTest(t)
+	at.feed(250, 320)
+
+	reloaded := NewVPNAlertManager(at.vm.statePath)
+	if alerts, _ := reloaded.List("active"); len(alerts) != 1 {
+		t.Fatalf("reloaded active alerts = %d, want 1", len(alerts))
+	}
+}
+
+func TestHandleAcknowledgeAlert(t *testing.T) {
+	at := newAlertTest(t)
+	at.feed(250, 320)
+	alerts := at.list(t, "active")
+	router := at.vm.setupRoutes()
+
+	cases := []struct {
+		id   string
+		want int
+	}{
+		{alerts[0].ID, http.StatusOK},
+		{"missing", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/vpn/health/alerts/"+tc.id+"/acknowledge",
+			strings.NewReader(`{"acknowledged_by":"noc"}`)))
+		if rec.Code != tc.want {
+			t.Errorf("acknowledge %s = %d, want %d: %s", tc.id, rec.Code, tc.want, rec.Body.String())
+		}
+	}
+
+	// The acknowledgement stays with the alert once it resolves
+	at.feed(100, 100, 100)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/vpn/health/alerts?status=resolved", nil))
+	var resolved []VPNHealthAlert
+	json.NewDecoder(rec.Body).Decode(&resolved)
+	if len(resolved) != 1 || !resolved[0].Resolved || !resolved[0].Acknowledged || resolved[0].AcknowledgedBy != "noc" {
+		t.Fatalf("resolved alerts = %+v", resolved)
+	}
+}
+
+func TestAlertNotifiers_SMTPMessage(t *testing.T) {
+	var gotAddr string
+	var gotMsg []byte
+	n := &smtpNotifier{
+		target: SMTPTarget{Host: "mail.example.com", From: "raven@example.com", To: []string{"noc@example.com"}},
+		send: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			gotAddr, gotMsg = addr, msg
+			return nil
+		},
+	}
+	alert := finishAlert(VPNHealthAlert{Timestamp: time.Now(), Type: "packet_loss", Value: 6, Threshold: 5},
+		func(v, t float64) string { return "High packet loss" })
+	if err := n.Notify(VPNAlertNotification{Event: alertEventRaised, Timestamp: time.Now(), Alert: alert}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if gotAddr != "mail.example.com:587" {
+		t.Errorf("addr = %s", gotAddr)
+	}
+	if !strings.Contains(string(gotMsg), "Subject: [NoC Raven] VPN warning alert raised: High packet loss\r\n") {
+		t.Errorf("message = %s", gotMsg)
+	}
+}
+
+func TestAlertNotifiers_SMTPPasswordRedaction(t *testing.T) {
+	am := NewVPNAlertManager(t.TempDir())
+	config := VPNAlertNotifierConfig{SMTP: []SMTPTarget{{Host: "mail.example.com", Username: "raven", Password: "hunter2", From: "a@b", To: []string{"c@d"}}}}
+	if err := am.SetNotifierConfig(config); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	got := am.GetNotifierConfig()
+	if got.SMTP[0].Password != redactedSecret {
+		t.Errorf("password not redacted: %q", got.SMTP[0].Password)
+	}
+	// Saving the redacted config back keeps the stored password
+	if err := am.SetNotifierConfig(got); err != nil {
+		t.Fatalf("set redacted: %v", err)
+	}
+	if am.config.SMTP[0].Password != "hunter2" {
+		t.Errorf("stored password = %q", am.config.SMTP[0].Password)
+	}
+}
+
+func TestAlertNotifiers_RejectsInvalidWebhookURL(t *testing.T) {
+	am := NewVPNAlertManager(t.TempDir())
+	if err := am.SetNotifierConfig(VPNAlertNotifierConfig{Webhooks: []WebhookTarget{{URL: "ftp://x"}}}); err == nil {
+		t.Error("invalid webhook URL accepted")
+	}
+}
+
+func TestAlertNotifiers_WebhookHeaderRedaction(t *testing.T) {
+	stored := VPNAlertNotifierConfig{Webhooks: []WebhookTarget{{
+		URL:     "https://hooks.example.com/noc",
+		Headers: map[string]string{"Authorization": "Bearer s3cret", "X-Team": "noc"},
+	}}}
+	cases := []struct {
+		name   string
+		update WebhookTarget
+		want   map[string]string
+	}{
+		{"echoed back", WebhookTarget{URL: "https://hooks.example.com/noc", Headers: map[string]string{"Authorization": redactedSecret, "X-Team": redactedSecret}},
+			map[string]string{"Authorization": "Bearer s3cret", "X-Team": "noc"}},
+		{"header name case", WebhookTarget{URL: "https://hooks.example.com/noc", Headers: map[string]string{"authorization": redactedSecret}},
+			map[string]string{"authorization": "Bearer s3cret"}},
+		{"new value", WebhookTarget{URL: "https://hooks.example.com/noc", Headers: map[string]string{"Authorization": "Bearer rotated", "X-Team": redactedSecret}},
+			map[string]string{"Authorization": "Bearer rotated", "X-Team": "noc"}},
+		{"other URL", WebhookTarget{URL: "https://elsewhere.example.com/", Headers: map[string]string{"Authorization": redactedSecret}},
+			map[string]string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newTestVPNManager(t)
+			defer vm.healthMonitor.Close()
+			am := vm.healthMonitor.alerts
+			if err := am.SetNotifierConfig(stored); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/vpn/health/alerts/notifiers", nil))
+			if strings.Contains(rec.Body.String(), "s3cret") || strings.Contains(rec.Body.String(), `"noc"`) {
+				t.Errorf("GET notifiers leaks header values: %s", rec.Body.String())
+			}
+
+			if err := am.SetNotifierConfig(VPNAlertNotifierConfig{Webhooks: []WebhookTarget{tc.update}}); err != nil {
+				t.Fatalf("update: %v", err)
+			}
+			got := am.config.Webhooks[0].Headers
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("stored headers = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// Notifier targets receive alert contents, so only the API key may change them
+func TestAlertNotifiers_NeedAPIKey(t *testing.T) {
+	cases := []struct {
+		name       string
+		configured string
+		apiKey     string
+		want       int
+	}{
+		{"unconfigured", "", "", http.StatusForbidden},
+		{"unconfigured with a key", "", "admin-key", http.StatusForbidden},
+		{"missing key", "admin-key", "", http.StatusForbidden},
+		{"wrong key", "admin-key", "wrong", http.StatusForbidden},
+		{"api key", "admin-key", "admin-key", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NOC_RAVEN_API_KEY", tc.configured)
+			vm := newTestVPNManager(t)
+			defer vm.healthMonitor.Close()
+			hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer hook.Close()
+
+			for _, route := range []struct{ method, path, body string }{
+				{http.MethodPut, "/api/vpn/health/alerts/notifiers", fmt.Sprintf(`{"webhooks":[{"url":%q}]}`, hook.URL)},
+				{http.MethodPost, "/api/vpn/health/alerts/notifiers/test", ""},
+			} {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(route.method, route.path, strings.NewReader(route.body))
+				if tc.apiKey != "" {
+					req.Header.Set("X-API-Key", tc.apiKey)
+				}
+				vm.setupRoutes().ServeHTTP(rec, req)
+				if rec.Code != tc.want {
+					t.Errorf("%s %s = %d, want %d: %s", route.method, route.path, rec.Code, tc.want, rec.Body.String())
+				}
+			}
+			if got := len(vm.healthMonitor.alerts.GetNotifierConfig().Webhooks); (got == 1) != (tc.want == http.StatusOK) {
+				t.Errorf("stored %d webhooks after PUT answered %d", got, tc.want)
+			}
+		})
+	}
+}
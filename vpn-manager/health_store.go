@@ -0,0 +1,371 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Health history retention per resolution
+const (
+	healthRawRetention    = 24 * time.Hour
+	health5mRetention     = 30 * 24 * time.Hour
+	health1hRetention     = 365 * 24 * time.Hour
+	healthPruneInterval   = 10 * time.Minute
+	healthResolutionRaw   = "raw"
+	healthResolution5m    = "5m"
+	healthResolution1h    = "1h"
+	healthResolutionAuto  = "auto"
+	healthRollup5mSeconds = 300
+	healthRollup1hSeconds = 3600
+)
+
+// healthRollupWidths maps rollup resolutions to their bucket width in seconds
+var healthRollupWidths = map[string]int64{
+	healthResolution5m: healthRollup5mSeconds,
+	healthResolution1h: healthRollup1hSeconds,
+}
+
+// HealthHistoryQuery selects a time range and resolution of health history
+type HealthHistoryQuery struct {
+	From       time.Time
+	To         time.Time
+	Resolution string // "raw", "5m", "1h" or "auto"
+}
+
+// healthQueryError is a history query that cannot be answered as asked, as
+// opposed to a failure of the store
+type healthQueryError string
+
+func (e healthQueryError) Error() string { return string(e) }
+
+// VPNHealthPoint is health aggregated over one raw sample or rollup bucket
+type VPNHealthPoint struct {
+	Timestamp        time.Time `json:"timestamp"`
+	Samples          int       `json:"samples"`
+	UptimePercent    float64   `json:"uptime_percent"`
+	ReachablePercent float64   `json:"reachable_percent"`
+	AvgLatency       float64   `json:"avg_latency_ms"`
+	MinLatency       float64   `json:"min_latency_ms"`
+	MaxLatency       float64   `json:"max_latency_ms"`
+	AvgPacketLoss    float64   `json:"avg_packet_loss_percent"`
+	MaxPacketLoss    float64   `json:"max_packet_loss_percent"`
+	AvgDownloadMbps  float64   `json:"avg_download_mbps"`
+	AvgUploadMbps    float64   `json:"avg_upload_mbps"`
+}
+
+// VPNHealthHistory is the response of a health history query
+type VPNHealthHistory struct {
+	From       time.Time            `json:"from"`
+	To         time.Time            `json:"to"`
+	Resolution string               `json:"resolution"`
+	Points     []VPNHealthPoint     `json:"points"`
+	Snapshots  []*VPNHealthSnapshot `json:"snapshots,omitempty"` // raw resolution only
+}
+
+// healthStore persists health snapshots and their rollups in SQLite
+type healthStore struct {
+	db        *sql.DB
+	lastPrune time.Time
+}
+
+// openHealthStore opens or creates the health history database
+func openHealthStore(path string) (*healthStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create health store directory: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open health store: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping health store: %v", err)
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS health_snapshots (
+		timestamp INTEGER NOT NULL,
+		connected INTEGER NOT NULL,
+		profile_id TEXT,
+		latency_ms REAL NOT NULL,
+		packet_loss REAL NOT NULL,
+		remote_reachable INTEGER NOT NULL,
+		download_mbps REAL NOT NULL,
+		upload_mbps REAL NOT NULL,
+		snapshot TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_health_snapshots_timestamp ON health_snapshots(timestamp);
+
+	CREATE TABLE IF NOT EXISTS health_rollups (
+		resolution INTEGER NOT NULL,
+		bucket INTEGER NOT NULL,
+		samples INTEGER NOT NULL,
+		connected_samples INTEGER NOT NULL,
+		reachable_samples INTEGER NOT NULL,
+		latency_sum REAL NOT NULL,
+		latency_min REAL NOT NULL,
+		latency_max REAL NOT NULL,
+		loss_sum REAL NOT NULL,
+		loss_max REAL NOT NULL,
+		download_sum REAL NOT NULL,
+		upload_sum REAL NOT NULL,
+		PRIMARY KEY (resolution, bucket)
+	);`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create health store tables: %v", err)
+	}
+
+	return &healthStore{db: db}, nil
+}
+
+// Close closes the database
+func (hs *healthStore) Close() error {
+	return hs.db.Close()
+}
+
+// Record stores a snapshot and folds it into the 5-minute and hourly rollups
+func (hs *healthStore) Record(snapshot *VPNHealthSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tx, err := hs.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ts := snapshot.Timestamp.Unix()
+	_, err = tx.Exec(`INSERT INTO health_snapshots
+		(timestamp, connected, profile_id, latency_ms, packet_loss, remote_reachable, download_mbps, upload_mbps, snapshot)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ts, snapshot.Connected, snapshot.ProfileID, snapshot.Latency, snapshot.PacketLoss, snapshot.RemoteReachable,
+		snapshot.Throughput.DownloadSpeedMbps, snapshot.Throughput.UploadSpeedMbps, string(data))
+	if err != nil {
+		return err
+	}
+
+	// Latency only counts when the remote answered; loss and throughput only while connected
+	var connected, reachable int
+	var latency, loss, download, upload float64
+	if snapshot.Connected {
+		connected = 1
+		loss = snapshot.PacketLoss
+		download = snapshot.Throughput.DownloadSpeedMbps
+		upload = snapshot.Throughput.UploadSpeedMbps
+		if snapshot.RemoteReachable {
+			reachable = 1
+			latency = snapshot.Latency
+		}
+	}
+
+	for _, width := range []int64{healthRollup5mSeconds, healthRollup1hSeconds} {
+		_, err := tx.Exec(`INSERT INTO health_rollups
+			(resolution, bucket, samples, connected_samples, reachable_samples,
+			 latency_sum, latency_min, latency_max, loss_sum, loss_max, download_sum, upload_sum)
+			VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(resolution, bucket) DO UPDATE SET
+				samples = samples + 1,
+				connected_samples = connected_samples + excluded.connected_samples,
+				latency_min = CASE
+					WHEN excluded.reachable_samples = 0 THEN latency_min
+					WHEN reachable_samples = 0 THEN excluded.latency_min
+					ELSE MIN(latency_min, excluded.latency_min) END,
+				reachable_samples = reachable_samples + excluded.reachable_samples,
+				latency_sum = latency_sum + excluded.latency_sum,
+				latency_max = MAX(latency_max, excluded.latency_max),
+				loss_sum = loss_sum + excluded.loss_sum,
+				loss_max = MAX(loss_max, excluded.loss_max),
+				download_sum = download_sum + excluded.download_sum,
+				upload_sum = upload_sum + excluded.upload_sum`,
+			width, ts-ts%width, connected, reachable,
+			latency, latency, latency, loss, loss, download, upload)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if snapshot.Timestamp.Sub(hs.lastPrune) >= healthPruneInterval {
+		hs.lastPrune = snapshot.Timestamp
+		if err := hs.Prune(snapshot.Timestamp); err != nil {
+			return fmt.Errorf("failed to prune health history: %v", err)
+		}
+	}
+	return nil
+}
+
+// Prune removes data past the retention of each resolution
+func (hs *healthStore) Prune(now time.Time) error {
+	if _, err := hs.db.Exec("DELETE FROM health_snapshots WHERE timestamp < ?", now.Add(-healthRawRetention).Unix()); err != nil {
+		return err
+	}
+	if _, err := hs.db.Exec("DELETE FROM health_rollups WHERE resolution = ? AND bucket < ?",
+		healthRollup5mSeconds, now.Add(-health5mRetention).Unix()); err != nil {
+		return err
+	}
+	_, err := hs.db.Exec("DELETE FROM health_rollups WHERE resolution = ? AND bucket < ?",
+		healthRollup1hSeconds, now.Add(-health1hRetention).Unix())
+	return err
+}
+
+// Recent returns raw snapshots since the given time, oldest first
+func (hs *healthStore) Recent(since time.Time) ([]*VPNHealthSnapshot, error) {
+	rows, err := hs.db.Query("SELECT snapshot FROM health_snapshots WHERE timestamp >= ? ORDER BY timestamp ASC", since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]*VPNHealthSnapshot, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var snapshot VPNHealthSnapshot
+		if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// resolveHealthResolution picks the resolution for a query, checking the range
+// is still covered by the retention of that resolution
+func resolveHealthResolution(q HealthHistoryQuery, now time.Time) (string, error) {
+	age := now.Sub(q.From)
+	span := q.To.Sub(q.From)
+
+	switch q.Resolution {
+	case "", healthResolutionAuto:
+		switch {
+		case age <= healthRawRetention && span <= 6*time.Hour:
+			return healthResolutionRaw, nil
+		case age <= health5mRetention && span <= 7*24*time.Hour:
+			return healthResolution5m, nil
+		default:
+			return healthResolution1h, nil
+		}
+	case healthResolutionRaw:
+		if age > healthRawRetention {
+			return "", healthQueryError(fmt.Sprintf("raw health history is only kept for %s", healthRawRetention))
+		}
+	case healthResolution5m:
+		if age > health5mRetention {
+			return "", healthQueryError(fmt.Sprintf("5-minute health history is only kept for %s", health5mRetention))
+		}
+	case healthResolution1h:
+	default:
+		return "", healthQueryError(fmt.Sprintf("invalid resolution %q: use raw, 5m, 1h or auto", q.Resolution))
+	}
+	return q.Resolution, nil
+}
+
+// Query returns history between From and To at the requested resolution
+func (hs *healthStore) Query(q HealthHistoryQuery, now time.Time) (*VPNHealthHistory, error) {
+	if !q.To.After(q.From) {
+		return nil, healthQueryError("invalid range: from must be before to")
+	}
+	resolution, err := resolveHealthResolution(q, now)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &VPNHealthHistory{
+		From:       q.From,
+		To:         q.To,
+		Resolution: resolution,
+		Points:     make([]VPNHealthPoint, 0),
+	}
+
+	if resolution == healthResolutionRaw {
+		snapshots, err := hs.Recent(q.From)
+		if err != nil {
+			return nil, err
+		}
+		history.Snapshots = make([]*VPNHealthSnapshot, 0, len(snapshots))
+		for _, s := range snapshots {
+			if s.Timestamp.After(q.To) {
+				break
+			}
+			history.Snapshots = append(history.Snapshots, s)
+			history.Points = append(history.Points, healthPointFromSnapshot(s))
+		}
+		return history, nil
+	}
+
+	width := healthRollupWidths[resolution]
+	from := q.From.Unix()
+	rows, err := hs.db.Query(`SELECT bucket, samples, connected_samples, reachable_samples,
+			latency_sum, latency_min, latency_max, loss_sum, loss_max, download_sum, upload_sum
+		FROM health_rollups
+		WHERE resolution = ? AND bucket >= ? AND bucket <= ?
+		ORDER BY bucket ASC`, width, from-from%width, q.To.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket int64
+		var samples, connected, reachable int
+		var latencySum, latencyMin, latencyMax, lossSum, lossMax, downloadSum, uploadSum float64
+		if err := rows.Scan(&bucket, &samples, &connected, &reachable,
+			&latencySum, &latencyMin, &latencyMax, &lossSum, &lossMax, &downloadSum, &uploadSum); err != nil {
+			return nil, err
+		}
+		point := VPNHealthPoint{
+			Timestamp:     time.Unix(bucket, 0).UTC(),
+			Samples:       samples,
+			UptimePercent: float64(connected) / float64(samples) * 100,
+			MinLatency:    latencyMin,
+			MaxLatency:    latencyMax,
+			MaxPacketLoss: lossMax,
+		}
+		if connected > 0 {
+			point.ReachablePercent = float64(reachable) / float64(connected) * 100
+			point.AvgPacketLoss = lossSum / float64(connected)
+			point.AvgDownloadMbps = downloadSum / float64(connected)
+			point.AvgUploadMbps = uploadSum / float64(connected)
+		}
+		if reachable > 0 {
+			point.AvgLatency = latencySum / float64(reachable)
+		}
+		history.Points = append(history.Points, point)
+	}
+	return history, rows.Err()
+}
+
+// healthPointFromSnapshot converts a single raw snapshot to a history point
+func healthPointFromSnapshot(s *VPNHealthSnapshot) VPNHealthPoint {
+	point := VPNHealthPoint{Timestamp: s.Timestamp, Samples: 1}
+	if !s.Connected {
+		return point
+	}
+	point.UptimePercent = 100
+	point.AvgPacketLoss = s.PacketLoss
+	point.MaxPacketLoss = s.PacketLoss
+	point.AvgDownloadMbps = s.Throughput.DownloadSpeedMbps
+	point.AvgUploadMbps = s.Throughput.UploadSpeedMbps
+	if s.RemoteReachable {
+		point.ReachablePercent = 100
+		point.AvgLatency = s.Latency
+		point.MinLatency = s.Latency
+		point.MaxLatency = s.Latency
+	}
+	return point
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// seedHealthHistory records a sample 40 days ago, ten samples in one 5-minute
+// bucket two days ago (the last disconnected) and four recent samples
+func seedHealthHistory(t *testing.T) (hm *VPNHealthMonitor, now, old time.Time) {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	hm = vm.healthMonitor
+	if hm.store == nil {
+		t.Fatal("health store not opened")
+	}
+
+	now = time.Now().Truncate(time.Hour)
+	snapshot := func(at time.Time, connected bool, latency float64) *VPNHealthSnapshot {
+		return &VPNHealthSnapshot{
+			Timestamp:       at,
+			Connected:       connected,
+			RemoteReachable: connected,
+			Latency:         latency,
+			PacketLoss:      latency / 100,
+			Throughput:      VPNThroughputMetrics{DownloadSpeedMbps: 10, UploadSpeedMbps: 2},
+		}
+	}
+	hm.addHealthSnapshot(snapshot(now.Add(-40*24*time.Hour), true, 50))
+	old = now.Add(-48 * time.Hour)
+	for i := 0; i < 10; i++ {
+		hm.addHealthSnapshot(snapshot(old.Add(time.Duration(i)*25*time.Second), i != 9, float64(10*(i+1))))
+	}
+	for i := 0; i < 4; i++ {
+		hm.addHealthSnapshot(snapshot(now.Add(-time.Duration(4-i)*10*time.Minute), true, 20))
+	}
+	return hm, now, old
+}
+
+func TestHealthHistory_FiveMinuteRollup(t *testing.T) {
+	hm, _, old := seedHealthHistory(t)
+	defer hm.Close()
+
+	got, err := hm.GetHealthHistory(HealthHistoryQuery{From: old.Add(-time.Minute), To: old.Add(time.Hour), Resolution: healthResolution5m})
+	if err != nil {
+		t.Fatalf("5m history: %v", err)
+	}
+	if len(got.Points) != 1 {
+		t.Fatalf("5m points = %d, want 1", len(got.Points))
+	}
+	p := got.Points[0]
+	if p.Samples != 10 || p.UptimePercent != 90 || p.MinLatency != 10 || p.MaxLatency != 90 || p.AvgLatency != 50 {
+		t.Errorf("5m point = %+v", p)
+	}
+}
+
+func TestHealthHistory_Resolutions(t *testing.T) {
+	hm, now, _ := seedHealthHistory(t)
+	defer hm.Close()
+
+	cases := []struct {
+		name       string
+		from       time.Time
+		resolution string
+		wantErr    bool
+		want       string
+		points     int
+	}{
+		// The 40-day-old sample only survives in the hourly rollups
+		{"5m past retention", now.Add(-41 * 24 * time.Hour), healthResolution5m, true, "", 0},
+		{"auto over 41 days", now.Add(-41 * 24 * time.Hour), healthResolutionAuto, false, healthResolution1h, 3},
+		{"auto over an hour", now.Add(-time.Hour), healthResolutionAuto, false, healthResolutionRaw, 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := hm.GetHealthHistory(HealthHistoryQuery{From: tc.from, To: now, Resolution: tc.resolution})
+			if tc.wantErr {
+				if err == nil {
+					t.Error("history past its retention must be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("history: %v", err)
+			}
+			if got.Resolution != tc.want || len(got.Points) != tc.points {
+				t.Errorf("history = %s with %d points, want %s with %d", got.Resolution, len(got.Points), tc.want, tc.points)
+			}
+			if tc.want == healthResolutionRaw && len(got.Snapshots) != tc.points {
+				t.Errorf("raw history has %d snapshots, want %d", len(got.Snapshots), tc.points)
+			}
+		})
+	}
+}
+
+func TestHealthHistory_PrunesRawAndReloads(t *testing.T) {
+	hm, now, _ := seedHealthHistory(t)
+
+	// Raw snapshots older than 24h are pruned, and recent ones reload on restart
+	var raw int
+	hm.store.db.QueryRow("SELECT COUNT(*) FROM health_snapshots").Scan(&raw)
+	if raw != 4 {
+		t.Errorf("raw rows = %d, want 4 after pruning", raw)
+	}
+	hm.Close()
+
+	reloaded := NewVPNHealthMonitor(hm.vm)
+	defer reloaded.Close()
+	if cur := reloaded.GetCurrentHealth(); cur == nil || !cur.Timestamp.Equal(now.Add(-10*time.Minute)) {
+		t.Errorf("reloaded current health = %+v", cur)
+	}
+}
+
+func TestHandleHealthHistory_Params(t *testing.T) {
+	vm := newTestVPNManager(t)
+	defer vm.healthMonitor.Close()
+	router := vm.setupRoutes()
+	vm.healthMonitor.addHealthSnapshot(&VPNHealthSnapshot{Timestamp: time.Now().Add(-time.Minute), Connected: true, Latency: 20})
+
+	cases := []struct {
+		target string
+		code   int
+		array  bool // the original endpoint answers with a plain array
+	}{
+		{"/api/vpn/health/history", http.StatusOK, true},
+		{"/api/vpn/health/history?minutes=30", http.StatusOK, true},
+		{"/api/vpn/health/history?minutes=100000", http.StatusOK, true},
+		{"/api/vpn/health/history?from=yesterday", http.StatusBadRequest, false},
+		{"/api/vpn/v2/health/history", http.StatusOK, false},
+		{"/api/vpn/v2/health/history?from=2026-01-01T00:00:00Z&resolution=1h", http.StatusOK, false},
+		{"/api/vpn/v2/health/history?from=yesterday", http.StatusBadRequest, false},
+		{"/api/vpn/v2/health/history?resolution=10s", http.StatusBadRequest, false},
+		{"/api/vpn/v2/health/history?from=2000-01-01T00:00:00Z&resolution=raw", http.StatusBadRequest, false},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.code {
+			t.Errorf("GET %s = %d, want %d: %s", tc.target, rec.Code, tc.code, rec.Body.String())
+			continue
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		if tc.array {
+			var snapshots []*VPNHealthSnapshot
+			if err := json.Unmarshal(rec.Body.Bytes(), &snapshots); err != nil || len(snapshots) != 1 {
+				t.Errorf("GET %s = %s, want an array of 1 snapshot (%v)", tc.target, rec.Body.String(), err)
+			}
+		} else {
+			var history VPNHealthHistory
+			if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil || history.Resolution == "" {
+				t.Errorf("GET %s = %s, want a history object (%v)", tc.target, rec.Body.String(), err)
+			}
+		}
+	}
+
+	// A failing store is a server error, not a bad request
+	vm.healthMonitor.store.db.Close()
+	for _, target := range []string{"/api/vpn/health/history", "/api/vpn/v2/health/history"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s with a closed store = %d, want 500", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// seedHealthSummary fills two hours of history: the previous hour steady at
+// 40ms, the current hour climbing from 60ms with a packet loss burst and a
+// short drop
+func seedHealthSummary(t *testing.T) *VPNHealthMonitor {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	hm := vm.healthMonitor
+	t.Cleanup(func() { hm.Close() })
+
+	now := time.Now()
+	for i := 0; i < 120; i++ {
+		at := now.Add(-2*time.Hour + time.Duration(i+1)*time.Minute)
+		s := &VPNHealthSnapshot{
+			Timestamp:       at,
+			Connected:       true,
+			RemoteReachable: true,
+			TunnelStable:    true,
+			Latency:         40,
+			Throughput:      VPNThroughputMetrics{DownloadSpeedMbps: 20, UploadSpeedMbps: 5},
+		}
+		if i >= 60 {
+			s.Latency = 60 + float64(i-60)
+		}
+		if i >= 70 && i < 73 {
+			s.PacketLoss = 12
+		}
+		if i == 80 {
+			s.Connected = false
+		}
+		hm.healthHistory = append(hm.healthHistory, s)
+	}
+	return hm
+}
+
+func TestHealthSummary_ConnectionTotals(t *testing.T) {
+	hm := seedHealthSummary(t)
+	hm.vm.connectionManager.history = []*VPNConnectionHistory{
+		{ProfileID: "drt", Success: true, DisconnectReason: "process_died"},
+		{ProfileID: "drt", Success: false, DisconnectReason: "process_died"},
+		{ProfileID: "drt", Success: true, DisconnectReason: "user_requested"},
+		{ProfileID: "drt", Success: true, DisconnectReason: "user_requested"},
+	}
+
+	summary := hm.GetHealthSummary()
+	if summary.TotalConnections != 3 || summary.TotalReconnects != 1 {
+		t.Errorf("totals = %d connections, %d reconnects; want 3, 1", summary.TotalConnections, summary.TotalReconnects)
+	}
+}
+
+// One of the last hour's 60 samples was disconnected
+func TestHealthSummary_SuccessRate(t *testing.T) {
+	if got, want := seedHealthSummary(t).GetHealthSummary().SuccessRate, 59.0/60*100; math.Abs(got-want) > 0.001 {
+		t.Errorf("success rate = %v, want %v", got, want)
+	}
+}
+
+func TestHealthSummary_Trends(t *testing.T) {
+	trends := seedHealthSummary(t).GetHealthSummary().PerformanceTrends
+	if trends.LatencyTrend != "degrading" || trends.LatencyChange < 100 {
+		t.Errorf("latency trend = %s (%.1f%%), want degrading", trends.LatencyTrend, trends.LatencyChange)
+	}
+	if trends.ThroughputTrend != "stable" {
+		t.Errorf("throughput trend = %s, want stable", trends.ThroughputTrend)
+	}
+	if want := 119.0 / 120 * 100; math.Abs(trends.UptimePercentage-want) > 0.001 {
+		t.Errorf("24h uptime = %v, want %v", trends.UptimePercentage, want)
+	}
+}
+
+func TestHealthSummary_RecentAlerts(t *testing.T) {
+	alerts := map[string]VPNHealthAlert{}
+	for _, a := range seedHealthSummary(t).GetHealthSummary().RecentAlerts {
+		alerts[a.Type] = a
+	}
+
+	cases := []struct {
+		kind  string
+		check func(a VPNHealthAlert, ok bool) bool
+	}{
+		{"packet_loss", func(a VPNHealthAlert, ok bool) bool {
+			return ok && a.Resolved && a.Value == 12 && a.Severity == "critical"
+		}},
+		{"connection", func(a VPNHealthAlert, ok bool) bool { return ok && a.Resolved }},
+		// Latency stayed under the 200ms threshold
+		{"latency", func(a VPNHealthAlert, ok bool) bool { return !ok }},
+	}
+	for _, tc := range cases {
+		if alert, ok := alerts[tc.kind]; !tc.check(alert, ok) {
+			t.Errorf("%s alert = %+v (raised %v)", tc.kind, alert, ok)
+		}
+	}
+}
+
+func TestHealthSummary_ConcurrentWriterDoesNotDeadlock(t *testing.T) {
+	hm := seedHealthSummary(t)
+
+	// A writer waiting on the lock must not deadlock a summary in progress
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			hm.SetThresholds(hm.GetThresholds())
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		hm.GetHealthSummary()
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetHealthSummary deadlocked with a concurrent writer")
+	}
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"bufio"
 	"context"
-	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,9 +14,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -37,6 +37,18 @@ type VPNProfile struct {
 	CA               string                 `json:"ca,omitempty"`
 	Certificate      string                 `json:"cert,omitempty"`
 	PrivateKey       string                 `json:"key,omitempty"`
+	TLSAuth          string                 `json:"tls_auth,omitempty"`
+	TLSCrypt         string                 `json:"tls_crypt,omitempty"`
+	TLSCryptV2       string                 `json:"tls_crypt_v2,omitempty"`
+	ExtraCerts       string                 `json:"extra_certs,omitempty"`
+	PKCS12           string                 `json:"pkcs12,omitempty"` // base64 DER, as inlined
+	KeyDirection     string                 `json:"key_direction,omitempty"` // 0 or 1, for tls-auth
+	DataCiphers      string                 `json:"data_ciphers,omitempty"` // colon-separated, as in the directive
+	VerifyX509Name   string                 `json:"verify_x509_name,omitempty"`
+	VerifyX509Type   string                 `json:"verify_x509_type,omitempty"` // name, name-prefix or subject
+	Routes           []VPNRoute             `json:"routes,omitempty"`
+	RedirectGateway  bool                   `json:"redirect_gateway"`
+	RedirectGatewayFlags []string           `json:"redirect_gateway_flags,omitempty"`
 	AuthUserPass     string                 `json:"auth_user_pass,omitempty"`
 	Keepalive        []int                  `json:"keepalive,omitempty"`
 	Verb             int                    `json:"verb,omitempty"`
@@ -49,19 +61,32 @@ type VPNProfile struct {
 	RenegSec         int                    `json:"reneg_sec,omitempty"`
 	MuteReplayWarnings bool                 `json:"mute_replay_warnings"`
 	CompLZO          string                 `json:"comp_lzo,omitempty"`
-	CustomDirectives map[string]string      `json:"custom_directives,omitempty"`
+	RemoteRandom     bool                   `json:"remote_random"`
+	ServerPollTimeout int                   `json:"server_poll_timeout,omitempty"`
+	CustomDirectives VPNDirectives          `json:"custom_directives"`
 	CreatedAt        time.Time              `json:"created_at"`
 	LastModified     time.Time              `json:"last_modified"`
 	Validated        bool                   `json:"validated"`
 	ValidationError  string                 `json:"validation_error,omitempty"`
+	ContentHash      string                 `json:"content_hash,omitempty"` // SHA-256 of the imported .ovpn
 	Priority         int                    `json:"priority"`
 	Active           bool                   `json:"active"`
+	Revision         int                    `json:"revision,omitempty"` // current entry in the revision history
+}
+
+// VPNRoute is a route directive; unset trailing fields are omitted
+type VPNRoute struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	Metric  string `json:"metric,omitempty"`
 }
 
 // VPNRemote represents a remote server configuration
 type VPNRemote struct {
-	Host string `json:"host"`
-	Port int    `json:"port"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol,omitempty"` // overrides the profile protocol
 }
 
 // VPNConnectionState represents the current connection state
@@ -73,10 +98,18 @@ type VPNConnectionState struct {
 	ConnectionTime   int               `json:"connection_time_seconds"`
 	LocalIP          string            `json:"local_ip,omitempty"`
 	RemoteIP         string            `json:"remote_ip,omitempty"`
+	Remote           string            `json:"remote,omitempty"` // host:port of the connected remote
 	BytesReceived    int64             `json:"bytes_received"`
 	BytesSent        int64             `json:"bytes_sent"`
 	LastError        string            `json:"last_error,omitempty"`
 	RetryCount       int               `json:"retry_count"`
+	OpenVPNState     string            `json:"openvpn_state,omitempty"`
+	StateDetail      string            `json:"state_detail,omitempty"`
+	PendingAuth      *VPNAuthPrompt    `json:"pending_auth,omitempty"`
+	Statistics       *OpenVPNStatus    `json:"statistics,omitempty"`
+	ReconnectAttempt int               `json:"reconnect_attempt,omitempty"`
+	RetriesExhausted bool              `json:"retries_exhausted,omitempty"`
+	NextRetryAt      *time.Time        `json:"next_retry_at,omitempty"`
 	Health           VPNHealthMetrics  `json:"health"`
 }
 
@@ -94,10 +127,13 @@ type VPNManager struct {
 	profilesPath      string
 	statePath         string
 	profiles          map[string]*VPNProfile
+	profilesMutex     sync.RWMutex // guards profiles; monitors read it concurrently with API writes
+	updateMutex       sync.Mutex   // serializes profile edits and rollbacks, each a read-modify-write of profile and revisions
 	currentState      *VPNConnectionState
 	connectionManager *VPNConnectionManager
 	diagnostics       *NetworkDiagnostics
 	healthMonitor     *VPNHealthMonitor
+	secrets           *secretKeyring
 }
 
 // NewVPNManager creates a new VPN manager instance
@@ -112,6 +148,7 @@ func NewVPNManager(profilesPath, statePath string) *VPNManager {
 				LastHealthCheck: time.Now(),
 			},
 		},
+		secrets:      newSecretKeyring(filepath.Join(statePath, "secret.key")),
 	}
 	
 	// Initialize connection manager
@@ -134,13 +171,20 @@ func (vm *VPNManager) ParseOVPNFile(filepath string) (*VPNProfile, error) {
 	}
 	defer file.Close()
 
+	profile, _, err := vm.parseOVPN(file, filepath)
+	return profile, err
+}
+
+// parseOVPN parses .ovpn content read from source, returning warnings for
+// directives that were kept as custom directives
+func (vm *VPNManager) parseOVPN(reader io.Reader, source string) (*VPNProfile, []string, error) {
 	profile := &VPNProfile{
-		ID:               generateProfileID(filepath),
-		Name:             strings.TrimSuffix(filepath, ".ovpn"),
-		Filename:         filepath,
+		ID:               generateProfileID(source),
+		Name:             strings.TrimSuffix(filepath.Base(source), ".ovpn"),
+		Filename:         source,
 		CreatedAt:        time.Now(),
 		LastModified:     time.Now(),
-		CustomDirectives: make(map[string]string),
+		CustomDirectives: make(VPNDirectives, 0),
 		Protocol:         "udp", // default
 		Device:           "tun",  // default
 		Port:             1194,   // default
@@ -148,11 +192,14 @@ func (vm *VPNManager) ParseOVPNFile(filepath string) (*VPNProfile, error) {
 		Priority:         5,      // default
 	}
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(reader)
 	var currentSection string
 	var sectionContent strings.Builder
+	warnings := make([]string, 0)
+	lineNumber := 0
 
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimSpace(scanner.Text())
 		
 		// Skip comments and empty lines
@@ -164,8 +211,11 @@ func (vm *VPNManager) ParseOVPNFile(filepath string) (*VPNProfile, error) {
 		if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
 			if currentSection != "" {
 				// End of section
+				if line != "</"+currentSection+">" {
+					return nil, warnings, fmt.Errorf("line %d: %s inside <%s> section", lineNumber, line, currentSection)
+				}
 				if err := vm.processCertificateSection(profile, currentSection, sectionContent.String()); err != nil {
-					return nil, fmt.Errorf("failed to process %s section: %v", currentSection, err)
+					return nil, warnings, fmt.Errorf("failed to process %s section: %v", currentSection, err)
 				}
 				currentSection = ""
 				sectionContent.Reset()
@@ -182,7 +232,10 @@ func (vm *VPNManager) ParseOVPNFile(filepath string) (*VPNProfile, error) {
 		}
 
 		// Parse configuration directives
-		parts := strings.Fields(line)
+		parts, err := splitOVPNLine(line)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
 		if len(parts) == 0 {
 			continue
 		}
@@ -192,13 +245,24 @@ func (vm *VPNManager) ParseOVPNFile(filepath string) (*VPNProfile, error) {
 
 		if err := vm.parseDirective(profile, directive, args); err != nil {
 			log.Printf("Warning: failed to parse directive '%s': %v", directive, err)
+			warnings = append(warnings, fmt.Sprintf("line %d: %v (kept as custom directive)", lineNumber, err))
 			// Store unknown directives as custom
-			profile.CustomDirectives[directive] = strings.Join(args, " ")
+			profile.CustomDirectives = append(profile.CustomDirectives, VPNDirective{Name: directive, Args: args, Raw: ovpnArgText(line)})
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %v", err)
+		return nil, warnings, fmt.Errorf("error reading file: %v", err)
+	}
+	if currentSection != "" {
+		return nil, warnings, fmt.Errorf("unterminated <%s> section", currentSection)
+	}
+
+	// port sets the default for remotes wherever it appears
+	for i := range profile.Remote {
+		if profile.Remote[i].Port == 0 {
+			profile.Remote[i].Port = profile.Port
+		}
 	}
 
 	// Validate the profile
@@ -209,7 +273,7 @@ func (vm *VPNManager) ParseOVPNFile(filepath string) (*VPNProfile, error) {
 		profile.Validated = true
 	}
 
-	return profile, nil
+	return profile, warnings, nil
 }
 
 // parseDirective parses individual OpenVPN directives
@@ -226,11 +290,28 @@ func (vm *VPNManager) parseDirective(profile *VPNProfile, directive string, args
 				remote.Port = port
 			}
 		}
-		if remote.Port == 0 {
-			remote.Port = profile.Port // use default
+		if len(args) >= 3 {
+			protocol := strings.ToLower(args[2])
+			if !validOpenVPNProtocol(protocol) {
+				return fmt.Errorf("unsupported remote protocol: %s", protocol)
+			}
+			remote.Protocol = protocol
 		}
 		profile.Remote = append(profile.Remote, remote)
 
+	case "remote-random":
+		profile.RemoteRandom = true
+
+	case "server-poll-timeout":
+		if len(args) < 1 {
+			return fmt.Errorf("server-poll-timeout directive requires seconds")
+		}
+		timeout, err := strconv.Atoi(args[0])
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid server-poll-timeout: %s", args[0])
+		}
+		profile.ServerPollTimeout = timeout
+
 	case "port":
 		if len(args) < 1 {
 			return fmt.Errorf("port directive requires port number")
@@ -246,7 +327,7 @@ func (vm *VPNManager) parseDirective(profile *VPNProfile, directive string, args
 			return fmt.Errorf("proto directive requires protocol")
 		}
 		protocol := strings.ToLower(args[0])
-		if protocol != "udp" && protocol != "tcp" && protocol != "tcp-client" {
+		if !validOpenVPNProtocol(protocol) {
 			return fmt.Errorf("unsupported protocol: %s", protocol)
 		}
 		profile.Protocol = protocol
@@ -342,6 +423,58 @@ func (vm *VPNManager) parseDirective(profile *VPNProfile, directive string, args
 		// Client mode - this is expected for client configurations
 		break
 
+	case "tls-auth", "tls-crypt", "tls-crypt-v2", "ca", "cert", "key", "extra-certs", "pkcs12":
+		// Only the inline form maps onto the profile; key files stay custom
+		if len(args) > 0 && args[0] != "[inline]" {
+			return fmt.Errorf("%s refers to file %s rather than an inline block", directive, args[0])
+		}
+		if strings.EqualFold(directive, "tls-auth") && len(args) >= 2 {
+			return vm.parseDirective(profile, "key-direction", args[1:2])
+		}
+
+	case "key-direction":
+		if len(args) < 1 || (args[0] != "0" && args[0] != "1") {
+			return fmt.Errorf("key-direction must be 0 or 1")
+		}
+		profile.KeyDirection = args[0]
+
+	case "data-ciphers":
+		if len(args) < 1 {
+			return fmt.Errorf("data-ciphers directive requires cipher list")
+		}
+		profile.DataCiphers = args[0]
+
+	case "verify-x509-name":
+		if len(args) < 1 {
+			return fmt.Errorf("verify-x509-name directive requires a name")
+		}
+		verifyType := ""
+		if len(args) >= 2 {
+			switch args[1] {
+			case "name", "name-prefix", "subject":
+				verifyType = args[1]
+			default:
+				return fmt.Errorf("invalid verify-x509-name type: %s", args[1])
+			}
+		}
+		profile.VerifyX509Name = args[0]
+		profile.VerifyX509Type = verifyType
+
+	case "route":
+		if len(args) < 1 || len(args) > 4 {
+			return fmt.Errorf("route directive requires network [netmask [gateway [metric]]]")
+		}
+		route := VPNRoute{Network: args[0]}
+		fields := []*string{&route.Netmask, &route.Gateway, &route.Metric}
+		for i, arg := range args[1:] {
+			*fields[i] = arg
+		}
+		profile.Routes = append(profile.Routes, route)
+
+	case "redirect-gateway":
+		profile.RedirectGateway = true
+		profile.RedirectGatewayFlags = append([]string{}, args...)
+
 	default:
 		return fmt.Errorf("unknown directive: %s", directive)
 	}
@@ -358,6 +491,16 @@ func (vm *VPNManager) processCertificateSection(profile *VPNProfile, section, co
 		profile.Certificate = content
 	case "key":
 		profile.PrivateKey = content
+	case "tls-auth":
+		profile.TLSAuth = content
+	case "tls-crypt":
+		profile.TLSCrypt = content
+	case "tls-crypt-v2":
+		profile.TLSCryptV2 = content
+	case "extra-certs":
+		profile.ExtraCerts = content
+	case "pkcs12":
+		profile.PKCS12 = content
 	default:
 		return fmt.Errorf("unknown certificate section: %s", section)
 	}
@@ -412,15 +555,7 @@ func (vm *VPNManager) validateProfile(profile *VPNProfile) error {
 	}
 
 	// Validate protocol
-	validProtocols := []string{"udp", "tcp", "tcp-client"}
-	valid := false
-	for _, p := range validProtocols {
-		if profile.Protocol == p {
-			valid = true
-			break
-		}
-	}
-	if !valid {
+	if !validOpenVPNProtocol(profile.Protocol) {
 		return fmt.Errorf("invalid protocol: %s", profile.Protocol)
 	}
 
@@ -455,7 +590,7 @@ func (vm *VPNManager) validateCertificate(certPEM, certType string) error {
 
 	// Additional validation for client certificates
 	if certType == "client" {
-		if !cert.KeyUsage&x509.KeyUsageDigitalSignature != 0 {
+		if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
 			log.Printf("Warning: client certificate missing digital signature usage")
 		}
 	}
@@ -485,37 +620,44 @@ func (vm *VPNManager) validatePrivateKey(keyPEM string) error {
 }
 
 // generateProfileID generates a unique ID for a VPN profile
-func generateProfileID(filepath string) string {
-	filename := strings.TrimSuffix(filepath, ".ovpn")
+func generateProfileID(path string) string {
+	filename := profileSlug(strings.TrimSuffix(filepath.Base(path), ".ovpn"))
 	timestamp := time.Now().UnixNano()
 	return fmt.Sprintf("%s_%d", filename, timestamp)
 }
 
-// SaveProfile saves a VPN profile to disk
+// SaveProfile saves a VPN profile to disk, its key material encrypted and
+// the file readable only by us
 func (vm *VPNManager) SaveProfile(profile *VPNProfile) error {
-	os.MkdirAll(vm.profilesPath, 0755)
+	os.MkdirAll(vm.profilesPath, 0700)
 	
-	profileFile := filepath.Join(vm.profilesPath, profile.ID+".json")
-	file, err := os.Create(profileFile)
+	sealed, err := vm.sealProfile(profile)
 	if err != nil {
-		return fmt.Errorf("failed to create profile file: %v", err)
+		return err
 	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(profile); err != nil {
+	data, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
 		return fmt.Errorf("failed to encode profile: %v", err)
 	}
+	profileFile := filepath.Join(vm.profilesPath, profile.ID+".json")
+	if err := writePrivateFile(profileFile, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to create profile file: %v", err)
+	}
 
+	vm.profilesMutex.Lock()
 	vm.profiles[profile.ID] = profile
+	vm.profilesMutex.Unlock()
 	return nil
 }
 
 // LoadProfiles loads all VPN profiles from disk
 func (vm *VPNManager) LoadProfiles() error {
+	// Without the secret keys no profile can be read
+	if _, err := vm.secrets.status(); err != nil {
+		return err
+	}
 	if _, err := os.Stat(vm.profilesPath); os.IsNotExist(err) {
-		os.MkdirAll(vm.profilesPath, 0755)
+		os.MkdirAll(vm.profilesPath, 0700)
 		return nil
 	}
 
@@ -530,7 +672,26 @@ func (vm *VPNManager) LoadProfiles() error {
 			log.Printf("Warning: failed to load profile %s: %v", file, err)
 			continue
 		}
+		// Seal plaintext or old-key secrets with the current key
+		reseal, err := vm.openProfile(profile)
+		if err != nil {
+			log.Printf("Warning: failed to decrypt profile %s: %v", file, err)
+			continue
+		}
+		vm.profilesMutex.Lock()
 		vm.profiles[profile.ID] = profile
+		vm.profilesMutex.Unlock()
+		if reseal {
+			if err := vm.SaveProfile(profile); err != nil {
+				log.Printf("Warning: failed to reseal profile %s: %v", profile.ID, err)
+			} else if err := vm.resealProfileRevisions(profile.ID); err != nil {
+				log.Printf("Warning: failed to reseal revisions of profile %s: %v", profile.ID, err)
+			}
+		}
+		if err := vm.migrateCredentials(profile); err != nil {
+			log.Printf("Warning: failed to migrate credentials of profile %s: %v", profile.ID, err)
+		}
+		os.Chmod(file, 0600)
 	}
 
 	return nil
@@ -553,20 +714,30 @@ func (vm *VPNManager) loadProfileFromFile(filepath string) (*VPNProfile, error)
 	return &profile, nil
 }
 
-// GetProfiles returns all loaded VPN profiles
+// GetProfiles returns a snapshot of all loaded VPN profiles
 func (vm *VPNManager) GetProfiles() map[string]*VPNProfile {
-	return vm.profiles
+	vm.profilesMutex.RLock()
+	defer vm.profilesMutex.RUnlock()
+
+	profiles := make(map[string]*VPNProfile, len(vm.profiles))
+	for id, profile := range vm.profiles {
+		profiles[id] = profile
+	}
+	return profiles
 }
 
 // GetProfile returns a specific VPN profile by ID
 func (vm *VPNManager) GetProfile(id string) (*VPNProfile, bool) {
+	vm.profilesMutex.RLock()
+	defer vm.profilesMutex.RUnlock()
+
 	profile, exists := vm.profiles[id]
 	return profile, exists
 }
 
 // DeleteProfile removes a VPN profile
 func (vm *VPNManager) DeleteProfile(id string) error {
-	if _, exists := vm.profiles[id]; !exists {
+	if _, exists := vm.GetProfile(id); !exists {
 		return fmt.Errorf("profile not found: %s", id)
 	}
 
@@ -575,38 +746,43 @@ func (vm *VPNManager) DeleteProfile(id string) error {
 	if err := os.Remove(profileFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove profile file: %v", err)
 	}
+	os.Remove(vm.profileAuthPath(id))
+	os.Remove(vm.profileRevisionsPath(id))
 
 	// Remove from memory
+	vm.profilesMutex.Lock()
 	delete(vm.profiles, id)
+	vm.profilesMutex.Unlock()
 	return nil
 }
 
-// ImportProfile imports a .ovpn file and saves it as a profile
+// ImportProfile imports a .ovpn file and saves it as a profile. A file
+// already imported returns the existing profile.
 func (vm *VPNManager) ImportProfile(ovpnPath, profileName string) (*VPNProfile, error) {
-	profile, err := vm.ParseOVPNFile(ovpnPath)
+	content, err := os.ReadFile(ovpnPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse OVPN file: %v", err)
+		return nil, fmt.Errorf("failed to read OVPN file: %v", err)
 	}
 
-	if profileName != "" {
-		profile.Name = profileName
+	result, err := vm.ImportProfileContent(content, ProfileImportOptions{Filename: ovpnPath, Name: profileName})
+	if err != nil {
+		return nil, err
 	}
-
-	if err := vm.SaveProfile(profile); err != nil {
-		return nil, fmt.Errorf("failed to save profile: %v", err)
+	if result.Duplicate {
+		log.Printf("%s already imported as profile %s", ovpnPath, result.Profile.ID)
 	}
-
-	return profile, nil
+	return result.Profile, nil
 }
 
 // ExportProfile exports a profile to a .ovpn file
 func (vm *VPNManager) ExportProfile(profileID, outputPath string) error {
-	profile, exists := vm.profiles[profileID]
+	profile, exists := vm.GetProfile(profileID)
 	if !exists {
 		return fmt.Errorf("profile not found: %s", profileID)
 	}
 
-	file, err := os.Create(outputPath)
+	// The config holds the private key in the clear
+	file, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %v", err)
 	}
@@ -625,10 +801,23 @@ func (vm *VPNManager) writeOVPNFile(writer io.Writer, profile *VPNProfile) error
 	fmt.Fprintf(writer, "client\n")
 	fmt.Fprintf(writer, "dev %s\n", profile.Device)
 	fmt.Fprintf(writer, "proto %s\n", profile.Protocol)
+	if profile.Port != 0 && profile.Port != 1194 { // only if non-default
+		fmt.Fprintf(writer, "port %d\n", profile.Port)
+	}
 
 	// Remote servers
 	for _, remote := range profile.Remote {
-		fmt.Fprintf(writer, "remote %s %d\n", remote.Host, remote.Port)
+		if remote.Protocol != "" {
+			fmt.Fprintf(writer, "remote %s %d %s\n", remote.Host, remote.Port, remote.Protocol)
+		} else {
+			fmt.Fprintf(writer, "remote %s %d\n", remote.Host, remote.Port)
+		}
+	}
+	if profile.RemoteRandom {
+		fmt.Fprintf(writer, "remote-random\n")
+	}
+	if profile.ServerPollTimeout != 0 {
+		fmt.Fprintf(writer, "server-poll-timeout %d\n", profile.ServerPollTimeout)
 	}
 
 	// Optional configurations
@@ -642,7 +831,35 @@ func (vm *VPNManager) writeOVPNFile(writer io.Writer, profile *VPNProfile) error
 		fmt.Fprintf(writer, "tls-version-min %s\n", profile.TLSVersion)
 	}
 	if profile.RemoteCertEKU != "" {
-		fmt.Fprintf(writer, "remote-cert-eku \"%s\"\n", profile.RemoteCertEKU)
+		fmt.Fprintf(writer, "remote-cert-eku %s\n", quoteOVPNArg(profile.RemoteCertEKU))
+	}
+	if profile.DataCiphers != "" {
+		fmt.Fprintf(writer, "data-ciphers %s\n", profile.DataCiphers)
+	}
+	if profile.VerifyX509Name != "" {
+		if profile.VerifyX509Type != "" {
+			fmt.Fprintf(writer, "verify-x509-name %s %s\n", quoteOVPNArg(profile.VerifyX509Name), profile.VerifyX509Type)
+		} else {
+			fmt.Fprintf(writer, "verify-x509-name %s\n", quoteOVPNArg(profile.VerifyX509Name))
+		}
+	}
+	if profile.KeyDirection != "" {
+		fmt.Fprintf(writer, "key-direction %s\n", profile.KeyDirection)
+	}
+
+	// Routing
+	for _, route := range profile.Routes {
+		args := []string{route.Network}
+		for _, arg := range []string{route.Netmask, route.Gateway, route.Metric} {
+			if arg == "" {
+				break
+			}
+			args = append(args, arg)
+		}
+		fmt.Fprintf(writer, "route %s\n", strings.Join(args, " "))
+	}
+	if profile.RedirectGateway {
+		fmt.Fprintf(writer, "%s\n", strings.TrimSpace("redirect-gateway "+strings.Join(profile.RedirectGatewayFlags, " ")))
 	}
 
 	// Keepalive
@@ -683,7 +900,7 @@ func (vm *VPNManager) writeOVPNFile(writer io.Writer, profile *VPNProfile) error
 		if profile.AuthUserPass == "required" {
 			fmt.Fprintf(writer, "auth-user-pass\n")
 		} else {
-			fmt.Fprintf(writer, "auth-user-pass %s\n", profile.AuthUserPass)
+			fmt.Fprintf(writer, "auth-user-pass %s\n", quoteOVPNArg(profile.AuthUserPass))
 		}
 	}
 
@@ -696,24 +913,25 @@ func (vm *VPNManager) writeOVPNFile(writer io.Writer, profile *VPNProfile) error
 		}
 	}
 
-	// Custom directives
-	for directive, value := range profile.CustomDirectives {
-		if value == "" {
-			fmt.Fprintf(writer, "%s\n", directive)
-		} else {
-			fmt.Fprintf(writer, "%s %s\n", directive, value)
-		}
+	// Custom directives, in the order they were read
+	for _, directive := range profile.CustomDirectives {
+		fmt.Fprintf(writer, "%s\n", directive)
 	}
 
 	// Certificates
-	if profile.CA != "" {
-		fmt.Fprintf(writer, "<ca>\n%s</ca>\n", strings.TrimSpace(profile.CA))
-	}
-	if profile.Certificate != "" {
-		fmt.Fprintf(writer, "<cert>\n%s</cert>\n", strings.TrimSpace(profile.Certificate))
-	}
-	if profile.PrivateKey != "" {
-		fmt.Fprintf(writer, "<key>\n%s</key>\n", strings.TrimSpace(profile.PrivateKey))
+	for _, section := range []struct{ name, content string }{
+		{"ca", profile.CA},
+		{"cert", profile.Certificate},
+		{"key", profile.PrivateKey},
+		{"extra-certs", profile.ExtraCerts},
+		{"pkcs12", profile.PKCS12},
+		{"tls-auth", profile.TLSAuth},
+		{"tls-crypt", profile.TLSCrypt},
+		{"tls-crypt-v2", profile.TLSCryptV2},
+	} {
+		if section.content != "" {
+			fmt.Fprintf(writer, "<%s>\n%s\n</%s>\n", section.name, strings.TrimSpace(section.content), section.name)
+		}
 	}
 
 	return nil
@@ -732,29 +950,53 @@ func (vm *VPNManager) setupRoutes() *mux.Router {
 	api.HandleFunc("/profiles", vm.handleGetProfiles).Methods("GET")
 	api.HandleFunc("/profiles", vm.handleImportProfile).Methods("POST")
 	api.HandleFunc("/profiles/{id}", vm.handleGetProfile).Methods("GET")
+	api.HandleFunc("/profiles/{id}", vm.handleUpdateProfile).Methods("PATCH")
 	api.HandleFunc("/profiles/{id}", vm.handleDeleteProfile).Methods("DELETE")
+	api.HandleFunc("/profiles/{id}/revisions", vm.handleGetProfileRevisions).Methods("GET")
+	api.HandleFunc("/profiles/{id}/revisions/{revision}", vm.handleGetProfileRevision).Methods("GET")
+	api.HandleFunc("/profiles/{id}/diff", vm.handleDiffProfile).Methods("GET")
+	api.HandleFunc("/profiles/{id}/rollback", vm.handleRollbackProfile).Methods("POST")
 	api.HandleFunc("/profiles/{id}/export", vm.handleExportProfile).Methods("GET")
 	api.HandleFunc("/profiles/{id}/validate", vm.handleValidateProfile).Methods("POST")
+	api.HandleFunc("/profiles/{id}/config", vm.handleGetProfileConfig).Methods("GET")
+	api.HandleFunc("/profiles/{id}/config", vm.handleSetProfileConfig).Methods("PUT")
+	api.HandleFunc("/profiles/{id}/remotes", vm.handleGetProfileRemotes).Methods("GET")
+	api.HandleFunc("/profiles/{id}/credentials", vm.handleGetCredentials).Methods("GET")
+	api.HandleFunc("/profiles/{id}/credentials", vm.handleSetCredentials).Methods("PUT")
+	api.HandleFunc("/profiles/{id}/credentials", vm.handleClearCredentials).Methods("DELETE")
+	api.HandleFunc("/secrets", vm.handleGetSecretKeys).Methods("GET")
+	api.HandleFunc("/secrets/rotate", vm.handleRotateSecretKey).Methods("POST")
 	
 	// Connection management
 	api.HandleFunc("/connection/status", vm.handleConnectionStatus).Methods("GET")
 	api.HandleFunc("/connection/connect/{id}", vm.handleConnect).Methods("POST")
 	api.HandleFunc("/connection/connect-failover", vm.handleConnectWithFailover).Methods("POST")
 	api.HandleFunc("/connection/disconnect", vm.handleDisconnect).Methods("POST")
+	api.HandleFunc("/connection/auth", vm.handleConnectionAuth).Methods("POST")
 	api.HandleFunc("/connection/history", vm.handleConnectionHistory).Methods("GET")
 	api.HandleFunc("/failover/enable", vm.handleEnableFailover).Methods("POST")
 	api.HandleFunc("/failover/disable", vm.handleDisableFailover).Methods("POST")
 	api.HandleFunc("/failover/status", vm.handleFailoverStatus).Methods("GET")
 	api.HandleFunc("/failover/trigger", vm.handleTriggerFailover).Methods("POST")
 	api.HandleFunc("/failover/reset-attempts", vm.handleResetFailoverAttempts).Methods("POST")
+	api.HandleFunc("/failover/policy", vm.handleGetFailoverPolicy).Methods("GET")
+	api.HandleFunc("/failover/failback", vm.handleSetFailbackPolicy).Methods("PUT")
 	
 	// Health and diagnostics
 	api.HandleFunc("/health", vm.handleHealth).Methods("GET")
 	api.HandleFunc("/health/current", vm.handleCurrentHealth).Methods("GET")
 	api.HandleFunc("/health/summary", vm.handleHealthSummary).Methods("GET")
 	api.HandleFunc("/health/history", vm.handleHealthHistory).Methods("GET")
+	api.HandleFunc("/v2/health/history", vm.handleHealthHistoryV2).Methods("GET")
+	api.HandleFunc("/health/alerts", vm.handleHealthAlerts).Methods("GET")
+	api.HandleFunc("/health/alerts/notifiers", vm.handleGetAlertNotifiers).Methods("GET")
+	api.HandleFunc("/health/alerts/notifiers", vm.handleSetAlertNotifiers).Methods("PUT")
+	api.HandleFunc("/health/alerts/notifiers/test", vm.handleTestAlertNotifiers).Methods("POST")
+	api.HandleFunc("/health/alerts/{id}/acknowledge", vm.handleAcknowledgeAlert).Methods("POST")
 	api.HandleFunc("/health/thresholds", vm.handleGetHealthThresholds).Methods("GET")
 	api.HandleFunc("/health/thresholds", vm.handleSetHealthThresholds).Methods("PUT")
+	api.HandleFunc("/health/probes", vm.handleGetProbeConfig).Methods("GET")
+	api.HandleFunc("/health/probes", vm.handleSetProbeConfig).Methods("PUT")
 	api.HandleFunc("/health/monitoring/start", vm.handleStartHealthMonitoring).Methods("POST")
 	api.HandleFunc("/health/monitoring/stop", vm.handleStopHealthMonitoring).Methods("POST")
 	api.HandleFunc("/diagnostics/ping/{host}", vm.handlePing).Methods("POST")
@@ -764,38 +1006,75 @@ func (vm *VPNManager) setupRoutes() *mux.Router {
 	api.HandleFunc("/diagnostics/results", vm.handleDiagnosticsResults).Methods("GET")
 	api.HandleFunc("/diagnostics/results/{key}", vm.handleDiagnosticsResult).Methods("GET")
 	
+	// Prometheus scrape endpoint
+	router.HandleFunc("/metrics", vm.handleMetrics).Methods("GET")
+	
 	return router
 }
 
-// handleGetProfiles returns all VPN profiles
+// handleGetProfiles returns all VPN profiles, secrets redacted
 func (vm *VPNManager) handleGetProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := vm.GetProfiles()
+	for id, profile := range profiles {
+		profiles[id] = publicProfile(profile)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(vm.profiles)
+	json.NewEncoder(w).Encode(profiles)
 }
 
-// handleGetProfile returns a specific VPN profile
+// handleGetProfile returns a specific VPN profile, secrets redacted
 func (vm *VPNManager) handleGetProfile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 	
-	profile, exists := vm.profiles[id]
+	profile, exists := vm.GetProfile(id)
 	if !exists {
 		http.Error(w, "Profile not found", http.StatusNotFound)
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(profile)
+	json.NewEncoder(w).Encode(publicProfile(profile))
 }
 
-// handleImportProfile handles profile import from .ovpn file
+// handleImportProfile imports a .ovpn sent as a multipart upload, a JSON
+// document or the raw request body
 func (vm *VPNManager) handleImportProfile(w http.ResponseWriter, r *http.Request) {
-	// This will be implemented to handle file upload
-	// For now, return a placeholder
+	content, opts, err := readProfileImportRequest(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts.Privileged = privilegedRequest(r)
+
+	result, err := vm.ImportProfileContent(content, opts)
+	var directiveErr *ProfileDirectiveError
+	var duplicateErr *ProfileDuplicateError
+	switch {
+	case errors.As(err, &directiveErr):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.As(err, &duplicateErr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      err.Error(),
+			"profile_id": duplicateErr.ProfileID,
+			"fields":     duplicateErr.Fields,
+		})
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result.Profile = publicProfile(result.Profile)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Profile import endpoint - implementation pending file upload handling",
-	})
+	if !result.Duplicate {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(result)
 }
 
 // handleDeleteProfile deletes a VPN profile
@@ -814,13 +1093,388 @@ func (vm *VPNManager) handleDeleteProfile(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// Placeholder handlers for features to be implemented
+// handleUpdateProfile applies a partial edit to a profile as a new revision
+func (vm *VPNManager) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	patch, err := io.ReadAll(io.LimitReader(r.Body, maxProfileUploadSize))
+	if err != nil {
+		http.Error(w, "Failed to read request", http.StatusBadRequest)
+		return
+	}
+
+	result, err := vm.UpdateProfile(id, patch, privilegedRequest(r))
+	writeProfileUpdate(w, result, err)
+}
+
+// handleRollbackProfile restores a previous revision of a profile
+func (vm *VPNManager) handleRollbackProfile(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req struct {
+		Revision int `json:"revision"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Revision <= 0 {
+		http.Error(w, "Request must name a revision", http.StatusBadRequest)
+		return
+	}
+
+	result, err := vm.RollbackProfile(id, req.Revision, privilegedRequest(r))
+	writeProfileUpdate(w, result, err)
+}
+
+// writeProfileUpdate reports an edit or rollback, with the validation
+// report when validation rejected it
+func writeProfileUpdate(w http.ResponseWriter, result *ProfileUpdateResult, err error) {
+	var validationErr *ProfileUpdateError
+	var directiveErr *ProfileDirectiveError
+	switch {
+	case err == errProfileNotFound:
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	case errors.As(err, &directiveErr):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.As(err, &validationErr):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":      err.Error(),
+			"validation": validationErr.Report,
+		})
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result.Profile = publicProfile(result.Profile)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleGetProfileRevisions lists a profile's revisions without their contents
+func (vm *VPNManager) handleGetProfileRevisions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	profile, exists := vm.GetProfile(id)
+	if !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	revisions, err := vm.GetProfileRevisions(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]map[string]interface{}, 0, len(revisions))
+	for _, rev := range revisions {
+		summaries = append(summaries, map[string]interface{}{
+			"revision":   rev.Revision,
+			"created_at": rev.CreatedAt,
+			"reason":     rev.Reason,
+			"changes":    rev.Changes,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profile_id": id,
+		"current":    profile.Revision,
+		"revisions":  summaries,
+	})
+}
+
+// handleGetProfileRevision returns one revision of a profile, secrets redacted
+func (vm *VPNManager) handleGetProfileRevision(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	revision, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		http.Error(w, "Invalid revision", http.StatusBadRequest)
+		return
+	}
+	rev, err := vm.GetProfileRevision(vars["id"], revision)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	rev.Profile = *publicProfile(&rev.Profile)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rev)
+}
+
+// handleDiffProfile compares two revisions of a profile. ?from defaults to
+// the previous revision and ?to to the current one.
+func (vm *VPNManager) handleDiffProfile(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	profile, exists := vm.GetProfile(id)
+	if !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	to := profile.Revision
+	if v := query.Get("to"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid to revision", http.StatusBadRequest)
+			return
+		}
+		to = n
+	}
+	from := to - 1
+	if v := query.Get("from"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid from revision", http.StatusBadRequest)
+			return
+		}
+		from = n
+	}
+
+	fromRev, err := vm.GetProfileRevision(id, from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	toRev, err := vm.GetProfileRevision(id, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	changes := diffProfiles(&fromRev.Profile, &toRev.Profile)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profile_id":         id,
+		"from":               from,
+		"to":                 to,
+		"changes":            changes,
+		"affects_connection": affectsConnection(changes),
+	})
+}
+
+// handleExportProfile streams a profile as a .ovpn file without its private
+// keys and credentials. ?redact=false is a privileged export of everything,
+// which needs the NOC_RAVEN_API_KEY.
 func (vm *VPNManager) handleExportProfile(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Export functionality - implementation pending", http.StatusNotImplemented)
+	id := mux.Vars(r)["id"]
+	profile, exists := vm.GetProfile(id)
+	if !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	redact := true
+	if value := r.URL.Query().Get("redact"); value != "" {
+		var err error
+		if redact, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Invalid redact parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if !redact && !privilegedRequest(r) {
+		http.Error(w, "Exporting secrets requires the API key", http.StatusForbidden)
+		return
+	}
+	if !redact {
+		log.Printf("Privileged export of profile %s from %s", id, r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/x-openvpn-profile")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", profileExportFilename(profile)))
+	if redact {
+		var removed []string
+		profile, removed = redactedProfile(profile)
+		if len(removed) > 0 {
+			fmt.Fprintf(w, "# Redacted: %s\n", strings.Join(removed, ", "))
+		}
+	}
+	if err := vm.writeOVPNFile(w, profile); err != nil {
+		log.Printf("Warning: failed to export profile %s: %v", id, err)
+	}
 }
 
+// handleGetCredentials reports whether credentials are stored for a profile
+func (vm *VPNManager) handleGetCredentials(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Reading credentials requires the API key", http.StatusForbidden)
+		return
+	}
+
+	status, err := vm.GetCredentialStatus(mux.Vars(r)["id"])
+	if err == errProfileNotFound {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleSetCredentials stores the username, password and optional TOTP
+// secret a profile connects with
+func (vm *VPNManager) handleSetCredentials(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Storing credentials requires the API key", http.StatusForbidden)
+		return
+	}
+
+	var creds VPNCredentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	status, err := vm.SetCredentials(mux.Vars(r)["id"], creds)
+	if err == errProfileNotFound {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleClearCredentials removes a profile's stored credentials
+func (vm *VPNManager) handleClearCredentials(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Clearing credentials requires the API key", http.StatusForbidden)
+		return
+	}
+
+	err := vm.ClearCredentials(mux.Vars(r)["id"])
+	if err == errProfileNotFound {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Credentials cleared",
+	})
+}
+
+// handleGetSecretKeys describes the keys sealing profile secrets
+func (vm *VPNManager) handleGetSecretKeys(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Reading secret keys requires the API key", http.StatusForbidden)
+		return
+	}
+
+	status, err := vm.secrets.status()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleRotateSecretKey seals every profile with a new key
+func (vm *VPNManager) handleRotateSecretKey(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Rotating secret keys requires the API key", http.StatusForbidden)
+		return
+	}
+
+	status, err := vm.RotateSecretKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleValidateProfile re-runs validation and returns the findings
 func (vm *VPNManager) handleValidateProfile(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "Validation endpoint - implementation pending", http.StatusNotImplemented)
+	id := mux.Vars(r)["id"]
+	if _, exists := vm.GetProfile(id); !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := vm.ValidateProfileReport(id)
+	if err != nil {
+		log.Printf("Warning: failed to save validation result: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleGetProfileConfig returns the connection and reconnect policy of a profile
+func (vm *VPNManager) handleGetProfileConfig(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, exists := vm.GetProfile(id); !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vm.connectionManager.GetProfileConfig(id))
+}
+
+// handleSetProfileConfig updates the connection and reconnect policy of a profile
+func (vm *VPNManager) handleSetProfileConfig(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, exists := vm.GetProfile(id); !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	// Fields left out of the request keep their current values
+	config := vm.connectionManager.GetProfileConfig(id)
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid profile configuration", http.StatusBadRequest)
+		return
+	}
+	config.ProfileID = id
+
+	if err := vm.connectionManager.SetProfileConfig(config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Profile configuration updated successfully",
+	})
+}
+
+// handleGetProfileRemotes returns the remote selection settings of a profile
+// and the connection attempts made against each remote
+func (vm *VPNManager) handleGetProfileRemotes(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	profile, exists := vm.GetProfile(id)
+	if !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	selection := vm.connectionManager.GetProfileConfig(id).RemoteSelection
+	if selection == "" {
+		selection = remoteSelectionOrdered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"profile_id":          id,
+		"remotes":             profile.Remote,
+		"remote_random":       profile.RemoteRandom,
+		"server_poll_timeout": profile.ServerPollTimeout,
+		"selection":           selection,
+		"stats":               vm.connectionManager.GetRemoteStats(id),
+	})
 }
 
 func (vm *VPNManager) handleConnectionStatus(w http.ResponseWriter, r *http.Request) {
@@ -857,6 +1511,25 @@ func (vm *VPNManager) handleDisconnect(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleConnectionAuth answers a credential or challenge prompt from OpenVPN
+func (vm *VPNManager) handleConnectionAuth(w http.ResponseWriter, r *http.Request) {
+	var answer VPNAuthAnswer
+	if err := json.NewDecoder(r.Body).Decode(&answer); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := vm.connectionManager.SubmitAuth(answer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Credentials submitted",
+	})
+}
+
 // handleConnectionHistory returns the VPN connection history
 func (vm *VPNManager) handleConnectionHistory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -882,6 +1555,7 @@ func (vm *VPNManager) handleEnableFailover(w http.ResponseWriter, r *http.Reques
 	var request struct {
 		ProfileIDs []string              `json:"profile_ids"`
 		Thresholds *FailoverThresholds   `json:"thresholds,omitempty"`
+		Failback   *FailbackPolicy       `json:"failback,omitempty"`
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -894,7 +1568,7 @@ func (vm *VPNManager) handleEnableFailover(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	
-	if err := vm.connectionManager.EnableFailover(request.ProfileIDs, request.Thresholds); err != nil {
+	if err := vm.connectionManager.EnableFailover(request.ProfileIDs, request.Thresholds, request.Failback); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -925,12 +1599,9 @@ func (vm *VPNManager) handleFailoverStatus(w http.ResponseWriter, r *http.Reques
 
 // handleTriggerFailover manually triggers a failover
 func (vm *VPNManager) handleTriggerFailover(w http.ResponseWriter, r *http.Request) {
-	// This will be done in a goroutine since performFailover expects the mutex
+	// Failover can take a while, so it runs in the background
 	go func() {
-		vm.connectionManager.mutex.Lock()
-		defer vm.connectionManager.mutex.Unlock()
-		
-		if err := vm.connectionManager.performFailover(); err != nil {
+		if err := vm.connectionManager.triggerFailover("", "manual"); err != nil {
 			log.Printf("Manual failover failed: %v", err)
 		}
 	}()
@@ -941,6 +1612,31 @@ func (vm *VPNManager) handleTriggerFailover(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+// handleGetFailoverPolicy returns the persisted failover and failback policy
+func (vm *VPNManager) handleGetFailoverPolicy(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vm.connectionManager.GetFailoverPolicy())
+}
+
+// handleSetFailbackPolicy updates the failback settings
+func (vm *VPNManager) handleSetFailbackPolicy(w http.ResponseWriter, r *http.Request) {
+	policy := vm.connectionManager.GetFailoverPolicy().Failback
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid failback policy", http.StatusBadRequest)
+		return
+	}
+
+	if err := vm.connectionManager.SetFailbackPolicy(policy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Failback policy updated successfully",
+	})
+}
+
 // handleResetFailoverAttempts resets the failed connection attempt counters
 func (vm *VPNManager) handleResetFailoverAttempts(w http.ResponseWriter, r *http.Request) {
 	vm.connectionManager.ResetConnectionAttempts()
@@ -957,7 +1653,7 @@ func (vm *VPNManager) handleHealth(w http.ResponseWriter, r *http.Request) {
 	health := map[string]interface{}{
 		"vpn_manager": "running",
 		"connection_status": vm.connectionManager.GetConnectionStatus(),
-		"profiles_loaded": len(vm.profiles),
+		"profiles_loaded": len(vm.GetProfiles()),
 		"diagnostics_ready": vm.diagnostics != nil,
 		"health_monitoring": vm.healthMonitor != nil,
 		"timestamp": time.Now(),
@@ -987,22 +1683,207 @@ func (vm *VPNManager) handleHealthSummary(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(summary)
 }
 
-// handleHealthHistory returns health history for a specified time period
+// handleHealthHistory returns raw health snapshots for a time period as a
+// plain array, the shape clients of this endpoint have always received.
+// Rollups are served by handleHealthHistoryV2.
 func (vm *VPNManager) handleHealthHistory(w http.ResponseWriter, r *http.Request) {
+	q, err := parseHealthHistoryQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Raw snapshots are all this endpoint returns; older ones are not kept.
+	// The margin keeps the range inside raw retention when the store checks it.
+	q.Resolution = healthResolutionRaw
+	if oldest := time.Now().Add(-healthRawRetention + time.Minute); q.From.Before(oldest) {
+		q.From = oldest
+	}
+
+	history, err := vm.healthMonitor.GetHealthHistory(q)
+	if err != nil {
+		vm.writeHealthHistoryError(w, err)
+		return
+	}
+	snapshots := history.Snapshots
+	if snapshots == nil {
+		snapshots = []*VPNHealthSnapshot{}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	
-	// Get minutes parameter from query
-	minutesStr := r.URL.Query().Get("minutes")
-	minutes := 60 // Default to 1 hour
-	
-	if minutesStr != "" {
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// handleHealthHistoryV2 returns health history for any range, as raw
+// snapshots or 5m/1h rollups chosen by ?resolution
+func (vm *VPNManager) handleHealthHistoryV2(w http.ResponseWriter, r *http.Request) {
+	q, err := parseHealthHistoryQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, err := vm.healthMonitor.GetHealthHistory(q)
+	if err != nil {
+		vm.writeHealthHistoryError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// parseHealthHistoryQuery reads from, to, resolution and the older minutes
+// parameter; the range defaults to the last hour
+func parseHealthHistoryQuery(r *http.Request) (HealthHistoryQuery, error) {
+	params := r.URL.Query()
+	now := time.Now()
+	q := HealthHistoryQuery{
+		From:       now.Add(-time.Hour),
+		To:         now,
+		Resolution: params.Get("resolution"),
+	}
+
+	// minutes is kept for older clients; from/to take precedence
+	if minutesStr := params.Get("minutes"); minutesStr != "" {
 		if m, err := strconv.Atoi(minutesStr); err == nil && m > 0 {
-			minutes = m
+			q.From = now.Add(-time.Duration(m) * time.Minute)
 		}
 	}
-	
-	history := vm.healthMonitor.GetHealthHistory(minutes)
-	json.NewEncoder(w).Encode(history)
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := parseHistoryTime(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		*t = parsed
+	}
+	return q, nil
+}
+
+// writeHealthHistoryError maps a history query failure to its status: 400
+// for a query that cannot be answered as asked, 503 without a store and 500
+// when the store fails
+func (vm *VPNManager) writeHealthHistoryError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if _, ok := err.(healthQueryError); ok {
+		status = http.StatusBadRequest
+	} else if vm.healthMonitor.store == nil {
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// parseHistoryTime accepts RFC3339 timestamps or unix seconds
+func parseHistoryTime(v string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// handleHealthAlerts lists health alerts, filtered by status
+func (vm *VPNManager) handleHealthAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := vm.healthMonitor.alerts.List(r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// handleAcknowledgeAlert acknowledges a health alert
+func (vm *VPNManager) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	alertID := vars["id"]
+
+	// The body is optional
+	var request struct {
+		AcknowledgedBy string `json:"acknowledged_by"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid acknowledge request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	alert, err := vm.healthMonitor.alerts.Acknowledge(alertID, request.AcknowledgedBy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alert)
+}
+
+// handleGetAlertNotifiers returns alert notification targets
+func (vm *VPNManager) handleGetAlertNotifiers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vm.healthMonitor.alerts.GetNotifierConfig())
+}
+
+// handleSetAlertNotifiers replaces alert notification targets
+func (vm *VPNManager) handleSetAlertNotifiers(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Changing alert notifiers requires the API key", http.StatusForbidden)
+		return
+	}
+
+	var config VPNAlertNotifierConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid notifier configuration", http.StatusBadRequest)
+		return
+	}
+
+	if err := vm.healthMonitor.alerts.SetNotifierConfig(config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Alert notifiers updated successfully",
+	})
+}
+
+// handleTestAlertNotifiers sends a test notification to every target
+func (vm *VPNManager) handleTestAlertNotifiers(w http.ResponseWriter, r *http.Request) {
+	if !privilegedRequest(r) {
+		http.Error(w, "Testing alert notifiers requires the API key", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vm.healthMonitor.alerts.TestNotifiers())
+}
+
+// handleGetProbeConfig returns the health probe settings and targets
+func (vm *VPNManager) handleGetProbeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vm.healthMonitor.GetProbeConfig())
+}
+
+// handleSetProbeConfig replaces the health probe settings and targets
+func (vm *VPNManager) handleSetProbeConfig(w http.ResponseWriter, r *http.Request) {
+	config := defaultProbeConfig()
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid probe configuration", http.StatusBadRequest)
+		return
+	}
+
+	if err := vm.healthMonitor.SetProbeConfig(config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Health probes updated successfully",
+	})
 }
 
 // handleGetHealthThresholds returns current health alert thresholds
@@ -1213,7 +2094,7 @@ func main() {
 		log.Fatalf("Failed to load VPN profiles: %v", err)
 	}
 	
-	log.Printf("Loaded %d VPN profiles", len(vm.profiles))
+	log.Printf("Loaded %d VPN profiles", len(vm.GetProfiles()))
 	
 	// Test with existing DRT.ovpn file
 	if _, err := os.Stat("/config/vpn/DRT.ovpn"); err == nil {
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestVPNManager(t *testing.T) *VPNManager {
+	t.Helper()
+	dir := t.TempDir()
+	return NewVPNManager(dir+"/profiles", dir+"/state")
+}
+
+// testCertificate returns a self-signed PEM certificate valid until notAfter
+func testCertificate(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "noc-raven-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// Monitors read profiles from their own goroutines while the API writes
+// them; go test -race fails here if the map is not guarded
+func TestVPNManager_ProfilesConcurrentAccess(t *testing.T) {
+	vm := newTestVPNManager(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				id := fmt.Sprintf("p%d_%d", i, j)
+				if err := vm.SaveProfile(&VPNProfile{ID: id, Name: id}); err != nil {
+					t.Errorf("SaveProfile: %v", err)
+					return
+				}
+				if j%2 == 0 {
+					vm.DeleteProfile(id)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				vm.GetProfile("p0_1")
+				for range vm.GetProfiles() {
+				}
+				vm.findProfileByHash("none")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := len(vm.GetProfiles()); n != 40 {
+		t.Errorf("profiles = %d, want 40", n)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
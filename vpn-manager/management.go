@@ -0,0 +1,653 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// managementCommandTimeout bounds a command round trip so a wedged
+	// OpenVPN cannot hold the connection manager lock
+	managementCommandTimeout = 5 * time.Second
+
+	// managementDialTimeout is how long OpenVPN gets to open its socket after start
+	managementDialTimeout = 10 * time.Second
+
+	// shutdownTimeout is how long OpenVPN gets to exit after SIGTERM
+	shutdownTimeout = 10 * time.Second
+
+	// bytecountInterval is the real-time byte count period in seconds
+	bytecountInterval = 5
+)
+
+// managementEvent is a real-time notification from the management interface,
+// e.g. ">STATE:..." becomes {Kind: "STATE", Payload: "..."}
+type managementEvent struct {
+	Kind    string
+	Payload string
+}
+
+// managementClient speaks the OpenVPN management protocol over a unix socket.
+// Command responses and real-time notifications share the socket; a reader
+// goroutine routes notifications to Events and responses to the waiting command.
+type managementClient struct {
+	conn      net.Conn
+	cmdMutex  sync.Mutex // one command in flight at a time
+	responses chan string
+	Events    chan managementEvent
+	closed    chan struct{}
+}
+
+// dialManagement connects to a management socket, retrying until timeout
+// while OpenVPN starts up
+func dialManagement(path string, timeout time.Duration) (*managementClient, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			return newManagementClient(conn), nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to connect to management interface: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func newManagementClient(conn net.Conn) *managementClient {
+	mc := &managementClient{
+		conn:      conn,
+		responses: make(chan string, 64),
+		Events:    make(chan managementEvent, 256),
+		closed:    make(chan struct{}),
+	}
+	go mc.readLoop()
+	return mc
+}
+
+func (mc *managementClient) readLoop() {
+	defer close(mc.closed)
+	defer close(mc.Events)
+
+	scanner := bufio.NewScanner(mc.conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, ">") {
+			kind, payload, _ := strings.Cut(line[1:], ":")
+			// Never block the reader on a slow consumer, or command
+			// responses behind the notification would stall too
+			select {
+			case mc.Events <- managementEvent{Kind: kind, Payload: payload}:
+			default:
+				log.Printf("Warning: dropping management notification %s: consumer too slow", kind)
+			}
+			continue
+		}
+		select {
+		case mc.responses <- line:
+		default:
+			log.Printf("Warning: dropping unexpected management output: %s", line)
+		}
+	}
+}
+
+// Closed is closed once the management connection ends
+func (mc *managementClient) Closed() <-chan struct{} {
+	return mc.closed
+}
+
+// Close closes the management connection
+func (mc *managementClient) Close() error {
+	return mc.conn.Close()
+}
+
+// Command sends a single-line command and waits for its SUCCESS or ERROR reply
+func (mc *managementClient) Command(cmd string) (string, error) {
+	lines, err := mc.command(cmd, false)
+	if err != nil {
+		return "", err
+	}
+	return lines[0], nil
+}
+
+// CommandMulti sends a command whose reply is a block of lines terminated by END
+func (mc *managementClient) CommandMulti(cmd string) ([]string, error) {
+	return mc.command(cmd, true)
+}
+
+func (mc *managementClient) command(cmd string, multi bool) ([]string, error) {
+	mc.cmdMutex.Lock()
+	defer mc.cmdMutex.Unlock()
+
+	// Discard stray output left by an earlier timed out command
+	for len(mc.responses) > 0 {
+		<-mc.responses
+	}
+
+	mc.conn.SetWriteDeadline(time.Now().Add(managementCommandTimeout))
+	if _, err := mc.conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, fmt.Errorf("management command %q: %v", commandName(cmd), err)
+	}
+
+	timeout := time.After(managementCommandTimeout)
+	lines := make([]string, 0)
+	for {
+		select {
+		case line := <-mc.responses:
+			if strings.HasPrefix(line, "ERROR:") {
+				return nil, fmt.Errorf("management command %q: %s", commandName(cmd), strings.TrimSpace(strings.TrimPrefix(line, "ERROR:")))
+			}
+			if !multi {
+				if strings.HasPrefix(line, "SUCCESS:") {
+					return []string{strings.TrimSpace(strings.TrimPrefix(line, "SUCCESS:"))}, nil
+				}
+				continue
+			}
+			if line == "END" {
+				return lines, nil
+			}
+			lines = append(lines, line)
+		case <-mc.closed:
+			return nil, fmt.Errorf("management command %q: connection closed", commandName(cmd))
+		case <-timeout:
+			return nil, fmt.Errorf("management command %q: timed out", commandName(cmd))
+		}
+	}
+}
+
+// commandName returns the command verb, keeping credentials out of errors and logs
+func commandName(cmd string) string {
+	name, _, _ := strings.Cut(cmd, " ")
+	return name
+}
+
+// managementQuote quotes a command argument per the management protocol
+func managementQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// openVPNState is a parsed >STATE notification or state history line:
+// time,name,description,local_ip,remote_ip,remote_port,local_addr,local_port,local_ipv6
+type openVPNState struct {
+	Time        time.Time
+	Name        string
+	Description string
+	LocalIP     string
+	RemoteIP    string
+	RemotePort  int
+}
+
+func parseOpenVPNState(payload string) (openVPNState, error) {
+	fields := strings.Split(payload, ",")
+	if len(fields) < 2 {
+		return openVPNState{}, fmt.Errorf("malformed state %q", payload)
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return openVPNState{}, fmt.Errorf("malformed state time %q", fields[0])
+	}
+	state := openVPNState{Time: time.Unix(secs, 0), Name: fields[1]}
+	if len(fields) > 2 {
+		state.Description = fields[2]
+	}
+	if len(fields) > 3 {
+		state.LocalIP = fields[3]
+	}
+	if len(fields) > 4 {
+		state.RemoteIP = fields[4]
+	}
+	if len(fields) > 5 {
+		state.RemotePort, _ = strconv.Atoi(fields[5])
+	}
+	return state, nil
+}
+
+// parseByteCount parses a >BYTECOUNT payload: bytes_in,bytes_out
+func parseByteCount(payload string) (in, out int64, err error) {
+	inStr, outStr, ok := strings.Cut(payload, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed bytecount %q", payload)
+	}
+	if in, err = strconv.ParseInt(inStr, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	if out, err = strconv.ParseInt(outStr, 10, 64); err != nil {
+		return 0, 0, err
+	}
+	return in, out, nil
+}
+
+// VPNAuthPrompt is a credential request from OpenVPN waiting for an answer
+type VPNAuthPrompt struct {
+	Type          string    `json:"type"` // "Auth" or "Private Key"
+	NeedsUsername bool      `json:"needs_username"`
+	Challenge     string    `json:"challenge,omitempty"` // text to show the user
+	Echo          bool      `json:"echo"`                // challenge response may be shown while typed
+	Dynamic       bool      `json:"dynamic"`             // server-issued (CRV1) rather than static challenge
+	RequestedAt   time.Time `json:"requested_at"`
+}
+
+// VPNAuthAnswer answers an auth prompt, or supplies credentials ahead of one
+type VPNAuthAnswer struct {
+	Username          string `json:"username,omitempty"`
+	Password          string `json:"password,omitempty"`
+	ChallengeResponse string `json:"challenge_response,omitempty"`
+}
+
+// dynamicChallenge is a CRV1 challenge issued by the server after a failed auth
+type dynamicChallenge struct {
+	StateID  string
+	Username string
+	Text     string
+	Echo     bool
+}
+
+var (
+	passwordNeedRegexp = regexp.MustCompile(`^Need '([^']+)' (username/password|password)(?: SC:(\d),(.*))?$`)
+	crv1Regexp         = regexp.MustCompile(`CRV1:([^:]*):([^:]*):([^:]*):(.*?)'?\]?$`)
+)
+
+// parsePasswordPrompt parses the payload of a >PASSWORD:Need notification
+func parsePasswordPrompt(payload string) (*VPNAuthPrompt, bool) {
+	m := passwordNeedRegexp.FindStringSubmatch(payload)
+	if m == nil {
+		return nil, false
+	}
+	prompt := &VPNAuthPrompt{
+		Type:          m[1],
+		NeedsUsername: m[2] == "username/password",
+		RequestedAt:   time.Now(),
+	}
+	if m[3] != "" {
+		prompt.Echo = m[3] == "1"
+		prompt.Challenge = m[4]
+	}
+	return prompt, true
+}
+
+// parseDynamicChallenge extracts a CRV1 challenge from a >PASSWORD:Verification Failed payload
+func parseDynamicChallenge(payload string) (*dynamicChallenge, bool) {
+	m := crv1Regexp.FindStringSubmatch(payload)
+	if m == nil {
+		return nil, false
+	}
+	username, err := base64.StdEncoding.DecodeString(m[3])
+	if err != nil {
+		return nil, false
+	}
+	return &dynamicChallenge{
+		StateID:  m[2],
+		Username: string(username),
+		Text:     m[4],
+		Echo:     strings.Contains(m[1], "E"),
+	}, true
+}
+
+// managementSocketPath returns a short per-profile socket path; profile IDs
+// can be long and contain path separators, and unix socket paths are limited
+func (cm *VPNConnectionManager) managementSocketPath(profileID string) string {
+	sum := sha1.Sum([]byte(profileID))
+	return filepath.Join(cm.statePath, "mgmt_"+hex.EncodeToString(sum[:6])+".sock")
+}
+
+// attachManagement connects to the management interface of a started or
+// restored OpenVPN, subscribes to state and byte counts and releases the hold
+func (cm *VPNConnectionManager) attachManagement(conn *VPNConnection, timeout time.Duration, releaseHold bool) error {
+	mc, err := dialManagement(conn.ManagementSocket, timeout)
+	if err != nil {
+		return err
+	}
+
+	if _, err := mc.Command("state on"); err != nil {
+		mc.Close()
+		return err
+	}
+	if _, err := mc.Command(fmt.Sprintf("bytecount %d", bytecountInterval)); err != nil {
+		mc.Close()
+		return err
+	}
+	// Catch up on the state reached before we subscribed
+	if lines, err := mc.CommandMulti("state"); err == nil && len(lines) > 0 {
+		if state, err := parseOpenVPNState(lines[len(lines)-1]); err == nil {
+			cm.applyOpenVPNState(conn, state)
+		}
+	}
+
+	conn.mgmt = mc
+	go cm.handleManagementEvents(conn, mc)
+
+	if releaseHold {
+		if _, err := mc.Command("hold release"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleManagementEvents applies real-time notifications to the connection
+func (cm *VPNConnectionManager) handleManagementEvents(conn *VPNConnection, mc *managementClient) {
+	for event := range mc.Events {
+		cm.mutex.Lock()
+		if cm.activeConn != conn {
+			cm.mutex.Unlock()
+			continue
+		}
+		switch event.Kind {
+		case "STATE":
+			if state, err := parseOpenVPNState(event.Payload); err == nil {
+				cm.applyOpenVPNState(conn, state)
+			}
+		case "BYTECOUNT":
+			if in, out, err := parseByteCount(event.Payload); err == nil {
+				conn.BytesIn, conn.BytesOut = in, out
+			}
+		case "PASSWORD":
+			cm.handlePasswordEvent(conn, event.Payload)
+		case "REMOTE":
+			cm.handleRemoteEvent(conn, event.Payload)
+		case "FATAL":
+			conn.LastError = event.Payload
+			log.Printf("OpenVPN fatal error for profile %s: %s", conn.Profile.Name, event.Payload)
+		case "HOLD":
+			// A hold after startup means OpenVPN restarted and waits for us again
+			go mc.Command("hold release")
+		}
+		cm.saveConnectionState()
+		cm.mutex.Unlock()
+	}
+
+	// OpenVPN closed the interface; fall back to process and interface checks
+	cm.mutex.Lock()
+	if conn.mgmt == mc {
+		conn.mgmt = nil
+	}
+	cm.mutex.Unlock()
+}
+
+// applyOpenVPNState maps an OpenVPN state onto the connection (requires lock)
+func (cm *VPNConnectionManager) applyOpenVPNState(conn *VPNConnection, state openVPNState) {
+	previous := conn.OpenVPNState
+	conn.OpenVPNState = state.Name
+	conn.StateDescription = state.Description
+	conn.StateChangedAt = state.Time
+	conn.LastSeen = time.Now()
+	if state.LocalIP != "" {
+		conn.LocalIP = state.LocalIP
+	}
+	if state.RemoteIP != "" {
+		conn.RemoteIP = state.RemoteIP
+	}
+	if previous != state.Name {
+		log.Printf("OpenVPN state for profile %s: %s %s", conn.Profile.Name, state.Name, state.Description)
+	}
+
+	switch state.Name {
+	case "CONNECTED":
+		conn.PendingAuth = nil
+		cm.recordRemoteConnected(conn, state)
+		if conn.State == "connecting" {
+			cm.markConnected(conn)
+		}
+	case "RECONNECTING":
+		if conn.State == "connected" {
+			conn.State = "connecting"
+			conn.Reconnects++
+			cm.reconnectPending[conn.Profile.ID] = true
+		}
+	}
+}
+
+// markConnected records that a tunnel came up (requires lock)
+func (cm *VPNConnectionManager) markConnected(conn *VPNConnection) {
+	conn.State = "connected"
+	conn.ConnectedAt = time.Now()
+	conn.LastError = ""
+	counters := cm.profileCounters(conn.Profile.ID)
+	counters.Connections++
+	if cm.reconnectPending[conn.Profile.ID] {
+		counters.Reconnects++
+		delete(cm.reconnectPending, conn.Profile.ID)
+	}
+	log.Printf("VPN connection established for profile: %s", conn.Profile.Name)
+}
+
+// handlePasswordEvent answers credential prompts from what is on hand, or
+// leaves them pending for SubmitAuth (requires lock)
+func (cm *VPNConnectionManager) handlePasswordEvent(conn *VPNConnection, payload string) {
+	if strings.HasPrefix(payload, "Verification Failed") {
+		if challenge, ok := parseDynamicChallenge(payload); ok {
+			conn.challenge = challenge
+			log.Printf("VPN server issued an authentication challenge for profile %s", conn.Profile.Name)
+			return
+		}
+		conn.LastError = "authentication failed"
+		if conn.credentialsFromStore {
+			// Stored credentials are not retried, on this connection or the
+			// next, until they change; the next prompt waits
+			cm.rejectedCredentials[conn.Profile.ID] = conn.storeVersion
+			conn.LastError = "stored credentials were rejected"
+		}
+		conn.credentials = nil
+		conn.credentialsFromStore = false
+		log.Printf("VPN authentication failed for profile %s", conn.Profile.Name)
+		return
+	}
+
+	prompt, ok := parsePasswordPrompt(payload)
+	if !ok {
+		return
+	}
+	if prompt.Type == "Auth" && conn.challenge != nil {
+		prompt.Challenge = conn.challenge.Text
+		prompt.Echo = conn.challenge.Echo
+		prompt.Dynamic = true
+		prompt.NeedsUsername = false
+	}
+	conn.PendingAuth = prompt
+	cm.answerPendingAuth(conn)
+}
+
+// answerPendingAuth answers the pending prompt from credentials on hand:
+// those submitted for this connection, then the credential store, then an
+// auth-user-pass file. Challenges are answered with a TOTP code when the
+// store holds a secret; otherwise the prompt waits for SubmitAuth (requires lock)
+func (cm *VPNConnectionManager) answerPendingAuth(conn *VPNConnection) {
+	prompt := conn.PendingAuth
+	if prompt == nil {
+		return
+	}
+
+	var stored *VPNCredentials
+	if prompt.Type == "Auth" {
+		stored = cm.storedAnswer(conn)
+	}
+	var answer *VPNAuthAnswer
+	fromStore, storeVersion := false, conn.storeVersion
+	switch {
+	case conn.credentials != nil:
+		kept := *conn.credentials
+		answer, fromStore = &kept, conn.credentialsFromStore
+	case prompt.Type == "Auth" && !prompt.Dynamic && stored != nil:
+		answer, fromStore = &VPNAuthAnswer{Username: stored.Username, Password: stored.Password}, true
+		storeVersion = stored.UpdatedAt
+	case prompt.Type == "Auth" && !prompt.Dynamic:
+		answer = readAuthFile(conn.Profile.AuthUserPass)
+	case prompt.Dynamic && stored != nil && stored.TOTPSecret != "":
+		// Only the challenge response is sent for a server challenge
+		answer = &VPNAuthAnswer{}
+	}
+	if answer == nil {
+		log.Printf("VPN profile %s is waiting for %s credentials", conn.Profile.Name, prompt.Type)
+		return
+	}
+
+	var totpStepUsed int64
+	if prompt.Challenge != "" && answer.ChallengeResponse == "" && stored != nil && stored.TOTPSecret != "" {
+		now := time.Now()
+		step := now.Unix() / totpStep
+		if step <= cm.totpSteps[conn.Profile.ID] {
+			// Servers refuse a code sent before; wait for the next one
+			wait := time.Unix((step+1)*totpStep, 0).Sub(now)
+			log.Printf("VPN profile %s is waiting %s for a new OTP code", conn.Profile.Name, wait.Round(time.Second))
+			cm.retryPendingAuth(conn, prompt, wait)
+			return
+		}
+		code, err := totpCode(stored.TOTPSecret, now)
+		if err != nil {
+			log.Printf("Warning: failed to generate OTP for profile %s: %v", conn.Profile.Name, err)
+		}
+		answer.ChallengeResponse = code
+		totpStepUsed = step
+	}
+	if prompt.Challenge != "" && answer.ChallengeResponse == "" {
+		log.Printf("VPN profile %s is waiting for a challenge response", conn.Profile.Name)
+		return
+	}
+	if err := cm.answerPrompt(conn, prompt, *answer); err != nil {
+		conn.LastError = err.Error()
+		log.Printf("Failed to answer %s prompt for profile %s: %v", prompt.Type, conn.Profile.Name, err)
+		return
+	}
+	conn.credentialsFromStore, conn.storeVersion = fromStore, storeVersion
+	if totpStepUsed != 0 {
+		cm.totpSteps[conn.Profile.ID] = totpStepUsed
+	}
+}
+
+// retryPendingAuth answers a prompt again after wait, if the connection is
+// still waiting on it then
+func (cm *VPNConnectionManager) retryPendingAuth(conn *VPNConnection, prompt *VPNAuthPrompt, wait time.Duration) {
+	time.AfterFunc(wait, func() {
+		cm.mutex.Lock()
+		defer cm.mutex.Unlock()
+		if cm.activeConn == conn && conn.PendingAuth == prompt {
+			cm.answerPendingAuth(conn)
+			cm.saveConnectionState()
+		}
+	})
+}
+
+// answerPrompt sends credentials for a pending prompt (requires lock)
+func (cm *VPNConnectionManager) answerPrompt(conn *VPNConnection, prompt *VPNAuthPrompt, answer VPNAuthAnswer) error {
+	if conn.mgmt == nil {
+		return fmt.Errorf("management interface not connected")
+	}
+
+	username, password := answer.Username, answer.Password
+	switch {
+	case prompt.Dynamic:
+		username = conn.challenge.Username
+		password = fmt.Sprintf("CRV1::%s::%s", conn.challenge.StateID, answer.ChallengeResponse)
+	case prompt.Challenge != "":
+		password = fmt.Sprintf("SCRV1:%s:%s",
+			base64.StdEncoding.EncodeToString([]byte(answer.Password)),
+			base64.StdEncoding.EncodeToString([]byte(answer.ChallengeResponse)))
+	}
+
+	quotedType := managementQuote(prompt.Type)
+	if prompt.NeedsUsername || prompt.Dynamic {
+		if _, err := conn.mgmt.Command("username " + quotedType + " " + managementQuote(username)); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.mgmt.Command("password " + quotedType + " " + managementQuote(password)); err != nil {
+		return err
+	}
+
+	conn.PendingAuth = nil
+	if prompt.Dynamic {
+		conn.challenge = nil
+	}
+	// Challenge responses are single use; keep the rest for reconnects
+	kept := answer
+	kept.ChallengeResponse = ""
+	conn.credentials = &kept
+	return nil
+}
+
+// SubmitAuth answers the pending credential prompt of the active connection,
+// or keeps the credentials for its next prompt
+func (cm *VPNConnectionManager) SubmitAuth(answer VPNAuthAnswer) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	conn := cm.activeConn
+	if conn == nil {
+		return fmt.Errorf("no active connection")
+	}
+
+	prompt := conn.PendingAuth
+	if prompt == nil {
+		conn.credentials = &answer
+		conn.credentialsFromStore = false
+		return nil
+	}
+	if prompt.Challenge != "" && answer.ChallengeResponse == "" {
+		return fmt.Errorf("challenge_response is required: %s", prompt.Challenge)
+	}
+	if !prompt.Dynamic {
+		if prompt.NeedsUsername && answer.Username == "" && conn.credentials != nil {
+			answer.Username = conn.credentials.Username
+		}
+		if answer.Password == "" && conn.credentials != nil {
+			answer.Password = conn.credentials.Password
+		}
+		if (prompt.NeedsUsername && answer.Username == "") || answer.Password == "" {
+			return fmt.Errorf("username and password are required")
+		}
+	}
+
+	err := cm.answerPrompt(conn, prompt, answer)
+	if err == nil {
+		conn.credentialsFromStore = false
+	}
+	cm.saveConnectionState()
+	return err
+}
+
+// readAuthFile reads an auth-user-pass file: username then password
+func readAuthFile(path string) *VPNAuthAnswer {
+	if path == "" || path == "required" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.SplitN(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n", 3)
+	if len(lines) < 2 {
+		return nil
+	}
+	return &VPNAuthAnswer{Username: lines[0], Password: lines[1]}
+}
+
+// shutdownViaManagement asks OpenVPN to exit and waits for it to go (requires lock)
+func (cm *VPNConnectionManager) shutdownViaManagement(conn *VPNConnection) error {
+	if _, err := conn.mgmt.Command("signal SIGTERM"); err != nil {
+		return err
+	}
+
+	var exited <-chan struct{} = conn.exited
+	if exited == nil {
+		exited = conn.mgmt.Closed()
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-time.After(shutdownTimeout):
+		return fmt.Errorf("OpenVPN did not exit within %s", shutdownTimeout)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeManagement serves the OpenVPN management protocol on a unix socket,
+// scripting a connect that stops at a static challenge prompt
+type fakeManagement struct {
+	listener net.Listener
+	commands chan string
+	remotes  []string // >REMOTE queries to send, connecting on the last
+}
+
+func newFakeManagement(t *testing.T, path string, remotes ...string) *fakeManagement {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen management socket: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	fm := &fakeManagement{listener: listener, commands: make(chan string, 64), remotes: remotes}
+	go fm.serve()
+	return fm
+}
+
+func (fm *fakeManagement) serve() {
+	conn, err := fm.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	send := func(lines ...string) {
+		for _, line := range lines {
+			conn.Write([]byte(line + "\r\n"))
+		}
+	}
+	send(">INFO:OpenVPN Management Interface Version 5 -- type 'help' for more info",
+		">HOLD:Waiting for hold release:0")
+
+	released := false
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := scanner.Text()
+		fm.commands <- cmd
+		switch {
+		case cmd == "state":
+			send("1700000000,CONNECTING,,,,,,,", "END")
+		case cmd == "hold release":
+			send("SUCCESS: hold release succeeded")
+			if !released && len(fm.remotes) > 0 {
+				released = true
+				send(">REMOTE:" + fm.remotes[0])
+			} else if !released {
+				released = true
+				send(">STATE:1700000001,WAIT,,,,,,,",
+					">STATE:1700000002,AUTH,,,,,,,",
+					">PASSWORD:Need 'Auth' username/password SC:1,Enter OTP")
+			}
+		case strings.HasPrefix(cmd, "password "):
+			send("SUCCESS: 'Auth' password entered, but not yet verified",
+				">STATE:1700000003,GET_CONFIG,,,,,,,",
+				">STATE:1700000004,ASSIGN_IP,,10.8.0.6,,,,,",
+				">STATE:1700000005,CONNECTED,SUCCESS,10.8.0.6,203.0.113.10,1194,,,",
+				">BYTECOUNT:4096,2048")
+		case cmd == "remote ACCEPT":
+			send("SUCCESS: remote command succeeded")
+			if fm.remotes = fm.remotes[1:]; len(fm.remotes) > 0 {
+				send(">STATE:1700000002,RECONNECTING,connection-refused,,,,,,",
+					">REMOTE:"+fm.remotes[0])
+			} else {
+				send(">STATE:1700000005,CONNECTED,SUCCESS,10.8.0.6,198.51.100.7,443,,,")
+			}
+		case cmd == "signal SIGTERM":
+			send("SUCCESS: signal SIGTERM thrown", ">STATE:1700000009,EXITING,SIGTERM,,,,,,")
+			return
+		default:
+			send("SUCCESS: ok")
+		}
+	}
+}
+
+// attachFakeManagement attaches a connecting DRT profile to a fake management
+// interface that prompts for a static challenge before connecting
+func attachFakeManagement(t *testing.T) (*VPNConnectionManager, *fakeManagement) {
+	t.Helper()
+	cm := newTestVPNManager(t).connectionManager
+	profile := &VPNProfile{ID: "/config/vpn/DRT_1", Name: "DRT", AuthUserPass: "required"}
+	conn := &VPNConnection{
+		Profile:          profile,
+		StartedAt:        time.Now(),
+		State:            "connecting",
+		PidFile:          cm.statePath + "/missing.pid",
+		ManagementSocket: cm.managementSocketPath(profile.ID),
+	}
+	fm := newFakeManagement(t, conn.ManagementSocket)
+
+	cm.mutex.Lock()
+	cm.activeConn = conn
+	err := cm.attachManagement(conn, time.Second, true)
+	cm.mutex.Unlock()
+	if err != nil {
+		t.Fatalf("attachManagement: %v", err)
+	}
+	waitFor(t, "auth prompt", func() bool { return cm.GetConnectionStatus().PendingAuth != nil })
+	return cm, fm
+}
+
+func TestManagementSocketPath_OmitsProfileID(t *testing.T) {
+	cm := newTestVPNManager(t).connectionManager
+	if path := cm.managementSocketPath("/config/vpn/DRT_1"); strings.Contains(strings.TrimPrefix(path, cm.statePath), "DRT") {
+		t.Errorf("socket path %s should not embed the profile ID", path)
+	}
+}
+
+func TestManagementInterface_AuthPrompt(t *testing.T) {
+	cm, _ := attachFakeManagement(t)
+
+	status := cm.GetConnectionStatus()
+	if status.OpenVPNState != "AUTH" || status.Connected {
+		t.Errorf("status before auth = %s connected=%v, want AUTH and not connected", status.OpenVPNState, status.Connected)
+	}
+	if p := status.PendingAuth; p.Type != "Auth" || !p.NeedsUsername || p.Challenge != "Enter OTP" || !p.Echo {
+		t.Errorf("pending auth = %+v", p)
+	}
+	if err := cm.SubmitAuth(VPNAuthAnswer{Username: "alice", Password: "secret"}); err == nil {
+		t.Error("SubmitAuth without a challenge response succeeded")
+	}
+}
+
+func TestManagementInterface_ConnectsAfterAuth(t *testing.T) {
+	cm, _ := attachFakeManagement(t)
+	if err := cm.SubmitAuth(VPNAuthAnswer{Username: "alice", Password: "secret", ChallengeResponse: "123456"}); err != nil {
+		t.Fatalf("SubmitAuth: %v", err)
+	}
+
+	waitFor(t, "connected", func() bool { return cm.GetConnectionStatus().Connected })
+	waitFor(t, "byte counts", func() bool { return cm.GetConnectionStatus().BytesReceived == 4096 })
+	status := cm.GetConnectionStatus()
+	if status.OpenVPNState != "CONNECTED" || status.LocalIP != "10.8.0.6" || status.RemoteIP != "203.0.113.10" {
+		t.Errorf("connected status = %+v", status)
+	}
+	if status.BytesSent != 2048 || status.PendingAuth != nil {
+		t.Errorf("bytes sent = %d, pending auth = %+v", status.BytesSent, status.PendingAuth)
+	}
+	if counters := cm.GetProfileCounters()["/config/vpn/DRT_1"]; counters.Connections != 1 {
+		t.Errorf("connections = %d, want 1", counters.Connections)
+	}
+}
+
+func TestManagementInterface_DisconnectCommands(t *testing.T) {
+	cm, fm := attachFakeManagement(t)
+	if err := cm.SubmitAuth(VPNAuthAnswer{Username: "alice", Password: "secret", ChallengeResponse: "123456"}); err != nil {
+		t.Fatalf("SubmitAuth: %v", err)
+	}
+	waitFor(t, "connected", func() bool { return cm.GetConnectionStatus().Connected })
+	if err := cm.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	close(fm.commands)
+	got := make([]string, 0)
+	for cmd := range fm.commands {
+		got = append(got, cmd)
+	}
+	want := []string{
+		`state on`,
+		`bytecount 5`,
+		`state`,
+		`hold release`,
+		`username "Auth" "alice"`,
+		`password "Auth" "SCRV1:c2VjcmV0:MTIzNDU2"`,
+		`signal SIGTERM`,
+	}
+	filtered := make([]string, 0)
+	released := false
+	for _, cmd := range got {
+		// The >HOLD notification triggers a second, harmless release
+		if cmd == "hold release" {
+			if released {
+				continue
+			}
+			released = true
+		}
+		filtered = append(filtered, cmd)
+	}
+	if strings.Join(filtered, "\n") != strings.Join(want, "\n") {
+		t.Errorf("management commands:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if status := cm.GetConnectionStatus(); status.Connected || status.ProfileID != "" {
+		t.Errorf("status after disconnect = %+v", status)
+	}
+}
+
+func TestParsePasswordPrompt(t *testing.T) {
+	cases := []struct {
+		line string
+		ok   bool
+		want VPNAuthPrompt
+	}{
+		{"Need 'Private Key' password", true, VPNAuthPrompt{Type: "Private Key"}},
+		{"Auth-Token:abc", false, VPNAuthPrompt{}},
+	}
+	for _, tc := range cases {
+		prompt, ok := parsePasswordPrompt(tc.line)
+		if ok != tc.ok || (ok && (prompt.Type != tc.want.Type || prompt.NeedsUsername || prompt.Challenge != "")) {
+			t.Errorf("parsePasswordPrompt(%q) = %+v, %v", tc.line, prompt, ok)
+		}
+	}
+}
+
+func TestParseDynamicChallenge(t *testing.T) {
+	challenge, ok := parseDynamicChallenge("Verification Failed: 'Auth' ['CRV1:R,E:Om01u7Fh4LrGBS7uh0SWmzwabUiGiW6l:Y3Ix:Please enter token PIN']")
+	if !ok {
+		t.Fatal("CRV1 challenge not parsed")
+	}
+	if challenge.StateID != "Om01u7Fh4LrGBS7uh0SWmzwabUiGiW6l" || challenge.Username != "cr1" ||
+		challenge.Text != "Please enter token PIN" || !challenge.Echo {
+		t.Errorf("challenge = %+v", challenge)
+	}
+}
+
+func TestParseOpenVPNState(t *testing.T) {
+	state, err := parseOpenVPNState("1700000005,CONNECTED,SUCCESS,10.8.0.6,203.0.113.10,1194,,,")
+	if err != nil || state.Name != "CONNECTED" || state.RemotePort != 1194 || state.LocalIP != "10.8.0.6" {
+		t.Errorf("state = %+v, %v", state, err)
+	}
+}
+
+func TestManagementQuote(t *testing.T) {
+	if got := managementQuote(`pa"ss\word`); got != `"pa\"ss\\word"` {
+		t.Errorf("managementQuote = %s", got)
+	}
+}
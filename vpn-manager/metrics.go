@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricPrefix namespaces everything exported on /metrics. Metric names and
+// labels are part of the scrape contract with Prometheus and dashboards, so
+// rename only with a deprecation period.
+const metricPrefix = "noc_raven_vpn_"
+
+// metricWriter writes the Prometheus text exposition format (version 0.0.4)
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricWriter) header(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one line; labels are given as alternating name, value pairs
+func (m *metricWriter) sample(name string, value float64, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			m.w.WriteString(labels[i])
+			m.w.WriteString(`="`)
+			m.w.WriteString(labelEscaper.Replace(labels[i+1]))
+			m.w.WriteByte('"')
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(formatFloat(value))
+	m.w.WriteByte('\n')
+}
+
+// single writes a metric family with one unlabeled sample
+func (m *metricWriter) single(name, kind, help string, value float64) {
+	m.header(name, kind, help)
+	m.sample(name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// certificateExpiry returns the NotAfter time of the first certificate in a PEM bundle
+func certificateExpiry(certPEM string) (time.Time, bool) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return time.Time{}, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return cert.NotAfter, true
+}
+
+// sortedProfiles returns a snapshot of the profiles and their IDs in a
+// stable order for exposition
+func (vm *VPNManager) sortedProfiles() ([]string, map[string]*VPNProfile) {
+	profiles := vm.GetProfiles()
+	ids := make([]string, 0, len(profiles))
+	for id := range profiles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, profiles
+}
+
+// handleMetrics serves tunnel, health, failover and diagnostics metrics for Prometheus
+func (vm *VPNManager) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	status := vm.connectionManager.GetConnectionStatus()
+	counters := vm.connectionManager.GetProfileCounters()
+	runs := vm.diagnostics.GetRunCounts()
+	health := vm.healthMonitor.GetCurrentHealth()
+	profileIDs, profiles := vm.sortedProfiles()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	m := &metricWriter{w: bw}
+
+	// Profiles
+	m.header(metricPrefix+"profile_info", "gauge", "Loaded VPN profiles; always 1.")
+	for _, id := range profileIDs {
+		p := profiles[id]
+		m.sample(metricPrefix+"profile_info", 1, "profile", id, "name", p.Name,
+			"priority", strconv.Itoa(p.Priority), "validated", strconv.FormatBool(p.Validated))
+	}
+
+	m.header(metricPrefix+"certificate_expiry_days", "gauge", "Days until the profile certificate expires; negative once expired.")
+	for _, id := range profileIDs {
+		p := profiles[id]
+		for _, c := range []struct{ kind, pem string }{{"ca", p.CA}, {"client", p.Certificate}} {
+			if c.pem == "" {
+				continue
+			}
+			if notAfter, ok := certificateExpiry(c.pem); ok {
+				m.sample(metricPrefix+"certificate_expiry_days", notAfter.Sub(now).Hours()/24, "profile", id, "certificate", c.kind)
+			}
+		}
+	}
+
+	// Tunnel state
+	m.single(metricPrefix+"tunnel_up", "gauge", "Whether the VPN tunnel is connected.", boolFloat(status.Connected))
+	m.header(metricPrefix+"tunnel_active_profile", "gauge", "Profile of the active or connecting tunnel; always 1.")
+	if status.ProfileID != "" {
+		m.sample(metricPrefix+"tunnel_active_profile", 1, "profile", status.ProfileID)
+	}
+	m.single(metricPrefix+"tunnel_uptime_seconds", "gauge", "Seconds since the current tunnel was established, 0 when down.", float64(status.ConnectionTime))
+	m.header(metricPrefix+"tunnel_bytes_total", "counter", "Bytes carried by the current tunnel interface; resets when the tunnel is re-created.")
+	m.sample(metricPrefix+"tunnel_bytes_total", float64(status.BytesReceived), "direction", "rx")
+	m.sample(metricPrefix+"tunnel_bytes_total", float64(status.BytesSent), "direction", "tx")
+
+	// Health monitor
+	m.single(metricPrefix+"health_monitoring", "gauge", "Whether periodic health monitoring is running.", boolFloat(vm.healthMonitor.IsMonitoring()))
+	if health != nil {
+		m.single(metricPrefix+"health_last_check_timestamp_seconds", "gauge", "Unix time of the last health snapshot.", float64(health.Timestamp.Unix()))
+		m.single(metricPrefix+"latency_seconds", "gauge", "Round trip time to the VPN remote at the last health check.", health.Latency/1000)
+		m.single(metricPrefix+"jitter_seconds", "gauge", "Mean difference between consecutive probe round trips at the last health check.", health.Jitter/1000)
+		m.single(metricPrefix+"packet_loss_ratio", "gauge", "Packet loss to the VPN remote at the last health check, 0 to 1.", health.PacketLoss/100)
+		m.header(metricPrefix+"throughput_bits_per_second", "gauge", "Tunnel throughput over the last health check interval.")
+		m.sample(metricPrefix+"throughput_bits_per_second", health.Throughput.DownloadSpeedMbps*1e6, "direction", "rx")
+		m.sample(metricPrefix+"throughput_bits_per_second", health.Throughput.UploadSpeedMbps*1e6, "direction", "tx")
+		m.single(metricPrefix+"remote_reachable", "gauge", "Whether the VPN remote answered the last health check.", boolFloat(health.RemoteReachable))
+		m.single(metricPrefix+"dns_resolution_up", "gauge", "Whether DNS resolution worked at the last health check.", boolFloat(health.DNSResolution))
+	}
+
+	// Connection lifecycle per profile
+	counterIDs := make([]string, 0, len(counters))
+	for id := range counters {
+		counterIDs = append(counterIDs, id)
+	}
+	sort.Strings(counterIDs)
+	perProfile := func(name, help string, value func(VPNProfileCounters) int64) {
+		m.header(metricPrefix+name, "counter", help)
+		for _, id := range counterIDs {
+			m.sample(metricPrefix+name, float64(value(counters[id])), "profile", id)
+		}
+	}
+	perProfile("connect_attempts_total", "Connection attempts per profile.",
+		func(c VPNProfileCounters) int64 { return c.ConnectAttempts })
+	perProfile("connect_failures_total", "Connection attempts that failed to start per profile.",
+		func(c VPNProfileCounters) int64 { return c.ConnectFailures })
+	perProfile("connections_total", "Tunnels established per profile.",
+		func(c VPNProfileCounters) int64 { return c.Connections })
+	perProfile("reconnects_total", "Tunnels re-established after an unexpected drop per profile.",
+		func(c VPNProfileCounters) int64 { return c.Reconnects })
+	perProfile("disconnects_total", "Tunnels torn down or lost per profile.",
+		func(c VPNProfileCounters) int64 { return c.Disconnects })
+	perProfile("failovers_total", "Successful failovers to a profile.",
+		func(c VPNProfileCounters) int64 { return c.Failovers })
+	perProfile("failover_failures_total", "Failed failover attempts to a profile.",
+		func(c VPNProfileCounters) int64 { return c.FailoverFailures })
+
+	// Diagnostics
+	runKeys := make([]DiagnosticRunKey, 0, len(runs))
+	for k := range runs {
+		runKeys = append(runKeys, k)
+	}
+	sort.Slice(runKeys, func(i, j int) bool {
+		if runKeys[i].TestType != runKeys[j].TestType {
+			return runKeys[i].TestType < runKeys[j].TestType
+		}
+		return !runKeys[i].Success && runKeys[j].Success
+	})
+	m.header(metricPrefix+"diagnostics_runs_total", "counter", "Diagnostic test runs by test type and result.")
+	for _, k := range runKeys {
+		result := "failure"
+		if k.Success {
+			result = "success"
+		}
+		m.sample(metricPrefix+"diagnostics_runs_total", float64(runs[k]), "test", k.TestType, "result", result)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrapeValue returns the value of the sample whose name and labels match exactly
+func scrapeValue(t *testing.T, out, series string) float64 {
+	t.Helper()
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			if err != nil {
+				t.Fatalf("parse %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	t.Fatalf("series %s not found in:\n%s", series, out)
+	return 0
+}
+
+func TestMetrics_ScrapeRacesProfileWrites(t *testing.T) {
+	vm := newTestVPNManager(t)
+	router := vm.setupRoutes()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			vm.SaveProfile(&VPNProfile{ID: fmt.Sprintf("p%d", i), Name: "site"})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	}
+	<-done
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := strings.Count(rec.Body.String(), metricPrefix+"profile_info{"); got != 20 {
+		t.Errorf("profile_info samples = %d, want 20", got)
+	}
+}
+
+func TestMetrics_ScrapeSeries(t *testing.T) {
+	vm := newTestVPNManager(t)
+	vm.profiles["drt"] = &VPNProfile{
+		ID:          "drt",
+		Name:        "DRT VPN",
+		Priority:    1,
+		Validated:   true,
+		Certificate: testCertificate(t, time.Now().Add(30*24*time.Hour)),
+	}
+
+	cm := vm.connectionManager
+	cm.profileCounters("drt").Connections = 3
+	cm.profileCounters("drt").Reconnects = 2
+	cm.profileCounters("backup").Failovers = 1
+	vm.diagnostics.storeResult(&DiagnosticResult{TestType: "ping", Target: "10.0.0.1", StartTime: time.Now(), Success: true})
+	vm.diagnostics.storeResult(&DiagnosticResult{TestType: "ping", Target: "10.0.0.2", StartTime: time.Now(), Success: false})
+
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape: %d", rec.Code)
+	}
+	out := rec.Body.String()
+
+	if v := scrapeValue(t, out, `noc_raven_vpn_certificate_expiry_days{profile="drt",certificate="client"}`); math.Abs(v-30) > 0.01 {
+		t.Errorf("certificate expiry = %v days, want 30", v)
+	}
+	checks := map[string]float64{
+		`noc_raven_vpn_profile_info{profile="drt",name="DRT VPN",priority="1",validated="true"}`: 1,
+		`noc_raven_vpn_tunnel_up`:                                            0,
+		`noc_raven_vpn_connections_total{profile="drt"}`:                     3,
+		`noc_raven_vpn_reconnects_total{profile="drt"}`:                      2,
+		`noc_raven_vpn_failovers_total{profile="backup"}`:                    1,
+		`noc_raven_vpn_failovers_total{profile="drt"}`:                       0,
+		`noc_raven_vpn_diagnostics_runs_total{test="ping",result="success"}`: 1,
+		`noc_raven_vpn_diagnostics_runs_total{test="ping",result="failure"}`: 1,
+	}
+	for series, want := range checks {
+		if got := scrapeValue(t, out, series); got != want {
+			t.Errorf("%s = %v, want %v", series, got, want)
+		}
+	}
+	if strings.Contains(out, "noc_raven_vpn_latency_seconds") {
+		t.Errorf("latency must not be reported before the first health check")
+	}
+}
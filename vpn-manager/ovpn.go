@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inlineSections are the <section> blocks a .ovpn may embed
+var inlineSections = []string{"ca", "cert", "key", "tls-auth", "tls-crypt", "tls-crypt-v2", "extra-certs", "pkcs12"}
+
+// validOpenVPNProtocol reports whether p is a client transport OpenVPN accepts
+func validOpenVPNProtocol(p string) bool {
+	switch p {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6", "tcp-client", "tcp4-client", "tcp6-client":
+		return true
+	}
+	return false
+}
+
+// splitOVPNLine splits a config line into its directive and arguments the
+// way OpenVPN does: double quotes group and honour backslash escapes, single
+// quotes group literally, and a token starting with # or ; begins a comment.
+func splitOVPNLine(line string) ([]string, error) {
+	tokens, _, err := scanOVPNLine(line)
+	return tokens, err
+}
+
+// ovpnArgText returns the arguments of a directive line as written, without
+// the directive name or a trailing comment
+func ovpnArgText(line string) string {
+	tokens, ends, err := scanOVPNLine(line)
+	if err != nil || len(tokens) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(line[ends[0]:ends[len(ends)-1]])
+}
+
+// scanOVPNLine splits a config line and reports where each token ends
+func scanOVPNLine(line string) ([]string, []int, error) {
+	tokens := make([]string, 0)
+	ends := make([]int, 0)
+	var token strings.Builder
+	inToken := false
+	var quote rune
+	escaped := false
+
+	for i, c := range line {
+		switch {
+		case escaped:
+			token.WriteRune(c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				token.WriteRune(c)
+			}
+		case quote == '"':
+			switch c {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				token.WriteRune(c)
+			}
+		case c == ' ' || c == '\t':
+			if inToken {
+				tokens = append(tokens, token.String())
+				ends = append(ends, i)
+				token.Reset()
+				inToken = false
+			}
+		case !inToken && (c == '#' || c == ';'):
+			return tokens, ends, nil
+		default:
+			inToken = true
+			switch c {
+			case '"', '\'':
+				quote = c
+			case '\\':
+				escaped = true
+			default:
+				token.WriteRune(c)
+			}
+		}
+	}
+	if quote != 0 {
+		return tokens, ends, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+		ends = append(ends, len(line))
+	}
+	return tokens, ends, nil
+}
+
+// quoteOVPNArg quotes an argument that would not survive splitOVPNLine as is
+func quoteOVPNArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\#;") {
+		return arg
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+// joinOVPNArgs quotes and joins arguments for a config line
+func joinOVPNArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteOVPNArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// VPNDirective is a directive the manager has no field for, kept as parsed
+type VPNDirective struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+	Raw  string   `json:"raw,omitempty"` // arguments as written, quoting included
+}
+
+// String renders the directive as a config line. The arguments are written
+// as they were read unless Args has since been changed.
+func (d VPNDirective) String() string {
+	if len(d.Args) == 0 {
+		return d.Name
+	}
+	if d.Raw != "" {
+		if args, err := splitOVPNLine(d.Raw); err == nil && strings.Join(args, "\x00") == strings.Join(d.Args, "\x00") {
+			return d.Name + " " + d.Raw
+		}
+	}
+	return d.Name + " " + joinOVPNArgs(d.Args)
+}
+
+// VPNDirectives are a profile's custom directives in file order. A directive
+// may repeat, as push-peer-info, setenv or pull-filter often do.
+type VPNDirectives []VPNDirective
+
+// Lookup returns the arguments of the first directive with the given name
+func (d VPNDirectives) Lookup(name string) (string, bool) {
+	for _, directive := range d {
+		if directive.Name == name {
+			return joinOVPNArgs(directive.Args), true
+		}
+	}
+	return "", false
+}
+
+// MarshalJSON always encodes a list, so an empty set compares equal to none
+func (d VPNDirectives) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]VPNDirective(d))
+}
+
+// UnmarshalJSON accepts a list of directives, or the name to arguments object
+// profiles were saved with before directives kept their order
+func (d *VPNDirectives) UnmarshalJSON(data []byte) error {
+	var list []VPNDirective
+	if err := json.Unmarshal(data, &list); err == nil {
+		*d = list
+		return nil
+	}
+
+	var legacy map[string]string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("custom_directives must be a list of {name, args}: %v", err)
+	}
+	names := make([]string, 0, len(legacy))
+	for name := range legacy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	directives := make(VPNDirectives, 0, len(names))
+	for _, name := range names {
+		raw := legacy[name]
+		args, err := splitOVPNLine(raw)
+		if err != nil {
+			args, raw = strings.Fields(raw), ""
+		}
+		directives = append(directives, VPNDirective{Name: name, Args: args, Raw: raw})
+	}
+	*d = directives
+	return nil
+}
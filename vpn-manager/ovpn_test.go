@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// updateGolden rewrites golden files from the current output: go test -update
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+func TestProfileRoundTrip_GoldenFiles(t *testing.T) {
+	vm := newTestVPNManager(t)
+	inputs, _ := filepath.Glob(filepath.Join("testdata", "profiles", "*.ovpn"))
+	if len(inputs) == 0 {
+		t.Fatal("no profile fixtures")
+	}
+	export := func(t *testing.T, profile *VPNProfile) string {
+		t.Helper()
+		profile.CreatedAt = time.Date(2024, 3, 5, 14, 0, 0, 0, time.UTC)
+		var buf bytes.Buffer
+		if err := vm.writeOVPNFile(&buf, profile); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+		return buf.String()
+	}
+
+	// Spot checks that the directives landed in their fields
+	checks := map[string]func(p *VPNProfile) bool{
+		"access_server": func(p *VPNProfile) bool {
+			return p.KeyDirection == "1" && strings.Contains(p.TLSAuth, "BEGIN OpenVPN Static key V1") &&
+				len(p.Remote) == 4 && p.Remote[2].Protocol == "tcp" && p.ServerPollTimeout == 4 &&
+				p.CustomDirectives[0].String() == "setenv FORWARD_COMPATIBLE 1" && p.CustomDirectives[6].Args[1] == "NoC Raven VPN Manager 1.0"
+		},
+		"provider_remote_random": func(p *VPNProfile) bool {
+			return p.RemoteRandom && p.RedirectGateway && strings.Join(p.RedirectGatewayFlags, " ") == "def1 bypass-dhcp" &&
+				p.KeyDirection == "1" && p.TLSAuth != "" && p.CompLZO == "no"
+		},
+		"tls_crypt_routes": func(p *VPNProfile) bool {
+			return p.DataCiphers == "AES-256-GCM:AES-128-GCM:CHACHA20-POLY1305" &&
+				p.VerifyX509Name == "C=US, ST=CA, O=Example Corp, CN=vpn.example.com" && p.VerifyX509Type == "subject" &&
+				len(p.Routes) == 3 && p.Routes[1] == VPNRoute{"192.168.50.0", "255.255.255.0", "vpn_gateway", "100"} &&
+				p.Routes[0] == VPNRoute{Network: "10.10.0.0", Netmask: "255.255.0.0"} &&
+				p.TLSCrypt != "" && strings.Contains(p.ExtraCerts, "BEGIN CERTIFICATE") &&
+				len(p.CustomDirectives) == 9 && p.CustomDirectives[6].String() == "pull-filter ignore 'route-gateway'" &&
+				p.CustomDirectives[7].String() == `pull-filter accept "route 10."`
+		},
+		"quoted_args": func(p *VPNProfile) bool {
+			return len(p.CustomDirectives) == 10 && p.CustomDirectives[1].String() == "setenv FRIENDLY_NAME 'Branch Office VPN'" &&
+				p.CustomDirectives[2].String() == `setenv "UV_SITE" "branch-7"` && p.CustomDirectives[6].String() == `pull-filter ignore "route-ipv6"` &&
+				p.CustomDirectives[8].String() == `tun-mtu "1400"` && p.CustomDirectives[9].Args[0] == "1360"
+		},
+		"tls_crypt_v2_pkcs12": func(p *VPNProfile) bool {
+			return p.PKCS12 != "" && strings.Contains(p.TLSCryptV2, "tls-crypt-v2 client key") && p.Protocol == "tcp-client" &&
+				p.Remote[0].Port == 443 && p.Remote[1].Protocol == "tcp4" && p.VerifyX509Type == "name-prefix" &&
+				p.AuthUserPass == "/etc/openvpn/client/corp auth.txt" && strings.Join(p.RedirectGatewayFlags, " ") == "def1 ipv6"
+		},
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".ovpn")
+		t.Run(name, func(t *testing.T) {
+			content, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			parsed, _, err := vm.parseOVPN(bytes.NewReader(content), filepath.Base(input))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if check, ok := checks[name]; !ok || !check(parsed) {
+				t.Errorf("parsed fields = %+v", parsed)
+			}
+
+			got := export(t, parsed)
+			golden := filepath.Join("testdata", "profiles", name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatalf("update golden: %v", err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("export differs from %s:\n%s", golden, got)
+			}
+
+			// Nothing is lost re-reading the export, and exporting again is stable
+			reparsed, _, err := vm.parseOVPN(strings.NewReader(got), filepath.Base(input))
+			if err != nil {
+				t.Fatalf("parse export: %v", err)
+			}
+			if changes := diffProfiles(parsed, reparsed); len(changes) > 0 {
+				t.Errorf("round trip changed %+v", changes)
+			}
+			if again := export(t, reparsed); again != got {
+				t.Errorf("second export differs:\n%s", again)
+			}
+		})
+	}
+
+	for _, bad := range []string{
+		"remote 192.0.2.1\n<tls-auth>\nkey\n",
+		"remote 192.0.2.1\n<tls-crypt>\nkey\n</tls-auth>\n",
+		"remote 192.0.2.1\nverify-x509-name \"CN=vpn\n",
+	} {
+		if _, _, err := vm.parseOVPN(strings.NewReader(bad), "bad.ovpn"); err == nil {
+			t.Errorf("parse %q succeeded", bad)
+		}
+	}
+
+	// Control channel keys are secrets
+	profile, _, _ := vm.parseOVPN(strings.NewReader("remote 192.0.2.1\n<tls-crypt>\nkey\n</tls-crypt>\n"), "tc.ovpn")
+	if redacted, removed := redactedProfile(profile); redacted.TLSCrypt != "" || strings.Join(removed, ",") != "tls-crypt" {
+		t.Errorf("redacted = %q, removed %v", redacted.TLSCrypt, removed)
+	}
+	report := checkProfileValidation(profile, time.Now())
+	if report.Valid || report.firstError() != "tls-crypt key is not an OpenVPN key (missing -----BEGIN OpenVPN Static key V1-----)" {
+		t.Errorf("validation = %+v", report.Findings)
+	}
+}
+
+const (
+	customDirectivesOVPN = "client\nremote 192.0.2.1\npush-peer-info\nsetenv UV_A 1\nignore-unknown-option \"block-outside-dns\" 'x y'\nsetenv UV_B \"two words\"\npush-peer-info\n"
+	customDirectivesWant = "push-peer-info|setenv UV_A 1|ignore-unknown-option \"block-outside-dns\" 'x y'|setenv UV_B \"two words\"|push-peer-info"
+)
+
+func parseCustomDirectives(t *testing.T, vm *VPNManager) *VPNProfile {
+	t.Helper()
+	profile, warnings, err := vm.parseOVPN(strings.NewReader(customDirectivesOVPN), "custom.ovpn")
+	if err != nil || len(warnings) != 5 {
+		t.Fatalf("parse = %v, warnings %v", err, warnings)
+	}
+	return profile
+}
+
+func TestCustomDirectives_OrderAndRepeats(t *testing.T) {
+	profile := parseCustomDirectives(t, newTestVPNManager(t))
+	lines := make([]string, 0)
+	for _, directive := range profile.CustomDirectives {
+		lines = append(lines, directive.String())
+	}
+	if strings.Join(lines, "|") != customDirectivesWant {
+		t.Errorf("directives = %q", lines)
+	}
+	if value, ok := profile.CustomDirectives.Lookup("setenv"); !ok || value != "UV_A 1" {
+		t.Errorf("lookup setenv = %q, %v", value, ok)
+	}
+}
+
+// Arguments changed after parsing are quoted afresh
+func TestCustomDirectives_EditedArgsRequoted(t *testing.T) {
+	edited := parseCustomDirectives(t, newTestVPNManager(t)).CustomDirectives[2]
+	edited.Args = []string{"block-outside-dns", "x z"}
+	if got := edited.String(); got != `ignore-unknown-option block-outside-dns "x z"` {
+		t.Errorf("edited directive = %s", got)
+	}
+}
+
+// Every export is identical and keeps the directives in order
+func TestCustomDirectives_ExportIsStable(t *testing.T) {
+	vm := newTestVPNManager(t)
+	profile := parseCustomDirectives(t, vm)
+	var first, second bytes.Buffer
+	vm.writeOVPNFile(&first, profile)
+	vm.writeOVPNFile(&second, profile)
+	if first.String() != second.String() || !strings.Contains(first.String(), strings.ReplaceAll(customDirectivesWant, "|", "\n")+"\n") {
+		t.Errorf("export = %s", first.String())
+	}
+}
+
+func TestCustomDirectives_JSONRoundTrip(t *testing.T) {
+	profile := parseCustomDirectives(t, newTestVPNManager(t))
+	data, _ := json.Marshal(profile)
+	var decoded VPNProfile
+	if err := json.Unmarshal(data, &decoded); err != nil || len(diffProfiles(profile, &decoded)) != 0 {
+		t.Errorf("json round trip = %v, %+v", err, diffProfiles(profile, &decoded))
+	}
+	if data, _ := json.Marshal(&VPNProfile{}); !strings.Contains(string(data), `"custom_directives":[]`) {
+		t.Errorf("empty directives = %s", data)
+	}
+}
+
+// Profiles saved with directives as a name to value object still load
+func TestCustomDirectives_LegacyJSON(t *testing.T) {
+	cases := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"object", `{"custom_directives": {"tun-mtu": "1500", "pull-filter": "ignore \"dhcp-option DNS\"", "push-peer-info": ""}}`,
+			`[pull-filter ignore "dhcp-option DNS" push-peer-info tun-mtu 1500]`},
+		{"string", `{"custom_directives": "mssfix 1400"}`, ""},
+	}
+	for _, tc := range cases {
+		var legacy VPNProfile
+		err := json.Unmarshal([]byte(tc.json), &legacy)
+		if tc.want == "" {
+			if err == nil {
+				t.Errorf("%s directives accepted", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s decode: %v", tc.name, err)
+		}
+		if got := fmt.Sprint(legacy.CustomDirectives); got != tc.want || len(legacy.CustomDirectives[0].Args) != 2 {
+			t.Errorf("%s directives = %s", tc.name, got)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Probe protocols
+const (
+	probeAuto = "auto" // ICMP, falling back to TCP connect when ICMP sockets are not permitted
+	probeICMP = "icmp"
+	probeTCP  = "tcp"
+	probeUDP  = "udp"
+)
+
+const (
+	// defaultTCPProbePort is used by the auto fallback when the target has no port;
+	// a refused connection still measures the round trip
+	defaultTCPProbePort = 443
+	defaultUDPProbePort = 7 // echo
+)
+
+// ProbeTarget is a host probed on every health check
+type ProbeTarget struct {
+	Name     string `json:"name,omitempty"`
+	Host     string `json:"host"`
+	Protocol string `json:"protocol,omitempty"` // "auto" (default), "icmp", "tcp" or "udp"
+	Port     int    `json:"port,omitempty"`
+}
+
+// label names the target in results and logs
+func (t ProbeTarget) label() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Host
+}
+
+// VPNProbeConfig controls the latency probe train sent to each target and the
+// reachability checks run on every health check
+type VPNProbeConfig struct {
+	Count        int                 `json:"count"`
+	IntervalMs   int                 `json:"interval_ms"`
+	TimeoutMs    int                 `json:"timeout_ms"`
+	ProbeGateway bool                `json:"probe_gateway"` // probe the tunnel remote as the primary target
+	Targets      []ProbeTarget       `json:"targets"`
+	Checks       []ReachabilityCheck `json:"checks"`
+}
+
+func defaultProbeConfig() VPNProbeConfig {
+	return VPNProbeConfig{
+		Count:        10,
+		IntervalMs:   200,
+		TimeoutMs:    1000,
+		ProbeGateway: true,
+		Targets:      []ProbeTarget{},
+		Checks:       []ReachabilityCheck{},
+	}
+}
+
+// Validate checks the probe train and targets
+func (c VPNProbeConfig) Validate() error {
+	if c.Count < 1 || c.Count > 100 {
+		return fmt.Errorf("count must be between 1 and 100")
+	}
+	if c.IntervalMs < 10 || c.TimeoutMs < 10 {
+		return fmt.Errorf("interval_ms and timeout_ms must be at least 10")
+	}
+	// The whole train must fit comfortably inside the minimum 10s monitoring interval
+	if c.Count*max(c.IntervalMs, c.TimeoutMs) > 10000 {
+		return fmt.Errorf("probe train of %d probes would take longer than 10s", c.Count)
+	}
+	for i, t := range c.Targets {
+		if t.Host == "" {
+			return fmt.Errorf("target %d: host is required", i)
+		}
+		switch t.Protocol {
+		case "", probeAuto, probeICMP, probeTCP, probeUDP:
+		default:
+			return fmt.Errorf("target %d: invalid protocol %q", i, t.Protocol)
+		}
+		if t.Port < 0 || t.Port > 65535 {
+			return fmt.Errorf("target %d: invalid port %d", i, t.Port)
+		}
+	}
+	names := make(map[string]bool)
+	for _, c := range c.Checks {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate check name %q", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// ProbeResult summarises one probe train
+type ProbeResult struct {
+	Target      ProbeTarget `json:"target"`
+	Method      string      `json:"method"` // protocol actually used
+	Sent        int         `json:"sent"`
+	Received    int         `json:"received"`
+	PacketLoss  float64     `json:"packet_loss_percent"`
+	MinLatency  float64     `json:"min_latency_ms"`
+	AvgLatency  float64     `json:"avg_latency_ms"`
+	MaxLatency  float64     `json:"max_latency_ms"`
+	Jitter      float64     `json:"jitter_ms"`
+	Error       string      `json:"error,omitempty"`
+	DurationMs  float64     `json:"duration_ms"`
+	ResolvedIP  string      `json:"resolved_ip,omitempty"`
+	Unreachable bool        `json:"unreachable"`
+}
+
+// errProbeUnavailable means the probe method cannot be used on this host
+var errProbeUnavailable = errors.New("probe method unavailable")
+
+// prober sends one probe and returns its round trip time
+type prober interface {
+	probe(seq int, timeout time.Duration) (time.Duration, error)
+	close()
+}
+
+// runProbe sends a train of probes to a target and summarises the replies
+func runProbe(target ProbeTarget, count int, interval, timeout time.Duration) ProbeResult {
+	start := time.Now()
+	result := ProbeResult{Target: target, Sent: count}
+	defer func() { result.DurationMs = float64(time.Since(start).Microseconds()) / 1000 }()
+
+	addr, err := net.ResolveIPAddr("ip", target.Host)
+	if err != nil {
+		result.Error = fmt.Sprintf("resolve %s: %v", target.Host, err)
+		result.PacketLoss = 100
+		result.Unreachable = true
+		return result
+	}
+	result.ResolvedIP = addr.IP.String()
+
+	p, method, err := openProber(target, addr.IP)
+	if err != nil {
+		result.Error = err.Error()
+		result.PacketLoss = 100
+		result.Unreachable = true
+		return result
+	}
+	defer p.close()
+	result.Method = method
+
+	rtts := make([]time.Duration, 0, count)
+	var lastErr error
+	for seq := 0; seq < count; seq++ {
+		sent := time.Now()
+		rtt, err := p.probe(seq, timeout)
+		if err != nil {
+			lastErr = err
+		} else {
+			rtts = append(rtts, rtt)
+		}
+		if seq < count-1 {
+			if wait := interval - time.Since(sent); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+
+	summariseProbe(&result, rtts)
+	if result.Received == 0 && lastErr != nil {
+		result.Error = lastErr.Error()
+	}
+	return result
+}
+
+// summariseProbe fills loss, latency and jitter from the round trips of the replies
+func summariseProbe(result *ProbeResult, rtts []time.Duration) {
+	result.Received = len(rtts)
+	if result.Sent > 0 {
+		result.PacketLoss = float64(result.Sent-result.Received) / float64(result.Sent) * 100
+	}
+	result.Unreachable = result.Received == 0
+	if len(rtts) == 0 {
+		return
+	}
+
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	result.MinLatency = math.Inf(1)
+	var sum, jitter float64
+	for i, rtt := range rtts {
+		v := ms(rtt)
+		sum += v
+		result.MinLatency = math.Min(result.MinLatency, v)
+		result.MaxLatency = math.Max(result.MaxLatency, v)
+		// Jitter is the mean difference between consecutive round trips
+		if i > 0 {
+			jitter += math.Abs(v - ms(rtts[i-1]))
+		}
+	}
+	result.AvgLatency = sum / float64(len(rtts))
+	if len(rtts) > 1 {
+		result.Jitter = jitter / float64(len(rtts)-1)
+	}
+}
+
+// openProber opens the prober for a target, applying the auto fallback
+func openProber(target ProbeTarget, ip net.IP) (prober, string, error) {
+	switch target.Protocol {
+	case probeICMP:
+		p, err := newICMPProber(ip)
+		return p, probeICMP, err
+	case probeTCP:
+		return newTCPProber(ip, portOr(target.Port, defaultTCPProbePort)), probeTCP, nil
+	case probeUDP:
+		p, err := newUDPProber(ip, portOr(target.Port, defaultUDPProbePort))
+		return p, probeUDP, err
+	}
+
+	p, err := newICMPProber(ip)
+	if err == nil {
+		return p, probeICMP, nil
+	}
+	if !errors.Is(err, errProbeUnavailable) {
+		return nil, "", err
+	}
+	return newTCPProber(ip, portOr(target.Port, defaultTCPProbePort)), probeTCP, nil
+}
+
+func portOr(port, fallback int) int {
+	if port > 0 {
+		return port
+	}
+	return fallback
+}
+
+// icmpProber sends echo requests over an unprivileged ICMP datagram socket.
+// The kernel assigns the echo identifier and only delivers our replies.
+type icmpProber struct {
+	conn net.PacketConn
+	dst  net.Addr
+	v6   bool
+}
+
+func newICMPProber(ip net.IP) (*icmpProber, error) {
+	family, proto, v6 := syscall.AF_INET, syscall.IPPROTO_ICMP, false
+	if ip.To4() == nil {
+		family, proto, v6 = syscall.AF_INET6, syscall.IPPROTO_ICMPV6, true
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		// Datagram ICMP is gated by net.ipv4.ping_group_range
+		if err == syscall.EACCES || err == syscall.EPERM || err == syscall.EPROTONOSUPPORT {
+			return nil, fmt.Errorf("%w: icmp socket: %v", errProbeUnavailable, err)
+		}
+		return nil, fmt.Errorf("icmp socket: %v", err)
+	}
+	var sa syscall.Sockaddr = &syscall.SockaddrInet4{}
+	if v6 {
+		sa = &syscall.SockaddrInet6{}
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("icmp bind: %v", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	conn, err := net.FilePacketConn(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("icmp socket: %v", err)
+	}
+	return &icmpProber{conn: conn, dst: &net.UDPAddr{IP: ip}, v6: v6}, nil
+}
+
+func (p *icmpProber) probe(seq int, timeout time.Duration) (time.Duration, error) {
+	request, reply := byte(8), byte(0)
+	if p.v6 {
+		request, reply = 128, 129
+	}
+
+	msg := make([]byte, 16)
+	msg[0] = request
+	binary.BigEndian.PutUint16(msg[6:], uint16(seq))
+	binary.BigEndian.PutUint64(msg[8:], uint64(time.Now().UnixNano()))
+	if !p.v6 {
+		binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	}
+
+	start := time.Now()
+	if _, err := p.conn.WriteTo(msg, p.dst); err != nil {
+		return 0, err
+	}
+	deadline := start.Add(timeout)
+	p.conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		// Skip late replies to earlier probes
+		if n >= 8 && buf[0] == reply && int(binary.BigEndian.Uint16(buf[6:])) == seq&0xffff {
+			return time.Since(start), nil
+		}
+	}
+}
+
+func (p *icmpProber) close() {
+	p.conn.Close()
+}
+
+// icmpChecksum is the internet checksum of an ICMP message
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// tcpProber times TCP handshakes. A refused connection is an answer from the
+// host, so it counts as a reply.
+type tcpProber struct {
+	addr string
+}
+
+func newTCPProber(ip net.IP, port int) *tcpProber {
+	return &tcpProber{addr: net.JoinHostPort(ip.String(), strconv.Itoa(port))}
+}
+
+func (p *tcpProber) probe(seq int, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", p.addr, timeout)
+	rtt := time.Since(start)
+	if err == nil {
+		conn.Close()
+		return rtt, nil
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return rtt, nil
+	}
+	return 0, err
+}
+
+func (p *tcpProber) close() {}
+
+// udpProber sends datagrams to a UDP echo service and waits for them to come
+// back. A port unreachable reply is an answer from the host, so it counts too.
+type udpProber struct {
+	conn net.Conn
+}
+
+func newUDPProber(ip net.IP, port int) (*udpProber, error) {
+	conn, err := net.Dial("udp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("udp socket: %v", err)
+	}
+	return &udpProber{conn: conn}, nil
+}
+
+func (p *udpProber) probe(seq int, timeout time.Duration) (time.Duration, error) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint32(msg, uint32(seq))
+	binary.BigEndian.PutUint64(msg[4:], uint64(time.Now().UnixNano()))
+
+	start := time.Now()
+	if _, err := p.conn.Write(msg); err != nil {
+		return 0, err
+	}
+	p.conn.SetReadDeadline(start.Add(timeout))
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := p.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				return time.Since(start), nil
+			}
+			return 0, err
+		}
+		if n == len(msg) && binary.BigEndian.Uint32(buf) == uint32(seq) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+func (p *udpProber) close() {
+	p.conn.Close()
+}
+
+// runProbes probes all targets concurrently, returning results in target order
+func runProbes(targets []ProbeTarget, config VPNProbeConfig) []ProbeResult {
+	results := make([]ProbeResult, len(targets))
+	interval := time.Duration(config.IntervalMs) * time.Millisecond
+	timeout := time.Duration(config.TimeoutMs) * time.Millisecond
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target ProbeTarget) {
+			defer wg.Done()
+			results[i] = runProbe(target, config.Count, interval, timeout)
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// probeConfigPath is where probe settings persist across restarts
+func (hm *VPNHealthMonitor) probeConfigPath() string {
+	return filepath.Join(hm.vm.statePath, "probe_config.json")
+}
+
+// GetProbeConfig returns the probe settings
+func (hm *VPNHealthMonitor) GetProbeConfig() VPNProbeConfig {
+	hm.mutex.RLock()
+	defer hm.mutex.RUnlock()
+
+	config := hm.probeConfig
+	config.Targets = append([]ProbeTarget{}, hm.probeConfig.Targets...)
+	config.Checks = append([]ReachabilityCheck{}, hm.probeConfig.Checks...)
+	return config
+}
+
+// SetProbeConfig validates, applies and persists probe settings
+func (hm *VPNHealthMonitor) SetProbeConfig(config VPNProbeConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if config.Targets == nil {
+		config.Targets = []ProbeTarget{}
+	}
+	if config.Checks == nil {
+		config.Checks = []ReachabilityCheck{}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode probe config: %v", err)
+	}
+	if err := os.WriteFile(hm.probeConfigPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save probe config: %v", err)
+	}
+
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+	hm.probeConfig = config
+	return nil
+}
+
+// loadProbeConfig reads persisted probe settings, keeping defaults when there are none
+func (hm *VPNHealthMonitor) loadProbeConfig() {
+	data, err := os.ReadFile(hm.probeConfigPath())
+	if err != nil {
+		return
+	}
+	config := defaultProbeConfig()
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Printf("Warning: failed to decode probe config: %v", err)
+		return
+	}
+	if err := config.Validate(); err != nil {
+		log.Printf("Warning: ignoring invalid probe config: %v", err)
+		return
+	}
+	hm.probeConfig = config
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTCPLoopback accepts and closes TCP connections on a loopback port
+func serveTCPLoopback(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// serveLossyUDPEcho echoes every other datagram on a loopback port
+func serveLossyUDPEcho(t *testing.T) int {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for i := 0; ; i++ {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if i%2 == 0 {
+				pc.WriteTo(buf[:n], addr)
+			}
+		}
+	}()
+	return pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestRunProbe_Loopback(t *testing.T) {
+	interval := 5 * time.Millisecond
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	cases := []struct {
+		name    string
+		target  ProbeTarget
+		count   int
+		timeout time.Duration
+		check   func(r ProbeResult) bool
+	}{
+		{"tcp", ProbeTarget{Host: "127.0.0.1", Protocol: probeTCP, Port: serveTCPLoopback(t)}, 5, 500 * time.Millisecond,
+			func(r ProbeResult) bool {
+				return r.Method == probeTCP && r.Received == 5 && r.PacketLoss == 0 && r.MinLatency <= r.AvgLatency && r.AvgLatency <= r.MaxLatency
+			}},
+		// A refused connection is still an answer from the host
+		{"tcp refused", ProbeTarget{Host: "127.0.0.1", Protocol: probeTCP, Port: closedPort}, 3, 500 * time.Millisecond,
+			func(r ProbeResult) bool { return r.Received == 3 }},
+		{"udp echo dropping half", ProbeTarget{Host: "127.0.0.1", Protocol: probeUDP, Port: serveLossyUDPEcho(t)}, 4, 100 * time.Millisecond,
+			func(r ProbeResult) bool {
+				return r.Method == probeUDP && r.Received == 2 && r.PacketLoss == 50 && !r.Unreachable
+			}},
+		{"unresolvable", ProbeTarget{Host: "no-such-host.invalid"}, 3, 500 * time.Millisecond,
+			func(r ProbeResult) bool { return r.Unreachable && r.PacketLoss == 100 && r.Error != "" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if r := runProbe(tc.target, tc.count, interval, tc.timeout); !tc.check(r) {
+				t.Errorf("probe = %+v", r)
+			}
+		})
+	}
+}
+
+func TestRunProbe_AutoPrefersICMP(t *testing.T) {
+	interval, timeout := 5*time.Millisecond, 500*time.Millisecond
+	port := serveTCPLoopback(t)
+
+	// Unprivileged ICMP depends on net.ipv4.ping_group_range; auto falls back to TCP
+	r := runProbe(ProbeTarget{Host: "127.0.0.1", Protocol: probeAuto, Port: port}, 3, interval, timeout)
+	if r.Received != 3 {
+		t.Errorf("auto probe = %+v", r)
+	}
+	p, err := newICMPProber(net.ParseIP("127.0.0.1"))
+	if err != nil {
+		if !errors.Is(err, errProbeUnavailable) {
+			t.Fatalf("icmp socket: %v", err)
+		}
+		if r.Method != probeTCP {
+			t.Errorf("auto probe used %s without ICMP sockets", r.Method)
+		}
+		t.Skip("ICMP datagram sockets not permitted; skipping ICMP probe")
+	}
+	p.close()
+	if r.Method != probeICMP {
+		t.Errorf("auto probe used %s with ICMP available", r.Method)
+	}
+	if r := runProbe(ProbeTarget{Host: "127.0.0.1", Protocol: probeICMP}, 3, interval, timeout); r.Received != 3 {
+		t.Errorf("icmp probe = %+v", r)
+	}
+}
+
+func TestSummariseProbe(t *testing.T) {
+	r := ProbeResult{Sent: 5}
+	summariseProbe(&r, []time.Duration{10 * time.Millisecond, 14 * time.Millisecond, 12 * time.Millisecond, 20 * time.Millisecond})
+	if r.PacketLoss != 20 || r.MinLatency != 10 || r.MaxLatency != 20 || r.AvgLatency != 14 || r.Jitter != 14.0/3 {
+		t.Errorf("summary = %+v", r)
+	}
+}
+
+func TestHandleSetProbeConfig(t *testing.T) {
+	vm := newTestVPNManager(t)
+	defer vm.healthMonitor.Close()
+	router := vm.setupRoutes()
+
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid protocol", `{"targets":[{"host":"10.8.0.1","protocol":"sctp"}]}`, http.StatusBadRequest},
+		{"tcp target", `{"count":5,"targets":[{"name":"dc","host":"10.20.0.5","protocol":"tcp","port":22}]}`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/vpn/health/probes", strings.NewReader(tc.body)))
+		if rec.Code != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	// Unset fields keep their defaults, and the settings survive a restart
+	reloaded := NewVPNHealthMonitor(vm)
+	defer reloaded.Close()
+	got := reloaded.GetProbeConfig()
+	if got.Count != 5 || got.TimeoutMs != 1000 || !got.ProbeGateway || len(got.Targets) != 1 || got.Targets[0].Port != 22 {
+		t.Errorf("reloaded probe config = %+v", got)
+	}
+}
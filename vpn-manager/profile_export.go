@@ -0,0 +1,28 @@
+package main
+
+import "strings"
+
+// redactedProfile returns a copy of a profile without secrets, for sharing an
+// export, and the names of what was removed
+func redactedProfile(profile *VPNProfile) (*VPNProfile, []string) {
+	redacted := *profile
+	removed := make([]string, 0)
+
+	for _, f := range profileInlineFields(&redacted) {
+		if f.secret && *f.value != "" {
+			*f.value = ""
+			removed = append(removed, f.directive)
+		}
+	}
+	// A credentials file lives on this host; the recipient supplies their own
+	if redacted.AuthUserPass != "" && redacted.AuthUserPass != "required" {
+		redacted.AuthUserPass = "required"
+		removed = append(removed, "auth-user-pass")
+	}
+	return &redacted, removed
+}
+
+// profileExportFilename is the download name of an exported profile
+func profileExportFilename(profile *VPNProfile) string {
+	return profileSlug(strings.TrimSuffix(profile.Name, ".ovpn")) + ".ovpn"
+}
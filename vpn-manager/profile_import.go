@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxProfileUploadSize bounds an imported .ovpn, inline certificates included
+const maxProfileUploadSize = 1 << 20
+
+// ProfileImportOptions are the optional settings sent with an imported .ovpn
+type ProfileImportOptions struct {
+	Filename string // source file name, used for the default profile name
+	Name     string
+	Priority *int
+	Username string
+	Password string
+	// Privileged imports carried the API key and may use script, plugin,
+	// host file and unlisted directives
+	Privileged bool
+}
+
+// ProfileImportResult is the outcome of an import
+type ProfileImportResult struct {
+	Profile   *VPNProfile `json:"profile"`
+	Warnings  []string    `json:"warnings"`
+	Duplicate bool        `json:"duplicate"` // content matched an existing profile, which is returned unchanged
+}
+
+// ProfileDuplicateError rejects a re-import whose name, priority or
+// credentials differ from the profile already imported from the same content
+type ProfileDuplicateError struct {
+	ProfileID string
+	Fields    []string
+}
+
+func (e *ProfileDuplicateError) Error() string {
+	return fmt.Sprintf("content was already imported as profile %s; update its %s there", e.ProfileID, strings.Join(e.Fields, ", "))
+}
+
+// hostDirectives run commands, load code or name files on the host. startOpenVPN
+// allows scripts, and an auth-user-pass file is read and sent to the remote, so
+// they are only accepted from privileged requests. The map explains the
+// rejection; directives missing from safeDirectives are rejected as well.
+var hostDirectives = map[string]string{
+	"up":                    "runs a command",
+	"down":                  "runs a command",
+	"route-up":              "runs a command",
+	"route-pre-down":        "runs a command",
+	"ipchange":              "runs a command",
+	"tls-verify":            "runs a command",
+	"auth-user-pass-verify": "runs a command",
+	"client-connect":        "runs a command",
+	"client-disconnect":     "runs a command",
+	"learn-address":         "runs a command",
+	"iproute":               "runs a command",
+	"script-security":       "enables commands",
+	"plugin":                "loads a plugin",
+	"config":                "reads a host file",
+	"cd":                    "changes directory",
+	"chroot":                "changes directory",
+	"askpass":               "reads a host file",
+	"secret":                "reads a host file",
+	"dh":                    "reads a host file",
+	"crl-verify":            "reads a host file",
+	"capath":                "reads host files",
+	"tls-export-cert":       "writes host files",
+	"writepid":              "writes a host file",
+	"log":                   "writes a host file",
+	"log-append":            "writes a host file",
+	"status":                "writes a host file",
+	"management":            "opens a management interface",
+	"tls-crypt-v2-verify":   "runs a command",
+	"providers":             "loads a library",
+	"engine":                "loads a library",
+	"pkcs11-providers":      "loads a library",
+	// Inline blocks map onto profile fields; the file forms stay custom
+	"ca":           "reads a host file",
+	"cert":         "reads a host file",
+	"key":          "reads a host file",
+	"tls-auth":     "reads a host file",
+	"tls-crypt":    "reads a host file",
+	"tls-crypt-v2": "reads a host file",
+	"extra-certs":  "reads a host file",
+	"pkcs12":       "reads a host file",
+}
+
+// safeDirectives are the client directives known to act only on the tunnel,
+// accepted from any request. Anything else, including options added by newer
+// OpenVPN releases, needs the API key until it is reviewed and listed here.
+// auth-user-pass and http-proxy are checked by their arguments instead.
+var safeDirectives = map[string]bool{
+	// Mode and transport
+	"client": true, "pull": true, "tls-client": true, "dev": true, "dev-type": true,
+	"proto": true, "port": true, "rport": true, "lport": true, "bind": true, "nobind": true,
+	"remote": true, "remote-random": true, "remote-random-hostname": true, "float": true,
+	"resolv-retry": true, "connect-retry": true, "connect-retry-max": true, "connect-timeout": true,
+	"server-poll-timeout": true, "explicit-exit-notify": true, "http-proxy-option": true,
+	"persist-key": true, "persist-tun": true, "persist-remote-ip": true, "persist-local-ip": true,
+	// Crypto and certificate checks
+	"cipher": true, "data-ciphers": true, "data-ciphers-fallback": true, "ncp-ciphers": true,
+	"auth": true, "key-direction": true, "tls-version-min": true, "tls-version-max": true,
+	"tls-cipher": true, "tls-ciphersuites": true, "tls-groups": true, "tls-cert-profile": true,
+	"ecdh-curve": true, "remote-cert-tls": true, "remote-cert-eku": true, "remote-cert-ku": true,
+	"ns-cert-type": true, "verify-x509-name": true, "peer-fingerprint": true,
+	"reneg-sec": true, "reneg-bytes": true, "reneg-pkts": true, "hand-window": true,
+	"tran-window": true, "tls-timeout": true, "replay-window": true, "mute-replay-warnings": true,
+	"auth-nocache": true, "auth-retry": true, "static-challenge": true,
+	// Routing and addressing pushed to the tunnel
+	"route": true, "route-ipv6": true, "route-metric": true, "route-delay": true,
+	"route-gateway": true, "route-nopull": true, "redirect-gateway": true, "redirect-private": true,
+	"pull-filter": true, "dhcp-option": true, "block-outside-dns": true, "block-ipv6": true,
+	"topology": true, "allow-pull-fqdn": true,
+	// Link tuning and liveness
+	"tun-mtu": true, "tun-mtu-extra": true, "link-mtu": true, "mssfix": true, "fragment": true,
+	"sndbuf": true, "rcvbuf": true, "txqueuelen": true, "fast-io": true,
+	"comp-lzo": true, "compress": true, "allow-compression": true,
+	"keepalive": true, "ping": true, "ping-restart": true, "ping-exit": true,
+	"ping-timer-rem": true, "inactive": true,
+	// Logging
+	"verb": true, "mute": true,
+}
+
+// ProfileDirectiveError rejects a directive that needs a privileged request
+type ProfileDirectiveError struct {
+	Directive string
+	Reason    string
+}
+
+func (e *ProfileDirectiveError) Error() string {
+	return fmt.Sprintf("directive %s %s on the host and needs the API key", e.Directive, e.Reason)
+}
+
+// checkHostDirectives rejects profiles whose config would run commands, load
+// plugins or read host files when OpenVPN starts, or uses a directive not in
+// safeDirectives. The exported config is
+// checked, since any edited field can carry a line break. Lines current, the
+// profile being replaced (nil on import), already exports are kept.
+func (vm *VPNManager) checkHostDirectives(profile, current *VPNProfile) error {
+	kept := make(map[string]int)
+	if current != nil {
+		lines, err := vm.exportedDirectives(current)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			kept[line]++
+		}
+	}
+
+	lines, err := vm.exportedDirectives(profile)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if kept[line] > 0 {
+			kept[line]--
+			continue
+		}
+		// A line that fails to split still names its directive
+		tokens, _ := splitOVPNLine(line)
+		if len(tokens) == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(tokens[0], "--"))
+		args := tokens[1:]
+		switch {
+		case name == "auth-user-pass":
+			if len(args) > 0 && args[0] != vm.profileAuthPath(profile.ID) {
+				return &ProfileDirectiveError{Directive: tokens[0], Reason: "reads a host file"}
+			}
+		case name == "http-proxy":
+			// http-proxy server port [authfile|auto|auto-nct] [auth-method]
+			if len(args) >= 3 && args[2] != "auto" && args[2] != "auto-nct" && args[2] != "stdin" {
+				return &ProfileDirectiveError{Directive: tokens[0], Reason: "reads a host file"}
+			}
+		case len(args) > 0 && args[0] == "[inline]" && hostDirectives[name] == "reads a host file":
+		case safeDirectives[name]:
+		default:
+			reason, ok := hostDirectives[name]
+			if !ok {
+				reason = "is not known to be safe"
+			}
+			return &ProfileDirectiveError{Directive: tokens[0], Reason: reason}
+		}
+	}
+	return nil
+}
+
+// exportedDirectives returns the directive lines of a profile's exported
+// config, without comments or inline blocks
+func (vm *VPNManager) exportedDirectives(profile *VPNProfile) ([]string, error) {
+	var config bytes.Buffer
+	if err := vm.writeOVPNFile(&config, profile); err != nil {
+		return nil, fmt.Errorf("failed to export profile: %v", err)
+	}
+
+	lines := make([]string, 0)
+	section := ""
+	for _, line := range strings.Split(config.String(), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case section != "":
+			if line == "</"+section+">" {
+				section = ""
+			}
+		case strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">"):
+			section = strings.Trim(line, "<>")
+		case line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, ";"):
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// profileImportJSON is the JSON form of an import request
+type profileImportJSON struct {
+	Content  string `json:"content"`
+	Filename string `json:"filename"`
+	Name     string `json:"name"`
+	Priority *int   `json:"priority"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// profileContentHash identifies .ovpn content regardless of line endings
+func profileContentHash(content []byte) string {
+	sum := sha256.Sum256(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// profileSlug reduces a name to characters safe in profile IDs and file names
+func profileSlug(name string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(name))
+	slug = strings.Trim(slug, "_.")
+	if slug == "" {
+		return "profile"
+	}
+	return slug
+}
+
+// findProfileByHash returns the profile imported from identical content
+func (vm *VPNManager) findProfileByHash(hash string) (*VPNProfile, bool) {
+	for _, profile := range vm.GetProfiles() {
+		if profile.ContentHash == hash {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+// ImportProfileContent parses, validates and saves .ovpn content. Content
+// already imported returns the existing profile rather than a copy, or a
+// ProfileDuplicateError if the options would have changed it.
+func (vm *VPNManager) ImportProfileContent(content []byte, opts ProfileImportOptions) (*ProfileImportResult, error) {
+	if len(bytes.TrimSpace(content)) == 0 {
+		return nil, fmt.Errorf("profile content is empty")
+	}
+	if opts.Priority != nil && *opts.Priority < 0 {
+		return nil, fmt.Errorf("priority must not be negative")
+	}
+	if (opts.Username == "") != (opts.Password == "") {
+		return nil, fmt.Errorf("username and password must be given together")
+	}
+
+	hash := profileContentHash(content)
+	if existing, exists := vm.findProfileByHash(hash); exists {
+		if fields := vm.duplicateImportChanges(existing, opts); len(fields) > 0 {
+			return nil, &ProfileDuplicateError{ProfileID: existing.ID, Fields: fields}
+		}
+		return &ProfileImportResult{Profile: existing, Warnings: make([]string, 0), Duplicate: true}, nil
+	}
+
+	source := opts.Filename
+	if source == "" {
+		source = "profile.ovpn"
+	}
+	profile, warnings, err := vm.parseOVPN(bytes.NewReader(content), source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OVPN file: %v", err)
+	}
+
+	profile.ContentHash = hash
+	if opts.Name != "" {
+		profile.Name = opts.Name
+	}
+	if opts.Priority != nil {
+		profile.Priority = *opts.Priority
+	}
+	// IDs follow the content, so re-importing after a restart keeps the ID
+	profile.ID = fmt.Sprintf("%s_%s", profileSlug(profile.Name), hash[:12])
+
+	if !opts.Privileged {
+		if err := vm.checkHostDirectives(profile, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if !profile.Validated {
+		warnings = append(warnings, fmt.Sprintf("validation failed: %s", profile.ValidationError))
+	}
+	if opts.Username != "" {
+		if err := vm.saveProfileCredentials(profile, opts.Username, opts.Password); err != nil {
+			return nil, err
+		}
+	} else if profile.AuthUserPass == "required" {
+		warnings = append(warnings, "profile requires a username and password; none were supplied")
+	}
+
+	if err := vm.recordProfileRevision(profile, "import", nil); err != nil {
+		return nil, err
+	}
+	if err := vm.SaveProfile(profile); err != nil {
+		os.Remove(vm.profileAuthPath(profile.ID))
+		os.Remove(vm.profileRevisionsPath(profile.ID))
+		return nil, fmt.Errorf("failed to save profile: %v", err)
+	}
+
+	log.Printf("Imported profile %s (%s) with %d warnings", profile.Name, profile.ID, len(warnings))
+	return &ProfileImportResult{Profile: profile, Warnings: warnings}, nil
+}
+
+// duplicateImportChanges lists the settings a re-import asks for that the
+// existing profile does not have
+func (vm *VPNManager) duplicateImportChanges(existing *VPNProfile, opts ProfileImportOptions) []string {
+	fields := make([]string, 0)
+	if opts.Name != "" && opts.Name != existing.Name {
+		fields = append(fields, "name")
+	}
+	if opts.Priority != nil && *opts.Priority != existing.Priority {
+		fields = append(fields, "priority")
+	}
+	if opts.Username != "" {
+		creds, _, err := vm.LoadCredentials(existing.ID)
+		if err != nil || creds == nil || creds.Username != opts.Username || creds.Password != opts.Password {
+			fields = append(fields, "credentials")
+		}
+	}
+	return fields
+}
+
+// profileAuthPath is where a profile's sealed auth-user-pass credentials are kept
+func (vm *VPNManager) profileAuthPath(profileID string) string {
+	return filepath.Join(vm.profilesPath, profileID+".auth")
+}
+
+// saveProfileCredentials puts imported credentials in the credential store.
+// The profile is not saved yet, so SetCredentials cannot be used.
+func (vm *VPNManager) saveProfileCredentials(profile *VPNProfile, username, password string) error {
+	if strings.ContainsAny(username, "\r\n") || strings.ContainsAny(password, "\r\n") {
+		return fmt.Errorf("username and password must be single lines")
+	}
+	creds := &VPNCredentials{Username: username, Password: password, UpdatedAt: time.Now()}
+	if err := vm.storeCredentials(profile.ID, creds); err != nil {
+		return err
+	}
+	profile.AuthUserPass = "required"
+	profile.LastModified = time.Now()
+	return nil
+}
+
+// readProfileImportRequest extracts the .ovpn content and options from a
+// multipart upload ("file" part), a JSON document or a raw body. Raw bodies
+// take name and priority from the query string.
+func readProfileImportRequest(w http.ResponseWriter, r *http.Request) ([]byte, ProfileImportOptions, error) {
+	var opts ProfileImportOptions
+	r.Body = http.MaxBytesReader(w, r.Body, maxProfileUploadSize+64*1024)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxProfileUploadSize); err != nil {
+			return nil, opts, fmt.Errorf("invalid multipart upload: %v", err)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, opts, fmt.Errorf("multipart upload needs a \"file\" part: %v", err)
+		}
+		defer file.Close()
+		content, err := readLimited(file)
+		if err != nil {
+			return nil, opts, err
+		}
+		opts.Filename = header.Filename
+		opts.Name = r.FormValue("name")
+		opts.Username = r.FormValue("username")
+		opts.Password = r.FormValue("password")
+		if opts.Priority, err = parseImportPriority(r.FormValue("priority")); err != nil {
+			return nil, opts, err
+		}
+		return content, opts, nil
+
+	case "application/json":
+		var req profileImportJSON
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, opts, fmt.Errorf("invalid import request: %v", err)
+		}
+		if len(req.Content) > maxProfileUploadSize {
+			return nil, opts, fmt.Errorf("profile exceeds %d bytes", maxProfileUploadSize)
+		}
+		opts = ProfileImportOptions{
+			Filename: req.Filename,
+			Name:     req.Name,
+			Priority: req.Priority,
+			Username: req.Username,
+			Password: req.Password,
+		}
+		return []byte(req.Content), opts, nil
+	}
+
+	content, err := readLimited(r.Body)
+	if err != nil {
+		return nil, opts, err
+	}
+	query := r.URL.Query()
+	opts.Filename = query.Get("filename")
+	opts.Name = query.Get("name")
+	if opts.Priority, err = parseImportPriority(query.Get("priority")); err != nil {
+		return nil, opts, err
+	}
+	return content, opts, nil
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(reader, maxProfileUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %v", err)
+	}
+	if len(content) > maxProfileUploadSize {
+		return nil, fmt.Errorf("profile exceeds %d bytes", maxProfileUploadSize)
+	}
+	return content, nil
+}
+
+func parseImportPriority(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid priority: %s", value)
+	}
+	return &priority, nil
+}
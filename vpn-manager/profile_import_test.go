@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testImportOVPN is a valid profile that prompts for credentials and carries
+// one safe directive the parser keeps as custom on line 6
+func testImportOVPN(t *testing.T) string {
+	return "client\ndev tun\nproto udp\nremote 127.0.0.1 1194\nauth-user-pass\ntun-mtu 1400\n<ca>\n" +
+		testCertificate(t, time.Now().Add(24*time.Hour)) + "</ca>\n"
+}
+
+// postMultipartImport uploads ovpn as office.ovpn with priority 2 and
+// credentials for alice
+func postMultipartImport(t *testing.T, vm *VPNManager, ovpn string) ProfileImportResult {
+	t.Helper()
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("file", "office.ovpn")
+	part.Write([]byte(ovpn))
+	mw.WriteField("priority", "2")
+	mw.WriteField("username", "alice")
+	mw.WriteField("password", "s3cret")
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/vpn/profiles", strings.NewReader(body.String()))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("multipart import = %d: %s", rec.Code, rec.Body.String())
+	}
+	var result ProfileImportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return result
+}
+
+func TestProfileImport_Multipart(t *testing.T) {
+	vm := newTestVPNManager(t)
+	result := postMultipartImport(t, vm, testImportOVPN(t))
+	profile := result.Profile
+	if profile == nil || profile.Name != "office" || profile.Priority != 2 || !profile.Validated || result.Duplicate {
+		t.Fatalf("imported profile = %+v", result)
+	}
+	if strings.Contains(profile.ID, "/") || !strings.HasPrefix(profile.ID, "office_") {
+		t.Errorf("profile ID = %q", profile.ID)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "line 6") || !strings.Contains(result.Warnings[0], "tun-mtu") {
+		t.Errorf("warnings = %v", result.Warnings)
+	}
+}
+
+func TestProfileImport_MultipartCredentials(t *testing.T) {
+	vm := newTestVPNManager(t)
+	profile := postMultipartImport(t, vm, testImportOVPN(t)).Profile
+	if creds, _, err := vm.LoadCredentials(profile.ID); err != nil || creds == nil || creds.Username != "alice" || creds.Password != "s3cret" || profile.AuthUserPass != "required" {
+		t.Errorf("credentials = %+v, %v (auth-user-pass %q)", creds, err, profile.AuthUserPass)
+	}
+	if info, err := os.Stat(vm.profileAuthPath(profile.ID)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("auth file mode = %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(vm.profileAuthPath(profile.ID)); strings.Contains(string(data), "s3cret") {
+		t.Errorf("auth file holds the password in plain text: %s", data)
+	}
+}
+
+// The same content with CRLF line endings is a duplicate
+func TestProfileImport_RawCRLFIsDuplicate(t *testing.T) {
+	vm := newTestVPNManager(t)
+	ovpn := testImportOVPN(t)
+	profile := postMultipartImport(t, vm, ovpn).Profile
+
+	req := httptest.NewRequest("POST", "/api/vpn/profiles?priority=2", strings.NewReader(strings.ReplaceAll(ovpn, "\n", "\r\n")))
+	req.Header.Set("Content-Type", "application/x-openvpn-profile")
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, req)
+	var result ProfileImportResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if rec.Code != http.StatusOK || !result.Duplicate || result.Profile.ID != profile.ID || len(vm.profiles) != 1 {
+		t.Errorf("raw re-import = %d %+v", rec.Code, result)
+	}
+}
+
+func TestProfileImport_JSON(t *testing.T) {
+	ovpn := testImportOVPN(t)
+	cases := []struct {
+		name     string
+		doc      map[string]interface{}
+		want     int
+		warnings int
+	}{
+		// Credentials must come in pairs
+		{"username without password", map[string]interface{}{"content": ovpn, "name": "Branch", "username": "bob"}, http.StatusBadRequest, 0},
+		// No credentials for auth-user-pass adds a warning
+		{"named", map[string]interface{}{"content": ovpn, "name": "Branch"}, http.StatusCreated, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newTestVPNManager(t)
+			doc, _ := json.Marshal(tc.doc)
+			req := httptest.NewRequest("POST", "/api/vpn/profiles", bytes.NewReader(doc))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			vm.setupRoutes().ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("json import = %d, want %d: %s", rec.Code, tc.want, rec.Body.String())
+			}
+			var result ProfileImportResult
+			json.Unmarshal(rec.Body.Bytes(), &result)
+			if tc.want == http.StatusCreated && (result.Profile.Name != "Branch" || len(result.Warnings) != tc.warnings) {
+				t.Errorf("json import = %+v", result)
+			}
+		})
+	}
+}
+
+// Boot-time imports of the same file keep one profile and its ID
+func TestImportProfile_StableAcrossRestart(t *testing.T) {
+	vm := newTestVPNManager(t)
+	path := filepath.Join(t.TempDir(), "DRT.ovpn")
+	os.WriteFile(path, []byte("client\nremote 127.0.0.1 1196\n"), 0644)
+	first, err := vm.ImportProfile(path, "DRT VPN")
+	if err != nil {
+		t.Fatalf("ImportProfile: %v", err)
+	}
+	reloaded := NewVPNManager(vm.profilesPath, vm.statePath)
+	if err := reloaded.LoadProfiles(); err != nil {
+		t.Fatalf("LoadProfiles: %v", err)
+	}
+	second, err := reloaded.ImportProfile(path, "DRT VPN")
+	if err != nil || second.ID != first.ID || len(reloaded.profiles) != 1 {
+		t.Errorf("re-import after restart = %v (%v), %d profiles", second, err, len(reloaded.profiles))
+	}
+}
+
+func TestProfileImport_DuplicateWithChangedSettingsConflicts(t *testing.T) {
+	vm := newTestVPNManager(t)
+	router := vm.setupRoutes()
+	ovpn := "client\ndev tun\nproto udp\nremote 127.0.0.1 1194\nauth-user-pass\n"
+	first, err := vm.ImportProfileContent([]byte(ovpn), ProfileImportOptions{Name: "Office", Username: "alice", Password: "s3cret"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		doc    map[string]interface{}
+		want   int
+		fields []string
+	}{
+		{"same settings", map[string]interface{}{"name": "Office", "priority": 5, "username": "alice", "password": "s3cret"}, http.StatusOK, nil},
+		{"no settings", map[string]interface{}{}, http.StatusOK, nil},
+		{"new name", map[string]interface{}{"name": "Branch"}, http.StatusConflict, []string{"name"}},
+		{"new priority", map[string]interface{}{"priority": 1}, http.StatusConflict, []string{"priority"}},
+		{"new password", map[string]interface{}{"username": "alice", "password": "changed"}, http.StatusConflict, []string{"credentials"}},
+		{"everything", map[string]interface{}{"name": "Branch", "priority": 1, "username": "bob", "password": "pw"}, http.StatusConflict, []string{"name", "priority", "credentials"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.doc["content"] = ovpn
+			body, _ := json.Marshal(tc.doc)
+			req := httptest.NewRequest("POST", "/api/vpn/profiles", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("re-import = %d, want %d: %s", rec.Code, tc.want, rec.Body.String())
+			}
+			if tc.want == http.StatusConflict {
+				var conflict struct {
+					ProfileID string   `json:"profile_id"`
+					Fields    []string `json:"fields"`
+				}
+				json.Unmarshal(rec.Body.Bytes(), &conflict)
+				if conflict.ProfileID != first.Profile.ID || fmt.Sprint(conflict.Fields) != fmt.Sprint(tc.fields) {
+					t.Errorf("conflict = %+v", conflict)
+				}
+			}
+		})
+	}
+
+	profile, _ := vm.GetProfile(first.Profile.ID)
+	creds, _, _ := vm.LoadCredentials(profile.ID)
+	if len(vm.GetProfiles()) != 1 || profile.Name != "Office" || profile.Priority != 5 || creds.Password != "s3cret" {
+		t.Errorf("existing profile changed: %+v %+v", profile, creds)
+	}
+}
+
+func TestProfileImport_HostDirectivesNeedAPIKey(t *testing.T) {
+	t.Setenv("NOC_RAVEN_API_KEY", "import-key")
+	base := "client\ndev tun\nproto udp\nremote 127.0.0.1 1194\n"
+
+	cases := []struct {
+		name   string
+		extra  string
+		apiKey string
+		want   int
+	}{
+		{"up script", "script-security 2\nup /tmp/x.sh\n", "", http.StatusForbidden},
+		{"down with dashes", "--down '/bin/sh -c id'\n", "", http.StatusForbidden},
+		{"route-up", "route-up /tmp/x.sh\n", "", http.StatusForbidden},
+		{"tls-verify", "tls-verify /tmp/x.sh\n", "", http.StatusForbidden},
+		{"auth-user-pass-verify", "auth-user-pass-verify /tmp/x.sh via-env\n", "", http.StatusForbidden},
+		{"plugin", "plugin /tmp/evil.so\n", "", http.StatusForbidden},
+		{"auth-user-pass file", "auth-user-pass /etc/shadow\n", "", http.StatusForbidden},
+		{"ca file", "ca /etc/ssl/private/ca.pem\n", "", http.StatusForbidden},
+		{"http-proxy authfile", "http-proxy proxy.example.com 8080 /etc/proxy.auth\n", "", http.StatusForbidden},
+		{"providers", "providers legacy default\n", "", http.StatusForbidden},
+		{"engine", "engine dynamic\n", "", http.StatusForbidden},
+		{"pkcs11-providers", "pkcs11-providers /tmp/evil.so\n", "", http.StatusForbidden},
+		{"tls-crypt-v2-verify", "tls-crypt-v2-verify /tmp/x.sh\n", "", http.StatusForbidden},
+		{"unlisted directive", "frobnicate yes\n", "", http.StatusForbidden},
+		{"dev-node file", "dev-node /dev/net/tun\n", "", http.StatusForbidden},
+		{"inline block arg on unlisted", "plugin [inline]\n", "", http.StatusForbidden},
+		{"wrong api key", "up /tmp/x.sh\n", "other-key", http.StatusForbidden},
+		{"auth-user-pass prompt", "auth-user-pass\n", "", http.StatusCreated},
+		{"http-proxy auto", "http-proxy proxy.example.com 8080 auto\n", "", http.StatusCreated},
+		{"safe custom directive", "mssfix 1400\ndhcp-option DNS 10.0.0.1\n", "", http.StatusCreated},
+		{"privileged unlisted directive", "frobnicate yes\n", "import-key", http.StatusCreated},
+		{"privileged script", "up /tmp/x.sh\n", "import-key", http.StatusCreated},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newTestVPNManager(t)
+			req := httptest.NewRequest("POST", "/api/vpn/profiles?name=office", strings.NewReader(base+tc.extra))
+			if tc.apiKey != "" {
+				req.Header.Set("X-API-Key", tc.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			vm.setupRoutes().ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("import = %d, want %d: %s", rec.Code, tc.want, rec.Body.String())
+			}
+			if tc.want == http.StatusForbidden && len(vm.GetProfiles()) != 0 {
+				t.Errorf("rejected profile was saved")
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// maxProfileRevisions is how many revisions are kept per profile
+const maxProfileRevisions = 50
+
+// disconnectReasonProfileUpdated ends a session restarted for an edited profile
+const disconnectReasonProfileUpdated = "profile_updated"
+
+var errProfileNotFound = fmt.Errorf("profile not found")
+
+// profileMetadataFields are profile JSON fields maintained by the manager,
+// which edits may not set and diffs ignore
+var profileMetadataFields = map[string]bool{
+	"id":               true,
+	"filename":         true,
+	"created_at":       true,
+	"last_modified":    true,
+	"validated":        true,
+	"validation_error": true,
+	"content_hash":     true,
+	"revision":         true,
+	"active":           true,
+}
+
+// profileCosmeticFields change without affecting a running tunnel
+var profileCosmeticFields = map[string]bool{
+	"name":     true,
+	"priority": true,
+}
+
+// secretProfileFields have their values hidden in diffs
+var secretProfileFields = map[string]bool{
+	"key":          true,
+	"tls_auth":     true,
+	"tls_crypt":    true,
+	"tls_crypt_v2": true,
+	"pkcs12":       true,
+}
+
+// ProfileRevision is a saved version of a profile
+type ProfileRevision struct {
+	Revision  int        `json:"revision"`
+	CreatedAt time.Time  `json:"created_at"`
+	Reason    string     `json:"reason"`            // import, edit, rollback to N
+	Changes   []string   `json:"changes,omitempty"` // fields changed from the previous revision
+	Profile   VPNProfile `json:"profile"`
+}
+
+// ProfileFieldChange is one field differing between two revisions
+type ProfileFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// ProfileUpdateResult is the outcome of an edit or rollback
+type ProfileUpdateResult struct {
+	Profile     *VPNProfile              `json:"profile"`
+	Revision    int                      `json:"revision"`
+	Changes     []ProfileFieldChange     `json:"changes"`
+	Reconnected bool                     `json:"reconnected"`
+	Validation  *ProfileValidationReport `json:"validation"`
+}
+
+// profileFields returns a profile's JSON fields, for comparing revisions
+func profileFields(profile *VPNProfile) map[string]interface{} {
+	data, _ := json.Marshal(profile)
+	fields := make(map[string]interface{})
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// cloneProfile deep-copies a profile through its JSON form
+func cloneProfile(profile *VPNProfile) (*VPNProfile, error) {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return nil, err
+	}
+	clone := &VPNProfile{}
+	if err := json.Unmarshal(data, clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// diffProfiles lists the fields that differ between two profiles, in name order
+func diffProfiles(from, to *VPNProfile) []ProfileFieldChange {
+	a, b := profileFields(from), profileFields(to)
+	names := make(map[string]bool)
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+
+	changes := make([]ProfileFieldChange, 0)
+	for name := range names {
+		if profileMetadataFields[name] || reflect.DeepEqual(a[name], b[name]) {
+			continue
+		}
+		change := ProfileFieldChange{Field: name, From: a[name], To: b[name]}
+		if secretProfileFields[name] {
+			change.From, change.To = redactedValue(a[name]), redactedValue(b[name])
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func redactedValue(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return "[redacted]"
+}
+
+// affectsConnection reports whether a change needs the tunnel re-established
+func affectsConnection(changes []ProfileFieldChange) bool {
+	for _, change := range changes {
+		if !profileCosmeticFields[change.Field] {
+			return true
+		}
+	}
+	return false
+}
+
+func (vm *VPNManager) profileRevisionsPath(profileID string) string {
+	return filepath.Join(vm.profilesPath, "revisions", profileID+".json")
+}
+
+// GetProfileRevisions returns a profile's saved revisions, oldest first
+func (vm *VPNManager) GetProfileRevisions(profileID string) ([]ProfileRevision, error) {
+	data, err := os.ReadFile(vm.profileRevisionsPath(profileID))
+	if os.IsNotExist(err) {
+		return make([]ProfileRevision, 0), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile revisions: %v", err)
+	}
+	var revisions []ProfileRevision
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, fmt.Errorf("failed to decode profile revisions: %v", err)
+	}
+	for i := range revisions {
+		if _, err := vm.openProfile(&revisions[i].Profile); err != nil {
+			return nil, fmt.Errorf("failed to decrypt revision %d: %v", revisions[i].Revision, err)
+		}
+	}
+	return revisions, nil
+}
+
+// saveProfileRevisions writes a profile's revisions, their secrets sealed
+func (vm *VPNManager) saveProfileRevisions(profileID string, revisions []ProfileRevision) error {
+	sealed := make([]ProfileRevision, len(revisions))
+	for i, rev := range revisions {
+		profile, err := vm.sealProfile(&rev.Profile)
+		if err != nil {
+			return err
+		}
+		rev.Profile = *profile
+		sealed[i] = rev
+	}
+
+	data, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode profile revisions: %v", err)
+	}
+	path := vm.profileRevisionsPath(profileID)
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to save profile revisions: %v", err)
+	}
+	return nil
+}
+
+// resealProfileRevisions rewrites a profile's revisions with the current key
+func (vm *VPNManager) resealProfileRevisions(profileID string) error {
+	revisions, err := vm.GetProfileRevisions(profileID)
+	if err != nil || len(revisions) == 0 {
+		return err
+	}
+	return vm.saveProfileRevisions(profileID, revisions)
+}
+
+// GetProfileRevision returns one saved revision of a profile
+func (vm *VPNManager) GetProfileRevision(profileID string, revision int) (*ProfileRevision, error) {
+	revisions, err := vm.GetProfileRevisions(profileID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		if revisions[i].Revision == revision {
+			return &revisions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d of profile %s not found", revision, profileID)
+}
+
+// recordProfileRevision appends the profile as its next revision, dropping
+// the oldest beyond maxProfileRevisions. It sets profile.Revision.
+func (vm *VPNManager) recordProfileRevision(profile *VPNProfile, reason string, changes []ProfileFieldChange) error {
+	revisions, err := vm.GetProfileRevisions(profile.ID)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(revisions) > 0 {
+		next = revisions[len(revisions)-1].Revision + 1
+	}
+	profile.Revision = next
+
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		names = append(names, change.Field)
+	}
+	revisions = append(revisions, ProfileRevision{
+		Revision:  next,
+		CreatedAt: time.Now(),
+		Reason:    reason,
+		Changes:   names,
+		Profile:   *profile,
+	})
+	if len(revisions) > maxProfileRevisions {
+		revisions = revisions[len(revisions)-maxProfileRevisions:]
+	}
+	return vm.saveProfileRevisions(profile.ID, revisions)
+}
+
+// ensureBaselineRevision records a profile saved before revisions existed
+// as its first revision
+func (vm *VPNManager) ensureBaselineRevision(profile *VPNProfile) error {
+	revisions, err := vm.GetProfileRevisions(profile.ID)
+	if err != nil || len(revisions) > 0 {
+		return err
+	}
+	return vm.recordProfileRevision(profile, "baseline", nil)
+}
+
+// UpdateProfile applies a JSON edit to a profile. Fields present in the
+// patch replace the current values; manager-maintained fields are rejected,
+// as are new host directives unless the edit is privileged.
+func (vm *VPNManager) UpdateProfile(profileID string, patch []byte, privileged bool) (*ProfileUpdateResult, error) {
+	vm.updateMutex.Lock()
+	defer vm.updateMutex.Unlock()
+
+	current, exists := vm.GetProfile(profileID)
+	if !exists {
+		return nil, errProfileNotFound
+	}
+
+	var present map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &present); err != nil {
+		return nil, fmt.Errorf("invalid profile update: %v", err)
+	}
+	for field := range present {
+		if profileMetadataFields[field] {
+			return nil, fmt.Errorf("field %s cannot be changed", field)
+		}
+	}
+
+	updated, err := cloneProfile(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy profile: %v", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(updated); err != nil {
+		return nil, fmt.Errorf("invalid profile update: %v", err)
+	}
+	keepRedactedSecrets(updated, current)
+	if !privileged {
+		if err := vm.checkHostDirectives(updated, current); err != nil {
+			return nil, err
+		}
+	}
+
+	return vm.commitProfileUpdate(current, updated, "edit")
+}
+
+// RollbackProfile makes a previous revision current again, as a new revision.
+// Like an edit, it may only bring back host directives when privileged.
+func (vm *VPNManager) RollbackProfile(profileID string, revision int, privileged bool) (*ProfileUpdateResult, error) {
+	vm.updateMutex.Lock()
+	defer vm.updateMutex.Unlock()
+
+	current, exists := vm.GetProfile(profileID)
+	if !exists {
+		return nil, errProfileNotFound
+	}
+	target, err := vm.GetProfileRevision(profileID, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	restored, err := cloneProfile(&target.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy revision: %v", err)
+	}
+	if !privileged {
+		if err := vm.checkHostDirectives(restored, current); err != nil {
+			return nil, err
+		}
+	}
+	return vm.commitProfileUpdate(current, restored, fmt.Sprintf("rollback to %d", revision))
+}
+
+// ProfileUpdateError carries the validation report of a rejected update
+type ProfileUpdateError struct {
+	Report *ProfileValidationReport
+}
+
+func (e *ProfileUpdateError) Error() string {
+	return fmt.Sprintf("profile update failed validation: %s", e.Report.firstError())
+}
+
+// commitProfileUpdate validates and saves an edited profile as a new
+// revision, then reconnects if the profile is in use and the change affects
+// the tunnel. DNS failures are recorded but do not block an update.
+// (requires updateMutex)
+func (vm *VPNManager) commitProfileUpdate(current, updated *VPNProfile, reason string) (*ProfileUpdateResult, error) {
+	// Identity and history stay with the current profile
+	updated.ID = current.ID
+	updated.Filename = current.Filename
+	updated.CreatedAt = current.CreatedAt
+	updated.ContentHash = current.ContentHash
+	updated.Active = current.Active
+
+	changes := diffProfiles(current, updated)
+	if len(changes) == 0 {
+		return &ProfileUpdateResult{Profile: current, Revision: current.Revision, Changes: changes}, nil
+	}
+
+	report := checkProfileValidation(updated, time.Now())
+	for _, f := range report.Findings {
+		if f.Severity == severityError && f.Check != "dns" {
+			return nil, &ProfileUpdateError{Report: report}
+		}
+	}
+	updated.Validated = report.Valid
+	updated.ValidationError = report.firstError()
+	updated.LastModified = time.Now()
+
+	if err := vm.ensureBaselineRevision(current); err != nil {
+		return nil, err
+	}
+	if err := vm.recordProfileRevision(updated, reason, changes); err != nil {
+		return nil, err
+	}
+	if err := vm.SaveProfile(updated); err != nil {
+		return nil, err
+	}
+
+	result := &ProfileUpdateResult{
+		Profile:    updated,
+		Revision:   updated.Revision,
+		Changes:    changes,
+		Validation: report,
+	}
+	reconnected, err := vm.connectionManager.applyProfileUpdate(updated, affectsConnection(changes))
+	if err != nil {
+		log.Printf("Warning: failed to reconnect updated profile %s: %v", updated.Name, err)
+	}
+	result.Reconnected = reconnected
+	log.Printf("Profile %s updated to revision %d (%s)", updated.Name, updated.Revision, reason)
+	return result, nil
+}
+
+// applyProfileUpdate points an active connection at the updated profile,
+// restarting the tunnel when the change affects it. It reports whether a
+// reconnect was made.
+func (cm *VPNConnectionManager) applyProfileUpdate(profile *VPNProfile, reconnect bool) (bool, error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if cm.activeConn == nil || cm.activeConn.Profile.ID != profile.ID {
+		return false, nil
+	}
+	if !reconnect {
+		cm.activeConn.Profile = profile
+		cm.saveConnectionState()
+		return false, nil
+	}
+
+	log.Printf("Reconnecting profile %s to apply changes", profile.Name)
+	if err := cm.disconnectInternalReason(disconnectReasonProfileUpdated); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return true, cm.connectInternal(profile.ID)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newRevisionTest imports an Office profile at revision 1 with a tun-mtu directive
+func newRevisionTest(t *testing.T) (*VPNManager, string) {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	vm.connectionManager.startProcess = func(*VPNConnection) error { return nil }
+	t.Cleanup(vm.connectionManager.Stop)
+	result, err := vm.ImportProfileContent([]byte("client\ndev tun\nremote 127.0.0.1 1194\ncipher AES-256-GCM\ntun-mtu 1400\n"), ProfileImportOptions{Name: "Office"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if result.Profile.Revision != 1 {
+		t.Errorf("imported revision = %d", result.Profile.Revision)
+	}
+	return vm, result.Profile.ID
+}
+
+func patchProfile(vm *VPNManager, id, body string) (*httptest.ResponseRecorder, ProfileUpdateResult) {
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest("PATCH", "/api/vpn/profiles/"+id, strings.NewReader(body)))
+	var update ProfileUpdateResult
+	json.Unmarshal(rec.Body.Bytes(), &update)
+	return rec, update
+}
+
+const (
+	cosmeticPatch   = `{"priority": 1, "name": "Head Office"}`
+	connectionPatch = `{"remote": [{"host": "127.0.0.2", "port": 443}], "custom_directives": [{"name": "mssfix", "args": ["1400"]}]}`
+)
+
+// seedRevisions applies a cosmetic edit (revision 2) and a connection edit
+// (revision 3)
+func seedRevisions(t *testing.T, vm *VPNManager, id string) {
+	t.Helper()
+	for _, body := range []string{cosmeticPatch, connectionPatch} {
+		if rec, _ := patchProfile(vm, id, body); rec.Code != http.StatusOK {
+			t.Fatalf("patch %s = %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// A connected tunnel survives cosmetic edits
+func TestUpdateProfile_CosmeticEditKeepsConnection(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	cm := vm.connectionManager
+	conn := &VPNConnection{Profile: vm.profiles[id], State: "connected", StartedAt: time.Now()}
+	cm.mutex.Lock()
+	cm.activeConn = conn
+	cm.mutex.Unlock()
+
+	rec, update := patchProfile(vm, id, cosmeticPatch)
+	if rec.Code != http.StatusOK || update.Revision != 2 || update.Reconnected || len(update.Changes) != 2 {
+		t.Fatalf("cosmetic patch = %d %+v", rec.Code, update)
+	}
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	if cm.activeConn != conn || conn.Profile.Name != "Head Office" {
+		t.Errorf("active connection after cosmetic edit = %+v", cm.activeConn)
+	}
+}
+
+// Remotes and directives reconnect; the directive list is replaced, not merged
+func TestUpdateProfile_ConnectionEditReconnects(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	cm := vm.connectionManager
+	cm.mutex.Lock()
+	cm.activeConn = &VPNConnection{Profile: vm.profiles[id], State: "connected", StartedAt: time.Now()}
+	cm.mutex.Unlock()
+
+	rec, update := patchProfile(vm, id, connectionPatch)
+	if rec.Code != http.StatusOK || update.Revision != 2 || !update.Reconnected {
+		t.Fatalf("connection patch = %d %+v", rec.Code, update)
+	}
+	if profile := vm.profiles[id]; len(profile.CustomDirectives) != 1 || profile.CustomDirectives[0].String() != "mssfix 1400" || profile.Remote[0].Host != "127.0.0.2" {
+		t.Errorf("patched profile = %+v", profile)
+	}
+	history := cm.GetConnectionHistory()
+	if len(history) == 0 || history[0].DisconnectReason != disconnectReasonProfileUpdated {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+// Rejected edits leave the profile alone
+func TestUpdateProfile_RejectedEdits(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{"device": "bogus"}`, http.StatusUnprocessableEntity},
+		{`{"id": "other"}`, http.StatusBadRequest},
+		{`{"colour": "red"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if rec, _ := patchProfile(vm, id, tc.body); rec.Code != tc.want {
+			t.Errorf("patch %s = %d, want %d", tc.body, rec.Code, tc.want)
+		}
+	}
+	if vm.profiles[id].Revision != 1 || vm.profiles[id].Device != "tun" {
+		t.Errorf("profile changed by rejected edits: %+v", vm.profiles[id])
+	}
+}
+
+func TestProfileDiff(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	seedRevisions(t, vm, id)
+
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest("GET", "/api/vpn/profiles/"+id+"/diff?from=1", nil))
+	var diff struct {
+		Changes           []ProfileFieldChange `json:"changes"`
+		AffectsConnection bool                 `json:"affects_connection"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &diff)
+	fields := make([]string, 0)
+	for _, c := range diff.Changes {
+		fields = append(fields, c.Field)
+	}
+	if strings.Join(fields, ",") != "custom_directives,name,priority,remote" || !diff.AffectsConnection {
+		t.Errorf("diff 1..3 = %d %+v", rec.Code, diff)
+	}
+}
+
+func TestRollbackProfile(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	seedRevisions(t, vm, id)
+
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/vpn/profiles/"+id+"/rollback", strings.NewReader(`{"revision": 1}`)))
+	var update ProfileUpdateResult
+	json.Unmarshal(rec.Body.Bytes(), &update)
+	profile := vm.profiles[id]
+	if rec.Code != http.StatusOK || update.Revision != 4 || profile.Name != "Office" || profile.Remote[0].Host != "127.0.0.1" || profile.CustomDirectives[0].String() != "tun-mtu 1400" {
+		t.Errorf("rollback = %d %+v, profile %+v", rec.Code, update, profile)
+	}
+	revisions, _ := vm.GetProfileRevisions(id)
+	if len(revisions) != 4 || revisions[3].Reason != "rollback to 1" {
+		t.Errorf("revisions = %+v", revisions)
+	}
+}
+
+// Revisions survive a restart with the profile
+func TestProfileRevisions_SurviveRestart(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	seedRevisions(t, vm, id)
+
+	reloaded := NewVPNManager(vm.profilesPath, vm.statePath)
+	reloaded.LoadProfiles()
+	if rev, err := reloaded.GetProfileRevision(id, 2); err != nil || rev.Profile.Name != "Head Office" || reloaded.profiles[id].Revision != 3 {
+		t.Errorf("reloaded revision 2 = %+v, %v", rev, err)
+	}
+}
+
+// Concurrent edits each get their own revision, none overwriting another
+func TestUpdateProfile_ConcurrentEdits(t *testing.T) {
+	vm, id := newRevisionTest(t)
+	const edits = 10
+
+	var wg sync.WaitGroup
+	results := make(chan int, edits)
+	for i := 1; i <= edits; i++ {
+		wg.Add(1)
+		go func(priority int) {
+			defer wg.Done()
+			rec, update := patchProfile(vm, id, fmt.Sprintf(`{"priority": %d}`, priority))
+			if rec.Code != http.StatusOK {
+				t.Errorf("patch priority %d = %d: %s", priority, rec.Code, rec.Body.String())
+			}
+			results <- update.Revision
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	seen := make(map[int]bool)
+	for revision := range results {
+		if seen[revision] {
+			t.Errorf("revision %d returned twice", revision)
+		}
+		seen[revision] = true
+	}
+	revisions, err := vm.GetProfileRevisions(id)
+	if err != nil || len(revisions) != edits+1 {
+		t.Fatalf("revisions = %d, %v, want %d", len(revisions), err, edits+1)
+	}
+	profile, _ := vm.GetProfile(id)
+	last := revisions[len(revisions)-1]
+	if profile.Revision != edits+1 || last.Revision != edits+1 || last.Profile.Priority != profile.Priority {
+		t.Errorf("profile at revision %d priority %d, last revision %d priority %d", profile.Revision, profile.Priority, last.Revision, last.Profile.Priority)
+	}
+}
+
+func TestProfileUpdate_HostDirectivesNeedAPIKey(t *testing.T) {
+	t.Setenv("NOC_RAVEN_API_KEY", "edit-key")
+	vm := newTestVPNManager(t)
+	router := vm.setupRoutes()
+	ovpn := "client\ndev tun\nproto udp\nremote 127.0.0.1 1194\nup /etc/openvpn/up.sh\n"
+	imported, err := vm.ImportProfileContent([]byte(ovpn), ProfileImportOptions{Name: "Office", Privileged: true})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	id := imported.Profile.ID
+
+	send := func(method, path, body, apiKey string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	up := `{"name":"up","args":["/etc/openvpn/up.sh"]}`
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		apiKey string
+		want   int
+	}{
+		{"rename keeps existing script", "PATCH", "", `{"name":"Head Office"}`, "", http.StatusOK},
+		{"add down script", "PATCH", "", `{"custom_directives":[` + up + `,{"name":"down","args":["/tmp/x.sh"]}]}`, "", http.StatusForbidden},
+		{"change script path", "PATCH", "", `{"custom_directives":[{"name":"up","args":["/tmp/x.sh"]}]}`, "", http.StatusForbidden},
+		{"add plugin", "PATCH", "", `{"custom_directives":[` + up + `,{"name":"plugin","args":["/tmp/x.so"]}]}`, "", http.StatusForbidden},
+		{"auth-user-pass file", "PATCH", "", `{"auth_user_pass":"/etc/shadow"}`, "", http.StatusForbidden},
+		{"script in cipher", "PATCH", "", `{"cipher":"AES-256-GCM\nup /tmp/x.sh"}`, "", http.StatusForbidden},
+		{"script in name", "PATCH", "", `{"name":"Office\nup /tmp/x.sh"}`, "", http.StatusForbidden},
+		{"plugin after ca block", "PATCH", "", `{"ca":"x\n</ca>\nplugin /tmp/x.so\n<ca>\nx"}`, "", http.StatusForbidden},
+		{"script in directive args", "PATCH", "", `{"custom_directives":[` + up + `,{"name":"setenv","args":["A","1\ndown /tmp/x.sh"]}]}`, "", http.StatusForbidden},
+		{"remove script", "PATCH", "", `{"custom_directives":[]}`, "", http.StatusOK},
+		{"rollback restores script", "POST", "/rollback", `{"revision":1}`, "", http.StatusForbidden},
+		{"privileged rollback", "POST", "/rollback", `{"revision":1}`, "edit-key", http.StatusOK},
+		{"privileged plugin", "PATCH", "", `{"custom_directives":[{"name":"plugin","args":["/tmp/x.so"]}]}`, "edit-key", http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := send(tc.method, "/api/vpn/profiles/"+id+tc.path, tc.body, tc.apiKey); got != tc.want {
+			t.Errorf("%s = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+	profile, _ := vm.GetProfile(id)
+	if fmt.Sprint(profile.CustomDirectives) != "[plugin /tmp/x.so]" || profile.AuthUserPass != "" {
+		t.Errorf("custom directives = %v, auth-user-pass = %q", profile.CustomDirectives, profile.AuthUserPass)
+	}
+}
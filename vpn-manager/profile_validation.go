@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Validation finding severities
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// certificateExpiryWarning is how far ahead an expiring certificate is flagged
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// weakCiphers are data channel ciphers OpenVPN 2.6 no longer accepts by default
+var weakCiphers = map[string]bool{
+	"BF-CBC":       true,
+	"DES-CBC":      true,
+	"DES-EDE-CBC":  true,
+	"DES-EDE3-CBC": true,
+	"RC2-CBC":      true,
+	"CAST5-CBC":    true,
+}
+
+// ValidationFinding is one result of validating a profile
+type ValidationFinding struct {
+	Check    string `json:"check"`    // remote, dns, certificate_chain, certificate_expiry, key_type, protocol, device, cipher, control_channel
+	Severity string `json:"severity"` // error, warning or info
+	Message  string `json:"message"`
+}
+
+// ProfileValidationReport lists every finding for a profile; it is valid
+// when no finding is an error
+type ProfileValidationReport struct {
+	ProfileID string              `json:"profile_id"`
+	CheckedAt time.Time           `json:"checked_at"`
+	Valid     bool                `json:"valid"`
+	Errors    int                 `json:"errors"`
+	Warnings  int                 `json:"warnings"`
+	Findings  []ValidationFinding `json:"findings"`
+}
+
+func (r *ProfileValidationReport) add(check, severity, format string, args ...interface{}) {
+	r.Findings = append(r.Findings, ValidationFinding{Check: check, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	switch severity {
+	case severityError:
+		r.Errors++
+	case severityWarning:
+		r.Warnings++
+	}
+}
+
+// firstError returns the first error finding's message
+func (r *ProfileValidationReport) firstError() string {
+	for _, f := range r.Findings {
+		if f.Severity == severityError {
+			return f.Message
+		}
+	}
+	return ""
+}
+
+// ValidateProfileReport re-validates a profile, records the outcome on it
+// and returns every finding
+func (vm *VPNManager) ValidateProfileReport(profileID string) (*ProfileValidationReport, error) {
+	profile, exists := vm.GetProfile(profileID)
+	if !exists {
+		return nil, fmt.Errorf("profile not found: %s", profileID)
+	}
+
+	report := checkProfileValidation(profile, time.Now())
+	profile.Validated = report.Valid
+	profile.ValidationError = report.firstError()
+	if err := vm.SaveProfile(profile); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// checkProfileValidation runs every validation check against a profile
+func checkProfileValidation(profile *VPNProfile, now time.Time) *ProfileValidationReport {
+	report := &ProfileValidationReport{
+		ProfileID: profile.ID,
+		CheckedAt: now,
+		Findings:  make([]ValidationFinding, 0),
+	}
+
+	validateRemotes(report, profile)
+	validateTransport(report, profile)
+	validateControlChannelKeys(report, profile)
+	certs := validateCertificates(report, profile, now)
+	validatePrivateKeyType(report, profile, certs)
+
+	report.Valid = report.Errors == 0
+	return report
+}
+
+// validateRemotes checks each remote is well formed and its host resolves.
+// An unresolvable host is only an error when no other remote resolves.
+func validateRemotes(report *ProfileValidationReport, profile *VPNProfile) {
+	if len(profile.Remote) == 0 {
+		report.add("remote", severityError, "no remote servers configured")
+		return
+	}
+
+	unresolved := make([]string, 0)
+	resolved := 0
+	for i, remote := range profile.Remote {
+		if remote.Host == "" {
+			report.add("remote", severityError, "remote server %d: empty host", i+1)
+			continue
+		}
+		if remote.Port <= 0 || remote.Port > 65535 {
+			report.add("remote", severityError, "remote server %d: invalid port %d", i+1, remote.Port)
+		}
+		if net.ParseIP(remote.Host) != nil {
+			resolved++
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(ctx, remote.Host)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			unresolved = append(unresolved, fmt.Sprintf("%s: %v", remote.Host, err))
+			continue
+		}
+		resolved++
+		report.add("dns", severityInfo, "%s resolves to %s", remote.Host, strings.Join(addrs, ", "))
+	}
+
+	severity := severityWarning
+	if resolved == 0 {
+		severity = severityError
+	}
+	for _, msg := range unresolved {
+		report.add("dns", severity, "failed to resolve %s", msg)
+	}
+}
+
+// validateTransport checks the protocol, device and data channel cipher
+func validateTransport(report *ProfileValidationReport, profile *VPNProfile) {
+	if !validOpenVPNProtocol(profile.Protocol) {
+		report.add("protocol", severityError, "invalid protocol: %s", profile.Protocol)
+	}
+	for _, remote := range profile.Remote {
+		if remote.Protocol != "" && !validOpenVPNProtocol(remote.Protocol) {
+			report.add("protocol", severityError, "remote %s: invalid protocol %s", remote.Host, remote.Protocol)
+		}
+	}
+
+	switch profile.Device {
+	case "tun", "tap":
+	default:
+		report.add("device", severityError, "invalid device type: %s", profile.Device)
+	}
+
+	if weakCiphers[strings.ToUpper(profile.CipherMode)] {
+		report.add("cipher", severityWarning, "cipher %s is deprecated and rejected by OpenVPN 2.6 unless listed in data-ciphers", profile.CipherMode)
+	}
+	for _, cipher := range strings.Split(profile.DataCiphers, ":") {
+		if weakCiphers[strings.ToUpper(cipher)] {
+			report.add("cipher", severityWarning, "data-ciphers lists deprecated cipher %s", cipher)
+		}
+	}
+}
+
+// validateControlChannelKeys checks inline tls-auth and tls-crypt keys are in
+// the format OpenVPN expects
+func validateControlChannelKeys(report *ProfileValidationReport, profile *VPNProfile) {
+	for _, key := range []struct {
+		name, content, header string
+	}{
+		{"tls-auth", profile.TLSAuth, "-----BEGIN OpenVPN Static key V1-----"},
+		{"tls-crypt", profile.TLSCrypt, "-----BEGIN OpenVPN Static key V1-----"},
+		{"tls-crypt-v2", profile.TLSCryptV2, "-----BEGIN OpenVPN tls-crypt-v2 client key-----"},
+	} {
+		if key.content != "" && !strings.Contains(key.content, key.header) {
+			report.add("control_channel", severityError, "%s key is not an OpenVPN key (missing %s)", key.name, key.header)
+		}
+	}
+	if profile.TLSAuth != "" && profile.KeyDirection == "" {
+		report.add("control_channel", severityInfo, "tls-auth key has no key-direction; it is used bidirectionally")
+	}
+}
+
+// parsePEMCertificates decodes every certificate in a PEM bundle
+func parsePEMCertificates(bundle string) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0)
+	rest := []byte(bundle)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return certs, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// validateCertificates checks expiry of every certificate and that the client
+// certificate chains to the CA. It returns the client chain, leaf first.
+func validateCertificates(report *ProfileValidationReport, profile *VPNProfile, now time.Time) []*x509.Certificate {
+	var cas, chain []*x509.Certificate
+	var err error
+
+	if profile.CA == "" {
+		report.add("certificate_chain", severityWarning, "no inline CA certificate; the server certificate cannot be verified from this profile")
+	} else if cas, err = parsePEMCertificates(profile.CA); err != nil {
+		report.add("certificate_chain", severityError, "CA certificate: %v", err)
+		cas = nil
+	}
+	if profile.Certificate == "" {
+		if profile.AuthUserPass == "" {
+			report.add("certificate_chain", severityWarning, "no client certificate or auth-user-pass; the server must allow anonymous clients")
+		}
+	} else if chain, err = parsePEMCertificates(profile.Certificate); err != nil {
+		report.add("certificate_chain", severityError, "client certificate: %v", err)
+		chain = nil
+	}
+
+	for _, group := range []struct {
+		name  string
+		certs []*x509.Certificate
+	}{{"CA", cas}, {"client", chain}} {
+		for _, cert := range group.certs {
+			name := cert.Subject.CommonName
+			switch {
+			case now.After(cert.NotAfter):
+				report.add("certificate_expiry", severityError, "%s certificate %q expired on %s", group.name, name, cert.NotAfter.Format(time.RFC3339))
+			case now.Before(cert.NotBefore):
+				report.add("certificate_expiry", severityError, "%s certificate %q is not valid until %s", group.name, name, cert.NotBefore.Format(time.RFC3339))
+			case cert.NotAfter.Sub(now) < certificateExpiryWarning:
+				report.add("certificate_expiry", severityWarning, "%s certificate %q expires in %d days", group.name, name, int(cert.NotAfter.Sub(now).Hours()/24))
+			default:
+				report.add("certificate_expiry", severityInfo, "%s certificate %q valid until %s", group.name, name, cert.NotAfter.Format(time.RFC3339))
+			}
+		}
+	}
+
+	if len(cas) > 0 && len(chain) > 0 {
+		roots := x509.NewCertPool()
+		for _, ca := range cas {
+			roots.AddCert(ca)
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := chain[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			report.add("certificate_chain", severityError, "client certificate does not chain to the CA: %v", err)
+		} else {
+			report.add("certificate_chain", severityInfo, "client certificate %q chains to the CA", chain[0].Subject.CommonName)
+		}
+	}
+	if len(chain) > 0 && chain[0].KeyUsage != 0 && chain[0].KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		report.add("certificate_chain", severityWarning, "client certificate lacks the digital signature key usage")
+	}
+	return chain
+}
+
+// validatePrivateKeyType checks the private key parses, is strong enough and
+// belongs to the client certificate
+func validatePrivateKeyType(report *ProfileValidationReport, profile *VPNProfile, chain []*x509.Certificate) {
+	if profile.PrivateKey == "" {
+		if len(chain) > 0 {
+			report.add("key_type", severityError, "client certificate present without a private key")
+		}
+		return
+	}
+
+	block, _ := pem.Decode([]byte(profile.PrivateKey))
+	if block == nil {
+		report.add("key_type", severityError, "failed to decode PEM private key")
+		return
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" || block.Headers["Proc-Type"] != "" {
+		report.add("key_type", severityWarning, "private key is passphrase protected; OpenVPN will ask for it when connecting")
+		return
+	}
+
+	var key crypto.PrivateKey
+	var err error
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				report.add("key_type", severityError, "unsupported private key format")
+				return
+			}
+		}
+	}
+
+	var public crypto.PublicKey
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		bits := k.N.BitLen()
+		switch {
+		case bits < 1024:
+			report.add("key_type", severityError, "RSA key of %d bits is too weak", bits)
+		case bits < 2048:
+			report.add("key_type", severityWarning, "RSA key of %d bits is below the recommended 2048", bits)
+		default:
+			report.add("key_type", severityInfo, "RSA %d-bit key", bits)
+		}
+		public = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		report.add("key_type", severityInfo, "ECDSA %s key", k.Curve.Params().Name)
+		public = &k.PublicKey
+	case ed25519.PrivateKey:
+		report.add("key_type", severityInfo, "Ed25519 key")
+		public = k.Public()
+	default:
+		report.add("key_type", severityError, "unsupported private key type %T", key)
+		return
+	}
+
+	if len(chain) > 0 {
+		if matcher, ok := public.(interface{ Equal(crypto.PublicKey) bool }); ok && !matcher.Equal(chain[0].PublicKey) {
+			report.add("key_type", severityError, "private key does not match the client certificate")
+		}
+	}
+}
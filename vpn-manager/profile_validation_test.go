@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClientPKI returns a CA certificate and a client certificate and key it
+// issued, all PEM encoded
+func testClientPKI(t *testing.T, clientNotAfter time.Time) (caPEM, certPEM, keyPEM string) {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     clientNotAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create client certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+// newValidationTest saves an office profile with a valid client PKI, one
+// unresolvable remote, a weak cipher and an auth file; it returns the
+// profile and its private key
+func newValidationTest(t *testing.T) (*VPNManager, *VPNProfile, string) {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	ca, cert, key := testClientPKI(t, time.Now().Add(10*24*time.Hour))
+	profile := &VPNProfile{
+		ID: "office", Name: "Office", Protocol: "udp", Device: "tun", Verb: 3,
+		Remote:       []VPNRemote{{Host: "127.0.0.1", Port: 1194}, {Host: "vpn.invalid", Port: 1194}},
+		CA:           ca,
+		Certificate:  cert,
+		PrivateKey:   key,
+		CipherMode:   "BF-CBC",
+		AuthUserPass: filepath.Join(t.TempDir(), "office.auth"),
+	}
+	vm.SaveProfile(profile)
+	return vm, profile, key
+}
+
+func validateOffice(t *testing.T, vm *VPNManager) ProfileValidationReport {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/vpn/profiles/office/validate", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("validate = %d: %s", rec.Code, rec.Body.String())
+	}
+	var report ProfileValidationReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	return report
+}
+
+func hasFinding(report ProfileValidationReport, check, severity, text string) bool {
+	for _, f := range report.Findings {
+		if f.Check == check && f.Severity == severity && strings.Contains(f.Message, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateProfile_Findings(t *testing.T) {
+	vm, profile, _ := newValidationTest(t)
+	report := validateOffice(t, vm)
+	if !report.Valid || report.Errors != 0 || !profile.Validated {
+		t.Errorf("report = %+v", report)
+	}
+	for _, want := range []struct{ check, severity, text string }{
+		{"dns", severityWarning, "vpn.invalid"},
+		{"certificate_expiry", severityWarning, `"test-client" expires in`},
+		{"certificate_expiry", severityInfo, `"test-ca" valid until`},
+		{"certificate_chain", severityInfo, "chains to the CA"},
+		{"key_type", severityInfo, "ECDSA P-256"},
+		{"cipher", severityWarning, "BF-CBC"},
+	} {
+		if !hasFinding(report, want.check, want.severity, want.text) {
+			t.Errorf("missing %s %s finding %q in %+v", want.severity, want.check, want.text, report.Findings)
+		}
+	}
+}
+
+// A certificate from another CA with someone else's key fails twice over
+func TestValidateProfile_MismatchedPKI(t *testing.T) {
+	vm, profile, _ := newValidationTest(t)
+	otherCA, _, otherKey := testClientPKI(t, time.Now().Add(time.Hour))
+	profile.CA, profile.PrivateKey, profile.Device = otherCA, otherKey, "tunnel"
+
+	report := validateOffice(t, vm)
+	if report.Valid || profile.Validated || profile.ValidationError == "" {
+		t.Errorf("mismatched profile reported valid: %+v", report)
+	}
+	for _, want := range []struct{ check, text string }{
+		{"certificate_chain", "does not chain"},
+		{"key_type", "does not match"},
+		{"device", "tunnel"},
+	} {
+		if !hasFinding(report, want.check, severityError, want.text) {
+			t.Errorf("missing %s error %q in %+v", want.check, want.text, report.Findings)
+		}
+	}
+}
+
+func exportOffice(vm *VPNManager, query, apiKey string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/vpn/profiles/office/export"+query, nil)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	vm.setupRoutes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExportProfile_RedactedByDefault(t *testing.T) {
+	vm, profile, _ := newValidationTest(t)
+	for _, query := range []string{"", "?redact=true"} {
+		rec := exportOffice(vm, query, "")
+		body := rec.Body.String()
+		if rec.Code != http.StatusOK || strings.Contains(body, "PRIVATE KEY") || strings.Contains(body, profile.AuthUserPass) ||
+			!strings.Contains(body, "# Redacted: key, auth-user-pass") || !strings.Contains(body, "auth-user-pass\n") || !strings.Contains(body, "<cert>") ||
+			!strings.Contains(rec.Header().Get("Content-Disposition"), `filename="Office.ovpn"`) {
+			t.Errorf("export%s = %d %v:\n%s", query, rec.Code, rec.Header(), body)
+		}
+	}
+}
+
+// Secrets only leave with the API key, which must be configured
+func TestExportProfile_UnredactedNeedsAPIKey(t *testing.T) {
+	cases := []struct {
+		name       string
+		configured string
+		query      string
+		apiKey     string
+		want       int
+	}{
+		{"unconfigured", "", "?redact=false", "", http.StatusForbidden},
+		{"unconfigured with a key", "", "?redact=false", "admin-key", http.StatusForbidden},
+		{"wrong key", "admin-key", "?redact=false", "wrong", http.StatusForbidden},
+		{"invalid redact", "", "?redact=maybe", "", http.StatusBadRequest},
+		{"api key", "admin-key", "?redact=false", "admin-key", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NOC_RAVEN_API_KEY", tc.configured)
+			vm, profile, key := newValidationTest(t)
+			rec := exportOffice(vm, tc.query, tc.apiKey)
+			if rec.Code != tc.want {
+				t.Fatalf("export = %d, want %d: %s", rec.Code, tc.want, rec.Body.String())
+			}
+			if tc.want == http.StatusOK && (!strings.Contains(rec.Body.String(), "<key>") || strings.Contains(rec.Body.String(), "# Redacted")) {
+				t.Errorf("privileged export:\n%s", rec.Body.String())
+			}
+			if profile.PrivateKey != key {
+				t.Error("export modified the stored profile")
+			}
+		})
+	}
+}
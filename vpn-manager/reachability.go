@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reachability check protocols; icmp reuses the latency prober
+const (
+	checkTCP   = "tcp"
+	checkUDP   = "udp"
+	checkHTTP  = "http"
+	checkHTTPS = "https"
+	checkDNS   = "dns"
+	checkICMP  = "icmp"
+)
+
+const defaultCheckTimeout = 3 * time.Second
+
+// ReachabilityCheck is a named service behind the tunnel that must answer
+type ReachabilityCheck struct {
+	Name          string `json:"name"`
+	Address       string `json:"address"` // host:port; host only for icmp
+	Protocol      string `json:"protocol"`
+	Path          string `json:"path,omitempty"`            // http(s) request path
+	ExpectStatus  int    `json:"expect_status,omitempty"`   // http(s); any status below 400 when unset
+	TLSSkipVerify bool   `json:"tls_skip_verify,omitempty"` // https with private certificates
+	Query         string `json:"query,omitempty"`           // dns name to resolve via the server at Address
+	ExpectAnswer  string `json:"expect_answer,omitempty"`   // dns; an address the answer must contain
+	Required      bool   `json:"required"`                  // tunnel is not healthy while this fails
+	TimeoutMs     int    `json:"timeout_ms,omitempty"`
+}
+
+// Validate checks a reachability check is complete for its protocol
+func (c ReachabilityCheck) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if c.Address == "" {
+		return fmt.Errorf("check %s: address is required", c.Name)
+	}
+	switch c.Protocol {
+	case checkICMP:
+	case checkTCP, checkUDP, checkHTTP, checkHTTPS, checkDNS:
+		if _, _, err := net.SplitHostPort(c.checkAddress()); err != nil {
+			return fmt.Errorf("check %s: address must be host:port", c.Name)
+		}
+	default:
+		return fmt.Errorf("check %s: invalid protocol %q", c.Name, c.Protocol)
+	}
+	if c.Protocol == checkDNS && c.Query == "" {
+		return fmt.Errorf("check %s: query is required for dns checks", c.Name)
+	}
+	if c.ExpectAnswer != "" && net.ParseIP(c.ExpectAnswer) == nil {
+		return fmt.Errorf("check %s: expect_answer must be an IP address", c.Name)
+	}
+	if c.ExpectStatus != 0 && (c.ExpectStatus < 100 || c.ExpectStatus > 599) {
+		return fmt.Errorf("check %s: invalid expect_status %d", c.Name, c.ExpectStatus)
+	}
+	if c.TimeoutMs < 0 || c.TimeoutMs > 10000 {
+		return fmt.Errorf("check %s: timeout_ms must be at most 10000", c.Name)
+	}
+	return nil
+}
+
+// checkAddress fills in the default port for http, https and dns
+func (c ReachabilityCheck) checkAddress() string {
+	if _, _, err := net.SplitHostPort(c.Address); err == nil {
+		return c.Address
+	}
+	switch c.Protocol {
+	case checkHTTP:
+		return net.JoinHostPort(c.Address, "80")
+	case checkHTTPS:
+		return net.JoinHostPort(c.Address, "443")
+	case checkDNS:
+		return net.JoinHostPort(c.Address, "53")
+	}
+	return c.Address
+}
+
+func (c ReachabilityCheck) timeout() time.Duration {
+	if c.TimeoutMs > 0 {
+		return time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	return defaultCheckTimeout
+}
+
+// ReachabilityResult is the outcome of one check in a health snapshot
+type ReachabilityResult struct {
+	Name      string   `json:"name"`
+	Protocol  string   `json:"protocol"`
+	Address   string   `json:"address"`
+	Required  bool     `json:"required"`
+	Reachable bool     `json:"reachable"`
+	LatencyMs float64  `json:"latency_ms"`
+	Status    int      `json:"status,omitempty"`  // http(s)
+	Answers   []string `json:"answers,omitempty"` // dns
+	Error     string   `json:"error,omitempty"`
+}
+
+// runReachabilityCheck performs one check
+func runReachabilityCheck(c ReachabilityCheck) ReachabilityResult {
+	result := ReachabilityResult{
+		Name:     c.Name,
+		Protocol: c.Protocol,
+		Address:  c.checkAddress(),
+		Required: c.Required,
+	}
+
+	start := time.Now()
+	var err error
+	switch c.Protocol {
+	case checkTCP:
+		err = checkTCPConnect(result.Address, c.timeout())
+	case checkUDP:
+		err = checkUDPReply(result.Address, c.timeout())
+	case checkHTTP, checkHTTPS:
+		result.Status, err = checkHTTPStatus(c, result.Address)
+	case checkDNS:
+		result.Answers, err = checkDNSAnswer(c, result.Address)
+	case checkICMP:
+		timeout := c.timeout()
+		// No TCP fallback: an icmp check passes only on an echo reply
+		probe := runProbe(ProbeTarget{Name: c.Name, Host: c.Address, Protocol: probeICMP}, 1, timeout, timeout)
+		if probe.Unreachable {
+			err = errors.New(probe.Error)
+		}
+	default:
+		err = fmt.Errorf("invalid protocol %q", c.Protocol)
+	}
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Reachable = true
+	return result
+}
+
+func checkTCPConnect(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkUDPReply sends a datagram and requires any datagram back; silence and
+// port unreachable both fail
+func checkUDPReply(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte("noc-raven reachability check\n")); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	if _, err := conn.Read(buf); err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Errorf("port unreachable")
+		}
+		return err
+	}
+	return nil
+}
+
+// HTTP checks share these transports. Keep-alives are off so every check
+// opens a fresh connection through the tunnel and none is left idle between
+// intervals.
+var (
+	reachabilityTransport         = &http.Transport{DisableKeepAlives: true}
+	reachabilityInsecureTransport = &http.Transport{DisableKeepAlives: true, TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+)
+
+func checkHTTPStatus(c ReachabilityCheck, address string) (int, error) {
+	transport := reachabilityTransport
+	if c.TLSSkipVerify {
+		transport = reachabilityInsecureTransport
+	}
+	client := &http.Client{
+		Timeout:   c.timeout(),
+		Transport: transport,
+		// Report redirects rather than following them off the tunnel
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	path := c.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	resp, err := client.Get(c.Protocol + "://" + address + path)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if c.ExpectStatus != 0 && resp.StatusCode != c.ExpectStatus {
+		return resp.StatusCode, fmt.Errorf("status %d, expected %d", resp.StatusCode, c.ExpectStatus)
+	}
+	if c.ExpectStatus == 0 && resp.StatusCode >= 400 {
+		return resp.StatusCode, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// checkDNSAnswer resolves the query through the DNS server at address
+func checkDNSAnswer(c ReachabilityCheck, address string) ([]string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout())
+	defer cancel()
+
+	answers, err := resolver.LookupHost(ctx, c.Query)
+	if err != nil {
+		return nil, err
+	}
+	if c.ExpectAnswer != "" {
+		want := net.ParseIP(c.ExpectAnswer)
+		for _, a := range answers {
+			if ip := net.ParseIP(a); ip != nil && ip.Equal(want) {
+				return answers, nil
+			}
+		}
+		return answers, fmt.Errorf("answer %s does not contain %s", strings.Join(answers, ","), c.ExpectAnswer)
+	}
+	return answers, nil
+}
+
+// runReachabilityChecks runs all checks concurrently, returning results in check order
+func runReachabilityChecks(checks []ReachabilityCheck) []ReachabilityResult {
+	results := make([]ReachabilityResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c ReachabilityCheck) {
+			defer wg.Done()
+			results[i] = runReachabilityCheck(c)
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// requiredTargetsDown lists the required checks that failed in a snapshot
+func requiredTargetsDown(results []ReachabilityResult) []string {
+	down := make([]string, 0)
+	for _, r := range results {
+		if r.Required && !r.Reachable {
+			down = append(down, r.Name)
+		}
+	}
+	return down
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveTestDNS answers A queries for any name with ip over UDP
+func serveTestDNS(t *testing.T, ip net.IP) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// Question ends after the name's zero label and 4 bytes of type/class
+			end := 12
+			for end < n && buf[end] != 0 {
+				end += int(buf[end]) + 1
+			}
+			end += 5
+			qtype := binary.BigEndian.Uint16(buf[end-4:])
+			resp := append([]byte{}, buf[:end]...)
+			resp[2], resp[3] = 0x81, 0x80 // response, recursion available
+			if qtype != 1 {
+				binary.BigEndian.PutUint16(resp[6:], 0)
+				pc.WriteTo(resp, addr)
+				continue
+			}
+			binary.BigEndian.PutUint16(resp[6:], 1)
+			resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+			resp = append(resp, ip.To4()...)
+			pc.WriteTo(resp, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestReachabilityChecks_Loopback(t *testing.T) {
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer web.Close()
+	webAddr := strings.TrimPrefix(web.URL, "http://")
+	dns := serveTestDNS(t, net.ParseIP("10.20.0.5"))
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	cases := []struct {
+		check     ReachabilityCheck
+		reachable bool
+		status    int
+		answers   []string
+	}{
+		{ReachabilityCheck{Name: "collector", Address: webAddr, Protocol: checkTCP, Required: true}, true, 0, nil},
+		{ReachabilityCheck{Name: "collector-down", Address: closedAddr, Protocol: checkTCP}, false, 0, nil},
+		{ReachabilityCheck{Name: "api", Address: webAddr, Protocol: checkHTTP, Path: "/health", ExpectStatus: 204}, true, 204, nil},
+		{ReachabilityCheck{Name: "api-wrong-status", Address: webAddr, Protocol: checkHTTP, Path: "/health", ExpectStatus: 200}, false, 204, nil},
+		{ReachabilityCheck{Name: "api-missing", Address: webAddr, Protocol: checkHTTP, Path: "/nope"}, false, 404, nil},
+		{ReachabilityCheck{Name: "dns", Address: dns, Protocol: checkDNS, Query: "collector.noc.internal", ExpectAnswer: "10.20.0.5"}, true, 0, []string{"10.20.0.5"}},
+		{ReachabilityCheck{Name: "dns-wrong-answer", Address: dns, Protocol: checkDNS, Query: "collector.noc.internal", ExpectAnswer: "10.20.0.6"}, false, 0, []string{"10.20.0.5"}},
+	}
+	checks := make([]ReachabilityCheck, len(cases))
+	for i, tc := range cases {
+		if err := tc.check.Validate(); err != nil {
+			t.Fatalf("validate %s: %v", tc.check.Name, err)
+		}
+		checks[i] = tc.check
+	}
+
+	results := runReachabilityChecks(checks)
+	for i, tc := range cases {
+		r := results[i]
+		if r.Name != tc.check.Name {
+			t.Fatalf("result %d is %s, want %s", i, r.Name, tc.check.Name)
+		}
+		if r.Reachable != tc.reachable || r.Status != tc.status || strings.Join(r.Answers, ",") != strings.Join(tc.answers, ",") {
+			t.Errorf("%s = reachable %v, status %d, answers %v (%s)", r.Name, r.Reachable, r.Status, r.Answers, r.Error)
+		}
+	}
+}
+
+func TestReachabilityCheck_Validate(t *testing.T) {
+	cases := []struct {
+		name  string
+		check ReachabilityCheck
+	}{
+		{"tcp without a port", ReachabilityCheck{Name: "x", Address: "10.0.0.1", Protocol: checkTCP}},
+		{"dns without a query", ReachabilityCheck{Name: "x", Address: "10.0.0.1", Protocol: checkDNS}},
+	}
+	for _, tc := range cases {
+		if err := tc.check.Validate(); err == nil {
+			t.Errorf("%s accepted", tc.name)
+		}
+	}
+}
+
+func TestReachabilityChecks_HTTPLeavesNoIdleConnections(t *testing.T) {
+	var mu sync.Mutex
+	states := map[http.ConnState]int{}
+	web := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	web.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		mu.Lock()
+		states[state]++
+		mu.Unlock()
+	}
+	web.Start()
+	defer web.Close()
+
+	check := ReachabilityCheck{Name: "api", Address: strings.TrimPrefix(web.URL, "http://"), Protocol: checkHTTP}
+	for i := 0; i < 3; i++ {
+		if r := runReachabilityCheck(check); !r.Reachable {
+			t.Fatalf("check %d: %+v", i, r)
+		}
+	}
+	waitFor(t, "connections closed", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return states[http.StateClosed] == 3
+	})
+	if states[http.StateNew] != 3 || states[http.StateIdle] != 0 {
+		t.Errorf("connection states = %v, want 3 fresh connections, none idle", states)
+	}
+}
+
+func TestReachabilityChecks_ICMPDoesNotFallBackToTCP(t *testing.T) {
+	r := runReachabilityCheck(ReachabilityCheck{Name: "gw", Address: "127.0.0.1", Protocol: checkICMP, TimeoutMs: 500})
+	p, err := newICMPProber(net.ParseIP("127.0.0.1"))
+	if err != nil {
+		if r.Reachable || !strings.Contains(r.Error, errProbeUnavailable.Error()) {
+			t.Errorf("icmp check without ICMP sockets = %+v, want unreachable", r)
+		}
+		return
+	}
+	p.close()
+	if !r.Reachable {
+		t.Errorf("icmp check = %+v", r)
+	}
+}
+
+// reachabilitySnapshot is a healthy tunnel whose required collector target is
+// up or down, alongside an optional target that is always down
+func reachabilitySnapshot(i int, collectorUp bool) *VPNHealthSnapshot {
+	results := []ReachabilityResult{
+		{Name: "collector", Protocol: checkTCP, Required: true, Reachable: collectorUp},
+		{Name: "optional", Protocol: checkTCP, Reachable: false},
+	}
+	return &VPNHealthSnapshot{
+		Timestamp:         time.Now().Add(time.Duration(i-10) * time.Second),
+		Connected:         true,
+		RemoteReachable:   true,
+		TunnelStable:      true,
+		Latency:           20,
+		Reachability:      results,
+		RequiredTargetsUp: len(requiredTargetsDown(results)) == 0,
+	}
+}
+
+func TestReachability_RequiredTargetsDriveStatus(t *testing.T) {
+	cases := []struct {
+		name   string
+		up     []bool
+		status string
+	}{
+		{"optional target down", []bool{true}, "healthy"},
+		{"required target down", []bool{true, false, false}, "critical"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hm := newTestVPNManager(t).healthMonitor
+			defer hm.Close()
+			for i, up := range tc.up {
+				hm.addHealthSnapshot(reachabilitySnapshot(i, up))
+			}
+			if s := hm.GetHealthSummary(); s.OverallStatus != tc.status {
+				t.Errorf("status = %s, want %s", s.OverallStatus, tc.status)
+			}
+		})
+	}
+}
+
+func TestReachability_AlertResolvesWhenTargetRemoved(t *testing.T) {
+	hm := newTestVPNManager(t).healthMonitor
+	defer hm.Close()
+
+	hm.addHealthSnapshot(reachabilitySnapshot(0, true))
+	hm.addHealthSnapshot(reachabilitySnapshot(1, false))
+	hm.addHealthSnapshot(reachabilitySnapshot(2, false))
+	active, _ := hm.alerts.List("active")
+	if len(active) != 1 || active[0].Type != "reachability" || active[0].Severity != "critical" || !strings.Contains(active[0].Message, "collector") {
+		t.Fatalf("active alerts = %+v", active)
+	}
+
+	gone := reachabilitySnapshot(3, true)
+	gone.Reachability = nil
+	hm.addHealthSnapshot(gone)
+	if active, _ := hm.alerts.List("active"); len(active) != 0 {
+		t.Errorf("alert for removed target still active: %+v", active)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultReadinessInterval applies when the failover thresholds carry no usable interval
+	defaultReadinessInterval = 60 * time.Second
+
+	// readinessTimeout bounds each DNS lookup and remote probe
+	readinessTimeout = 3 * time.Second
+)
+
+// OpenVPN control channel opcodes (high five bits of the first byte)
+const (
+	opControlHardResetClientV2 = 7
+	opControlHardResetServerV2 = 8
+)
+
+// RemoteReadiness is the pre-flight result for one remote of a profile
+type RemoteReadiness struct {
+	Host      string   `json:"host"`
+	Port      int      `json:"port"`
+	Protocol  string   `json:"protocol"`
+	Addresses []string `json:"addresses,omitempty"`
+	Reachable bool     `json:"reachable"`
+	Method    string   `json:"method,omitempty"` // tcp-connect, udp-handshake or the latency probe method
+	LatencyMs float64  `json:"latency_ms,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// ProfileReadiness is the pre-flight result for a standby profile
+type ProfileReadiness struct {
+	ProfileID         string            `json:"profile_id"`
+	CheckedAt         time.Time         `json:"checked_at"`
+	Ready             bool              `json:"ready"`
+	Remotes           []RemoteReadiness `json:"remotes"`
+	CertificatesValid bool              `json:"certificates_valid"`
+	CertificateExpiry *time.Time        `json:"certificate_expiry,omitempty"` // earliest expiry of the CA and client certificates
+	BestLatencyMs     float64           `json:"best_latency_ms,omitempty"`
+	Error             string            `json:"error,omitempty"`
+}
+
+// checkProfileReadiness checks a profile could connect right now: its
+// certificates are in date and at least one remote resolves and answers
+func checkProfileReadiness(profile *VPNProfile) ProfileReadiness {
+	readiness := ProfileReadiness{
+		ProfileID: profile.ID,
+		CheckedAt: time.Now(),
+		Remotes:   make([]RemoteReadiness, len(profile.Remote)),
+	}
+
+	expiry, certErr := checkProfileCertificates(profile, readiness.CheckedAt)
+	readiness.CertificatesValid = certErr == nil
+	readiness.CertificateExpiry = expiry
+
+	var wg sync.WaitGroup
+	for i, remote := range profile.Remote {
+		wg.Add(1)
+		go func(i int, remote VPNRemote) {
+			defer wg.Done()
+			readiness.Remotes[i] = checkRemoteReadiness(profile, remote)
+		}(i, remote)
+	}
+	wg.Wait()
+
+	for _, r := range readiness.Remotes {
+		if r.Reachable && (readiness.BestLatencyMs == 0 || r.LatencyMs < readiness.BestLatencyMs) {
+			readiness.BestLatencyMs = r.LatencyMs
+		}
+	}
+	var remoteErr error
+	switch {
+	case len(readiness.Remotes) == 0:
+		remoteErr = fmt.Errorf("profile has no remotes")
+	case !anyRemoteReachable(readiness.Remotes):
+		remoteErr = fmt.Errorf("no remote reachable: %s", readiness.Remotes[len(readiness.Remotes)-1].Error)
+	}
+
+	switch {
+	case certErr != nil:
+		readiness.Error = certErr.Error()
+	case remoteErr != nil:
+		readiness.Error = remoteErr.Error()
+	default:
+		readiness.Ready = true
+	}
+	return readiness
+}
+
+func anyRemoteReachable(remotes []RemoteReadiness) bool {
+	for _, r := range remotes {
+		if r.Reachable {
+			return true
+		}
+	}
+	return false
+}
+
+// checkProfileCertificates checks every inline CA and client certificate is
+// within its validity period, returning the earliest expiry
+func checkProfileCertificates(profile *VPNProfile, now time.Time) (*time.Time, error) {
+	var earliest *time.Time
+	for _, section := range []struct{ name, content string }{
+		{"ca", profile.CA},
+		{"cert", profile.Certificate},
+	} {
+		rest := []byte(section.content)
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return earliest, fmt.Errorf("%s certificate: %v", section.name, err)
+			}
+			if earliest == nil || cert.NotAfter.Before(*earliest) {
+				notAfter := cert.NotAfter
+				earliest = &notAfter
+			}
+			if now.After(cert.NotAfter) {
+				return earliest, fmt.Errorf("%s certificate %q expired at %s", section.name, cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+			}
+			if now.Before(cert.NotBefore) {
+				return earliest, fmt.Errorf("%s certificate %q is not valid until %s", section.name, cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+			}
+		}
+	}
+	return earliest, nil
+}
+
+// checkRemoteReadiness resolves a remote and probes it with the profile's transport
+func checkRemoteReadiness(profile *VPNProfile, remote VPNRemote) RemoteReadiness {
+	port := remote.Port
+	if port == 0 {
+		port = profile.Port
+	}
+	if port == 0 {
+		port = 1194
+	}
+	protocol := remote.Protocol
+	if protocol == "" {
+		protocol = profile.Protocol
+	}
+	result := RemoteReadiness{Host: remote.Host, Port: port, Protocol: protocol}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, remote.Host)
+	if err != nil || len(addrs) == 0 {
+		result.Error = fmt.Sprintf("DNS resolution failed: %v", err)
+		return result
+	}
+	result.Addresses = addrs
+	address := net.JoinHostPort(addrs[0], strconv.Itoa(port))
+
+	start := time.Now()
+	if strings.HasPrefix(protocol, "tcp") {
+		result.Method = "tcp-connect"
+		err = checkTCPConnect(address, readinessTimeout)
+	} else {
+		result.Method = "udp-handshake"
+		err = openVPNHandshake(address, readinessTimeout)
+		// Servers behind tls-auth or tls-crypt drop unauthenticated resets,
+		// so silence only tells us the host should be probed another way
+		if errors.Is(err, errHandshakeTimeout) && profileHasControlChannelKey(profile) {
+			probe := runProbe(ProbeTarget{Name: remote.Host, Host: addrs[0], Protocol: probeAuto}, 3, 200*time.Millisecond, readinessTimeout)
+			result.Method = probe.Method
+			if probe.Unreachable {
+				err = errors.New(probe.Error)
+			} else {
+				result.Reachable = true
+				result.LatencyMs = probe.AvgLatency
+				return result
+			}
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Reachable = true
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+var errHandshakeTimeout = errors.New("no handshake reply")
+
+// openVPNHandshake sends a P_CONTROL_HARD_RESET_CLIENT_V2 and waits for the
+// server's P_CONTROL_HARD_RESET_SERVER_V2, proving an OpenVPN server listens
+func openVPNHandshake(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("udp", address, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// opcode/key_id, session_id, empty ack array, message packet_id
+	packet := make([]byte, 14)
+	packet[0] = opControlHardResetClientV2 << 3
+	if _, err := rand.Read(packet[1:9]); err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(packet); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Errorf("port unreachable")
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return errHandshakeTimeout
+		}
+		return err
+	}
+	if n < 9 || buf[0]>>3 != opControlHardResetServerV2 {
+		return fmt.Errorf("unexpected reply to handshake")
+	}
+	return nil
+}
+
+// profileHasControlChannelKey reports whether the server only answers
+// packets authenticated with a tls-auth or tls-crypt key
+func profileHasControlChannelKey(profile *VPNProfile) bool {
+	if profile.TLSAuth != "" || profile.TLSCrypt != "" || profile.TLSCryptV2 != "" {
+		return true
+	}
+	for _, directive := range []string{"tls-auth", "tls-crypt", "tls-crypt-v2"} {
+		if _, ok := profile.CustomDirectives.Lookup(directive); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// probeProfileReadiness adapts the readiness check for failback probing
+func probeProfileReadiness(profile *VPNProfile) error {
+	if readiness := checkProfileReadiness(profile); !readiness.Ready {
+		return errors.New(readiness.Error)
+	}
+	return nil
+}
+
+// readinessInterval is how often standbys are checked. Thresholds sent as
+// plain seconds decode as nanoseconds, so implausibly short values fall back.
+func (cm *VPNConnectionManager) readinessInterval() time.Duration {
+	if interval := cm.failoverThresholds.HealthCheckInterval; interval >= 5*time.Second {
+		return interval
+	}
+	return defaultReadinessInterval
+}
+
+// restartReadinessMonitor stops any running readiness monitor and starts one
+// while failover is enabled (requires lock)
+func (cm *VPNConnectionManager) restartReadinessMonitor() {
+	if cm.readinessStop != nil {
+		close(cm.readinessStop)
+		cm.readinessStop = nil
+	}
+	if !cm.failoverEnabled {
+		return
+	}
+	stop := make(chan struct{})
+	cm.readinessStop = stop
+	go cm.runReadinessMonitor(stop, cm.readinessInterval())
+}
+
+func (cm *VPNConnectionManager) runReadinessMonitor(stop chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	cm.refreshReadiness()
+	for {
+		select {
+		case <-ticker.C:
+			cm.refreshReadiness()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// refreshReadiness checks every standby profile concurrently
+func (cm *VPNConnectionManager) refreshReadiness() {
+	cm.mutex.RLock()
+	check := cm.checkReadiness
+	standbys := make([]*VPNProfile, 0, len(cm.failoverProfiles))
+	for _, id := range cm.failoverProfiles {
+		if cm.activeConn != nil && cm.activeConn.Profile.ID == id {
+			continue
+		}
+		if profile, exists := cm.vm.GetProfile(id); exists {
+			standbys = append(standbys, profile)
+		}
+	}
+	cm.mutex.RUnlock()
+
+	results := make([]ProfileReadiness, len(standbys))
+	var wg sync.WaitGroup
+	for i, profile := range standbys {
+		wg.Add(1)
+		go func(i int, profile *VPNProfile) {
+			defer wg.Done()
+			results[i] = check(profile)
+		}(i, profile)
+	}
+	wg.Wait()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	for _, r := range results {
+		if !r.Ready {
+			log.Printf("Standby profile %s is not ready: %s", r.ProfileID, r.Error)
+		}
+		cm.readiness[r.ProfileID] = r
+	}
+}
+
+// rankFailoverCandidates orders standby profiles for failover: ready ones by
+// latency, then unchecked ones in priority order. Profiles whose last check
+// failed are skipped, with the reason (requires lock).
+func (cm *VPNConnectionManager) rankFailoverCandidates(candidates []string, now time.Time) ([]string, map[string]string) {
+	stale := 3 * cm.readinessInterval()
+	ready := make([]string, 0)
+	unchecked := make([]string, 0)
+	skipped := make(map[string]string)
+
+	for _, id := range candidates {
+		r, ok := cm.readiness[id]
+		switch {
+		case !ok || now.Sub(r.CheckedAt) > stale:
+			unchecked = append(unchecked, id)
+		case r.Ready:
+			ready = append(ready, id)
+		default:
+			skipped[id] = r.Error
+		}
+	}
+	sort.SliceStable(ready, func(i, j int) bool {
+		return cm.readiness[ready[i]].BestLatencyMs < cm.readiness[ready[j]].BestLatencyMs
+	})
+	return append(ready, unchecked...), skipped
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveFakeOpenVPN answers OpenVPN client hard resets on a loopback UDP port
+func serveFakeOpenVPN(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 14 || buf[0]>>3 != opControlHardResetClientV2 {
+				continue
+			}
+			// P_CONTROL_HARD_RESET_SERVER_V2 acking the client session
+			reply := append([]byte{opControlHardResetServerV2 << 3}, make([]byte, 8)...)
+			reply = append(reply, 1)
+			reply = append(reply, make([]byte, 4)...)
+			reply = append(reply, buf[1:9]...)
+			reply = append(reply, make([]byte, 4)...)
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestCheckProfileReadiness(t *testing.T) {
+	port := serveFakeOpenVPN(t)
+	valid := testCertificate(t, time.Now().Add(30*24*time.Hour))
+	expired := testCertificate(t, time.Now().Add(-time.Hour))
+
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	closedPort := closed.LocalAddr().(*net.UDPAddr).Port
+	closed.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	defer listener.Close()
+	tcpPort := listener.Addr().(*net.TCPAddr).Port
+
+	up := VPNRemote{Host: "127.0.0.1", Port: port}
+	down := VPNRemote{Host: "127.0.0.1", Port: closedPort}
+	cases := []struct {
+		name    string
+		profile *VPNProfile
+		check   func(r ProfileReadiness) bool
+	}{
+		{"udp handshake", &VPNProfile{ID: "udp", Protocol: "udp", CA: valid, Certificate: valid, Remote: []VPNRemote{up}},
+			func(r ProfileReadiness) bool {
+				return r.Ready && r.CertificatesValid && r.CertificateExpiry != nil && r.Remotes[0].Method == "udp-handshake" &&
+					r.BestLatencyMs > 0 && r.Remotes[0].Addresses[0] == "127.0.0.1"
+			}},
+		// A closed port fails fast
+		{"closed port", &VPNProfile{ID: "udp", Protocol: "udp", Remote: []VPNRemote{down}},
+			func(r ProfileReadiness) bool { return !r.Ready && strings.Contains(r.Error, "port unreachable") }},
+		// One good remote is still enough
+		{"mixed remotes", &VPNProfile{ID: "udp", Protocol: "udp", Remote: []VPNRemote{down, up}},
+			func(r ProfileReadiness) bool { return r.Ready && !r.Remotes[0].Reachable && r.Remotes[1].Reachable }},
+		{"expired certificate", &VPNProfile{ID: "udp", Protocol: "udp", CA: valid, Certificate: expired, Remote: []VPNRemote{up}},
+			func(r ProfileReadiness) bool {
+				return !r.Ready && !r.CertificatesValid && strings.Contains(r.Error, "expired")
+			}},
+		{"tcp connect", &VPNProfile{ID: "tcp", Protocol: "tcp-client", Remote: []VPNRemote{{Host: "127.0.0.1", Port: tcpPort}}},
+			func(r ProfileReadiness) bool { return r.Ready && r.Remotes[0].Method == "tcp-connect" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if r := checkProfileReadiness(tc.profile); !tc.check(r) {
+				t.Errorf("readiness = %+v", r)
+			}
+		})
+	}
+}
+
+func TestReadiness_FailoverPicksHealthiestReadyStandby(t *testing.T) {
+	vm := newTestVPNManager(t)
+	cm := vm.connectionManager
+	cm.startProcess = func(*VPNConnection) error { return nil }
+	var downMutex sync.Mutex
+	down := map[string]bool{"p2": true}
+	cm.checkReadiness = func(p *VPNProfile) ProfileReadiness {
+		downMutex.Lock()
+		defer downMutex.Unlock()
+		switch {
+		case down[p.ID]:
+			return ProfileReadiness{ProfileID: p.ID, CheckedAt: time.Now(), Error: "no remote reachable: i/o timeout"}
+		case p.ID == "p3":
+			return ProfileReadiness{ProfileID: p.ID, CheckedAt: time.Now(), Ready: true, BestLatencyMs: 80}
+		}
+		return ProfileReadiness{ProfileID: p.ID, CheckedAt: time.Now(), Ready: true, BestLatencyMs: 20}
+	}
+	for _, id := range []string{"p1", "p2", "p3", "p4"} {
+		vm.profiles[id] = &VPNProfile{ID: id, Name: id, Validated: true, Protocol: "udp", Device: "tun"}
+	}
+	defer cm.Stop()
+
+	now := time.Now()
+	cm.readiness = map[string]ProfileReadiness{
+		"a": {CheckedAt: now, Ready: true, BestLatencyMs: 50},
+		"b": {CheckedAt: now, Ready: true, BestLatencyMs: 10},
+		"c": {CheckedAt: now, Error: "expired"},
+		"d": {CheckedAt: now.Add(-time.Hour), Ready: true}, // stale
+	}
+	ordered, skipped := cm.rankFailoverCandidates([]string{"a", "c", "d", "e", "b"}, now)
+	if strings.Join(ordered, ",") != "b,a,d,e" || skipped["c"] != "expired" || len(skipped) != 1 {
+		t.Errorf("ranked = %v, skipped = %v", ordered, skipped)
+	}
+
+	if err := cm.EnableFailover([]string{"p1", "p2", "p3", "p4"}, nil, nil); err != nil {
+		t.Fatalf("EnableFailover: %v", err)
+	}
+	if err := cm.Connect("p1"); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	cm.refreshReadiness()
+
+	if err := cm.triggerFailover("", "process_died"); err != nil {
+		t.Fatalf("triggerFailover: %v", err)
+	}
+	if id := cm.GetConnectionStatus().ProfileID; id != "p4" {
+		t.Errorf("failed over to %s, want the lowest-latency ready standby p4", id)
+	}
+	readiness := cm.GetFailoverStatus()["readiness"].(map[string]ProfileReadiness)
+	if readiness["p2"].Ready || !readiness["p3"].Ready || readiness["p3"].BestLatencyMs != 80 {
+		t.Errorf("failover status readiness = %+v", readiness)
+	}
+
+	// With every standby unreachable there is nothing to try, and the
+	// current tunnel is left alone
+	downMutex.Lock()
+	down["p1"], down["p3"] = true, true
+	downMutex.Unlock()
+	cm.refreshReadiness()
+	if err := cm.triggerFailover("", "manual"); err == nil || err.Error() != "no standby profile ready" {
+		t.Errorf("failover with no ready standby: %v", err)
+	}
+	if id := cm.GetConnectionStatus().ProfileID; id != "p4" {
+		t.Errorf("active profile after refused failover = %q, want p4", id)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reconnectState tracks automatic reconnection of a profile whose tunnel dropped
+type reconnectState struct {
+	ProfileID   string
+	Attempt     int // retries scheduled since the tunnel was last stable
+	NextRetryAt time.Time
+	LastError   string
+	Exhausted   bool // MaxRetries reached; waiting for an operator
+	timer       *time.Timer
+}
+
+// defaultProfileConfig is the policy for profiles without a saved config
+func defaultProfileConfig(profileID string) VPNProfileConfig {
+	return VPNProfileConfig{
+		ProfileID:         profileID,
+		Enabled:           true,
+		MaxRetries:        10,
+		RetryDelay:        5,
+		AutoReconnect:     true,
+		MaxRetryDelay:     300,
+		BackoffMultiplier: 2,
+		Jitter:            0.2,
+		ResetAfter:        300,
+	}
+}
+
+// Validate checks the reconnect policy is usable
+func (c VPNProfileConfig) Validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if c.RetryDelay < 1 {
+		return fmt.Errorf("retry_delay_seconds must be at least 1")
+	}
+	if c.MaxRetryDelay < c.RetryDelay {
+		return fmt.Errorf("max_retry_delay_seconds must be at least retry_delay_seconds")
+	}
+	if c.BackoffMultiplier < 1 || c.BackoffMultiplier > 10 {
+		return fmt.Errorf("backoff_multiplier must be between 1 and 10")
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1")
+	}
+	if c.ResetAfter < 0 {
+		return fmt.Errorf("reset_after_seconds must not be negative")
+	}
+	switch c.RemoteSelection {
+	case "", remoteSelectionOrdered, remoteSelectionLatency:
+	default:
+		return fmt.Errorf("remote_selection must be %q or %q", remoteSelectionOrdered, remoteSelectionLatency)
+	}
+	return nil
+}
+
+// reconnectDelay is the exponential backoff for a retry attempt (1-based),
+// capped at MaxRetryDelay and spread by ±Jitter using r in [0,1)
+func reconnectDelay(c VPNProfileConfig, attempt int, r float64) time.Duration {
+	delay := float64(c.RetryDelay) * math.Pow(c.BackoffMultiplier, float64(attempt-1))
+	if limit := float64(c.MaxRetryDelay); delay > limit {
+		delay = limit
+	}
+	delay *= 1 + c.Jitter*(2*r-1)
+	return max(time.Duration(delay*float64(time.Second)), time.Second)
+}
+
+func (cm *VPNConnectionManager) profileConfigPath() string {
+	return filepath.Join(cm.statePath, "profile_configs.json")
+}
+
+// profileConfig returns the saved or default config for a profile (requires lock)
+func (cm *VPNConnectionManager) profileConfig(profileID string) VPNProfileConfig {
+	if config, ok := cm.profileConfigs[profileID]; ok {
+		return config
+	}
+	return defaultProfileConfig(profileID)
+}
+
+// GetProfileConfig returns the connection policy of a profile
+func (cm *VPNConnectionManager) GetProfileConfig(profileID string) VPNProfileConfig {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+	return cm.profileConfig(profileID)
+}
+
+// SetProfileConfig validates, applies and persists a profile's connection policy
+func (cm *VPNConnectionManager) SetProfileConfig(config VPNProfileConfig) error {
+	if _, exists := cm.vm.GetProfile(config.ProfileID); !exists {
+		return fmt.Errorf("profile not found: %s", config.ProfileID)
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	configs := make(map[string]VPNProfileConfig, len(cm.profileConfigs)+1)
+	for id, c := range cm.profileConfigs {
+		configs[id] = c
+	}
+	configs[config.ProfileID] = config
+
+	data, err := json.MarshalIndent(configs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode profile configs: %v", err)
+	}
+	if err := os.WriteFile(cm.profileConfigPath(), data, 0644); err != nil {
+		return fmt.Errorf("failed to save profile configs: %v", err)
+	}
+	cm.profileConfigs = configs
+
+	// Turning auto-reconnect off stops a pending retry
+	if !config.AutoReconnect && cm.reconnect != nil && cm.reconnect.ProfileID == config.ProfileID {
+		cm.cancelReconnect()
+	}
+	return nil
+}
+
+// loadProfileConfigs reads persisted profile configs, skipping invalid entries
+func (cm *VPNConnectionManager) loadProfileConfigs() {
+	data, err := os.ReadFile(cm.profileConfigPath())
+	if err != nil {
+		return
+	}
+	var configs map[string]VPNProfileConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		log.Printf("Warning: failed to decode profile configs: %v", err)
+		return
+	}
+	for id, config := range configs {
+		if err := config.Validate(); err != nil {
+			log.Printf("Warning: ignoring invalid config for profile %s: %v", id, err)
+			continue
+		}
+		config.ProfileID = id
+		cm.profileConfigs[id] = config
+	}
+}
+
+// scheduleReconnect arranges the next retry for a profile whose tunnel
+// dropped or failed to start (requires lock)
+func (cm *VPNConnectionManager) scheduleReconnect(profileID, reason string) {
+	config := cm.profileConfig(profileID)
+	if !config.AutoReconnect || !config.Enabled {
+		cm.cancelReconnect()
+		return
+	}
+
+	state := cm.reconnect
+	if state == nil || state.ProfileID != profileID {
+		cm.cancelReconnect()
+		state = &reconnectState{ProfileID: profileID}
+		cm.reconnect = state
+	}
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	state.Attempt++
+	state.LastError = reason
+
+	if config.MaxRetries > 0 && state.Attempt > config.MaxRetries {
+		state.Exhausted = true
+		state.NextRetryAt = time.Time{}
+		log.Printf("Giving up reconnecting profile %s after %d attempts", profileID, config.MaxRetries)
+		return
+	}
+
+	delay := reconnectDelay(config, state.Attempt, cm.jitterRand())
+	state.NextRetryAt = time.Now().Add(delay)
+	state.timer = time.AfterFunc(delay, func() { cm.attemptReconnect(state) })
+	log.Printf("Reconnecting profile %s in %s (attempt %d)", profileID, delay.Round(time.Second), state.Attempt)
+}
+
+// attemptReconnect runs a scheduled retry unless it was cancelled or
+// something else connected in the meantime
+func (cm *VPNConnectionManager) attemptReconnect(state *reconnectState) {
+	cm.refreshRemoteOrder(state.ProfileID)
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	if cm.reconnect != state || cm.activeConn != nil {
+		return
+	}
+	state.NextRetryAt = time.Time{}
+
+	if err := cm.connectInternal(state.ProfileID); err != nil {
+		log.Printf("Reconnect attempt %d for profile %s failed: %v", state.Attempt, state.ProfileID, err)
+		cm.scheduleReconnect(state.ProfileID, err.Error())
+	}
+}
+
+// checkReconnectStable resets the retry count once the tunnel has stayed up
+// for the profile's ResetAfter period (requires lock)
+func (cm *VPNConnectionManager) checkReconnectStable(conn *VPNConnection) {
+	state := cm.reconnect
+	if state == nil || conn.State != "connected" || conn.ConnectedAt.IsZero() {
+		return
+	}
+	config := cm.profileConfig(conn.Profile.ID)
+	if time.Since(conn.ConnectedAt) >= time.Duration(config.ResetAfter)*time.Second {
+		log.Printf("Profile %s stable for %ds, resetting reconnect attempts", conn.Profile.Name, config.ResetAfter)
+		cm.cancelReconnect()
+	}
+}
+
+// cancelReconnect drops any pending retry (requires lock)
+func (cm *VPNConnectionManager) cancelReconnect() {
+	if cm.reconnect != nil && cm.reconnect.timer != nil {
+		cm.reconnect.timer.Stop()
+	}
+	cm.reconnect = nil
+}
+
+// applyReconnectStatus reports a pending or exhausted retry in the status (requires lock)
+func (cm *VPNConnectionManager) applyReconnectStatus(state *VPNConnectionState) {
+	r := cm.reconnect
+	if r == nil || r.ProfileID != state.ProfileID {
+		return
+	}
+	state.ReconnectAttempt = r.Attempt
+	state.RetriesExhausted = r.Exhausted
+	if !r.NextRetryAt.IsZero() {
+		next := r.NextRetryAt
+		state.NextRetryAt = &next
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	config := defaultProfileConfig("p1")
+	for _, tc := range []struct {
+		attempt int
+		r       float64
+		want    time.Duration
+	}{
+		{1, 0.5, 5 * time.Second},
+		{2, 0.5, 10 * time.Second},
+		{3, 0.5, 20 * time.Second},
+		{7, 0.5, 300 * time.Second}, // capped
+		{7, 0, 240 * time.Second},   // -20% jitter
+		{1, 0.75, 5500 * time.Millisecond},
+	} {
+		if got := reconnectDelay(config, tc.attempt, tc.r); got != tc.want {
+			t.Errorf("reconnectDelay(attempt %d, r %v) = %v, want %v", tc.attempt, tc.r, got, tc.want)
+		}
+	}
+}
+
+// newReconnectTest stores config for a p1 profile that always fails validation,
+// so every reconnect attempt fails
+func newReconnectTest(t *testing.T, config VPNProfileConfig) *VPNConnectionManager {
+	t.Helper()
+	vm := newTestVPNManager(t)
+	cm := vm.connectionManager
+	cm.jitterRand = func() float64 { return 0.5 }
+	vm.profiles["p1"] = &VPNProfile{ID: "p1", Name: "site", ValidationError: "missing ca"}
+	if err := cm.SetProfileConfig(config); err != nil {
+		t.Fatalf("SetProfileConfig: %v", err)
+	}
+	t.Cleanup(func() {
+		cm.mutex.Lock()
+		cm.cancelReconnect()
+		cm.mutex.Unlock()
+	})
+	return cm
+}
+
+// dropConnection makes p1 the active connection and has its process exit
+func dropConnection(cm *VPNConnectionManager) {
+	exited := make(chan struct{})
+	close(exited)
+	cm.mutex.Lock()
+	cm.activeConn = &VPNConnection{Profile: cm.vm.profiles["p1"], State: "connected", StartedAt: time.Now(), exited: exited}
+	cm.updateConnectionStatus(cm.activeConn)
+	cm.mutex.Unlock()
+}
+
+func TestSetProfileConfig(t *testing.T) {
+	config := defaultProfileConfig("p1")
+	config.RetryDelay = 60
+	cm := newReconnectTest(t, config)
+
+	badJitter := config
+	badJitter.Jitter = 2
+	for name, bad := range map[string]VPNProfileConfig{
+		"jitter 2":        badJitter,
+		"unknown profile": defaultProfileConfig("missing"),
+	} {
+		if err := cm.SetProfileConfig(bad); err == nil {
+			t.Errorf("SetProfileConfig accepted %s", name)
+		}
+	}
+	if got := NewVPNConnectionManager(cm.vm, cm.statePath).GetProfileConfig("p1"); got != config {
+		t.Errorf("reloaded config = %+v, want %+v", got, config)
+	}
+}
+
+func TestReconnect_BackoffUntilRetriesExhausted(t *testing.T) {
+	config := defaultProfileConfig("p1")
+	config.RetryDelay = 60
+	config.MaxRetries = 2
+	cm := newReconnectTest(t, config)
+	dropConnection(cm)
+
+	status := cm.GetConnectionStatus()
+	if status.Connected || status.ProfileID != "p1" || status.ReconnectAttempt != 1 || status.NextRetryAt == nil {
+		t.Fatalf("status after drop = %+v", status)
+	}
+	if wait := time.Until(*status.NextRetryAt); wait < 59*time.Second || wait > 60*time.Second {
+		t.Errorf("first retry in %v, want 60s", wait)
+	}
+
+	cm.attemptReconnect(cm.reconnect)
+	status = cm.GetConnectionStatus()
+	if status.ReconnectAttempt != 2 || status.NextRetryAt == nil || time.Until(*status.NextRetryAt) < 119*time.Second {
+		t.Errorf("status after failed retry = %+v", status)
+	}
+	if !strings.Contains(status.LastError, "not validated") {
+		t.Errorf("last error = %q", status.LastError)
+	}
+	cm.attemptReconnect(cm.reconnect)
+	status = cm.GetConnectionStatus()
+	if !status.RetriesExhausted || status.NextRetryAt != nil {
+		t.Errorf("status after exhausting retries = %+v", status)
+	}
+}
+
+func TestReconnect_StableTunnelResetsRetries(t *testing.T) {
+	config := defaultProfileConfig("p1")
+	cm := newReconnectTest(t, config)
+	dropConnection(cm)
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	for _, tc := range []struct {
+		upFor   int
+		pending bool
+	}{
+		{config.ResetAfter - 1, true},
+		{config.ResetAfter, false},
+	} {
+		conn := &VPNConnection{Profile: cm.vm.profiles["p1"], State: "connected", ConnectedAt: time.Now().Add(-time.Duration(tc.upFor) * time.Second)}
+		cm.checkReconnectStable(conn)
+		if pending := cm.reconnect != nil; pending != tc.pending {
+			t.Errorf("up for %ds: reconnect pending = %v, want %v", tc.upFor, pending, tc.pending)
+		}
+	}
+}
+
+func TestReconnect_DisabledDropIsFinal(t *testing.T) {
+	config := defaultProfileConfig("p1")
+	config.AutoReconnect = false
+	cm := newReconnectTest(t, config)
+	dropConnection(cm)
+
+	if status := cm.GetConnectionStatus(); status.NextRetryAt != nil || status.ProfileID != "" {
+		t.Errorf("status with auto-reconnect off = %+v", status)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Remote selection modes for VPNProfileConfig.RemoteSelection
+const (
+	remoteSelectionOrdered = "ordered" // OpenVPN's own order, honouring remote-random
+	remoteSelectionLatency = "latency" // manager probes remotes and tries the fastest first
+)
+
+// VPNRemoteStats counts connection attempts against one remote of a profile
+type VPNRemoteStats struct {
+	Remote      string    `json:"remote"` // host:port as configured
+	Attempts    int64     `json:"attempts"`
+	Successes   int64     `json:"successes"`
+	Failures    int64     `json:"failures"`
+	LastAttempt time.Time `json:"last_attempt,omitempty"`
+	LastSuccess time.Time `json:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitempty"`
+}
+
+// remoteKey identifies a remote in stats and history
+func remoteKey(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// remoteStatsFor returns the stats record for a profile remote (requires lock)
+func (cm *VPNConnectionManager) remoteStatsFor(profileID, remote string) *VPNRemoteStats {
+	byRemote, ok := cm.remoteStats[profileID]
+	if !ok {
+		byRemote = make(map[string]*VPNRemoteStats)
+		cm.remoteStats[profileID] = byRemote
+	}
+	stats, ok := byRemote[remote]
+	if !ok {
+		stats = &VPNRemoteStats{Remote: remote}
+		byRemote[remote] = stats
+	}
+	return stats
+}
+
+// GetRemoteStats returns attempt statistics for every remote of a profile,
+// configured remotes first in profile order
+func (cm *VPNConnectionManager) GetRemoteStats(profileID string) []VPNRemoteStats {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	result := make([]VPNRemoteStats, 0)
+	seen := make(map[string]bool)
+	if profile, exists := cm.vm.GetProfile(profileID); exists {
+		for _, remote := range profile.Remote {
+			key := remoteKey(remote.Host, remote.Port)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			stats := VPNRemoteStats{Remote: key}
+			if s, ok := cm.remoteStats[profileID][key]; ok {
+				stats = *s
+			}
+			result = append(result, stats)
+		}
+	}
+
+	// Remotes no longer in the profile, or only known by address
+	extra := make([]VPNRemoteStats, 0)
+	for key, s := range cm.remoteStats[profileID] {
+		if !seen[key] {
+			extra = append(extra, *s)
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i].Remote < extra[j].Remote })
+	return append(result, extra...)
+}
+
+// handleRemoteEvent accounts for a >REMOTE query, which OpenVPN sends before
+// trying each remote, and lets it proceed (requires lock)
+func (cm *VPNConnectionManager) handleRemoteEvent(conn *VPNConnection, payload string) {
+	fields := strings.Split(payload, ",")
+	if len(fields) >= 2 {
+		port, _ := strconv.Atoi(fields[1])
+		now := time.Now()
+
+		// Moving on from a remote that never connected means it failed
+		cm.finishRemoteAttempt(conn, now)
+
+		conn.remoteAttempt = remoteKey(fields[0], port)
+		conn.remoteAttemptOK = false
+		stats := cm.remoteStatsFor(conn.Profile.ID, conn.remoteAttempt)
+		stats.Attempts++
+		stats.LastAttempt = now
+		log.Printf("OpenVPN trying remote %s for profile %s", conn.remoteAttempt, conn.Profile.Name)
+	}
+
+	if conn.mgmt != nil {
+		if _, err := conn.mgmt.Command("remote ACCEPT"); err != nil {
+			log.Printf("Warning: failed to accept remote: %v", err)
+		}
+	}
+}
+
+// finishRemoteAttempt records a failure for a remote attempt that ended
+// without connecting (requires lock)
+func (cm *VPNConnectionManager) finishRemoteAttempt(conn *VPNConnection, now time.Time) {
+	if conn.remoteAttempt == "" || conn.remoteAttemptOK {
+		return
+	}
+	stats := cm.remoteStatsFor(conn.Profile.ID, conn.remoteAttempt)
+	stats.Failures++
+	stats.LastFailure = now
+	conn.remoteAttempt = ""
+}
+
+// recordRemoteConnected notes the remote a tunnel came up on (requires lock)
+func (cm *VPNConnectionManager) recordRemoteConnected(conn *VPNConnection, state openVPNState) {
+	if conn.remoteAttempt == "" {
+		// Without remote queries all we know is the address
+		if state.RemoteIP != "" {
+			conn.ConnectedRemote = remoteKey(state.RemoteIP, state.RemotePort)
+		}
+		return
+	}
+	conn.ConnectedRemote = conn.remoteAttempt
+	if !conn.remoteAttemptOK {
+		conn.remoteAttemptOK = true
+		stats := cm.remoteStatsFor(conn.Profile.ID, conn.remoteAttempt)
+		stats.Successes++
+		stats.LastSuccess = time.Now()
+	}
+}
+
+// orderRemotesByLatency probes every remote and returns them fastest first,
+// followed by the unreachable ones in their configured order
+func orderRemotesByLatency(profile *VPNProfile) []VPNRemote {
+	results := make([]RemoteReadiness, len(profile.Remote))
+	var wg sync.WaitGroup
+	for i, remote := range profile.Remote {
+		wg.Add(1)
+		go func(i int, remote VPNRemote) {
+			defer wg.Done()
+			results[i] = checkRemoteReadiness(profile, remote)
+		}(i, remote)
+	}
+	wg.Wait()
+
+	order := make([]int, len(profile.Remote))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := results[order[a]], results[order[b]]
+		if ra.Reachable != rb.Reachable {
+			return ra.Reachable
+		}
+		return ra.Reachable && ra.LatencyMs < rb.LatencyMs
+	})
+
+	remotes := make([]VPNRemote, len(order))
+	for i, idx := range order {
+		remotes[i] = profile.Remote[idx]
+	}
+	return remotes
+}
+
+// remoteOrderMaxAge is how long a measured remote order is used for connects
+const remoteOrderMaxAge = 5 * time.Minute
+
+// remoteOrder is a profile's remotes as last ordered by measured latency
+type remoteOrder struct {
+	remotes    []VPNRemote
+	measuredAt time.Time
+}
+
+// refreshRemoteOrder measures a latency-selected profile's remotes and keeps
+// the order for its next connect. Probing takes seconds, so callers must not
+// hold the lock.
+func (cm *VPNConnectionManager) refreshRemoteOrder(profileID string) {
+	cm.mutex.RLock()
+	latency := cm.profileConfig(profileID).RemoteSelection == remoteSelectionLatency
+	orderRemotes := cm.orderRemotes
+	cm.mutex.RUnlock()
+	profile, exists := cm.vm.GetProfile(profileID)
+	if !latency || !exists || len(profile.Remote) < 2 {
+		return
+	}
+
+	remotes := orderRemotes(profile)
+
+	cm.mutex.Lock()
+	cm.remoteOrders[profileID] = remoteOrder{remotes: remotes, measuredAt: time.Now()}
+	cm.mutex.Unlock()
+}
+
+// measuredRemoteOrder returns the profile's remotes in their last measured
+// order, if that is recent and covers the same remotes (requires lock)
+func (cm *VPNConnectionManager) measuredRemoteOrder(profile *VPNProfile) ([]VPNRemote, bool) {
+	order, ok := cm.remoteOrders[profile.ID]
+	if !ok || time.Since(order.measuredAt) > remoteOrderMaxAge || len(order.remotes) != len(profile.Remote) {
+		return nil, false
+	}
+	configured := make(map[VPNRemote]int)
+	for _, remote := range profile.Remote {
+		configured[remote]++
+	}
+	for _, remote := range order.remotes {
+		if configured[remote] == 0 {
+			return nil, false
+		}
+		configured[remote]--
+	}
+	return order.remotes, true
+}
+
+// exportLatencyOrdered writes the connection config with remotes in their
+// measured latency order, so OpenVPN tries the fastest first. Without a
+// recent measurement the configured order is used and one is started in the
+// background (requires lock)
+func (cm *VPNConnectionManager) exportLatencyOrdered(profile *VPNProfile, path string) error {
+	remotes, measured := cm.measuredRemoteOrder(profile)
+	if !measured {
+		log.Printf("No recent latency measurement for profile %s; using the configured remote order", profile.Name)
+		go cm.refreshRemoteOrder(profile.ID)
+		return cm.vm.ExportProfile(profile.ID, path)
+	}
+	ordered := *profile
+	ordered.Remote = remotes
+	ordered.RemoteRandom = false
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	log.Printf("Lowest-latency remote for profile %s: %s", profile.Name, remoteKey(ordered.Remote[0].Host, ordered.Remote[0].Port))
+	return cm.vm.writeOVPNFile(file, &ordered)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseMultiRemote parses a profile with two remotes and remote-random
+func parseMultiRemote(t *testing.T, vm *VPNManager) *VPNProfile {
+	t.Helper()
+	ovpn := filepath.Join(t.TempDir(), "multi.ovpn")
+	os.WriteFile(ovpn, []byte("client\ndev tun\nproto udp\nport 1194\n"+
+		"remote vpn1.example.com\nremote vpn2.example.com 443 tcp-client\n"+
+		"remote-random\nserver-poll-timeout 4\n"), 0644)
+	profile, err := vm.ParseOVPNFile(ovpn)
+	if err != nil {
+		t.Fatalf("ParseOVPNFile: %v", err)
+	}
+	return profile
+}
+
+func TestRemotes_Directives(t *testing.T) {
+	vm := newTestVPNManager(t)
+	profile := parseMultiRemote(t, vm)
+	if !profile.RemoteRandom || profile.ServerPollTimeout != 4 || len(profile.CustomDirectives) != 0 {
+		t.Errorf("remote-random=%v server-poll-timeout=%d custom=%v", profile.RemoteRandom, profile.ServerPollTimeout, profile.CustomDirectives)
+	}
+	want := []VPNRemote{{Host: "vpn1.example.com", Port: 1194}, {Host: "vpn2.example.com", Port: 443, Protocol: "tcp-client"}}
+	if fmt.Sprint(profile.Remote) != fmt.Sprint(want) {
+		t.Errorf("remotes = %+v, want %+v", profile.Remote, want)
+	}
+	var out strings.Builder
+	vm.writeOVPNFile(&out, profile)
+	for _, line := range []string{"remote vpn1.example.com 1194\n", "remote vpn2.example.com 443 tcp-client\n", "remote-random\n", "server-poll-timeout 4\n"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("exported config lacks %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestRemotes_StatsFromManagement(t *testing.T) {
+	vm := newTestVPNManager(t)
+	cm := vm.connectionManager
+	profile := parseMultiRemote(t, vm)
+
+	// The first remote fails, the second connects
+	profile.ID = "multi"
+	vm.profiles[profile.ID] = profile
+	conn := &VPNConnection{
+		Profile:          profile,
+		StartedAt:        time.Now(),
+		State:            "connecting",
+		PidFile:          filepath.Join(t.TempDir(), "missing.pid"),
+		ManagementSocket: cm.managementSocketPath(profile.ID),
+	}
+	newFakeManagement(t, conn.ManagementSocket, "vpn1.example.com,1194,udp", "vpn2.example.com,443,tcp-client")
+	cm.mutex.Lock()
+	cm.activeConn = conn
+	err := cm.attachManagement(conn, time.Second, true)
+	cm.mutex.Unlock()
+	if err != nil {
+		t.Fatalf("attachManagement: %v", err)
+	}
+	waitFor(t, "connected", func() bool { return cm.GetConnectionStatus().Connected })
+	if remote := cm.GetConnectionStatus().Remote; remote != "vpn2.example.com:443" {
+		t.Errorf("connected remote = %q", remote)
+	}
+	stats := cm.GetRemoteStats(profile.ID)
+	if len(stats) != 2 || stats[0].Remote != "vpn1.example.com:1194" || stats[0].Attempts != 1 || stats[0].Failures != 1 ||
+		stats[1].Attempts != 1 || stats[1].Successes != 1 || stats[1].Failures != 0 || stats[1].LastSuccess.IsZero() {
+		t.Errorf("remote stats = %+v", stats)
+	}
+	if err := cm.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	history := cm.GetConnectionHistory()
+	if len(history) != 1 || history[0].Remote != "vpn2.example.com:443" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+// Latency selection puts reachable remotes ahead of dead ones
+func TestOrderRemotesByLatency(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	local := &VPNProfile{Protocol: "tcp-client", RemoteRandom: true, Remote: []VPNRemote{
+		{Host: "127.0.0.1", Port: closedPort},
+		{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port},
+	}}
+	ordered := orderRemotesByLatency(local)
+	if ordered[0] != local.Remote[1] || ordered[1] != local.Remote[0] {
+		t.Errorf("latency order = %+v", ordered)
+	}
+}
+
+func TestProfileConfig_RemoteSelection(t *testing.T) {
+	for _, tc := range []struct {
+		selection string
+		valid     bool
+	}{
+		{remoteSelectionOrdered, true},
+		{remoteSelectionLatency, true},
+		{"fastest", false},
+	} {
+		config := defaultProfileConfig("multi")
+		config.RemoteSelection = tc.selection
+		if err := config.Validate(); (err == nil) != tc.valid {
+			t.Errorf("remote_selection %q: err = %v, want valid %v", tc.selection, err, tc.valid)
+		}
+	}
+}
+
+func TestRemotes_LatencyProbeRunsOutsideLock(t *testing.T) {
+	vm := newTestVPNManager(t)
+	cm := vm.connectionManager
+	defer cm.Stop()
+
+	slow := VPNRemote{Host: "vpn1.example.com", Port: 1194}
+	fast := VPNRemote{Host: "vpn2.example.com", Port: 1194}
+	vm.profiles["multi"] = &VPNProfile{ID: "multi", Name: "multi", Validated: true, Protocol: "udp", Device: "tun",
+		Remote: []VPNRemote{slow, fast}}
+	config := defaultProfileConfig("multi")
+	config.RemoteSelection = remoteSelectionLatency
+	if err := cm.SetProfileConfig(config); err != nil {
+		t.Fatalf("SetProfileConfig: %v", err)
+	}
+
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	cm.orderRemotes = func(*VPNProfile) []VPNRemote {
+		close(probing)
+		<-release
+		return []VPNRemote{fast, slow}
+	}
+	var exported string
+	cm.startProcess = func(conn *VPNConnection) error {
+		data, err := os.ReadFile(conn.ConfigFile)
+		exported = string(data)
+		return err
+	}
+
+	connectErr := make(chan error, 1)
+	go func() { connectErr <- cm.Connect("multi") }()
+	<-probing
+
+	// Status reads must not wait for the probe
+	status := make(chan struct{})
+	go func() {
+		cm.GetConnectionStatus()
+		close(status)
+	}()
+	select {
+	case <-status:
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetConnectionStatus blocked while remotes were probed")
+	}
+
+	close(release)
+	if err := <-connectErr; err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if strings.Index(exported, "remote vpn2.example.com") > strings.Index(exported, "remote vpn1.example.com") {
+		t.Errorf("fastest remote not first:\n%s", exported)
+	}
+
+	// Changed remotes invalidate the measured order
+	cm.mutex.Lock()
+	changed := &VPNProfile{ID: "multi", Remote: []VPNRemote{slow, {Host: "vpn3.example.com", Port: 1194}}}
+	if _, ok := cm.measuredRemoteOrder(changed); ok {
+		t.Error("measured order used for a different remote set")
+	}
+	cm.mutex.Unlock()
+}
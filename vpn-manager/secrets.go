@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Secret key sources, checked in this order. Either holds base64 encoded
+// 32-byte keys, newest first: the first encrypts, the rest only decrypt, so
+// a new key can be put in front of the old one and the profiles resealed.
+const (
+	secretKeyEnv     = "NOC_RAVEN_VPN_SECRET_KEY"      // comma separated
+	secretKeyFileEnv = "NOC_RAVEN_VPN_SECRET_KEY_FILE" // one key per line
+)
+
+// sealedPrefix marks a value encrypted at rest: enc:v1:<key id>:<base64 nonce+ciphertext>
+const sealedPrefix = "enc:v1:"
+
+// secretKey is one AES-256-GCM key of the keyring
+type secretKey struct {
+	id   string // first 8 bytes of the key's SHA-256, in hex
+	aead cipher.AEAD
+}
+
+// secretKeyring seals profile secrets at rest. Keys are loaded on first use
+// from the environment, or from a key file generated under the state path.
+type secretKeyring struct {
+	mutex       sync.Mutex
+	defaultPath string
+	path        string // key file in use; empty when keys come from the environment
+	keys        []secretKey
+	loaded      bool
+}
+
+// SecretKeyStatus describes the keys sealing profile secrets
+type SecretKeyStatus struct {
+	Source   string    `json:"source"` // env or file
+	KeyFile  string    `json:"key_file,omitempty"`
+	Primary  string    `json:"primary"` // ID of the key new secrets are sealed with
+	KeyIDs   []string  `json:"key_ids"`
+	Resealed int       `json:"resealed,omitempty"` // profiles rewritten by a rotation
+	Rotated  time.Time `json:"rotated,omitempty"`
+}
+
+func newSecretKeyring(defaultPath string) *secretKeyring {
+	return &secretKeyring{defaultPath: defaultPath}
+}
+
+func newSecretKey(raw []byte) (secretKey, error) {
+	if len(raw) != 32 {
+		return secretKey{}, fmt.Errorf("secret key must be 32 bytes, got %d", len(raw))
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return secretKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return secretKey{}, err
+	}
+	sum := sha256.Sum256(raw)
+	return secretKey{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// parseSecretKeys decodes base64 keys, skipping blanks and # comments
+func parseSecretKeys(lines []string) ([]secretKey, error) {
+	keys := make([]secretKey, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("secret key %d is not base64: %v", len(keys)+1, err)
+		}
+		key, err := newSecretKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("secret key %d: %v", len(keys)+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no secret keys found")
+	}
+	return keys, nil
+}
+
+func readSecretKeyFile(path string) ([]secretKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Mode().Perm()&0077 != 0 {
+		log.Printf("Warning: secret key file %s is accessible by other users (mode %o)", path, info.Mode().Perm())
+	}
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return parseSecretKeys(lines)
+}
+
+// generateSecretKey returns a new random key, base64 encoded
+func generateSecretKey() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate secret key: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// load reads the keys on first use (requires lock)
+func (k *secretKeyring) load() error {
+	if k.loaded {
+		return nil
+	}
+
+	if value := os.Getenv(secretKeyEnv); value != "" {
+		keys, err := parseSecretKeys(strings.Split(value, ","))
+		if err != nil {
+			return fmt.Errorf("%s: %v", secretKeyEnv, err)
+		}
+		k.keys, k.path, k.loaded = keys, "", true
+		return nil
+	}
+
+	path := k.defaultPath
+	if value := os.Getenv(secretKeyFileEnv); value != "" {
+		path = value
+	}
+	keys, err := readSecretKeyFile(path)
+	if os.IsNotExist(err) && path == k.defaultPath {
+		// First start: create a key only this user can read
+		encoded, genErr := generateSecretKey()
+		if genErr != nil {
+			return genErr
+		}
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := writePrivateFile(path, []byte(encoded+"\n")); err != nil {
+			return fmt.Errorf("failed to create secret key file: %v", err)
+		}
+		log.Printf("Generated secret key file %s", path)
+		keys, err = readSecretKeyFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read secret key file %s: %v", path, err)
+	}
+	k.keys, k.path, k.loaded = keys, path, true
+	return nil
+}
+
+// seal encrypts a value with the primary key; empty values stay empty. The
+// field name is bound to the ciphertext so values cannot be swapped.
+func (k *secretKeyring) seal(field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.load(); err != nil {
+		return "", err
+	}
+
+	key := k.keys[0]
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	sealed := key.aead.Seal(nonce, nonce, []byte(value), []byte(field))
+	return sealedPrefix + key.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a sealed value. Plaintext passes through, as it was stored
+// before encryption; stale reports a value not sealed with the primary key.
+func (k *secretKeyring) open(field, value string) (plain string, stale bool, err error) {
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return value, value != "", nil
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.load(); err != nil {
+		return "", false, err
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, sealedPrefix), ":")
+	if !ok {
+		return "", false, fmt.Errorf("malformed sealed %s", field)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false, fmt.Errorf("malformed sealed %s: %v", field, err)
+	}
+	for i, key := range k.keys {
+		if key.id != id {
+			continue
+		}
+		size := key.aead.NonceSize()
+		if len(sealed) < size {
+			return "", false, fmt.Errorf("malformed sealed %s", field)
+		}
+		data, err := key.aead.Open(nil, sealed[:size], sealed[size:], []byte(field))
+		if err != nil {
+			return "", false, fmt.Errorf("failed to decrypt %s: %v", field, err)
+		}
+		return string(data), i != 0, nil
+	}
+	return "", false, fmt.Errorf("%s is sealed with unknown key %s", field, id)
+}
+
+// status describes the loaded keys
+func (k *secretKeyring) status() (*SecretKeyStatus, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+
+	status := &SecretKeyStatus{Source: "env", KeyFile: k.path, Primary: k.keys[0].id}
+	if k.path != "" {
+		status.Source = "file"
+	}
+	for _, key := range k.keys {
+		status.KeyIDs = append(status.KeyIDs, key.id)
+	}
+	return status, nil
+}
+
+// addKey generates a new primary key and writes it in front of the key file,
+// keeping the old keys to decrypt what they sealed
+func (k *secretKeyring) addKey() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.load(); err != nil {
+		return err
+	}
+	if k.path == "" {
+		return fmt.Errorf("keys come from %s; put the new key first there and restart to rotate", secretKeyEnv)
+	}
+
+	existing, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read secret key file: %v", err)
+	}
+	encoded, err := generateSecretKey()
+	if err != nil {
+		return err
+	}
+	content := []byte(encoded + "\n" + string(existing))
+	keys, err := parseSecretKeys(strings.Split(string(content), "\n"))
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(k.path, content); err != nil {
+		return fmt.Errorf("failed to save secret key file: %v", err)
+	}
+	k.keys = keys
+	return nil
+}
+
+// writePrivateFile writes a file only its owner can read, tightening the
+// mode of a file that already exists
+func writePrivateFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// profileSecret is a profile field holding key material
+type profileSecret struct {
+	field     string // JSON name
+	directive string // config directive or inline block
+	secret    bool   // redacted from API responses; certificates are only sealed
+	value     *string
+}
+
+// profileInlineFields returns the profile's inline key material, which is
+// sealed at rest
+func profileInlineFields(profile *VPNProfile) []profileSecret {
+	return []profileSecret{
+		{"ca", "ca", false, &profile.CA},
+		{"cert", "cert", false, &profile.Certificate},
+		{"extra_certs", "extra-certs", false, &profile.ExtraCerts},
+		{"key", "key", true, &profile.PrivateKey},
+		{"tls_auth", "tls-auth", true, &profile.TLSAuth},
+		{"tls_crypt", "tls-crypt", true, &profile.TLSCrypt},
+		{"tls_crypt_v2", "tls-crypt-v2", true, &profile.TLSCryptV2},
+		{"pkcs12", "pkcs12", true, &profile.PKCS12},
+	}
+}
+
+// sealProfile returns a copy of a profile with its key material encrypted,
+// for writing to disk
+func (vm *VPNManager) sealProfile(profile *VPNProfile) (*VPNProfile, error) {
+	sealed := *profile
+	for _, f := range profileInlineFields(&sealed) {
+		value, err := vm.secrets.seal(f.field, *f.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal %s: %v", f.field, err)
+		}
+		*f.value = value
+	}
+	return &sealed, nil
+}
+
+// openProfile decrypts a profile read from disk in place. It reports whether
+// the profile should be rewritten: it held plaintext or an old key's seal.
+func (vm *VPNManager) openProfile(profile *VPNProfile) (bool, error) {
+	reseal := false
+	for _, f := range profileInlineFields(profile) {
+		value, stale, err := vm.secrets.open(f.field, *f.value)
+		if err != nil {
+			return false, err
+		}
+		*f.value = value
+		reseal = reseal || stale
+	}
+	return reseal, nil
+}
+
+// publicProfile returns a copy of a profile safe to return from the API, its
+// secrets replaced by redactedSecret. Sending that back in an edit keeps the
+// stored value.
+func publicProfile(profile *VPNProfile) *VPNProfile {
+	public := *profile
+	for _, f := range profileInlineFields(&public) {
+		if f.secret && *f.value != "" {
+			*f.value = redactedSecret
+		}
+	}
+	return &public
+}
+
+// keepRedactedSecrets restores secrets an edit sent back redacted
+func keepRedactedSecrets(updated, current *VPNProfile) {
+	currentFields := profileInlineFields(current)
+	for i, f := range profileInlineFields(updated) {
+		if f.secret && *f.value == redactedSecret {
+			*f.value = *currentFields[i].value
+		}
+	}
+}
+
+// RotateSecretKey makes a new key primary and reseals every profile, revision,
+// stored credential and saved connection with it. With keys from the
+// environment no key is added; everything is resealed with the first key
+// listed there. Edits wait for it, so none is overwritten by a resealed copy.
+func (vm *VPNManager) RotateSecretKey() (*SecretKeyStatus, error) {
+	vm.updateMutex.Lock()
+	defer vm.updateMutex.Unlock()
+
+	before, err := vm.secrets.status()
+	if err != nil {
+		return nil, err
+	}
+	if before.Source == "file" {
+		if err := vm.secrets.addKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	resealed := 0
+	for _, profile := range vm.GetProfiles() {
+		if err := vm.SaveProfile(profile); err != nil {
+			return nil, err
+		}
+		if err := vm.resealProfileRevisions(profile.ID); err != nil {
+			return nil, err
+		}
+		if err := vm.migrateCredentials(profile); err != nil {
+			return nil, err
+		}
+		resealed++
+	}
+	vm.connectionManager.mutex.Lock()
+	vm.connectionManager.saveConnectionState()
+	vm.connectionManager.mutex.Unlock()
+
+	status, err := vm.secrets.status()
+	if err != nil {
+		return nil, err
+	}
+	status.Resealed = resealed
+	status.Rotated = time.Now()
+	log.Printf("Secret key rotated to %s; resealed %d profiles", status.Primary, resealed)
+	return status, nil
+}
+
+// privilegedRequest reports whether a request carries the API key configured
+// in NOC_RAVEN_API_KEY, as X-API-Key or an Authorization bearer token. With no
+// key configured no request is privileged.
+func privilegedRequest(r *http.Request) bool {
+	apiKey := strings.TrimSpace(os.Getenv("NOC_RAVEN_API_KEY"))
+	if apiKey == "" {
+		return false
+	}
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		auth := r.Header.Get("Authorization")
+		if strings.HasPrefix(strings.ToLower(auth), "bearer ") {
+			key = auth[len("Bearer "):]
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(key)), []byte(apiKey)) == 1
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSealedProfile imports a profile holding a private key and a tls-crypt key
+func newSealedProfile(t *testing.T) (vm *VPNManager, id, key string) {
+	t.Helper()
+	vm = newTestVPNManager(t)
+	_, _, key = testClientPKI(t, time.Now().Add(time.Hour))
+	content := "client\nremote 127.0.0.1 1194\n<key>\n" + key + "</key>\n<tls-crypt>\n-----BEGIN OpenVPN Static key V1-----\n00\n-----END OpenVPN Static key V1-----\n</tls-crypt>\n"
+	result, err := vm.ImportProfileContent([]byte(content), ProfileImportOptions{Name: "Sealed"})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	return vm, result.Profile.ID, key
+}
+
+// Nothing on disk holds the key in the clear, and only we can read it
+func TestProfileSecrets_SealedAtRest(t *testing.T) {
+	vm, id, _ := newSealedProfile(t)
+	profileFile := filepath.Join(vm.profilesPath, id+".json")
+	for _, path := range []string{profileFile, vm.profileRevisionsPath(id), filepath.Join(vm.statePath, "secret.key")} {
+		data, err := os.ReadFile(path)
+		info, _ := os.Stat(path)
+		if err != nil || strings.Contains(string(data), "PRIVATE KEY") || strings.Contains(string(data), "Static key") || info.Mode().Perm() != 0600 {
+			t.Errorf("%s: mode %v, err %v:\n%s", path, info.Mode(), err, data)
+		}
+	}
+	if data, _ := os.ReadFile(profileFile); strings.Count(string(data), `"enc:v1:`) != 2 {
+		t.Errorf("profile file = %s", data)
+	}
+}
+
+func TestProfileSecrets_RedactedInAPI(t *testing.T) {
+	vm, id, key := newSealedProfile(t)
+	router := vm.setupRoutes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/vpn/profiles/"+id, nil))
+	var public VPNProfile
+	json.Unmarshal(rec.Body.Bytes(), &public)
+	if public.PrivateKey != redactedSecret || public.TLSCrypt != redactedSecret || vm.profiles[id].PrivateKey != key {
+		t.Errorf("public profile key = %q, tls-crypt %q", public.PrivateKey, public.TLSCrypt)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/vpn/profiles", nil))
+	if strings.Contains(rec.Body.String(), "PRIVATE KEY") || !strings.Contains(rec.Body.String(), redactedSecret) {
+		t.Errorf("profiles = %s", rec.Body.String())
+	}
+}
+
+// Sending a secret back redacted keeps the stored one
+func TestProfileSecrets_RedactedPatchKeepsSecret(t *testing.T) {
+	vm, id, key := newSealedProfile(t)
+	rec := httptest.NewRecorder()
+	vm.setupRoutes().ServeHTTP(rec, httptest.NewRequest("PATCH", "/api/vpn/profiles/"+id, strings.NewReader(`{"name": "Renamed", "key": "********"}`)))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "PRIVATE KEY") || vm.profiles[id].PrivateKey != key || vm.profiles[id].Name != "Renamed" {
+		t.Errorf("patch = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestProfileSecrets_ConnectionStateSealed(t *testing.T) {
+	vm, id, _ := newSealedProfile(t)
+	cm := vm.connectionManager
+	cm.mutex.Lock()
+	cm.activeConn = &VPNConnection{Profile: vm.profiles[id], State: "connected"}
+	cm.saveConnectionState()
+	cm.activeConn = nil
+	cm.mutex.Unlock()
+	if data, _ := os.ReadFile(cm.statusFile); strings.Contains(string(data), "PRIVATE KEY") || !strings.Contains(string(data), "enc:v1:") {
+		t.Errorf("connection state = %s", data)
+	}
+}
+
+// Rotation adds a key in front and reseals everything with it
+func TestHandleRotateSecretKey(t *testing.T) {
+	t.Setenv("NOC_RAVEN_API_KEY", "admin-key")
+	vm, id, _ := newSealedProfile(t)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/vpn/secrets/rotate", nil)
+	req.Header.Set("X-API-Key", "admin-key")
+	vm.setupRoutes().ServeHTTP(rec, req)
+	var status SecretKeyStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	if rec.Code != http.StatusOK || status.Source != "file" || len(status.KeyIDs) != 2 || status.Primary != status.KeyIDs[0] || status.Resealed != 1 {
+		t.Fatalf("rotate = %d %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{filepath.Join(vm.profilesPath, id+".json"), vm.profileRevisionsPath(id)} {
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), "enc:v1:"+status.KeyIDs[1]) || !strings.Contains(string(data), "enc:v1:"+status.Primary) {
+			t.Errorf("%s not resealed: %s", path, data)
+		}
+	}
+}
+
+// Key management needs the API key, which must be configured
+func TestSecretKeyRoutes_NeedAPIKey(t *testing.T) {
+	cases := []struct {
+		name       string
+		configured string
+		apiKey     string
+		want       int
+	}{
+		{"unconfigured", "", "", http.StatusForbidden},
+		{"unconfigured with a key", "", "admin-key", http.StatusForbidden},
+		{"missing key", "admin-key", "", http.StatusForbidden},
+		{"wrong key", "admin-key", "wrong", http.StatusForbidden},
+		{"api key", "admin-key", "admin-key", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("NOC_RAVEN_API_KEY", tc.configured)
+			vm, _, _ := newSealedProfile(t)
+			before, _ := vm.secrets.status()
+
+			for _, route := range []struct{ method, path string }{
+				{"GET", "/api/vpn/secrets"},
+				{"POST", "/api/vpn/secrets/rotate"},
+			} {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(route.method, route.path, nil)
+				if tc.apiKey != "" {
+					req.Header.Set("X-API-Key", tc.apiKey)
+				}
+				vm.setupRoutes().ServeHTTP(rec, req)
+				if rec.Code != tc.want {
+					t.Errorf("%s %s = %d, want %d: %s", route.method, route.path, rec.Code, tc.want, rec.Body.String())
+				}
+			}
+			if after, _ := vm.secrets.status(); (after.Primary != before.Primary) != (tc.want == http.StatusOK) {
+				t.Errorf("primary key %s -> %s after rotate answered %d", before.Primary, after.Primary, tc.want)
+			}
+		})
+	}
+}
+
+// Plaintext written before encryption is sealed when loaded
+func TestLoadProfiles_SealsPlaintextSecrets(t *testing.T) {
+	vm, id, key := newSealedProfile(t)
+	legacyFile := filepath.Join(vm.profilesPath, "legacy.json")
+	legacy := &VPNProfile{ID: "legacy", Name: "Legacy", Protocol: "udp", Device: "tun", PrivateKey: key, Remote: []VPNRemote{{Host: "127.0.0.1", Port: 1194}}}
+	data, _ := json.Marshal(legacy)
+	os.WriteFile(legacyFile, data, 0644)
+
+	reloaded := NewVPNManager(vm.profilesPath, vm.statePath)
+	if err := reloaded.LoadProfiles(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if reloaded.profiles[id].PrivateKey != key || reloaded.profiles["legacy"].PrivateKey != key {
+		t.Errorf("reloaded keys = %q / %q", reloaded.profiles[id].PrivateKey, reloaded.profiles["legacy"].PrivateKey)
+	}
+	data, _ = os.ReadFile(legacyFile)
+	if info, _ := os.Stat(legacyFile); strings.Contains(string(data), "PRIVATE KEY") || info.Mode().Perm() != 0600 {
+		t.Errorf("legacy profile left as %v: %s", info.Mode(), data)
+	}
+	if rev, err := reloaded.GetProfileRevision(id, 1); err != nil || rev.Profile.PrivateKey != key {
+		t.Errorf("revision 1 = %v", err)
+	}
+}
+
+// A new key listed first in the environment takes over from the file key
+func TestSecretKeyEnv_NewKeyTakesOver(t *testing.T) {
+	vm, id, key := newSealedProfile(t)
+	keyFile, _ := os.ReadFile(filepath.Join(vm.statePath, "secret.key"))
+	newKey, _ := generateSecretKey()
+	t.Setenv(secretKeyEnv, newKey+","+strings.Fields(string(keyFile))[0])
+
+	fromEnv := NewVPNManager(vm.profilesPath, vm.statePath)
+	if err := fromEnv.LoadProfiles(); err != nil || fromEnv.profiles[id].PrivateKey != key {
+		t.Fatalf("env reload = %v", err)
+	}
+	envStatus, _ := fromEnv.secrets.status()
+	if data, _ := os.ReadFile(filepath.Join(vm.profilesPath, id+".json")); envStatus.Source != "env" || !strings.Contains(string(data), "enc:v1:"+envStatus.Primary) {
+		t.Errorf("env status %+v, profile %s", envStatus, data)
+	}
+	if _, err := fromEnv.RotateSecretKey(); err != nil {
+		t.Errorf("env rotate: %v", err)
+	}
+}
+
+func TestSecretKeyEnv_RejectedKeys(t *testing.T) {
+	unlisted, _ := generateSecretKey()
+	cases := []struct {
+		name    string
+		env     string
+		wantErr bool
+	}{
+		// Profiles sealed with a key that is not listed are not loaded
+		{"unlisted key", unlisted, false},
+		{"invalid key", "not-a-key", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm, _, _ := newSealedProfile(t)
+			t.Setenv(secretKeyEnv, tc.env)
+			reloaded := NewVPNManager(vm.profilesPath, vm.statePath)
+			err := reloaded.LoadProfiles()
+			if (err != nil) != tc.wantErr || len(reloaded.profiles) != 0 {
+				t.Errorf("LoadProfiles = %v, %d profiles", err, len(reloaded.profiles))
+			}
+		})
+	}
+}
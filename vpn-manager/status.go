@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenVPNStatus is a parsed --status file. Clients write the STATISTICS
+// counters; servers write the client list and routing table.
+type OpenVPNStatus struct {
+	Version     int                   `json:"version"` // 1, 2 or 3 (--status-version)
+	Title       string                `json:"title,omitempty"`
+	Updated     time.Time             `json:"updated"`
+	Counters    OpenVPNStatusCounters `json:"counters"`
+	Clients     []OpenVPNStatusClient `json:"clients,omitempty"`
+	Routes      []OpenVPNStatusRoute  `json:"routes,omitempty"`
+	GlobalStats map[string]string     `json:"global_stats,omitempty"`
+}
+
+// OpenVPNStatusCounters are the client byte counters
+type OpenVPNStatusCounters struct {
+	TunTapReadBytes     int64 `json:"tun_tap_read_bytes"`
+	TunTapWriteBytes    int64 `json:"tun_tap_write_bytes"`
+	TCPUDPReadBytes     int64 `json:"tcp_udp_read_bytes"`
+	TCPUDPWriteBytes    int64 `json:"tcp_udp_write_bytes"`
+	AuthReadBytes       int64 `json:"auth_read_bytes"`
+	PreCompressBytes    int64 `json:"pre_compress_bytes"`
+	PostCompressBytes   int64 `json:"post_compress_bytes"`
+	PreDecompressBytes  int64 `json:"pre_decompress_bytes"`
+	PostDecompressBytes int64 `json:"post_decompress_bytes"`
+}
+
+// OpenVPNStatusClient is a CLIENT_LIST entry of a server status file
+type OpenVPNStatusClient struct {
+	CommonName         string    `json:"common_name"`
+	RealAddress        string    `json:"real_address"`
+	VirtualAddress     string    `json:"virtual_address,omitempty"`
+	VirtualIPv6Address string    `json:"virtual_ipv6_address,omitempty"`
+	BytesReceived      int64     `json:"bytes_received"`
+	BytesSent          int64     `json:"bytes_sent"`
+	ConnectedSince     time.Time `json:"connected_since"`
+	Username           string    `json:"username,omitempty"`
+	ClientID           string    `json:"client_id,omitempty"`
+	PeerID             string    `json:"peer_id,omitempty"`
+	Cipher             string    `json:"cipher,omitempty"`
+}
+
+// OpenVPNStatusRoute is a ROUTING_TABLE entry of a server status file
+type OpenVPNStatusRoute struct {
+	VirtualAddress string    `json:"virtual_address"`
+	CommonName     string    `json:"common_name"`
+	RealAddress    string    `json:"real_address"`
+	LastRef        time.Time `json:"last_ref"`
+}
+
+// statusTimeLayouts are the formats OpenVPN has used for status timestamps
+var statusTimeLayouts = []string{
+	"2006-01-02 15:04:05",      // 2.5 and later
+	"Mon Jan _2 15:04:05 2006", // 2.4 and earlier
+}
+
+func parseStatusTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range statusTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+// parseStatusUnix parses a time_t column, preferred over the formatted time
+func parseStatusUnix(s string) (time.Time, bool) {
+	secs, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || secs <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(secs, 0), true
+}
+
+// parseOpenVPNStatusFile parses status-version 1, 2 or 3 content
+func parseOpenVPNStatusFile(content string) (*OpenVPNStatus, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("empty status file")
+	}
+
+	first := lines[0]
+	switch {
+	case strings.HasPrefix(first, "TITLE\t"):
+		return parseStatusV2(lines, "\t", 3)
+	case strings.HasPrefix(first, "TITLE,"):
+		return parseStatusV2(lines, ",", 2)
+	case first == "OpenVPN STATISTICS" || first == "OpenVPN CLIENT LIST":
+		return parseStatusV1(lines)
+	}
+	return nil, fmt.Errorf("unrecognised status file header %q", first)
+}
+
+// parseStatusV1 parses the sectioned format: a title line, then either
+// statistics counters or the client list, routing table and global stats
+func parseStatusV1(lines []string) (*OpenVPNStatus, error) {
+	status := &OpenVPNStatus{Version: 1, Title: lines[0]}
+	section := "STATISTICS"
+	if lines[0] == "OpenVPN CLIENT LIST" {
+		section = "CLIENT LIST"
+	}
+
+	var header []string
+	for i, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		switch line {
+		case "", "END":
+			continue
+		case "ROUTING TABLE", "GLOBAL STATS":
+			section, header = line, nil
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if fields[0] == "Updated" && len(fields) > 1 {
+			updated, err := parseStatusTime(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+2, err)
+			}
+			status.Updated = updated
+			continue
+		}
+
+		switch section {
+		case "STATISTICS":
+			if len(fields) == 2 {
+				if err := status.Counters.set(fields[0], fields[1]); err != nil {
+					return nil, fmt.Errorf("line %d: %v", i+2, err)
+				}
+			}
+		case "GLOBAL STATS":
+			if len(fields) == 2 {
+				status.setGlobalStat(fields[0], fields[1])
+			}
+		case "CLIENT LIST", "ROUTING TABLE":
+			// The first row of each table names its columns
+			if header == nil {
+				header = fields
+				continue
+			}
+			if err := status.addRow(section, header, fields); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+2, err)
+			}
+		}
+	}
+	return status, nil
+}
+
+// parseStatusV2 parses the keyed format, comma separated for version 2 and
+// tab separated for version 3. HEADER rows name the columns of later rows.
+func parseStatusV2(lines []string, sep string, version int) (*OpenVPNStatus, error) {
+	status := &OpenVPNStatus{Version: version}
+	headers := make(map[string][]string)
+
+	for i, line := range lines {
+		line = strings.TrimRight(line, " ")
+		if line == "" || line == "END" {
+			continue
+		}
+		fields := strings.Split(line, sep)
+		key, values := fields[0], fields[1:]
+
+		switch key {
+		case "TITLE":
+			status.Title = strings.Join(values, sep)
+		case "TIME":
+			if len(values) > 1 {
+				if t, ok := parseStatusUnix(values[1]); ok {
+					status.Updated = t
+					continue
+				}
+			}
+			if len(values) > 0 {
+				updated, err := parseStatusTime(values[0])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", i+1, err)
+				}
+				status.Updated = updated
+			}
+		case "HEADER":
+			if len(values) > 0 {
+				headers[values[0]] = values[1:]
+			}
+		case "CLIENT_LIST", "ROUTING_TABLE":
+			section := "CLIENT LIST"
+			if key == "ROUTING_TABLE" {
+				section = "ROUTING TABLE"
+			}
+			if err := status.addRow(section, headers[key], values); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		case "GLOBAL_STATS":
+			if len(values) == 2 {
+				status.setGlobalStat(values[0], values[1])
+			}
+		default:
+			// Client statistics keep their "name,value" form in every version
+			if len(values) == 1 {
+				if err := status.Counters.set(key, values[0]); err != nil {
+					return nil, fmt.Errorf("line %d: %v", i+1, err)
+				}
+			}
+		}
+	}
+	return status, nil
+}
+
+// set assigns a named counter; unknown names are ignored for forward compatibility
+func (c *OpenVPNStatusCounters) set(name, value string) error {
+	var target *int64
+	switch name {
+	case "TUN/TAP read bytes":
+		target = &c.TunTapReadBytes
+	case "TUN/TAP write bytes":
+		target = &c.TunTapWriteBytes
+	case "TCP/UDP read bytes":
+		target = &c.TCPUDPReadBytes
+	case "TCP/UDP write bytes":
+		target = &c.TCPUDPWriteBytes
+	case "Auth read bytes":
+		target = &c.AuthReadBytes
+	case "pre-compress bytes":
+		target = &c.PreCompressBytes
+	case "post-compress bytes":
+		target = &c.PostCompressBytes
+	case "pre-decompress bytes":
+		target = &c.PreDecompressBytes
+	case "post-decompress bytes":
+		target = &c.PostDecompressBytes
+	default:
+		return nil
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", name, value)
+	}
+	*target = n
+	return nil
+}
+
+func (s *OpenVPNStatus) setGlobalStat(name, value string) {
+	if s.GlobalStats == nil {
+		s.GlobalStats = make(map[string]string)
+	}
+	s.GlobalStats[name] = strings.TrimSpace(value)
+}
+
+// addRow maps a client list or routing table row onto its struct by column name
+func (s *OpenVPNStatus) addRow(section string, header, values []string) error {
+	if header == nil {
+		return fmt.Errorf("%s row before its header", strings.ToLower(section))
+	}
+	column := func(name string) string {
+		for i, h := range header {
+			if h == name && i < len(values) {
+				return strings.TrimSpace(values[i])
+			}
+		}
+		return ""
+	}
+	timeColumn := func(name string) (time.Time, error) {
+		if t, ok := parseStatusUnix(column(name + " (time_t)")); ok {
+			return t, nil
+		}
+		if v := column(name); v != "" {
+			return parseStatusTime(v)
+		}
+		return time.Time{}, nil
+	}
+	intColumn := func(name string) (int64, error) {
+		v := column(name)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", name, v)
+		}
+		return n, nil
+	}
+
+	if section == "ROUTING TABLE" {
+		lastRef, err := timeColumn("Last Ref")
+		if err != nil {
+			return err
+		}
+		s.Routes = append(s.Routes, OpenVPNStatusRoute{
+			VirtualAddress: column("Virtual Address"),
+			CommonName:     column("Common Name"),
+			RealAddress:    column("Real Address"),
+			LastRef:        lastRef,
+		})
+		return nil
+	}
+
+	received, err := intColumn("Bytes Received")
+	if err != nil {
+		return err
+	}
+	sent, err := intColumn("Bytes Sent")
+	if err != nil {
+		return err
+	}
+	since, err := timeColumn("Connected Since")
+	if err != nil {
+		return err
+	}
+	client := OpenVPNStatusClient{
+		CommonName:         column("Common Name"),
+		RealAddress:        column("Real Address"),
+		VirtualAddress:     column("Virtual Address"),
+		VirtualIPv6Address: column("Virtual IPv6 Address"),
+		BytesReceived:      received,
+		BytesSent:          sent,
+		ConnectedSince:     since,
+		Username:           column("Username"),
+		ClientID:           column("Client ID"),
+		PeerID:             column("Peer ID"),
+		Cipher:             column("Data Channel Cipher"),
+	}
+	if client.Username == "UNDEF" {
+		client.Username = ""
+	}
+	s.Clients = append(s.Clients, client)
+	return nil
+}